@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"sshai/pkg/config"
+	"sshai/pkg/kb"
+)
+
+// runKBCommand 处理 sshai kb 子命令，管理知识库索引
+// 用法: sshai kb reindex|status|search [-c config.yaml] [关键词]
+func runKBCommand(args []string) int {
+	usage := "用法: sshai kb reindex|status|search [-c config.yaml] [关键词]"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("kb "+args[0], flag.ContinueOnError)
+	configFile := flags.String("c", "config.yaml", "指定配置文件路径")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置文件失败: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "reindex":
+		index, err := kb.Build(context.Background())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("知识库索引已更新: %d 个文件，%d 段，%s\n", index.Files, len(index.Chunks), index.Mode())
+	case "status":
+		fmt.Println(kb.Status())
+	case "search":
+		query := strings.Join(flags.Args(), " ")
+		if query == "" {
+			fmt.Fprintln(os.Stderr, usage)
+			return 2
+		}
+		results, err := kb.Search(context.Background(), query, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for i, result := range results {
+			fmt.Printf("[%d] %s (%.3f)\n%s\n\n", i+1, result.Citation(), result.Score, result.Text)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
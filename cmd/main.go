@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"sshai/pkg/audit"
 	"sshai/pkg/config"
 	"sshai/pkg/i18n"
+	"sshai/pkg/jsrun"
+	"sshai/pkg/kb"
 	"sshai/pkg/mcp"
+	"sshai/pkg/metrics"
 	"sshai/pkg/ssh"
 	"sshai/pkg/ui"
 )
@@ -21,6 +27,19 @@ func showStartupBanner() {
 }
 
 func main() {
+	// 作为 run_js 的执行进程启动时执行脚本后退出
+	jsrun.Main()
+
+	// 子命令: sshai prompt render ...、sshai kb reindex ...
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "prompt":
+			os.Exit(runPromptCommand(os.Args[2:]))
+		case "kb":
+			os.Exit(runKBCommand(os.Args[2:]))
+		}
+	}
+
 	// 定义命令行参数
 	var configFile string
 	flag.StringVar(&configFile, "c", "", "指定配置文件路径")
@@ -63,6 +82,26 @@ func main() {
 		log.Printf("初始化MCP管理器失败: %v", err)
 	}
 
+	// 知识库没有索引时在后台建立
+	go kb.EnsureIndex()
+
+	// 初始化审计日志
+	if err := audit.Init(); err != nil {
+		log.Fatal(err)
+	}
+	defer audit.Close()
+
+	// 启动Prometheus指标服务
+	if cfg.Metrics.Enabled {
+		listen := cfg.Metrics.Listen
+		if listen == "" {
+			listen = "127.0.0.1:9090"
+		}
+		if _, err := metrics.StartServer(listen, cfg.Metrics.Path); err != nil {
+			log.Printf("启动指标服务失败: %v", err)
+		}
+	}
+
 	// 设置信号处理
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -85,7 +124,25 @@ func main() {
 	<-sigChan
 	log.Println("收到退出信号，正在关闭服务...")
 
-	// 停止MCP管理器
+	// 再次收到信号时立即退出
+	go func() {
+		<-sigChan
+		log.Println("再次收到退出信号，立即退出")
+		os.Exit(1)
+	}()
+
+	// 等待正在生成的回答完成，超时后取消剩余请求
+	timeout := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("等待会话结束超时: %v", err)
+	}
+
+	// 会话全部结束后再停止MCP管理器（子进程）
 	mcp.StopGlobalManager()
 	
 	log.Println("服务已关闭")
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"sshai/pkg/config"
+	"sshai/pkg/prompt"
+)
+
+// runPromptCommand 处理 sshai prompt 子命令，用于调试提示词模板
+// 用法: sshai prompt render [选项] [system|stdin|exec|提示词目录中的文件]
+func runPromptCommand(args []string) int {
+	if len(args) == 0 || args[0] != "render" {
+		fmt.Fprintln(os.Stderr, "用法: sshai prompt render [选项] [system|stdin|exec|文件名]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("prompt render", flag.ContinueOnError)
+	configFile := flags.String("c", "config.yaml", "指定配置文件路径")
+	user := flags.String("user", "user", "会话身份 {{.User}}")
+	loginName := flags.String("login", "", "登录用户名 {{.LoginName}}，默认与 -user 相同")
+	model := flags.String("model", "", "模型 {{.Model}}，默认使用配置的默认模型")
+	personaName := flags.String("persona", "", "角色名称，默认使用与登录用户名同名的角色")
+	lang := flags.String("lang", "", "界面语言 {{.Lang}}，默认使用配置的语言")
+	remoteAddr := flags.String("remote", "127.0.0.1:22", "客户端地址 {{.RemoteAddr}}")
+	clientVersion := flags.String("client", "SSH-2.0-OpenSSH", "客户端版本 {{.ClientVersion}}")
+	tools := flags.String("tools", "", "可用工具名称 {{.Tools}}，多个用逗号分隔")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	target := "system"
+	if flags.NArg() > 0 {
+		target = flags.Arg(0)
+	}
+
+	if err := config.Load(*configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置文件失败: %v\n", err)
+		return 1
+	}
+	cfg := config.Get()
+
+	if *loginName == "" {
+		*loginName = *user
+	}
+	persona := config.FindPersona(*loginName)
+	if *personaName != "" {
+		if persona = config.FindPersona(*personaName); persona == nil {
+			fmt.Fprintf(os.Stderr, "角色不存在: %s\n", *personaName)
+			return 1
+		}
+	}
+
+	data := prompt.Data{
+		User:          *user,
+		LoginName:     *loginName,
+		Model:         *model,
+		Lang:          *lang,
+		RemoteAddr:    *remoteAddr,
+		ClientVersion: *clientVersion,
+	}
+	if data.Model == "" {
+		data.Model = cfg.API.DefaultModel
+		if persona != nil && persona.Model != "" {
+			data.Model = persona.Model
+		}
+	}
+	if data.Lang == "" {
+		data.Lang = cfg.I18n.Language
+	}
+	if persona != nil {
+		data.Persona = persona.Name
+	}
+	if *tools != "" {
+		data.Tools = strings.Split(*tools, ",")
+	}
+
+	var text string
+	switch target {
+	case "system":
+		text = cfg.Prompt.SystemPrompt
+		if persona != nil && persona.SystemPrompt != "" {
+			text = persona.SystemPrompt
+		}
+	case "stdin":
+		text = cfg.Prompt.StdinPrompt
+		if text == "" {
+			text = prompt.DefaultStdinPrompt
+		}
+	case "exec":
+		text = cfg.Prompt.ExecPrompt
+		if text == "" {
+			text = prompt.DefaultExecPrompt
+		}
+	default:
+		rendered, err := prompt.RenderFile(target, data)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(rendered)
+		return 0
+	}
+
+	rendered, err := prompt.Render(target+"_prompt", text, data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(rendered)
+	return 0
+}
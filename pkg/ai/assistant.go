@@ -2,20 +2,103 @@ package ai
 
 import (
 	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/audit"
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+	"sshai/pkg/prompt"
+	"sshai/pkg/ui"
 )
 
 // Assistant AI助手结构体 - 重构为使用 go-openai 库
 type Assistant struct {
-	client   *OpenAIClient
-	username string
+	client     *OpenAIClient
+	username   string
+	renderMode string       // 交互模式回答的渲染方式
+	terminal   *ui.Terminal // 会话终端状态（尺寸、颜色深度），非PTY会话为nil
+	language   i18n.Language // 提示文字的语言，空表示使用当前语言
 }
 
 // NewAssistant 创建新的AI助手
 func NewAssistant(username string) *Assistant {
+	renderMode := config.Get().Display.RenderMode
+	if renderMode != ui.RenderPlain {
+		renderMode = ui.RenderMarkdown
+	}
 	return &Assistant{
-		client:   NewOpenAIClient(username),
-		username: username,
+		client:     NewOpenAIClient(username),
+		username:   username,
+		renderMode: renderMode,
+	}
+}
+
+// SetRenderMode 设置交互模式回答的渲染方式（markdown 或 plain）
+func (ai *Assistant) SetRenderMode(mode string) {
+	ai.renderMode = mode
+}
+
+// GetRenderMode 获取交互模式回答的渲染方式
+func (ai *Assistant) GetRenderMode() string {
+	return ai.renderMode
+}
+
+// SetLanguage 设置提示文字的语言
+func (ai *Assistant) SetLanguage(language i18n.Language) {
+	ai.language = language
+}
+
+// SetToolPolicy 设置路由规则的工具策略，nil表示不限制
+func (ai *Assistant) SetToolPolicy(policy *config.ToolPolicy) {
+	ai.client.SetToolPolicy(policy)
+}
+
+// SetSessionTools 设置只属于当前会话的内置工具
+func (ai *Assistant) SetSessionTools(tools []NativeTool) {
+	ai.client.SetSessionTools(tools)
+}
+
+// SetPromptData 设置提示词模板中的会话变量
+func (ai *Assistant) SetPromptData(data prompt.Data) {
+	ai.client.SetPromptData(data)
+}
+
+// RenderPrompt 使用会话变量渲染提示词模板（如 stdin、exec 提示词）
+func (ai *Assistant) RenderPrompt(name, text string) string {
+	return ai.client.RenderPrompt(name, text)
+}
+
+// RenderCommandPrompt 渲染自定义命令的提示词模板，input 为模板中的 {{.Input}}
+func (ai *Assistant) RenderCommandPrompt(name, text, input string) string {
+	return ai.client.RenderCommandPrompt(name, text, input)
+}
+
+// SetTemperature 设置自定义命令指定的温度，0表示恢复使用角色或配置的温度
+func (ai *Assistant) SetTemperature(temperature float64) {
+	ai.client.SetTemperature(temperature)
+}
+
+// SetTerminal 设置会话终端状态，用于按终端宽度渲染回答
+func (ai *Assistant) SetTerminal(terminal *ui.Terminal) {
+	ai.terminal = terminal
+}
+
+// Terminal 获取会话终端状态
+func (ai *Assistant) Terminal() *ui.Terminal {
+	return ai.terminal
+}
+
+// WrapWidth 获取回答的换行宽度：配置宽度和客户端终端宽度中较小者
+func (ai *Assistant) WrapWidth() int {
+	width := config.Get().Display.LineWidth
+	if ai.terminal != nil {
+		width = ai.terminal.WrapWidth(width)
 	}
+	return width
+}
+
+// SetAuditIdentity 设置审计日志中的会话身份，设置后每次请求都会写入审计日志
+func (ai *Assistant) SetAuditIdentity(identity audit.Identity) {
+	ai.client.SetAuditIdentity(identity)
 }
 
 // SetModel 设置当前使用的模型
@@ -23,24 +106,45 @@ func (ai *Assistant) SetModel(model string) {
 	ai.client.SetModel(model)
 }
 
+// SetPersona 切换角色（系统提示词、温度和可用工具）并清空对话上下文，nil表示恢复默认设置
+func (ai *Assistant) SetPersona(persona *config.Persona) {
+	ai.client.SetPersona(persona)
+}
+
+// GetPersona 获取当前角色，nil表示未选择角色
+func (ai *Assistant) GetPersona() *config.Persona {
+	return ai.client.GetPersona()
+}
+
 // ClearContext 清空对话上下文
 func (ai *Assistant) ClearContext() {
 	ai.client.ClearContext()
 }
 
-// ProcessMessage 处理用户消息
-func (ai *Assistant) ProcessMessage(input string, channel ssh.Channel, interrupt chan bool) {
-	ai.client.ProcessMessage(input, channel, interrupt)
+// ProcessMessage 处理用户消息（交互模式，按渲染方式输出到终端）
+func (ai *Assistant) ProcessMessage(input string, channel ssh.Channel, interrupt chan bool) error {
+	renderer := NewTerminalRenderer(channel)
+	if ai.renderMode == ui.RenderMarkdown {
+		renderer = NewMarkdownTerminalRenderer(channel, ai.WrapWidth())
+	}
+	renderer.SetLanguage(ai.language)
+	_, err := ai.client.ProcessMessageWithRenderer(input, channel, renderer, interrupt, true)
+	return err
 }
 
 // ProcessMessageWithOptions 处理用户消息（可选动画）
-func (ai *Assistant) ProcessMessageWithOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool) {
-	ai.client.ProcessMessageWithOptions(input, channel, interrupt, showAnimation)
+func (ai *Assistant) ProcessMessageWithOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool) error {
+	return ai.client.ProcessMessageWithOptions(input, channel, interrupt, showAnimation)
 }
 
 // ProcessMessageWithFullOptions 处理用户消息（完整选项）
-func (ai *Assistant) ProcessMessageWithFullOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool, showToolOutput bool) {
-	ai.client.ProcessMessageWithFullOptions(input, channel, interrupt, showAnimation, showToolOutput)
+func (ai *Assistant) ProcessMessageWithFullOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool, showToolOutput bool) error {
+	return ai.client.ProcessMessageWithFullOptions(input, channel, interrupt, showAnimation, showToolOutput)
+}
+
+// ProcessMessageWithRenderer 使用指定渲染器处理用户消息，返回完整的请求结果
+func (ai *Assistant) ProcessMessageWithRenderer(input string, channel ssh.Channel, renderer Renderer, interrupt chan bool, showToolOutput bool) (*Result, error) {
+	return ai.client.ProcessMessageWithRenderer(input, channel, renderer, interrupt, showToolOutput)
 }
 
 // GetCurrentModel 获取当前使用的模型
@@ -0,0 +1,368 @@
+package ai
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sshai/pkg/config"
+)
+
+// maxRegexMatches regex_test 最多列出的匹配数
+const maxRegexMatches = 50
+
+// builtinTool 内置工具的通用实现，由 tools.builtin 开关控制
+type builtinTool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	call        func(arguments map[string]interface{}) (string, error)
+}
+
+func (t *builtinTool) Name() string                       { return t.name }
+func (t *builtinTool) Description() string                { return t.description }
+func (t *builtinTool) Parameters() map[string]interface{} { return t.parameters }
+func (t *builtinTool) Enabled() bool                      { return config.Get().Tools.Builtin }
+
+func (t *builtinTool) Call(ctx context.Context, arguments map[string]interface{}) (string, error) {
+	return t.call(arguments)
+}
+
+func init() {
+	RegisterNativeTool(&builtinTool{
+		name:        "get_time",
+		description: "获取当前时间，或在时区之间转换时间。时区使用IANA名称（如 Asia/Shanghai、America/New_York、UTC）",
+		parameters: objectSchema(map[string]interface{}{
+			"timezone":      stringSchema("结果使用的时区，默认为服务器时区"),
+			"time":          stringSchema("要转换的时间（RFC 3339、2006-01-02 15:04:05、2006-01-02 或Unix时间戳），为空表示当前时间"),
+			"from_timezone": stringSchema("time 不含时区偏移时所在的时区，默认为服务器时区"),
+		}),
+		call: getTime,
+	})
+	RegisterNativeTool(&builtinTool{
+		name:        "calculate",
+		description: "计算数学表达式，支持 + - * / % ^、括号、常量 pi e 和函数 sqrt cbrt abs round floor ceil exp ln log log2 log10 sin cos tan asin acos atan min max pow",
+		parameters: objectSchema(map[string]interface{}{
+			"expression": stringSchema("表达式，如 (1+2)*3^2 或 sqrt(2)/2"),
+		}, "expression"),
+		call: func(arguments map[string]interface{}) (string, error) {
+			value, err := evaluate(stringArg(arguments, "expression"))
+			if err != nil {
+				return "", err
+			}
+			return formatNumber(value), nil
+		},
+	})
+	RegisterNativeTool(&builtinTool{
+		name:        "convert_unit",
+		description: "单位换算，支持长度(mm cm m km in ft yd mi nmi)、质量(mg g kg t lb oz 斤)、时间(ms s min h d week)、数据大小(bit B KB MB GB TB KiB MiB GiB TiB)、速度(m/s km/h mph kn)和温度(C F K)",
+		parameters: objectSchema(map[string]interface{}{
+			"value": map[string]interface{}{"type": "number", "description": "数值"},
+			"from":  stringSchema("原单位"),
+			"to":    stringSchema("目标单位"),
+		}, "value", "from", "to"),
+		call: func(arguments map[string]interface{}) (string, error) {
+			value, err := numberArg(arguments, "value")
+			if err != nil {
+				return "", err
+			}
+			from, to := stringArg(arguments, "from"), stringArg(arguments, "to")
+			result, err := convertUnit(value, from, to)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s %s = %s %s", formatNumber(value), from, formatNumber(result), to), nil
+		},
+	})
+	RegisterNativeTool(&builtinTool{
+		name:        "encode",
+		description: "生成UUID、计算哈希或进行编码转换",
+		parameters: objectSchema(map[string]interface{}{
+			"operation": map[string]interface{}{
+				"type":        "string",
+				"description": "操作",
+				"enum":        []string{"uuid", "md5", "sha1", "sha256", "sha512", "base64_encode", "base64_decode", "base64url_encode", "base64url_decode", "hex_encode", "hex_decode"},
+			},
+			"text": stringSchema("输入文本（uuid 不需要）"),
+		}, "operation"),
+		call: func(arguments map[string]interface{}) (string, error) {
+			return encode(stringArg(arguments, "operation"), stringArg(arguments, "text"))
+		},
+	})
+	RegisterNativeTool(&builtinTool{
+		name:        "json_query",
+		description: "使用jq风格的表达式查询JSON文本，支持 .key、.[0]、.[-1]、.[]、[\"key\"]、管道 | 以及 length keys values type first last",
+		parameters: objectSchema(map[string]interface{}{
+			"json":  stringSchema("JSON文本"),
+			"query": stringSchema("查询表达式，如 .items[].name 或 .data | length"),
+		}, "json", "query"),
+		call: func(arguments map[string]interface{}) (string, error) {
+			return queryJSON(stringArg(arguments, "json"), stringArg(arguments, "query"))
+		},
+	})
+	RegisterNativeTool(&builtinTool{
+		name:        "regex_test",
+		description: "测试正则表达式（Go RE2语法），列出匹配的位置和分组，提供 replace 时同时返回替换结果（$1 或 ${name} 引用分组）",
+		parameters: objectSchema(map[string]interface{}{
+			"pattern": stringSchema("正则表达式"),
+			"text":    stringSchema("测试文本"),
+			"replace": stringSchema("替换内容（可选）"),
+		}, "pattern", "text"),
+		call: func(arguments map[string]interface{}) (string, error) {
+			_, replace := arguments["replace"]
+			return regexTest(stringArg(arguments, "pattern"), stringArg(arguments, "text"), stringArg(arguments, "replace"), replace)
+		},
+	})
+}
+
+// objectSchema 生成对象类型的参数Schema
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// stringSchema 生成字符串类型的参数Schema
+func stringSchema(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+// stringArg 获取字符串参数，不存在时返回空字符串
+func stringArg(arguments map[string]interface{}, name string) string {
+	switch value := arguments[name].(type) {
+	case string:
+		return value
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// numberArg 获取数值参数，也接受数字字符串
+func numberArg(arguments map[string]interface{}, name string) (float64, error) {
+	switch value := arguments[name].(type) {
+	case float64:
+		return value, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("参数 %s 不是数字: %s", name, value)
+		}
+		return number, nil
+	case nil:
+		return 0, fmt.Errorf("缺少参数 %s", name)
+	default:
+		return 0, fmt.Errorf("参数 %s 不是数字", name)
+	}
+}
+
+// timeLayouts get_time 接受的时间格式
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// getTime 获取当前时间或将时间转换到指定时区
+func getTime(arguments map[string]interface{}) (string, error) {
+	location, err := loadLocation(stringArg(arguments, "timezone"))
+	if err != nil {
+		return "", err
+	}
+	fromLocation, err := loadLocation(stringArg(arguments, "from_timezone"))
+	if err != nil {
+		return "", err
+	}
+
+	t := time.Now()
+	if input := strings.TrimSpace(stringArg(arguments, "time")); input != "" {
+		if t, err = parseTime(input, fromLocation); err != nil {
+			return "", err
+		}
+	}
+	t = t.In(location)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "时间: %s\n", t.Format("2006-01-02 15:04:05 MST (-07:00)"))
+	fmt.Fprintf(&b, "时区: %s\n", location.String())
+	fmt.Fprintf(&b, "星期: %s\n", t.Weekday())
+	fmt.Fprintf(&b, "RFC 3339: %s\n", t.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Unix时间戳: %d", t.Unix())
+	return b.String(), nil
+}
+
+// loadLocation 加载时区，为空时使用服务器时区
+func loadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	switch strings.ToLower(name) {
+	case "", "local":
+		return time.Local, nil
+	case "utc", "gmt", "z":
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("未知的时区: %s", name)
+	}
+	return location, nil
+}
+
+// parseTime 解析时间，不含时区偏移的时间按location解释
+func parseTime(input string, location *time.Location) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(input, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, input, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间: %s", input)
+}
+
+// formatNumber 格式化数值，整数不显示小数部分
+func formatNumber(value float64) string {
+	abs := value
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs != 0 && (abs >= 1e15 || abs < 1e-6) {
+		return strconv.FormatFloat(value, 'g', 15, 64)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// encode 生成UUID、计算哈希或编码转换
+func encode(operation, text string) (string, error) {
+	var h hash.Hash
+	switch strings.ToLower(operation) {
+	case "uuid":
+		return newUUID()
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	case "base64_encode":
+		return base64.StdEncoding.EncodeToString([]byte(text)), nil
+	case "base64url_encode":
+		return base64.RawURLEncoding.EncodeToString([]byte(text)), nil
+	case "base64_decode", "base64url_decode":
+		return decodeBase64(text)
+	case "hex_encode":
+		return hex.EncodeToString([]byte(text)), nil
+	case "hex_decode":
+		data, err := hex.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return "", fmt.Errorf("hex解码失败: %v", err)
+		}
+		return decodedText(data), nil
+	default:
+		return "", fmt.Errorf("不支持的操作: %s", operation)
+	}
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newUUID 生成随机UUID（版本4）
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// decodeBase64 解码base64，自动识别标准和URL编码以及是否有填充
+func decodeBase64(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := encoding.DecodeString(text); err == nil {
+			return decodedText(data), nil
+		}
+	}
+	return "", fmt.Errorf("base64解码失败: 输入不是有效的base64")
+}
+
+// decodedText 解码结果不是文本时以hex显示
+func decodedText(data []byte) string {
+	if isPrintable(string(data)) {
+		return string(data)
+	}
+	return "（二进制数据，hex）" + hex.EncodeToString(data)
+}
+
+// isPrintable 判断是否为可显示的文本
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r == '�' || (r < 0x20 && r != '\n' && r != '\r' && r != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+// regexTest 列出正则表达式的匹配和分组，replaceSet时同时返回替换结果
+func regexTest(pattern, text, replace string, replaceSet bool) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("正则表达式无效: %v", err)
+	}
+
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	var b strings.Builder
+	if len(matches) == 0 {
+		b.WriteString("没有匹配")
+	} else {
+		fmt.Fprintf(&b, "匹配 %d 处:", len(matches))
+	}
+	names := re.SubexpNames()
+	for i, match := range matches {
+		if i == maxRegexMatches {
+			fmt.Fprintf(&b, "\n...（只显示前 %d 处）", maxRegexMatches)
+			break
+		}
+		fmt.Fprintf(&b, "\n[%d] 位置 %d-%d: %q", i+1, match[0], match[1], text[match[0]:match[1]])
+		for group := 1; group < len(names); group++ {
+			start, end := match[2*group], match[2*group+1]
+			label := strconv.Itoa(group)
+			if names[group] != "" {
+				label += " (" + names[group] + ")"
+			}
+			if start < 0 {
+				fmt.Fprintf(&b, "\n    分组 %s: 未匹配", label)
+			} else {
+				fmt.Fprintf(&b, "\n    分组 %s: %q", label, text[start:end])
+			}
+		}
+	}
+	if replaceSet {
+		b.WriteString("\n替换结果:\n")
+		b.WriteString(re.ReplaceAllString(text, replace))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,167 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"sshai/pkg/config"
+)
+
+func TestEvaluate(t *testing.T) {
+	cases := map[string]string{
+		"1 + 2 * 3":       "7",
+		"(1+2)*3^2":       "27",
+		"-2^2":            "-4",
+		"2^3^2":           "512",
+		"10 % 4 + 0x10":   "18",
+		"sqrt(16) / 2":    "2",
+		"max(1, 5, 3)":    "5",
+		"round(pi * 100)": "314",
+		"1.5e3 × 2":       "3000",
+	}
+	for expression, want := range cases {
+		value, err := evaluate(expression)
+		if err != nil || formatNumber(value) != want {
+			t.Errorf("%s = %v (%v), want %s", expression, value, err, want)
+		}
+	}
+	for _, expression := range []string{"", "1/0", "2 +", "(1", "foo(1)", "sqrt(1, 2)", "1 2"} {
+		if _, err := evaluate(expression); err == nil {
+			t.Errorf("%q should fail", expression)
+		}
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	cases := []struct {
+		value    float64
+		from, to string
+		want     string
+	}{
+		{1, "km", "m", "1000"},
+		{1, "mile", "km", "1.609344"},
+		{1, "GiB", "MiB", "1024"},
+		{1, "公斤", "斤", "2"},
+		{100, "C", "F", "212"},
+		{0, "K", "°C", "-273.15"},
+		{36, "km/h", "m/s", "10"},
+	}
+	for _, c := range cases {
+		result, err := convertUnit(c.value, c.from, c.to)
+		if err != nil || formatNumber(result) != c.want {
+			t.Errorf("%v %s -> %s = %v (%v), want %s", c.value, c.from, c.to, result, err, c.want)
+		}
+	}
+	if _, err := convertUnit(1, "kg", "m"); err == nil {
+		t.Error("converting between categories should fail")
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	doc := `{"items":[{"name":"a","id":12345678901234567890},{"name":"b"}],"meta":{"a b":1}}`
+	cases := map[string]string{
+		".items[].name":         "\"a\"\n\"b\"",
+		".items[0].id":          "12345678901234567890",
+		".items[-1]":            "{\n  \"name\": \"b\"\n}",
+		".items | length":       "2",
+		".meta | keys":          "[\n  \"a b\"\n]",
+		`.meta["a b"]`:          "1",
+		".missing.field":        "null",
+		".items | last | .name": "\"b\"",
+	}
+	for query, want := range cases {
+		if got, err := queryJSON(doc, query); err != nil || got != want {
+			t.Errorf("%s = %q (%v), want %q", query, got, err, want)
+		}
+	}
+	if _, err := queryJSON(doc, ".items.name"); err == nil {
+		t.Error("field access on an array should fail")
+	}
+	if _, err := queryJSON("{", "."); err == nil {
+		t.Error("invalid JSON should fail")
+	}
+}
+
+func TestRegexTest(t *testing.T) {
+	result, err := regexTest(`(?P<key>\w+)=(\d+)`, "a=1 b=x c=3", "$key", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"匹配 2 处", `[1] 位置 0-3: "a=1"`, `分组 1 (key): "c"`, "替换结果:\na b=x c"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("result should contain %q:\n%s", want, result)
+		}
+	}
+	if _, err := regexTest("(", "", "", false); err == nil {
+		t.Error("invalid pattern should fail")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	cases := map[string]string{
+		"sha256":        "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"md5":           "5d41402abc4b2a76b9719d911017c592",
+		"base64_encode": "aGVsbG8=",
+		"hex_encode":    "68656c6c6f",
+	}
+	for operation, want := range cases {
+		if got, err := encode(operation, "hello"); err != nil || got != want {
+			t.Errorf("%s = %q (%v), want %q", operation, got, err, want)
+		}
+	}
+	if got, _ := encode("base64_decode", "aGVsbG8"); got != "hello" {
+		t.Errorf("base64 without padding should decode: %q", got)
+	}
+	if uuid, err := encode("uuid", ""); err != nil || len(uuid) != 36 || uuid[14] != '4' {
+		t.Errorf("unexpected uuid: %q %v", uuid, err)
+	}
+}
+
+func TestGetTime(t *testing.T) {
+	result, err := getTime(map[string]interface{}{
+		"time":          "2024-01-02 08:00",
+		"from_timezone": "Asia/Shanghai",
+		"timezone":      "UTC",
+	})
+	if err != nil || !strings.Contains(result, "2024-01-02 00:00:00 UTC") || !strings.Contains(result, "Unix时间戳: 1704153600") {
+		t.Errorf("unexpected result: %q %v", result, err)
+	}
+	if _, err := getTime(map[string]interface{}{"timezone": "Mars/Base"}); err == nil {
+		t.Error("unknown timezone should fail")
+	}
+}
+
+func TestNativeToolsAvailability(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Tools
+	t.Cleanup(func() { cfg.Tools = saved })
+
+	client := &OpenAIClient{}
+	cfg.Tools.Builtin = false
+	if tools := client.GetAvailableTools(); len(tools) != 0 {
+		t.Errorf("builtin tools should be disabled by default: %d", len(tools))
+	}
+
+	cfg.Tools.Builtin = true
+	cfg.Tools.Disabled = []string{"regex_test"}
+	names := map[string]bool{}
+	for _, tool := range client.GetAvailableTools() {
+		names[tool.Function.Name] = true
+	}
+	if !names["calculate"] || !names["get_time"] || names["regex_test"] {
+		t.Errorf("unexpected tools: %v", names)
+	}
+	if client.findNativeTool("regex_test") != nil {
+		t.Error("disabled tool should not be dispatched")
+	}
+
+	// 工具策略中没有 builtin 时不提供内置工具
+	client.toolPolicy = &config.ToolPolicy{MCPServers: []string{"filesystem"}}
+	if tools := client.GetAvailableTools(); len(tools) != 0 {
+		t.Errorf("tool policy should exclude builtin tools: %d", len(tools))
+	}
+	client.toolPolicy = &config.ToolPolicy{MCPServers: []string{NativeServerName}}
+	if tools := client.GetAvailableTools(); len(tools) == 0 {
+		t.Error("tool policy allowing builtin should include builtin tools")
+	}
+}
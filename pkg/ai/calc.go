@@ -0,0 +1,413 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxExpressionLength calculate 接受的表达式最大长度
+const maxExpressionLength = 1000
+
+// calcFunctions calculate 支持的函数（参数个数为-1表示至少一个）
+var calcFunctions = map[string]struct {
+	args int
+	fn   func(args []float64) float64
+}{
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"cbrt":  {1, func(a []float64) float64 { return math.Cbrt(a[0]) }},
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"ln":    {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"log2":  {1, func(a []float64) float64 { return math.Log2(a[0]) }},
+	"log10": {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"sin":   {1, func(a []float64) float64 { return math.Sin(a[0]) }},
+	"cos":   {1, func(a []float64) float64 { return math.Cos(a[0]) }},
+	"tan":   {1, func(a []float64) float64 { return math.Tan(a[0]) }},
+	"asin":  {1, func(a []float64) float64 { return math.Asin(a[0]) }},
+	"acos":  {1, func(a []float64) float64 { return math.Acos(a[0]) }},
+	"atan":  {1, func(a []float64) float64 { return math.Atan(a[0]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min": {-1, func(a []float64) float64 {
+		result := a[0]
+		for _, v := range a[1:] {
+			result = math.Min(result, v)
+		}
+		return result
+	}},
+	"max": {-1, func(a []float64) float64 {
+		result := a[0]
+		for _, v := range a[1:] {
+			result = math.Max(result, v)
+		}
+		return result
+	}},
+}
+
+// calcConstants calculate 支持的常量
+var calcConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// calcParser 数学表达式的递归下降解析器，解析的同时计算结果
+type calcParser struct {
+	input string
+	pos   int
+}
+
+// evaluate 计算数学表达式
+func evaluate(expression string) (float64, error) {
+	if strings.TrimSpace(expression) == "" {
+		return 0, fmt.Errorf("表达式为空")
+	}
+	if len(expression) > maxExpressionLength {
+		return 0, fmt.Errorf("表达式过长")
+	}
+	// 常见的乘除符号
+	expression = strings.NewReplacer("×", "*", "÷", "/", "**", "^").Replace(expression)
+
+	p := &calcParser{input: expression}
+	value, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("表达式位置 %d 有无法识别的内容: %s", p.pos+1, p.input[p.pos:])
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("结果不是有效的数值")
+	}
+	return value, nil
+}
+
+func (p *calcParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek 跳过空白后返回下一个字符，已到结尾时返回0
+func (p *calcParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// expr := term (('+'|'-') term)*
+func (p *calcParser) expr() (float64, error) {
+	value, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += right
+		} else {
+			value -= right
+		}
+	}
+}
+
+// term := unary (('*'|'/'|'%') unary)*
+func (p *calcParser) term() (float64, error) {
+	value, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case op == '*':
+			value *= right
+		case right == 0:
+			return 0, fmt.Errorf("除数为0")
+		case op == '/':
+			value /= right
+		default:
+			value = math.Mod(value, right)
+		}
+	}
+}
+
+// unary := ('+'|'-') unary | power
+func (p *calcParser) unary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		value, err := p.unary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power := primary ('^' unary)?（右结合，-2^2 = -4）
+func (p *calcParser) power() (float64, error) {
+	base, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// primary := number | constant | function '(' args ')' | '(' expr ')'
+func (p *calcParser) primary() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return 0, fmt.Errorf("表达式不完整")
+	case c == '(':
+		p.pos++
+		value, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("缺少右括号")
+		}
+		p.pos++
+		return value, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case isLetter(c):
+		return p.identifier()
+	}
+	return 0, fmt.Errorf("表达式位置 %d 有无法识别的字符: %c", p.pos+1, c)
+}
+
+// number 解析十进制数（支持科学计数法）或0x开头的十六进制数
+func (p *calcParser) number() (float64, error) {
+	start := p.pos
+	if strings.HasPrefix(p.input[p.pos:], "0x") || strings.HasPrefix(p.input[p.pos:], "0X") {
+		p.pos += 2
+		for p.pos < len(p.input) && isHexDigit(p.input[p.pos]) {
+			p.pos++
+		}
+		value, err := strconv.ParseUint(p.input[start+2:p.pos], 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的数字: %s", p.input[start:p.pos])
+		}
+		return float64(value), nil
+	}
+	for p.pos < len(p.input) && (p.input[p.pos] == '.' || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+		p.pos++
+	}
+	// 科学计数法，如 1e-3
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		next := p.pos + 1
+		if next < len(p.input) && (p.input[next] == '+' || p.input[next] == '-') {
+			next++
+		}
+		if next < len(p.input) && p.input[next] >= '0' && p.input[next] <= '9' {
+			p.pos = next
+			for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+				p.pos++
+			}
+		}
+	}
+	value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的数字: %s", p.input[start:p.pos])
+	}
+	return value, nil
+}
+
+// identifier 解析常量或函数调用
+func (p *calcParser) identifier() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (isLetter(p.input[p.pos]) || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+
+	if p.peek() != '(' {
+		if value, ok := calcConstants[name]; ok {
+			return value, nil
+		}
+		return 0, fmt.Errorf("未知的常量: %s", name)
+	}
+	function, ok := calcFunctions[name]
+	if !ok {
+		return 0, fmt.Errorf("未知的函数: %s", name)
+	}
+	p.pos++
+
+	var args []float64
+	if p.peek() != ')' {
+		for {
+			value, err := p.expr()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, value)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peek() != ')' {
+		return 0, fmt.Errorf("函数 %s 缺少右括号", name)
+	}
+	p.pos++
+	if (function.args >= 0 && len(args) != function.args) || len(args) == 0 {
+		return 0, fmt.Errorf("函数 %s 的参数个数不正确", name)
+	}
+	return function.fn(args), nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// unitInfo 单位的类别和换算到基本单位的系数
+type unitInfo struct {
+	category string
+	factor   float64
+}
+
+// units convert_unit 支持的单位（温度单独处理）
+var units = map[string]unitInfo{
+	// 长度（米）
+	"mm": {"长度", 0.001}, "cm": {"长度", 0.01}, "m": {"长度", 1}, "km": {"长度", 1000},
+	"in": {"长度", 0.0254}, "ft": {"长度", 0.3048}, "yd": {"长度", 0.9144}, "mi": {"长度", 1609.344}, "nmi": {"长度", 1852},
+	"毫米": {"长度", 0.001}, "厘米": {"长度", 0.01}, "米": {"长度", 1}, "千米": {"长度", 1000}, "公里": {"长度", 1000},
+	"英寸": {"长度", 0.0254}, "英尺": {"长度", 0.3048}, "英里": {"长度", 1609.344}, "海里": {"长度", 1852},
+	// 质量（千克）
+	"mg": {"质量", 1e-6}, "g": {"质量", 0.001}, "kg": {"质量", 1}, "t": {"质量", 1000},
+	"lb": {"质量", 0.45359237}, "oz": {"质量", 0.028349523125},
+	"毫克": {"质量", 1e-6}, "克": {"质量", 0.001}, "千克": {"质量", 1}, "公斤": {"质量", 1}, "斤": {"质量", 0.5}, "吨": {"质量", 1000},
+	"磅": {"质量", 0.45359237}, "盎司": {"质量", 0.028349523125},
+	// 时间（秒）
+	"ms": {"时间", 0.001}, "s": {"时间", 1}, "min": {"时间", 60}, "h": {"时间", 3600}, "d": {"时间", 86400}, "week": {"时间", 604800},
+	"毫秒": {"时间", 0.001}, "秒": {"时间", 1}, "分钟": {"时间", 60}, "小时": {"时间", 3600}, "天": {"时间", 86400}, "周": {"时间", 604800},
+	// 数据大小（字节）
+	"bit": {"数据大小", 0.125}, "B": {"数据大小", 1},
+	"KB": {"数据大小", 1e3}, "MB": {"数据大小", 1e6}, "GB": {"数据大小", 1e9}, "TB": {"数据大小", 1e12}, "PB": {"数据大小", 1e15},
+	"KiB": {"数据大小", 1 << 10}, "MiB": {"数据大小", 1 << 20}, "GiB": {"数据大小", 1 << 30}, "TiB": {"数据大小", 1 << 40}, "PiB": {"数据大小", 1 << 50},
+	// 速度（米/秒）
+	"m/s": {"速度", 1}, "km/h": {"速度", 1 / 3.6}, "mph": {"速度", 0.44704}, "kn": {"速度", 1852.0 / 3600},
+}
+
+// unitAliases 单位的其他写法
+var unitAliases = map[string]string{
+	"meter": "m", "meters": "m", "metre": "m", "kilometer": "km", "kilometers": "km", "inch": "in", "inches": "in",
+	"foot": "ft", "feet": "ft", "yard": "yd", "mile": "mi", "miles": "mi",
+	"gram": "g", "grams": "g", "kilogram": "kg", "kilograms": "kg", "ton": "t", "tonne": "t", "pound": "lb", "pounds": "lb", "lbs": "lb", "ounce": "oz",
+	"sec": "s", "second": "s", "seconds": "s", "minute": "min", "minutes": "min", "hour": "h", "hours": "h", "hr": "h",
+	"day": "d", "days": "d", "weeks": "week",
+	"byte": "B", "bytes": "B", "bits": "bit", "kph": "km/h", "knot": "kn", "knots": "kn",
+}
+
+// lookupUnit 查找单位：先精确匹配，再按别名和不区分大小写匹配
+func lookupUnit(name string) (unitInfo, bool) {
+	name = strings.TrimSpace(name)
+	if unit, ok := units[name]; ok {
+		return unit, true
+	}
+	lower := strings.ToLower(name)
+	if alias, ok := unitAliases[lower]; ok {
+		return units[alias], true
+	}
+	for key, unit := range units {
+		if strings.ToLower(key) == lower {
+			return unit, true
+		}
+	}
+	return unitInfo{}, false
+}
+
+// temperatureUnit 识别温度单位，返回 C、F、K 或空
+func temperatureUnit(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "c", "°c", "celsius", "摄氏度", "℃":
+		return "C"
+	case "f", "°f", "fahrenheit", "华氏度", "℉":
+		return "F"
+	case "k", "kelvin", "开尔文":
+		return "K"
+	}
+	return ""
+}
+
+// convertUnit 单位换算
+func convertUnit(value float64, from, to string) (float64, error) {
+	fromTemp, toTemp := temperatureUnit(from), temperatureUnit(to)
+	if fromTemp != "" || toTemp != "" {
+		if fromTemp == "" || toTemp == "" {
+			return 0, fmt.Errorf("无法在 %s 和 %s 之间换算", from, to)
+		}
+		return convertTemperature(value, fromTemp, toTemp), nil
+	}
+
+	fromUnit, ok := lookupUnit(from)
+	if !ok {
+		return 0, fmt.Errorf("未知的单位: %s", from)
+	}
+	toUnit, ok := lookupUnit(to)
+	if !ok {
+		return 0, fmt.Errorf("未知的单位: %s", to)
+	}
+	if fromUnit.category != toUnit.category {
+		return 0, fmt.Errorf("无法在%s单位 %s 和%s单位 %s 之间换算", fromUnit.category, from, toUnit.category, to)
+	}
+	return value * fromUnit.factor / toUnit.factor, nil
+}
+
+// convertTemperature 温度换算
+func convertTemperature(value float64, from, to string) float64 {
+	celsius := value
+	switch from {
+	case "F":
+		celsius = (value - 32) * 5 / 9
+	case "K":
+		celsius = value - 273.15
+	}
+	switch to {
+	case "F":
+		return celsius*9/5 + 32
+	case "K":
+		return celsius + 273.15
+	}
+	return celsius
+}
@@ -2,7 +2,10 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -10,9 +13,11 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"golang.org/x/crypto/ssh"
 
+	"sshai/pkg/audit"
 	"sshai/pkg/config"
-	"sshai/pkg/i18n"
 	"sshai/pkg/mcp"
+	"sshai/pkg/metrics"
+	"sshai/pkg/prompt"
 )
 
 // OpenAIClient 基于 go-openai 库的客户端
@@ -22,6 +27,14 @@ type OpenAIClient struct {
 	username          string
 	currentModel      string // 添加当前模型字段
 	pendingToolCalls  map[string]*openai.ToolCall // 缓存不完整的工具调用
+	renderer          Renderer                    // 当前请求使用的渲染器
+	result            *Result                     // 当前请求的结果
+	identity          *audit.Identity             // 审计日志中的会话身份，nil表示不记录审计日志
+	persona           *config.Persona             // 当前角色，nil表示使用全局的系统提示词和全部工具
+	toolPolicy        *config.ToolPolicy          // 路由规则的工具策略，nil表示不限制
+	promptData        prompt.Data                 // 提示词模板中的会话变量
+	overrideTemp      float64                     // 自定义命令指定的温度，0表示不覆盖
+	sessionTools      []NativeTool                // 只属于当前会话的内置工具
 }
 
 // NewOpenAIClient 创建新的 OpenAI 客户端
@@ -42,38 +55,38 @@ func NewOpenAIClient(username string) *OpenAIClient {
 
 	client := openai.NewClientWithConfig(clientConfig)
 
-	// 初始化消息列表
-	messages := make([]openai.ChatCompletionMessage, 0)
-
-	// 如果配置了系统提示词，添加到消息列表开头
-	if cfg.Prompt.SystemPrompt != "" {
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: cfg.Prompt.SystemPrompt,
-		})
-	}
-
-	return &OpenAIClient{
+	c := &OpenAIClient{
 		client:            client,
-		messages:          messages,
 		username:          username,
 		currentModel:      cfg.API.DefaultModel, // 初始化为默认模型
-		pendingToolCalls:  make(map[string]*openai.ToolCall), // 初始化工具调用缓存
 	}
+	// 初始化消息列表（包括系统提示词）和工具调用缓存
+	c.ClearContext()
+	return c
 }
 
 // ProcessMessage 处理用户消息（带动画）
-func (c *OpenAIClient) ProcessMessage(input string, channel ssh.Channel, interrupt chan bool) {
-	c.ProcessMessageWithFullOptions(input, channel, interrupt, true, true)
+func (c *OpenAIClient) ProcessMessage(input string, channel ssh.Channel, interrupt chan bool) error {
+	return c.ProcessMessageWithFullOptions(input, channel, interrupt, true, true)
 }
 
 // ProcessMessageWithOptions 处理用户消息（可选动画）
-func (c *OpenAIClient) ProcessMessageWithOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool) {
-	c.ProcessMessageWithFullOptions(input, channel, interrupt, showAnimation, true)
+func (c *OpenAIClient) ProcessMessageWithOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool) error {
+	return c.ProcessMessageWithFullOptions(input, channel, interrupt, showAnimation, true)
 }
 
 // ProcessMessageWithFullOptions 处理用户消息（完整选项）
-func (c *OpenAIClient) ProcessMessageWithFullOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool, showToolOutput bool) {
+// 返回的错误为 *RequestError，可通过 KindOf 获取错误类别
+func (c *OpenAIClient) ProcessMessageWithFullOptions(input string, channel ssh.Channel, interrupt chan bool, showAnimation bool, showToolOutput bool) error {
+	_, err := c.ProcessMessageWithRenderer(input, channel, NewTerminalRenderer(channel), interrupt, showToolOutput)
+	return err
+}
+
+// ProcessMessageWithRenderer 使用指定渲染器处理用户消息，返回完整的请求结果
+func (c *OpenAIClient) ProcessMessageWithRenderer(input string, channel ssh.Channel, renderer Renderer, interrupt chan bool, showToolOutput bool) (*Result, error) {
+	c.renderer = renderer
+	c.result = newResult(c.currentModel)
+
 	// 添加用户消息到上下文
 	c.messages = append(c.messages, openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleUser,
@@ -98,23 +111,67 @@ func (c *OpenAIClient) ProcessMessageWithFullOptions(input string, channel ssh.C
 	}()
 
 	// 调用流式 API
-	c.callStreamingAPI(ctx, channel, showAnimation, showToolOutput)
+	err := c.callStreamingAPI(ctx, channel, showToolOutput)
+
+	result := c.result
+	result.finish(err)
+	renderer.Finish(result)
+	c.auditRequest(input, result)
+	return result, err
+}
+
+// SetAuditIdentity 设置审计日志中的会话身份
+func (c *OpenAIClient) SetAuditIdentity(identity audit.Identity) {
+	c.identity = &identity
 }
 
-// GetAvailableTools 获取可用的MCP工具列表（用于传递给AI模型）
+// auditRequest 将一次请求及其工具调用写入审计日志
+func (c *OpenAIClient) auditRequest(input string, result *Result) {
+	if c.identity == nil || !audit.Enabled() {
+		return
+	}
+
+	toolCalls := make([]audit.ToolCall, 0, len(result.ToolCalls))
+	for _, call := range result.ToolCalls {
+		toolCalls = append(toolCalls, audit.ToolCall{
+			Name:         call.Name,
+			Arguments:    call.Arguments,
+			Success:      call.Error == "",
+			Error:        call.Error,
+			ResultLength: len([]rune(call.Result)),
+			DurationMs:   call.LatencyMs,
+		})
+	}
+
+	start := result.startTime
+	audit.Log(audit.Record{
+		Event:          audit.EventRequest,
+		Identity:       *c.identity,
+		Model:          c.currentModel,
+		Prompt:         input,
+		ResponseLength: len([]rune(result.Content)),
+		ToolCalls:      toolCalls,
+		StartTime:      &start,
+		DurationMs:     result.LatencyMs,
+		Error:          result.Error,
+	})
+}
+
+// GetAvailableTools 获取可用的工具列表（内置工具和MCP工具，用于传递给AI模型）
 func (c *OpenAIClient) GetAvailableTools() []openai.Tool {
+	// 内置工具在进程内执行，不依赖MCP
+	tools := c.nativeOpenAITools()
+
 	mcpManager := mcp.GetGlobalManager()
 	if mcpManager == nil {
-		return nil
+		return tools
 	}
 
-	mcpTools := mcpManager.GetTools()
-	if len(mcpTools) == 0 {
-		return nil
-	}
-
-	var tools []openai.Tool
-	for _, mcpTool := range mcpTools {
+	for _, mcpTool := range mcpManager.GetTools() {
+		// 只提供当前角色和工具策略允许的MCP服务器的工具，与内置工具同名的MCP工具不会被调用
+		if !c.allowsMCPServer(mcpTool.ServerName) || c.findNativeTool(mcpTool.Name) != nil {
+			continue
+		}
 		tool := openai.Tool{
 			Type: openai.ToolTypeFunction,
 			Function: &openai.FunctionDefinition{
@@ -130,7 +187,7 @@ func (c *OpenAIClient) GetAvailableTools() []openai.Tool {
 }
 
 // callStreamingAPI 调用流式 API
-func (c *OpenAIClient) callStreamingAPI(ctx context.Context, channel ssh.Channel, showAnimation bool, showToolOutput bool) {
+func (c *OpenAIClient) callStreamingAPI(ctx context.Context, channel ssh.Channel, showToolOutput bool) error {
 	// 创建聊天完成请求
 	req := openai.ChatCompletionRequest{
 		Model:    c.currentModel, // 使用当前设置的模型
@@ -139,9 +196,8 @@ func (c *OpenAIClient) callStreamingAPI(ctx context.Context, channel ssh.Channel
 	}
 
 	// 设置温度参数（如果配置了的话）
-	cfg := config.Get()
-	if cfg.API.Temperature > 0 {
-		req.Temperature = float32(cfg.API.Temperature)
+	if temperature := c.temperature(); temperature > 0 {
+		req.Temperature = float32(temperature)
 	}
 
 	// 添加MCP工具（如果可用）
@@ -150,28 +206,50 @@ func (c *OpenAIClient) callStreamingAPI(ctx context.Context, channel ssh.Channel
 		req.ToolChoice = "auto" // 让AI自动决定是否使用工具
 	}
 
+	// 结构化输出需要上游在最后一个数据块中返回token用量
+	if c.renderer.IncludeUsage() {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	// 记录请求量、首token耗时、总耗时和上游错误
+	start := time.Now()
+	metrics.Requests.Inc(req.Model)
+	defer func() {
+		metrics.ObserveSince(metrics.RequestDuration, start, req.Model)
+		if first := c.result.firstTokenTime; !first.IsZero() && !first.Before(start) {
+			metrics.TimeToFirstToken.Observe(first.Sub(start).Seconds(), req.Model)
+		}
+	}()
+
 	// 创建流式响应
 	stream, err := c.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		// 检查是否是因为上下文取消导致的错误
 		if ctx.Err() == context.Canceled {
-			channel.Write([]byte("\r\n[已中断]\r\n"))
-			return
+			c.renderer.Error("\n[已中断]\n")
+			return ErrInterrupted
 		}
-		channel.Write([]byte(fmt.Sprintf("创建流式请求失败: %v\r\n", err)))
-		return
+		c.renderer.Error(fmt.Sprintf("创建流式请求失败: %v\n", err))
+		return recordUpstreamError(classifyError(ctx, err))
 	}
 	defer stream.Close()
 
 	// 处理流式响应
-	c.handleStreamResponse(ctx, stream, channel, showAnimation, showToolOutput)
+	return recordUpstreamError(c.handleStreamResponse(ctx, stream, channel, showToolOutput))
+}
+
+// recordUpstreamError 记录上游错误指标，中断不计入，返回原错误
+func recordUpstreamError(err error) error {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) && reqErr.Kind != ErrorKindInterrupted {
+		metrics.UpstreamErrors.Inc(metrics.StatusLabel(statusCodeOf(reqErr.Err)))
+	}
+	return err
 }
 
 // handleStreamResponse 处理流式响应
-func (c *OpenAIClient) handleStreamResponse(ctx context.Context, stream *openai.ChatCompletionStream, channel ssh.Channel, showAnimation bool, showToolOutput bool) {
+func (c *OpenAIClient) handleStreamResponse(ctx context.Context, stream *openai.ChatCompletionStream, channel ssh.Channel, showToolOutput bool) error {
 	var assistantMessage strings.Builder
-	isThinking := false
-	thinkingStartTime := time.Now()
 
 	// 创建响应通道
 	responseChan := make(chan openai.ChatCompletionStreamResponse, 1)
@@ -209,66 +287,66 @@ func (c *OpenAIClient) handleStreamResponse(ctx context.Context, stream *openai.
 		select {
 		case <-ctx.Done():
 			stream.Close()
-			channel.Write([]byte("\r\n[已中断]\r\n"))
-			return
-
-		case err := <-errorChan:
-			if err.Error() == "EOF" {
+			c.renderer.Error("\n[已中断]\n")
+			return ErrInterrupted
+
+		case err, ok := <-errorChan:
+			if !ok {
+				// 接收goroutine因上下文取消而退出
+				c.renderer.Error("\n[已中断]\n")
+				return ErrInterrupted
+			}
+			if errors.Is(err, io.EOF) {
 				goto finish
 			}
 			if ctx.Err() == context.Canceled {
-				channel.Write([]byte("\r\n[已中断]\r\n"))
-				return
+				c.renderer.Error("\n[已中断]\n")
+				return ErrInterrupted
 			}
-			channel.Write([]byte(fmt.Sprintf("\r\n流式响应错误: %v\r\n", err)))
-			return
+			c.renderer.Error(fmt.Sprintf("\n流式响应错误: %v\n", err))
+			return classifyError(ctx, err)
 
 		case response := <-responseChan:
 			// 在处理每个响应前再次检查 context
 			select {
 			case <-ctx.Done():
 				stream.Close()
-				channel.Write([]byte("\r\n[已中断]\r\n"))
-				return
+				c.renderer.Error("\n[已中断]\n")
+				return ErrInterrupted
 			default:
 			}
 
+			// 记录token用量（开启include_usage时最后一个数据块携带）
+			if response.Usage != nil {
+				c.result.addUsage(response.Usage)
+			}
+			if response.Model != "" {
+				c.result.Model = response.Model
+			}
+
 			// 处理响应数据
 			if len(response.Choices) > 0 {
 				delta := response.Choices[0].Delta
 
 				// 检查是否有思考内容（DeepSeek 等模型支持）
 				if delta.ReasoningContent != "" {
-					if !isThinking {
-						isThinking = true
-						thinkingStartTime = time.Now()
-						channel.Write([]byte(i18n.T("ai.thinking_process") + "\r\n"))
-					}
-
-					// 输出思考内容
-					thinkingText := strings.ReplaceAll(delta.ReasoningContent, "\n", "\r\n")
-					channel.Write([]byte(thinkingText))
+					c.result.markToken()
+					c.result.reasoning.WriteString(delta.ReasoningContent)
+					c.renderer.Reasoning(delta.ReasoningContent)
 				}
 
 				// 处理工具调用
 				if len(delta.ToolCalls) > 0 {
 					for _, toolCall := range delta.ToolCalls {
-						c.processToolCallSimpleWithOptions(ctx, toolCall, channel, &assistantMessage, showToolOutput)
+						if err := c.processToolCallSimpleWithOptions(ctx, toolCall, channel, &assistantMessage, showToolOutput); err != nil {
+							return err
+						}
 					}
 				}
 
 				// 处理正常回答内容
 				if delta.Content != "" {
-					if isThinking {
-						thinkingDuration := time.Since(thinkingStartTime)
-						channel.Write([]byte(fmt.Sprintf("\r\n%s\r\n\n", i18n.T("ai.thinking_complete", thinkingDuration.Seconds()))))
-						channel.Write([]byte(i18n.T("ai.response") + "\r\n"))
-						isThinking = false
-					}
-
-					content := delta.Content
-					content = strings.ReplaceAll(content, "\n", "\r\n")
-					channel.Write([]byte(content))
+					c.emitContent(delta.Content)
 					assistantMessage.WriteString(delta.Content)
 				}
 			}
@@ -277,7 +355,9 @@ func (c *OpenAIClient) handleStreamResponse(ctx context.Context, stream *openai.
 
 finish:
 	// 处理任何未完成的工具调用
-	c.processAllPendingToolCallsWithOptions(ctx, channel, &assistantMessage, showToolOutput)
+	if err := c.processAllPendingToolCallsWithOptions(ctx, channel, &assistantMessage, showToolOutput); err != nil {
+		return err
+	}
 
 	// 添加助手回复到上下文
 	if assistantMessage.Len() > 0 {
@@ -287,27 +367,136 @@ finish:
 		})
 	}
 
-	channel.Write([]byte("\r\n"))
+	return nil
+}
+
+// emitContent 输出回答内容增量并记录到请求结果
+func (c *OpenAIClient) emitContent(delta string) {
+	c.result.markToken()
+	c.result.content.WriteString(delta)
+	c.renderer.Content(delta)
 }
 
 // ClearContext 清空对话上下文
 func (c *OpenAIClient) ClearContext() {
-	cfg := config.Get()
 	c.messages = make([]openai.ChatCompletionMessage, 0)
 	c.pendingToolCalls = make(map[string]*openai.ToolCall) // 清空待处理的工具调用
 
 	// 重新添加系统提示词
-	if cfg.Prompt.SystemPrompt != "" {
+	if systemPrompt := c.systemPrompt(); systemPrompt != "" {
 		c.messages = append(c.messages, openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: cfg.Prompt.SystemPrompt,
+			Content: systemPrompt,
 		})
 	}
 }
 
+// SetPersona 切换角色并清空对话上下文，nil表示恢复默认设置
+func (c *OpenAIClient) SetPersona(persona *config.Persona) {
+	c.persona = persona
+	c.ClearContext()
+}
+
+// GetPersona 获取当前角色，nil表示未选择角色
+func (c *OpenAIClient) GetPersona() *config.Persona {
+	return c.persona
+}
+
+// systemPrompt 获取渲染后的系统提示词：角色的系统提示词优先
+func (c *OpenAIClient) systemPrompt() string {
+	if c.persona != nil && c.persona.SystemPrompt != "" {
+		return c.RenderPrompt("system_prompt", c.persona.SystemPrompt)
+	}
+	return c.RenderPrompt("system_prompt", config.Get().Prompt.SystemPrompt)
+}
+
+// refreshSystemPrompt 模型、工具或会话变量变化后重新渲染上下文中的系统提示词
+func (c *OpenAIClient) refreshSystemPrompt() {
+	if len(c.messages) > 0 && c.messages[0].Role == openai.ChatMessageRoleSystem {
+		c.messages[0].Content = c.systemPrompt()
+	}
+}
+
+// SetPromptData 设置提示词模板中的会话变量（用户、客户端地址、语言等）
+func (c *OpenAIClient) SetPromptData(data prompt.Data) {
+	c.promptData = data
+	c.refreshSystemPrompt()
+}
+
+// RenderPrompt 使用会话变量、当前模型、角色和可用工具渲染提示词模板，渲染失败时记录日志并使用原始内容
+func (c *OpenAIClient) RenderPrompt(name, text string) string {
+	return c.RenderCommandPrompt(name, text, "")
+}
+
+// RenderCommandPrompt 渲染自定义命令的提示词模板，input 为模板中的 {{.Input}}
+func (c *OpenAIClient) RenderCommandPrompt(name, text, input string) string {
+	if !prompt.IsTemplate(text) {
+		return text
+	}
+	data := c.promptData
+	data.Input = input
+	if data.User == "" {
+		data.User = c.username
+	}
+	data.Model = c.currentModel
+	if c.persona != nil {
+		data.Persona = c.persona.Name
+	}
+	for _, tool := range c.GetAvailableTools() {
+		data.Tools = append(data.Tools, tool.Function.Name)
+	}
+	rendered, err := prompt.Render(name, text, data)
+	if err != nil {
+		log.Printf("警告：%v，使用原始内容", err)
+		return text
+	}
+	return rendered
+}
+
+// SetTemperature 设置自定义命令指定的温度，0表示恢复使用角色或配置的温度
+func (c *OpenAIClient) SetTemperature(temperature float64) {
+	c.overrideTemp = temperature
+}
+
+// temperature 获取温度：自定义命令的温度优先，其次是角色的温度
+func (c *OpenAIClient) temperature() float64 {
+	if c.overrideTemp > 0 {
+		return c.overrideTemp
+	}
+	if c.persona != nil && c.persona.Temperature > 0 {
+		return c.persona.Temperature
+	}
+	return config.Get().API.Temperature
+}
+
+// SetToolPolicy 设置路由规则的工具策略，nil表示不限制
+func (c *OpenAIClient) SetToolPolicy(policy *config.ToolPolicy) {
+	c.toolPolicy = policy
+	c.refreshSystemPrompt()
+}
+
+// allowsMCPServer 判断当前角色和工具策略是否都允许使用该MCP服务器的工具
+func (c *OpenAIClient) allowsMCPServer(server string) bool {
+	if c.toolPolicy != nil && !c.toolPolicy.Allows(server) {
+		return false
+	}
+	return c.persona.AllowsMCPServer(server)
+}
+
+// toolAllowed 判断当前角色和工具策略是否可以调用该工具
+func (c *OpenAIClient) toolAllowed(mcpManager *mcp.MCPManager, name string) bool {
+	for _, tool := range mcpManager.GetTools() {
+		if tool.Name == name {
+			return c.allowsMCPServer(tool.ServerName)
+		}
+	}
+	return true
+}
+
 // SetModel 设置当前使用的模型
 func (c *OpenAIClient) SetModel(model string) {
 	c.currentModel = model
+	c.refreshSystemPrompt()
 }
 
 // GetCurrentModel 获取当前使用的模型
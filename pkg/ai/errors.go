@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrorKind AI请求错误类别，用于在exec/stdin模式下映射退出码
+type ErrorKind int
+
+const (
+	ErrorKindUnknown     ErrorKind = iota // 未分类错误
+	ErrorKindInput                        // 输入内容错误
+	ErrorKindAuth                         // 上游认证失败（401/403）
+	ErrorKindQuota                        // 配额不足或被限流（402/429）
+	ErrorKindUpstream                     // 上游服务错误或网络错误
+	ErrorKindInterrupted                  // 被用户或信号中断
+)
+
+// RequestError 带分类信息的AI请求错误
+type RequestError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// Error 实现error接口
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 返回原始错误
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInterrupted 请求被中断
+var ErrInterrupted = &RequestError{Kind: ErrorKindInterrupted, Err: context.Canceled}
+
+// KindOf 获取错误的类别，nil返回ErrorKindUnknown
+func KindOf(err error) ErrorKind {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Kind
+	}
+	return ErrorKindUnknown
+}
+
+// classifyError 根据上游返回的错误判断错误类别
+func classifyError(ctx context.Context, err error) *RequestError {
+	if ctx.Err() == context.Canceled || errors.Is(err, context.Canceled) {
+		return &RequestError{Kind: ErrorKindInterrupted, Err: err}
+	}
+
+	switch statusCodeOf(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &RequestError{Kind: ErrorKindAuth, Err: err}
+	case http.StatusPaymentRequired, http.StatusTooManyRequests:
+		return &RequestError{Kind: ErrorKindQuota, Err: err}
+	default:
+		return &RequestError{Kind: ErrorKindUpstream, Err: err}
+	}
+}
+
+// statusCodeOf 获取上游错误的HTTP状态码，没有收到响应时返回0
+func statusCodeOf(err error) int {
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sshai/pkg/config"
+	"sshai/pkg/jsrun"
+)
+
+// run_js 的默认执行限制
+const (
+	defaultJSTimeout   = 5 * time.Second
+	defaultJSMaxMemory = 64 << 20
+	defaultJSMaxOutput = 16 << 10
+	defaultJSMaxInput  = 1 << 20
+)
+
+// jsTool 在嵌入的JavaScript引擎中执行代码，用于计算和处理数据（CSV、JSON等）
+type jsTool struct{}
+
+func (jsTool) Name() string  { return "run_js" }
+func (jsTool) Enabled() bool { return config.Get().Tools.Builtin }
+
+func (jsTool) Description() string {
+	return "在沙箱中执行JavaScript代码（ES5.1和大部分ES6，没有文件、网络和定时器），适合精确计算和处理数据。" +
+		"用 console.log 输出结果，最后一个表达式的值也会返回；参数 input 的内容可以通过全局变量 input（字符串）读取，" +
+		"JSON 用 JSON.parse(input) 解析，CSV 用 parseCSV(input, {header: true, separator: \",\"}) 解析为对象数组（字段均为字符串）"
+}
+
+func (jsTool) Parameters() map[string]interface{} {
+	return objectSchema(map[string]interface{}{
+		"code":  stringSchema("要执行的JavaScript代码"),
+		"input": stringSchema("要处理的数据（如用户提供的CSV或JSON文本），在代码中通过全局变量 input 读取"),
+	}, "code")
+}
+
+func (jsTool) Call(ctx context.Context, arguments map[string]interface{}) (string, error) {
+	code := stringArg(arguments, "code")
+	if code == "" {
+		return "", fmt.Errorf("缺少参数 code")
+	}
+	limits, maxInput := jsLimits()
+	input := stringArg(arguments, "input")
+	if len(input) > maxInput {
+		return "", fmt.Errorf("input 超过 %d 字节的限制", maxInput)
+	}
+	// 脚本的异常也作为结果返回，模型可以据此修改代码
+	return jsrun.Run(ctx, code, input, limits).String(), nil
+}
+
+// jsLimits 配置的执行限制，未配置时使用默认值
+func jsLimits() (jsrun.Limits, int) {
+	cfg := config.Get().Tools.JavaScript
+	limits := jsrun.Limits{
+		Timeout:   defaultJSTimeout,
+		MaxMemory: defaultJSMaxMemory,
+		MaxOutput: defaultJSMaxOutput,
+	}
+	if cfg.Timeout > 0 {
+		limits.Timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	if cfg.MaxMemory > 0 {
+		limits.MaxMemory = uint64(cfg.MaxMemory) << 20
+	}
+	if cfg.MaxOutput > 0 {
+		limits.MaxOutput = cfg.MaxOutput
+	}
+	maxInput := defaultJSMaxInput
+	if cfg.MaxInput > 0 {
+		maxInput = cfg.MaxInput
+	}
+	return limits, maxInput
+}
+
+func init() {
+	RegisterNativeTool(jsTool{})
+}
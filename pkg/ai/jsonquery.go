@@ -0,0 +1,283 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxQueryResults json_query 最多输出的结果数
+const maxQueryResults = 200
+
+// queryJSON 使用jq风格的表达式查询JSON文本，每个结果输出一行（对象和数组格式化输出）
+// 支持的语法：.key、.["key"]、.[0]、.[-1]、.[]、管道 | 以及 length keys values type first last
+func queryJSON(text, query string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return "", fmt.Errorf("JSON解析失败: %v", err)
+	}
+
+	values := []interface{}{document}
+	for _, stage := range splitPipeline(query) {
+		var next []interface{}
+		for _, value := range values {
+			results, err := applyQueryStage(value, stage)
+			if err != nil {
+				return "", err
+			}
+			next = append(next, results...)
+		}
+		values = next
+	}
+
+	var lines []string
+	for i, value := range values {
+		if i == maxQueryResults {
+			lines = append(lines, fmt.Sprintf("...（共 %d 个结果，只显示前 %d 个）", len(values), maxQueryResults))
+			break
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return "", err
+		}
+		lines = append(lines, strings.TrimSuffix(buf.String(), "\n"))
+	}
+	if len(lines) == 0 {
+		return "（没有结果）", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// splitPipeline 按不在引号和方括号中的 | 拆分查询
+func splitPipeline(query string) []string {
+	var stages []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == '[':
+			depth++
+		case !quoted && c == ']':
+			depth--
+		case !quoted && depth == 0 && c == '|':
+			stages = append(stages, strings.TrimSpace(query[start:i]))
+			start = i + 1
+		}
+	}
+	return append(stages, strings.TrimSpace(query[start:]))
+}
+
+// applyQueryStage 对一个值执行管道中的一段，返回所有结果
+func applyQueryStage(value interface{}, stage string) ([]interface{}, error) {
+	switch stage {
+	case "", ".":
+		return []interface{}{value}, nil
+	case "length":
+		switch v := value.(type) {
+		case []interface{}:
+			return []interface{}{len(v)}, nil
+		case map[string]interface{}:
+			return []interface{}{len(v)}, nil
+		case string:
+			return []interface{}{len([]rune(v))}, nil
+		case nil:
+			return []interface{}{0}, nil
+		}
+		return nil, fmt.Errorf("%s 没有长度", jsonType(value))
+	case "keys":
+		switch v := value.(type) {
+		case map[string]interface{}:
+			keys := make([]interface{}, 0, len(v))
+			for _, key := range sortedKeys(v) {
+				keys = append(keys, key)
+			}
+			return []interface{}{keys}, nil
+		case []interface{}:
+			keys := make([]interface{}, len(v))
+			for i := range v {
+				keys[i] = i
+			}
+			return []interface{}{keys}, nil
+		}
+		return nil, fmt.Errorf("%s 没有键", jsonType(value))
+	case "values":
+		items, err := iterate(value)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{items}, nil
+	case "type":
+		return []interface{}{jsonType(value)}, nil
+	case "first", "last":
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s 只能用于数组", stage)
+		}
+		if len(array) == 0 {
+			return []interface{}{nil}, nil
+		}
+		if stage == "first" {
+			return []interface{}{array[0]}, nil
+		}
+		return []interface{}{array[len(array)-1]}, nil
+	}
+	if !strings.HasPrefix(stage, ".") {
+		return nil, fmt.Errorf("不支持的查询: %s", stage)
+	}
+	return applyPath([]interface{}{value}, stage)
+}
+
+// applyPath 执行路径表达式，如 .items[0].name 或 .data[]["key"]
+func applyPath(values []interface{}, path string) ([]interface{}, error) {
+	pos := 0
+	for pos < len(path) {
+		switch c := path[pos]; {
+		case c == '.':
+			pos++
+			// 字段名
+			start := pos
+			for pos < len(path) && isFieldChar(path[pos]) {
+				pos++
+			}
+			if pos == start {
+				continue
+			}
+			name := path[start:pos]
+			var err error
+			if values, err = mapValues(values, func(value interface{}) ([]interface{}, error) { return field(value, name) }); err != nil {
+				return nil, err
+			}
+		case c == '[':
+			end := strings.IndexByte(path[pos:], ']')
+			if strings.HasPrefix(path[pos:], `["`) {
+				// 带引号的字段名中可能包含 ]
+				end = strings.Index(path[pos:], `"]`) + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("缺少 ]: %s", path)
+			}
+			inner := strings.TrimSpace(path[pos+1 : pos+end])
+			pos += end + 1
+			var err error
+			if values, err = mapValues(values, func(value interface{}) ([]interface{}, error) { return subscript(value, inner) }); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("无法解析查询 %s（位置 %d）", path, pos+1)
+		}
+	}
+	return values, nil
+}
+
+// mapValues 对每个值执行函数并合并结果
+func mapValues(values []interface{}, fn func(interface{}) ([]interface{}, error)) ([]interface{}, error) {
+	var results []interface{}
+	for _, value := range values {
+		items, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, items...)
+	}
+	return results, nil
+}
+
+// field 获取对象的字段，null的字段为null
+func field(value interface{}, name string) ([]interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []interface{}{v[name]}, nil
+	case nil:
+		return []interface{}{nil}, nil
+	}
+	return nil, fmt.Errorf("无法在%s上获取字段 %s", jsonType(value), name)
+}
+
+// subscript 执行方括号中的操作：空表示遍历，数字表示数组下标，带引号的字符串表示字段
+func subscript(value interface{}, inner string) ([]interface{}, error) {
+	if inner == "" {
+		return iterate(value)
+	}
+	if strings.HasPrefix(inner, `"`) {
+		name, err := strconv.Unquote(inner)
+		if err != nil {
+			return nil, fmt.Errorf("无效的字段名: %s", inner)
+		}
+		return field(value, name)
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return nil, fmt.Errorf("无效的下标: %s", inner)
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		if index < 0 {
+			index += len(v)
+		}
+		if index < 0 || index >= len(v) {
+			return []interface{}{nil}, nil
+		}
+		return []interface{}{v[index]}, nil
+	case nil:
+		return []interface{}{nil}, nil
+	}
+	return nil, fmt.Errorf("无法在%s上使用下标 %d", jsonType(value), index)
+}
+
+// iterate 遍历数组的元素或对象的值（按键排序）
+func iterate(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case map[string]interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			items = append(items, v[key])
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("无法遍历%s", jsonType(value))
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isFieldChar(c byte) bool {
+	return isLetter(c) || (c >= '0' && c <= '9') || c == '-' || c >= 0x80
+}
+
+// jsonType JSON值的类型名称
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, int:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
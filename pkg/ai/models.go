@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +15,7 @@ import (
 
 	"sshai/pkg/config"
 	"sshai/pkg/i18n"
+	"sshai/pkg/metrics"
 	"sshai/pkg/models"
 )
 
@@ -42,9 +44,11 @@ func GetAvailableModels() ([]ModelInfo, error) {
 		cachedModels := make([]ModelInfo, len(modelCache.models))
 		copy(cachedModels, modelCache.models)
 		modelCache.mutex.RUnlock()
+		metrics.ModelCacheRequests.Inc("hit")
 		return cachedModels, nil
 	}
 	modelCache.mutex.RUnlock()
+	metrics.ModelCacheRequests.Inc("miss")
 
 	// 缓存无效或为空，需要重新获取
 	return fetchAndCacheModels()
@@ -122,7 +126,7 @@ func MatchModelsByUsername(models []ModelInfo, username string) []ModelInfo {
 }
 
 // SelectModelByUsername 根据用户名选择模型
-func SelectModelByUsername(channel ssh.Channel, models []ModelInfo, username string) string {
+func SelectModelByUsername(channel ssh.Channel, models []ModelInfo, username string, lang i18n.Language) string {
 	cfg := config.Get()
 
 	// 尝试根据用户名匹配模型
@@ -131,31 +135,92 @@ func SelectModelByUsername(channel ssh.Channel, models []ModelInfo, username str
 	if len(matchedModels) == 1 {
 		// 找到唯一匹配的模型
 		selectedModel := matchedModels[0].ID
-		channel.Write([]byte(fmt.Sprintf(i18n.T("model.auto_selected", username, selectedModel) + "\r\n")))
+		channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.auto_selected", username, selectedModel) + "\r\n")))
 		return selectedModel
 	} else if len(matchedModels) > 1 {
 		// 找到多个匹配的模型，让用户选择
-		channel.Write([]byte(fmt.Sprintf(i18n.T("model.multiple_matches", username) + "\r\n")))
-		return showModelSelection(channel, matchedModels, username, models)
+		channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.multiple_matches", username) + "\r\n")))
+		return showModelSelection(channel, matchedModels, username, models, lang)
 	} else {
 		// 没有找到匹配的模型
 		if len(models) > 0 {
-			channel.Write([]byte(fmt.Sprintf(i18n.T("model.no_matches", username) + "\r\n")))
-			return showModelSelection(channel, models, username, models)
+			channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.no_matches", username) + "\r\n")))
+			return showModelSelection(channel, models, username, models, lang)
 		} else {
-			channel.Write([]byte(i18n.T("model.no_available") + "\r\n"))
+			channel.Write([]byte(i18n.TL(lang, "model.no_available") + "\r\n"))
 			return cfg.API.DefaultModel
 		}
 	}
 }
 
+// MatchModelsByPattern 根据通配符（如 qwen*）匹配模型，不区分大小写
+func MatchModelsByPattern(models []ModelInfo, pattern string) []ModelInfo {
+	if pattern == "" {
+		return nil
+	}
+
+	var matches []ModelInfo
+	patternLower := strings.ToLower(pattern)
+
+	for _, model := range models {
+		if matched, _ := path.Match(patternLower, strings.ToLower(model.ID)); matched {
+			matches = append(matches, model)
+		}
+	}
+
+	return matches
+}
+
+// SelectModelByPattern 根据公钥指定的模型通配符选择模型，没有匹配的模型时返回空字符串
+func SelectModelByPattern(channel ssh.Channel, models []ModelInfo, pattern string, lang i18n.Language) string {
+	matchedModels := MatchModelsByPattern(models, pattern)
+
+	if len(matchedModels) == 1 {
+		selectedModel := matchedModels[0].ID
+		channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.pattern_selected", pattern, selectedModel) + "\r\n")))
+		return selectedModel
+	} else if len(matchedModels) > 1 {
+		channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.pattern_multiple", pattern) + "\r\n")))
+		return showModelSelection(channel, matchedModels, pattern, models, lang)
+	}
+	return ""
+}
+
+// DefaultModelForPattern 非交互模式下根据模型通配符选择模型：
+// 不含通配符时直接使用，否则使用第一个匹配的可用模型，没有匹配时使用默认模型
+func DefaultModelForPattern(pattern string) string {
+	cfg := config.Get()
+	if pattern == "" {
+		return cfg.API.DefaultModel
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return pattern
+	}
+	models, err := GetAvailableModels()
+	if err == nil {
+		if matches := MatchModelsByPattern(models, pattern); len(matches) > 0 {
+			return matches[0].ID
+		}
+	}
+	return cfg.API.DefaultModel
+}
+
+// SelectModelFromList 让用户从所有可用模型中选择（不根据用户名匹配）
+func SelectModelFromList(channel ssh.Channel, models []ModelInfo, lang i18n.Language) string {
+	if len(models) == 0 {
+		channel.Write([]byte(i18n.TL(lang, "model.no_available") + "\r\n"))
+		return config.Get().API.DefaultModel
+	}
+	return showModelSelection(channel, models, "", models, lang)
+}
+
 // showModelSelection 显示模型选择界面
-func showModelSelection(channel ssh.Channel, models []ModelInfo, username string, allModels []ModelInfo) string {
+func showModelSelection(channel ssh.Channel, models []ModelInfo, username string, allModels []ModelInfo, lang i18n.Language) string {
 	cfg := config.Get()
 
 	if len(models) == 1 {
 		selectedModel := models[0].ID
-		channel.Write([]byte(fmt.Sprintf(i18n.T("model.auto_only", selectedModel) + "\r\n")))
+		channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.auto_only", selectedModel) + "\r\n")))
 		return selectedModel
 	}
 
@@ -163,7 +228,7 @@ func showModelSelection(channel ssh.Channel, models []ModelInfo, username string
 	for i, model := range models {
 		channel.Write([]byte(fmt.Sprintf("%d. %s\r\n", i+1, model.ID)))
 	}
-	channel.Write([]byte(i18n.T("model.select_prompt")))
+	channel.Write([]byte(i18n.TL(lang, "model.select_prompt")))
 
 	// 处理用户输入
 	var inputBuffer []byte
@@ -196,10 +261,10 @@ func showModelSelection(channel ssh.Channel, models []ModelInfo, username string
 					// 解析用户输入的数字
 					if choice, err := strconv.Atoi(input); err == nil && choice >= 1 && choice <= len(models) {
 						selectedModel := models[choice-1].ID
-						channel.Write([]byte(fmt.Sprintf(i18n.T("model.selected", selectedModel) + "\r\n")))
+						channel.Write([]byte(fmt.Sprintf(i18n.TL(lang, "model.selected", selectedModel) + "\r\n")))
 						return selectedModel
 					} else {
-						channel.Write([]byte(i18n.T("model.invalid_choice")))
+						channel.Write([]byte(i18n.TL(lang, "model.invalid_choice")))
 						inputBuffer = nil
 						continue
 					}
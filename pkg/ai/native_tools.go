@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+	"sshai/pkg/metrics"
+)
+
+// NativeServerName 内置工具所属的服务器名称，角色和路由规则的 mcp_servers 中使用该名称允许内置工具
+const NativeServerName = "builtin"
+
+const (
+	defaultNativeToolTimeout = 30 * time.Second
+	maxNativeToolResult      = 32 << 10
+)
+
+// NativeTool 在进程内执行的工具，与MCP工具一起提供给模型，调用时不需要启动子进程
+type NativeTool interface {
+	Name() string
+	Description() string
+	Parameters() map[string]interface{} // 参数的JSON Schema
+	Call(ctx context.Context, arguments map[string]interface{}) (string, error)
+}
+
+// nativeRegistry 已注册的内置工具（按注册顺序）
+var nativeRegistry struct {
+	mutex sync.RWMutex
+	tools []NativeTool
+}
+
+// RegisterNativeTool 注册内置工具，同名工具会被替换
+// 工具实现了 Enabled() bool 时按其返回值决定是否提供给模型，实现了 ServerName() string 时按该名称应用工具策略
+// 实现了 Timeout() time.Duration 时使用该超时时间（默认30秒）
+func RegisterNativeTool(tool NativeTool) {
+	nativeRegistry.mutex.Lock()
+	defer nativeRegistry.mutex.Unlock()
+	for i, existing := range nativeRegistry.tools {
+		if existing.Name() == tool.Name() {
+			nativeRegistry.tools[i] = tool
+			return
+		}
+	}
+	nativeRegistry.tools = append(nativeRegistry.tools, tool)
+}
+
+// NativeTools 当前启用的内置工具
+func NativeTools() []NativeTool {
+	nativeRegistry.mutex.RLock()
+	defer nativeRegistry.mutex.RUnlock()
+	var tools []NativeTool
+	for _, tool := range nativeRegistry.tools {
+		if nativeToolEnabled(tool) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// findNativeTool 查找当前会话可用的内置工具（包括会话工具），不存在时返回nil
+func (c *OpenAIClient) findNativeTool(name string) NativeTool {
+	for _, tool := range c.nativeTools() {
+		if tool.Name() == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// nativeTools 已启用的全局内置工具和会话工具
+func (c *OpenAIClient) nativeTools() []NativeTool {
+	tools := NativeTools()
+	for _, tool := range c.sessionTools {
+		if nativeToolEnabled(tool) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// SetSessionTools 设置只属于当前会话的内置工具（如会话工作区的文件工具）
+func (c *OpenAIClient) SetSessionTools(tools []NativeTool) {
+	c.sessionTools = tools
+	c.refreshSystemPrompt()
+}
+
+// nativeToolServer 内置工具所属的服务器名称，工具实现了 ServerName() string 时使用其返回值
+func nativeToolServer(tool NativeTool) string {
+	if named, ok := tool.(interface{ ServerName() string }); ok {
+		return named.ServerName()
+	}
+	return NativeServerName
+}
+
+// nativeToolTimeout 工具调用的超时时间，工具可以通过 Timeout() 指定（如需要等待用户确认的工具）
+func nativeToolTimeout(tool NativeTool) time.Duration {
+	if limited, ok := tool.(interface{ Timeout() time.Duration }); ok {
+		return limited.Timeout()
+	}
+	return defaultNativeToolTimeout
+}
+
+// nativeToolEnabled 判断工具是否启用：未被 tools.disabled 禁用，且工具自身的开关（如有）已开启
+func nativeToolEnabled(tool NativeTool) bool {
+	for _, name := range config.Get().Tools.Disabled {
+		if strings.EqualFold(name, tool.Name()) {
+			return false
+		}
+	}
+	if switchable, ok := tool.(interface{ Enabled() bool }); ok {
+		return switchable.Enabled()
+	}
+	return true
+}
+
+// nativeOpenAITools 当前角色和工具策略允许使用的内置工具
+func (c *OpenAIClient) nativeOpenAITools() []openai.Tool {
+	var tools []openai.Tool
+	for _, tool := range c.nativeTools() {
+		if !c.allowsMCPServer(nativeToolServer(tool)) {
+			continue
+		}
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name(),
+				Description: tool.Description(),
+				Parameters:  tool.Parameters(),
+			},
+		})
+	}
+	return tools
+}
+
+// callNativeTool 调用内置工具，交互模式下的显示方式与MCP工具相同
+func (c *OpenAIClient) callNativeTool(ctx context.Context, tool NativeTool, arguments map[string]interface{}, channel ssh.Channel, showOutput bool) (string, error) {
+	if channel != nil && showOutput {
+		channel.Write([]byte(fmt.Sprintf("\r\n🔧 %s %s...\r\n", i18n.T("mcp.calling_tool"), tool.Name())))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, nativeToolTimeout(tool))
+	defer cancel()
+
+	server := nativeToolServer(tool)
+	start := time.Now()
+	metrics.ToolCalls.Inc(server)
+	result, err := tool.Call(ctx, arguments)
+	metrics.ObserveSince(metrics.ToolCallDuration, start, server)
+	if err != nil {
+		metrics.ToolCallErrors.Inc(server)
+		log.Printf("内置工具 %s 执行失败: %v", tool.Name(), err)
+		if channel != nil && showOutput {
+			channel.Write([]byte(fmt.Sprintf("❌ %s: %v\r\n", i18n.T("mcp.tool_error"), err)))
+		}
+		return "", err
+	}
+	if len(result) > maxNativeToolResult {
+		result = truncateResult(result, maxNativeToolResult) + "\n...（结果过长，已截断）"
+	}
+
+	if channel != nil && showOutput {
+		channel.Write([]byte(fmt.Sprintf("✅ %s %s\r\n", i18n.T("mcp.tool_success"), tool.Name())))
+		if result != "" {
+			channel.Write([]byte(strings.ReplaceAll(result, "\n", "\r\n") + "\r\n"))
+		}
+		channel.Write([]byte("\r\n"))
+	}
+	return result, nil
+}
+
+// truncateResult 截断结果到不超过n字节，不截断多字节字符
+func truncateResult(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
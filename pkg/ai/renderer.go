@@ -0,0 +1,282 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/i18n"
+	"sshai/pkg/ui"
+)
+
+// Renderer 输出渲染器，位于流式响应处理与SSH通道之间
+// 流式处理只产生事件，由渲染器决定如何写入终端或输出结构化数据
+type Renderer interface {
+	// Reasoning 输出思考内容增量
+	Reasoning(delta string)
+	// Content 输出回答内容增量
+	Content(delta string)
+	// ToolCall 工具调用开始
+	ToolCall(call ToolCallRecord)
+	// ToolResult 工具调用结束（成功或失败）
+	ToolResult(call ToolCallRecord)
+	// Error 输出错误或中断提示
+	Error(message string)
+	// Finish 一次请求处理结束
+	Finish(result *Result)
+	// IncludeUsage 是否需要上游返回token用量
+	IncludeUsage() bool
+}
+
+// ToolCallRecord 工具调用记录
+type ToolCallRecord struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Result    string                 `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	LatencyMs int64                  `json:"latency_ms"`
+}
+
+// Usage token用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Result 一次请求的完整结果
+type Result struct {
+	Model          string           `json:"model"`
+	Content        string           `json:"content"`
+	Reasoning      string           `json:"reasoning,omitempty"`
+	ToolCalls      []ToolCallRecord `json:"tool_calls,omitempty"`
+	Usage          *Usage           `json:"usage,omitempty"`
+	LatencyMs      int64            `json:"latency_ms"`
+	FirstTokenMs   int64            `json:"first_token_ms,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	content        strings.Builder
+	reasoning      strings.Builder
+	startTime      time.Time
+	firstTokenTime time.Time
+}
+
+// newResult 创建新的请求结果
+func newResult(model string) *Result {
+	return &Result{
+		Model:     model,
+		startTime: time.Now(),
+	}
+}
+
+// markToken 记录首个token到达时间
+func (r *Result) markToken() {
+	if r.firstTokenTime.IsZero() {
+		r.firstTokenTime = time.Now()
+		r.FirstTokenMs = r.firstTokenTime.Sub(r.startTime).Milliseconds()
+	}
+}
+
+// addUsage 累加token用量（工具调用后的后续请求会产生多次用量）
+func (r *Result) addUsage(usage *openai.Usage) {
+	if r.Usage == nil {
+		r.Usage = &Usage{}
+	}
+	r.Usage.PromptTokens += usage.PromptTokens
+	r.Usage.CompletionTokens += usage.CompletionTokens
+	r.Usage.TotalTokens += usage.TotalTokens
+}
+
+// finish 汇总内容并计算总耗时
+func (r *Result) finish(err error) {
+	r.Content = r.content.String()
+	r.Reasoning = r.reasoning.String()
+	r.LatencyMs = time.Since(r.startTime).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// TerminalRenderer 终端渲染器，将输出转换为适配SSH终端的文本
+type TerminalRenderer struct {
+	channel           ssh.Channel
+	isThinking        bool
+	thinkingStartTime time.Time
+	markdown          *ui.MarkdownStream // 非nil时将回答内容按Markdown渲染
+	language          i18n.Language      // 提示文字的语言，空表示使用当前语言
+}
+
+// NewTerminalRenderer 创建终端渲染器
+func NewTerminalRenderer(channel ssh.Channel) *TerminalRenderer {
+	return &TerminalRenderer{channel: channel}
+}
+
+// NewMarkdownTerminalRenderer 创建将回答内容渲染为ANSI格式的终端渲染器
+func NewMarkdownTerminalRenderer(channel ssh.Channel, width int) *TerminalRenderer {
+	return &TerminalRenderer{
+		channel:  channel,
+		markdown: ui.NewMarkdownStream(width),
+	}
+}
+
+// SetLanguage 设置提示文字（如思考过程标题）的语言
+func (r *TerminalRenderer) SetLanguage(language i18n.Language) {
+	r.language = language
+}
+
+// write 将\n转换为\r\n后写入终端
+func (r *TerminalRenderer) write(text string) {
+	if text != "" {
+		r.channel.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	}
+}
+
+// flushMarkdown 输出Markdown渲染器中缓存的内容
+func (r *TerminalRenderer) flushMarkdown() {
+	if r.markdown != nil {
+		r.write(r.markdown.Flush())
+	}
+}
+
+// Reasoning 输出思考内容
+func (r *TerminalRenderer) Reasoning(delta string) {
+	if !r.isThinking {
+		r.isThinking = true
+		r.thinkingStartTime = time.Now()
+		r.channel.Write([]byte(i18n.TL(r.language, "ai.thinking_process") + "\r\n"))
+	}
+	r.write(delta)
+}
+
+// Content 输出回答内容
+func (r *TerminalRenderer) Content(delta string) {
+	if r.isThinking {
+		thinkingDuration := time.Since(r.thinkingStartTime)
+		r.channel.Write([]byte(fmt.Sprintf("\r\n%s\r\n\n", i18n.TL(r.language, "ai.thinking_complete", thinkingDuration.Seconds()))))
+		r.channel.Write([]byte(i18n.TL(r.language, "ai.response") + "\r\n"))
+		r.isThinking = false
+	}
+	if r.markdown != nil {
+		r.write(r.markdown.Write(delta))
+		return
+	}
+	r.write(delta)
+}
+
+// ToolCall 工具调用信息由MCP管理器根据showToolOutput直接输出，这里只需先输出缓存的内容
+func (r *TerminalRenderer) ToolCall(call ToolCallRecord) {
+	r.flushMarkdown()
+}
+
+// ToolResult 工具结果由MCP管理器根据showToolOutput直接输出
+func (r *TerminalRenderer) ToolResult(call ToolCallRecord) {}
+
+// Error 错误信息输出到stderr
+func (r *TerminalRenderer) Error(message string) {
+	r.flushMarkdown()
+	r.channel.Stderr().Write([]byte(strings.ReplaceAll(message, "\n", "\r\n")))
+}
+
+// Finish 成功结束时输出换行
+func (r *TerminalRenderer) Finish(result *Result) {
+	r.flushMarkdown()
+	r.isThinking = false
+	if result.Error == "" {
+		r.channel.Write([]byte("\r\n"))
+	}
+}
+
+// IncludeUsage 终端模式不需要token用量
+func (r *TerminalRenderer) IncludeUsage() bool {
+	return false
+}
+
+// JSONRenderer 结构化输出渲染器
+// streaming为false时在结束时输出一个完整的JSON对象；为true时每个增量输出一行JSON事件（NDJSON）
+type JSONRenderer struct {
+	channel   ssh.Channel
+	streaming bool
+	mutex     sync.Mutex
+}
+
+// NewJSONRenderer 创建JSON渲染器
+func NewJSONRenderer(channel ssh.Channel, streaming bool) *JSONRenderer {
+	return &JSONRenderer{
+		channel:   channel,
+		streaming: streaming,
+	}
+}
+
+// jsonEvent NDJSON事件
+type jsonEvent struct {
+	Type    string          `json:"type"`
+	Delta   string          `json:"delta,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Tool    *ToolCallRecord `json:"tool,omitempty"`
+	Result  *Result         `json:"result,omitempty"`
+}
+
+// emit 输出一行JSON
+func (r *JSONRenderer) emit(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.channel.Write(append(data, '\n'))
+}
+
+// Reasoning 输出思考内容增量事件
+func (r *JSONRenderer) Reasoning(delta string) {
+	if r.streaming {
+		r.emit(jsonEvent{Type: "reasoning", Delta: delta})
+	}
+}
+
+// Content 输出回答内容增量事件
+func (r *JSONRenderer) Content(delta string) {
+	if r.streaming {
+		r.emit(jsonEvent{Type: "content", Delta: delta})
+	}
+}
+
+// ToolCall 输出工具调用事件
+func (r *JSONRenderer) ToolCall(call ToolCallRecord) {
+	if r.streaming {
+		r.emit(jsonEvent{Type: "tool_call", Tool: &call})
+	}
+}
+
+// ToolResult 输出工具结果事件
+func (r *JSONRenderer) ToolResult(call ToolCallRecord) {
+	if r.streaming {
+		r.emit(jsonEvent{Type: "tool_result", Tool: &call})
+	}
+}
+
+// Error 输出错误事件，非流式模式下错误包含在最终结果中
+func (r *JSONRenderer) Error(message string) {
+	if r.streaming {
+		r.emit(jsonEvent{Type: "error", Message: strings.TrimSpace(message)})
+	}
+}
+
+// Finish 输出最终结果
+func (r *JSONRenderer) Finish(result *Result) {
+	if r.streaming {
+		r.emit(jsonEvent{Type: "done", Result: result})
+		return
+	}
+	r.emit(result)
+}
+
+// IncludeUsage 结构化输出需要token用量
+func (r *JSONRenderer) IncludeUsage() bool {
+	return true
+}
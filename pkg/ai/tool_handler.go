@@ -3,26 +3,29 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"golang.org/x/crypto/ssh"
 
-	"sshai/pkg/config"
 	"sshai/pkg/mcp"
 )
 
 // handleToolCall 处理工具调用
-func (c *OpenAIClient) handleToolCall(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder) {
-	c.handleToolCallWithOptions(ctx, toolCall, channel, assistantMessage, true)
+func (c *OpenAIClient) handleToolCall(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder) error {
+	return c.handleToolCallWithOptions(ctx, toolCall, channel, assistantMessage, true)
 }
 
 // handleToolCallWithOptions 处理工具调用（可选是否显示输出）
-func (c *OpenAIClient) handleToolCallWithOptions(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder, showOutput bool) {
+// 工具调用失败会作为结果返回给模型，只有工具执行后继续对话失败或被中断时返回错误（*RequestError）
+func (c *OpenAIClient) handleToolCallWithOptions(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder, showOutput bool) error {
 	if toolCall.Function.Name == "" {
-		return
+		return nil
 	}
 
 	// 调试信息：输出原始工具调用信息
@@ -43,7 +46,12 @@ func (c *OpenAIClient) handleToolCallWithOptions(ctx context.Context, toolCall o
 		log.Printf("工具参数为空，使用空参数对象")
 	} else {
 		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); err != nil {
-			channel.Write([]byte(fmt.Sprintf("\r\n❌ 解析工具参数失败: %v\r\n原始参数: %s\r\n", err, toolCall.Function.Arguments)))
+			c.renderer.Error(fmt.Sprintf("\n❌ 解析工具参数失败: %v\n原始参数: %s\n", err, toolCall.Function.Arguments))
+			c.recordToolCall(ToolCallRecord{
+				ID:    toolCall.ID,
+				Name:  toolCall.Function.Name,
+				Error: fmt.Sprintf("工具参数解析失败: %v", err),
+			})
 			
 			// 将错误信息添加到对话上下文
 			c.messages = append(c.messages, openai.ChatCompletionMessage{
@@ -51,32 +59,54 @@ func (c *OpenAIClient) handleToolCallWithOptions(ctx context.Context, toolCall o
 				Content:    fmt.Sprintf("工具参数解析失败: %v", err),
 				ToolCallID: toolCall.ID,
 			})
-			return
+			return nil
 		}
 	}
 
 	log.Printf("解析后的工具参数: %+v", arguments)
 
-	// 获取MCP管理器
-	mcpManager := mcp.GetGlobalManager()
-	if mcpManager == nil {
-		channel.Write([]byte("\r\n❌ MCP管理器未初始化\r\n"))
-		
-		// 将错误信息添加到对话上下文
-		c.messages = append(c.messages, openai.ChatCompletionMessage{
-			Role:       openai.ChatMessageRoleTool,
-			Content:    "MCP管理器未初始化",
-			ToolCallID: toolCall.ID,
-		})
-		return
+	record := ToolCallRecord{
+		ID:        toolCall.ID,
+		Name:      toolCall.Function.Name,
+		Arguments: arguments,
 	}
+	c.renderer.ToolCall(record)
+	startTime := time.Now()
+
+	var result string
+	var err error
+	if tool := c.findNativeTool(toolCall.Function.Name); tool != nil {
+		// 内置工具在进程内执行
+		if !c.allowsMCPServer(nativeToolServer(tool)) {
+			c.rejectToolCall(toolCall.ID, record, fmt.Sprintf("当前会话不允许使用工具 %s", toolCall.Function.Name))
+			return nil
+		}
+		log.Printf("开始调用内置工具: %s, 参数: %+v", toolCall.Function.Name, arguments)
+		result, err = c.callNativeTool(ctx, tool, arguments, channel, showOutput)
+	} else {
+		// 获取MCP管理器
+		mcpManager := mcp.GetGlobalManager()
+		if mcpManager == nil {
+			c.rejectToolCall(toolCall.ID, record, "MCP管理器未初始化")
+			return nil
+		}
+
+		// 当前角色或工具策略不允许使用的工具（模型可能调用未提供给它的工具）
+		if !c.toolAllowed(mcpManager, toolCall.Function.Name) {
+			c.rejectToolCall(toolCall.ID, record, fmt.Sprintf("当前会话不允许使用工具 %s", toolCall.Function.Name))
+			return nil
+		}
 
-	// 调用MCP工具
-	log.Printf("开始调用MCP工具: %s, 参数: %+v", toolCall.Function.Name, arguments)
-	result, err := mcpManager.CallToolWithOptions(toolCall.Function.Name, arguments, channel, showOutput)
+		// 调用MCP工具
+		log.Printf("开始调用MCP工具: %s, 参数: %+v", toolCall.Function.Name, arguments)
+		result, err = mcpManager.CallToolWithOptions(toolCall.Function.Name, arguments, channel, showOutput)
+	}
 	if err != nil {
-		log.Printf("MCP工具调用失败: %v", err)
-		channel.Write([]byte(fmt.Sprintf("\r\n❌ 工具调用失败: %v\r\n", err)))
+		log.Printf("工具调用失败: %v", err)
+		c.renderer.Error(fmt.Sprintf("\n❌ 工具调用失败: %v\n", err))
+		record.Error = err.Error()
+		record.LatencyMs = time.Since(startTime).Milliseconds()
+		c.recordToolCall(record)
 		
 		// 将错误信息添加到对话上下文
 		c.messages = append(c.messages, openai.ChatCompletionMessage{
@@ -84,10 +114,14 @@ func (c *OpenAIClient) handleToolCallWithOptions(ctx context.Context, toolCall o
 			Content:    fmt.Sprintf("工具调用失败: %v", err),
 			ToolCallID: toolCall.ID,
 		})
-		return
+		return nil
 	}
 
-	log.Printf("MCP工具调用成功: %s, 结果长度: %d", toolCall.Function.Name, len(result))
+	log.Printf("工具调用成功: %s, 结果长度: %d", toolCall.Function.Name, len(result))
+	record.Result = result
+	record.LatencyMs = time.Since(startTime).Milliseconds()
+	c.recordToolCall(record)
+
 	// 工具调用成功，将实际结果添加到对话上下文
 	c.messages = append(c.messages, openai.ChatCompletionMessage{
 		Role:       openai.ChatMessageRoleTool,
@@ -100,30 +134,36 @@ func (c *OpenAIClient) handleToolCallWithOptions(ctx context.Context, toolCall o
 	assistantMessage.WriteString(toolCallInfo)
 	
 	// 工具执行完成后，需要继续对话让AI根据工具结果生成回复
-	c.continueConversationAfterTool(ctx, channel, assistantMessage)
+	return c.continueConversationAfterTool(ctx, channel, assistantMessage)
 }
 
 // continueConversationAfterTool 工具执行后继续对话
-func (c *OpenAIClient) continueConversationAfterTool(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder) {
+// 请求失败或被中断时返回分类后的 *RequestError，与首次请求的错误一样决定退出码
+func (c *OpenAIClient) continueConversationAfterTool(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder) error {
 	log.Printf("工具执行完成，继续对话...")
 	
-	cfg := config.Get()
-	
 	// 创建新的聊天完成请求，让AI根据工具结果继续回复
 	req := openai.ChatCompletionRequest{
-		Model:       cfg.API.DefaultModel,
+		Model:       c.currentModel,
 		Messages:    c.messages,
 		MaxTokens:   4000, // 使用默认值
-		Temperature: float32(cfg.API.Temperature),
+		Temperature: float32(c.temperature()),
 		Stream:      true,
 	}
+	if c.renderer.IncludeUsage() {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
 
 	// 发起新的流式请求
 	stream, err := c.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		log.Printf("创建工具后续对话流失败: %v", err)
-		channel.Write([]byte(fmt.Sprintf("\r\n❌ 继续对话失败: %v\r\n", err)))
-		return
+		if ctx.Err() == context.Canceled {
+			c.renderer.Error("\n[已中断]\n")
+			return ErrInterrupted
+		}
+		c.renderer.Error(fmt.Sprintf("\n❌ 继续对话失败: %v\n", err))
+		return classifyError(ctx, err)
 	}
 	defer stream.Close()
 
@@ -131,11 +171,21 @@ func (c *OpenAIClient) continueConversationAfterTool(ctx context.Context, channe
 	for {
 		response, err := stream.Recv()
 		if err != nil {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) {
 				break
 			}
 			log.Printf("接收工具后续对话流响应失败: %v", err)
-			break
+			if ctx.Err() == context.Canceled {
+				c.renderer.Error("\n[已中断]\n")
+				return ErrInterrupted
+			}
+			c.renderer.Error(fmt.Sprintf("\n流式响应错误: %v\n", err))
+			return classifyError(ctx, err)
+		}
+
+		// 累加后续请求的token用量
+		if response.Usage != nil {
+			c.result.addUsage(response.Usage)
 		}
 
 		if len(response.Choices) > 0 {
@@ -144,9 +194,7 @@ func (c *OpenAIClient) continueConversationAfterTool(ctx context.Context, channe
 			// 输出AI的后续回复
 			if delta.Content != "" {
 				assistantMessage.WriteString(delta.Content)
-				// 将\n转换为\r\n以适配SSH终端
-				formattedContent := strings.ReplaceAll(delta.Content, "\n", "\r\n")
-				channel.Write([]byte(formattedContent))
+				c.emitContent(delta.Content)
 			}
 			
 			// 检查是否完成
@@ -165,4 +213,24 @@ func (c *OpenAIClient) continueConversationAfterTool(ctx context.Context, channe
 	}
 	
 	log.Printf("工具后续对话完成")
-}
\ No newline at end of file
+	return nil
+}
+
+// rejectToolCall 拒绝执行工具调用，将原因记录并添加到对话上下文
+func (c *OpenAIClient) rejectToolCall(toolCallID string, record ToolCallRecord, message string) {
+	c.renderer.Error(fmt.Sprintf("\n❌ %s\n", message))
+	record.Error = message
+	c.recordToolCall(record)
+
+	c.messages = append(c.messages, openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Content:    message,
+		ToolCallID: toolCallID,
+	})
+}
+
+// recordToolCall 记录工具调用结果并通知渲染器
+func (c *OpenAIClient) recordToolCall(record ToolCallRecord) {
+	c.result.ToolCalls = append(c.result.ToolCalls, record)
+	c.renderer.ToolResult(record)
+}
@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+// discardChannel 丢弃写入内容的ssh.Channel
+type discardChannel struct{ ssh.Channel }
+
+func (discardChannel) Write(data []byte) (int, error) { return len(data), nil }
+
+// TestToolFollowUpError 工具执行后继续对话失败时返回分类后的错误，而不是当作成功
+func TestToolFollowUpError(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"rate limited","type":"rate_limit_error"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"id":"1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"calculate","arguments":"{\"expression\":\"1+1\"}"}}]}}]}`,
+			`{"id":"1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.Get()
+	savedAPI, savedTools := cfg.API, cfg.Tools
+	t.Cleanup(func() { cfg.API, cfg.Tools = savedAPI, savedTools })
+	cfg.API.BaseURL = server.URL + "/v1"
+	cfg.API.APIKey = "test"
+	cfg.API.DefaultModel = "m"
+	cfg.API.Timeout = 10
+	cfg.Tools.Builtin = true
+
+	channel := discardChannel{}
+	client := NewOpenAIClient("alice")
+	result, err := client.ProcessMessageWithRenderer("1+1", channel, NewJSONRenderer(channel, false), make(chan bool), false)
+	if KindOf(err) != ErrorKindQuota {
+		t.Fatalf("follow-up failure should be reported as a quota error, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 2 || len(result.ToolCalls) != 1 || !strings.Contains(result.ToolCalls[0].Result, "2") {
+		t.Errorf("tool should run before the follow-up request: %d requests, %+v", requests, result.ToolCalls)
+	}
+}
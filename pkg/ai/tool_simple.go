@@ -18,25 +18,25 @@ type SimpleToolCallBuffer struct {
 }
 
 // processToolCallSimple 简化的工具调用处理
-func (c *OpenAIClient) processToolCallSimple(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder) {
-	c.processToolCallSimpleWithOptions(ctx, toolCall, channel, assistantMessage, true)
+func (c *OpenAIClient) processToolCallSimple(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder) error {
+	return c.processToolCallSimpleWithOptions(ctx, toolCall, channel, assistantMessage, true)
 }
 
-// processToolCallSimpleWithOptions 简化的工具调用处理（可选是否显示输出）
-func (c *OpenAIClient) processToolCallSimpleWithOptions(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder, showOutput bool) {
+// processToolCallSimpleWithOptions 简化的工具调用处理（可选是否显示输出），返回工具执行后继续对话的错误
+func (c *OpenAIClient) processToolCallSimpleWithOptions(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder, showOutput bool) error {
 	// 如果这是一个完整的工具调用（有名称和参数），直接处理
 	if toolCall.Function.Name != "" && toolCall.Function.Arguments != "" {
 		// 检查参数是否是有效的JSON
 		var temp interface{}
 		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &temp); err == nil {
 			log.Printf("检测到完整的工具调用: %s, 参数: %s", toolCall.Function.Name, toolCall.Function.Arguments)
-			c.handleToolCallWithOptions(ctx, toolCall, channel, assistantMessage, showOutput)
-			return
+			return c.handleToolCallWithOptions(ctx, toolCall, channel, assistantMessage, showOutput)
 		}
 	}
 
 	// 否则，累积到缓冲区
 	c.accumulateToolCall(toolCall)
+	return nil
 }
 
 // accumulateToolCall 累积工具调用信息
@@ -75,14 +75,15 @@ func (c *OpenAIClient) accumulateToolCall(toolCall openai.ToolCall) {
 }
 
 // processAllPendingToolCalls 处理所有待处理的工具调用
-func (c *OpenAIClient) processAllPendingToolCalls(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder) {
-	c.processAllPendingToolCallsWithOptions(ctx, channel, assistantMessage, true)
+func (c *OpenAIClient) processAllPendingToolCalls(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder) error {
+	return c.processAllPendingToolCallsWithOptions(ctx, channel, assistantMessage, true)
 }
 
 // processAllPendingToolCallsWithOptions 处理所有待处理的工具调用（可选是否显示输出）
-func (c *OpenAIClient) processAllPendingToolCallsWithOptions(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder, showOutput bool) {
+// 工具执行后继续对话失败时丢弃剩余的工具调用并返回错误
+func (c *OpenAIClient) processAllPendingToolCallsWithOptions(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder, showOutput bool) error {
 	if c.pendingToolCalls == nil {
-		return
+		return nil
 	}
 
 	// 首先尝试智能合并工具调用
@@ -104,12 +105,16 @@ func (c *OpenAIClient) processAllPendingToolCallsWithOptions(ctx context.Context
 				},
 			}
 
-			c.handleToolCallWithOptions(ctx, finalTool, channel, assistantMessage, showOutput)
+			if err := c.handleToolCallWithOptions(ctx, finalTool, channel, assistantMessage, showOutput); err != nil {
+				c.pendingToolCalls = make(map[string]*openai.ToolCall)
+				return err
+			}
 		}
 
 		// 清理
 		delete(c.pendingToolCalls, id)
 	}
+	return nil
 }
 
 // mergeToolCalls 智能合并工具调用
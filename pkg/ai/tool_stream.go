@@ -11,8 +11,8 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// processToolCallDelta 处理流式响应中的工具调用增量
-func (c *OpenAIClient) processToolCallDelta(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder) {
+// processToolCallDelta 处理流式响应中的工具调用增量，返回工具执行后继续对话的错误
+func (c *OpenAIClient) processToolCallDelta(ctx context.Context, toolCall openai.ToolCall, channel ssh.Channel, assistantMessage *strings.Builder) error {
 	// 处理可能的ID为空的情况，使用索引作为临时ID
 	toolID := toolCall.ID
 	if toolID == "" {
@@ -74,10 +74,12 @@ func (c *OpenAIClient) processToolCallDelta(ctx context.Context, toolCall openai
 		}
 		
 		log.Printf("副本工具调用参数: %s", completeTool.Function.Arguments)
-		c.handleToolCall(ctx, completeTool, channel, assistantMessage)
+		err := c.handleToolCall(ctx, completeTool, channel, assistantMessage)
 		// 清理已处理的工具调用
 		delete(c.pendingToolCalls, toolID)
+		return err
 	}
+	return nil
 }
 
 // isToolCallComplete 检查工具调用是否完整
@@ -107,8 +109,8 @@ func (c *OpenAIClient) isToolCallComplete(toolCall *openai.ToolCall) bool {
 	return true
 }
 
-// finalizePendingToolCalls 在流结束时处理所有待处理的工具调用
-func (c *OpenAIClient) finalizePendingToolCalls(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder) {
+// finalizePendingToolCalls 在流结束时处理所有待处理的工具调用，返回工具执行后继续对话的错误
+func (c *OpenAIClient) finalizePendingToolCalls(ctx context.Context, channel ssh.Channel, assistantMessage *strings.Builder) error {
 	for id, toolCall := range c.pendingToolCalls {
 		log.Printf("处理未完成的工具调用: %s (ID: %s)", toolCall.Function.Name, id)
 		log.Printf("最终工具调用参数: %s (长度: %d)", toolCall.Function.Arguments, len(toolCall.Function.Arguments))
@@ -124,10 +126,14 @@ func (c *OpenAIClient) finalizePendingToolCalls(ctx context.Context, channel ssh
 					Arguments: toolCall.Function.Arguments,
 				},
 			}
-			c.handleToolCall(ctx, completeTool, channel, assistantMessage)
+			if err := c.handleToolCall(ctx, completeTool, channel, assistantMessage); err != nil {
+				c.pendingToolCalls = make(map[string]*openai.ToolCall)
+				return err
+			}
 		}
 		
 		// 清理
 		delete(c.pendingToolCalls, id)
 	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"sshai/pkg/config"
+)
+
+// 审计事件类型
+const (
+	EventSessionStart = "session_start"  // SSH连接建立
+	EventSessionEnd   = "session_end"    // SSH连接断开
+	EventRequest      = "request"        // 一次AI请求（包括其中的工具调用）
+	EventRemote       = "remote_command" // 在远程主机上执行的命令
+)
+
+// Identity 审计记录中的会话身份信息
+type Identity struct {
+	SessionID  int    `json:"session_id"`
+	User       string `json:"user"`
+	RemoteAddr string `json:"remote_addr"`
+	Mode       string `json:"mode,omitempty"` // interactive, exec, stdin
+}
+
+// ToolCall 审计记录中的工具调用
+type ToolCall struct {
+	Name            string                 `json:"name"`
+	Arguments       map[string]interface{} `json:"arguments,omitempty"`
+	ArgumentsSHA256 string                 `json:"arguments_sha256,omitempty"` // 隐私模式下代替参数
+	Success         bool                   `json:"success"`
+	Error           string                 `json:"error,omitempty"`
+	ResultLength    int                    `json:"result_length"`
+	DurationMs      int64                  `json:"duration_ms"`
+}
+
+// RemoteCommand 审计记录中在远程主机上执行的命令
+type RemoteCommand struct {
+	Host          string `json:"host"`
+	Command       string `json:"command,omitempty"`
+	CommandSHA256 string `json:"command_sha256,omitempty"` // 隐私模式下代替命令
+	Approval      string `json:"approval"`                 // readonly, approved, denied, rejected
+	ExitCode      *int   `json:"exit_code,omitempty"`
+	OutputLength  int    `json:"output_length,omitempty"`
+}
+
+// Record 一条审计记录，写入为一行JSON
+type Record struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Identity
+	Model          string         `json:"model,omitempty"`
+	Prompt         string         `json:"prompt,omitempty"`
+	PromptSHA256   string         `json:"prompt_sha256,omitempty"`
+	PromptLength   int            `json:"prompt_length,omitempty"`
+	ResponseLength int            `json:"response_length,omitempty"`
+	ToolCalls      []ToolCall     `json:"tool_calls,omitempty"`
+	Remote         *RemoteCommand `json:"remote,omitempty"`
+	StartTime      *time.Time     `json:"start_time,omitempty"`
+	DurationMs     int64          `json:"duration_ms,omitempty"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// Logger 审计日志记录器
+type Logger struct {
+	mutex    sync.Mutex
+	file     *rotatingFile
+	redactor *redactor
+	privacy  bool
+	failed   bool // 已经报告过写入失败，避免刷屏
+}
+
+// NewLogger 根据配置创建审计日志记录器
+func NewLogger() (*Logger, error) {
+	cfg := config.Get().Audit
+
+	path := cfg.File
+	if path == "" {
+		path = "audit/audit.jsonl"
+	}
+	maxSize := int64(cfg.MaxSizeMB) * 1024 * 1024
+	if cfg.MaxSizeMB == 0 {
+		maxSize = 100 * 1024 * 1024
+	}
+	file, err := openRotatingFile(path, maxSize, time.Duration(cfg.RotateHours)*time.Hour, cfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logger{
+		file:     file,
+		redactor: newRedactor(cfg.RedactPatterns),
+		privacy:  cfg.PrivacyMode,
+	}, nil
+}
+
+// Log 写入一条审计记录，按配置脱敏，隐私模式下用哈希和长度代替原文
+func (l *Logger) Log(record Record) {
+	if l == nil {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	l.sanitize(&record)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("序列化审计记录失败: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.file.Write(data); err != nil {
+		if !l.failed {
+			log.Printf("写入审计日志失败: %v", err)
+			l.failed = true
+		}
+		return
+	}
+	l.failed = false
+}
+
+// Close 关闭审计日志文件
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// sanitize 处理记录中的提示词和工具参数
+func (l *Logger) sanitize(record *Record) {
+	if record.Prompt != "" {
+		record.PromptLength = len([]rune(record.Prompt))
+		if l.privacy {
+			record.PromptSHA256 = hashString(record.Prompt)
+			record.Prompt = ""
+		} else {
+			record.Prompt = l.redactor.redact(record.Prompt)
+		}
+	}
+	record.Error = l.redactor.redact(record.Error)
+	if record.Remote != nil && record.Remote.Command != "" {
+		remote := *record.Remote
+		if l.privacy {
+			remote.CommandSHA256 = hashString(remote.Command)
+			remote.Command = ""
+		} else {
+			remote.Command = l.redactor.redact(remote.Command)
+		}
+		record.Remote = &remote
+	}
+
+	for i := range record.ToolCalls {
+		call := &record.ToolCalls[i]
+		call.Error = l.redactor.redact(call.Error)
+		if call.Arguments == nil {
+			continue
+		}
+		if l.privacy {
+			data, _ := json.Marshal(call.Arguments)
+			call.ArgumentsSHA256 = hashString(string(data))
+			call.Arguments = nil
+			continue
+		}
+		call.Arguments = l.redactor.redactValue(call.Arguments).(map[string]interface{})
+	}
+}
+
+// hashString 计算文本的SHA-256十六进制摘要
+func hashString(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// 全局审计日志记录器，未启用时为nil（所有方法都是空操作）
+var (
+	globalLogger *Logger
+	globalMutex  sync.RWMutex
+)
+
+// Init 根据配置初始化全局审计日志
+func Init() error {
+	if !config.Get().Audit.Enabled {
+		return nil
+	}
+	logger, err := NewLogger()
+	if err != nil {
+		return fmt.Errorf("初始化审计日志失败: %v", err)
+	}
+
+	globalMutex.Lock()
+	defer globalMutex.Unlock()
+	globalLogger = logger
+	return nil
+}
+
+// Enabled 是否启用了审计日志
+func Enabled() bool {
+	globalMutex.RLock()
+	defer globalMutex.RUnlock()
+	return globalLogger != nil
+}
+
+// Log 写入一条审计记录，未启用审计日志时忽略
+func Log(record Record) {
+	globalMutex.RLock()
+	defer globalMutex.RUnlock()
+	globalLogger.Log(record)
+}
+
+// Close 关闭全局审计日志
+func Close() {
+	globalMutex.Lock()
+	defer globalMutex.Unlock()
+	if err := globalLogger.Close(); err != nil {
+		log.Printf("关闭审计日志失败: %v", err)
+	}
+	globalLogger = nil
+}
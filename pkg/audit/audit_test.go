@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRecords 读取日志文件中的所有记录
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggerRedactionAndPrivacy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	file, err := openRotatingFile(path, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &Logger{file: file, redactor: newRedactor([]string{`sk-[a-z0-9]{8,}`, `[invalid`})}
+
+	args := map[string]interface{}{"query": "key sk-abcdef123456", "nested": []interface{}{"sk-zzzzzzzzzz", 3.0}}
+	logger.Log(Record{
+		Event:     EventRequest,
+		Identity:  Identity{SessionID: 7, User: "alice", RemoteAddr: "10.0.0.1:2222", Mode: "exec"},
+		Model:     "gpt-4",
+		Prompt:    "my key is sk-abcdef123456",
+		ToolCalls: []ToolCall{{Name: "search", Arguments: args, Success: true, ResultLength: 12}},
+	})
+	remote := &RemoteCommand{Host: "web1", Command: "curl -H 'Authorization: sk-abcdef123456' localhost", Approval: "approved"}
+	logger.Log(Record{Event: EventRemote, Remote: remote})
+
+	logger.privacy = true
+	logger.Log(Record{Event: EventRequest, Prompt: "秘密问题", ToolCalls: []ToolCall{{Name: "search", Arguments: args}}})
+	logger.Log(Record{Event: EventRemote, Remote: remote})
+	logger.Close()
+
+	records := readRecords(t, path)
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+	if got := records[1].Remote; got == nil || got.Command != "curl -H 'Authorization: [REDACTED]' localhost" || got.Host != "web1" {
+		t.Errorf("remote command not redacted: %+v", got)
+	}
+	if got := records[3].Remote; got == nil || got.Command != "" || len(got.CommandSHA256) != 64 {
+		t.Errorf("privacy mode should hash remote commands: %+v", got)
+	}
+	if remote.Command == "" || remote.CommandSHA256 != "" {
+		t.Error("sanitizing must not modify the caller's remote command")
+	}
+
+	first := records[0]
+	if first.SessionID != 7 || first.User != "alice" || first.Mode != "exec" || first.Time.IsZero() {
+		t.Errorf("identity not recorded: %+v", first)
+	}
+	if first.Prompt != "my key is [REDACTED]" || first.PromptLength != 25 {
+		t.Errorf("prompt not redacted: %q (%d)", first.Prompt, first.PromptLength)
+	}
+	if got := first.ToolCalls[0].Arguments["query"]; got != "key [REDACTED]" {
+		t.Errorf("tool argument not redacted: %v", got)
+	}
+	if got := first.ToolCalls[0].Arguments["nested"].([]interface{})[0]; got != "[REDACTED]" {
+		t.Errorf("nested tool argument not redacted: %v", got)
+	}
+	if args["query"] != "key sk-abcdef123456" {
+		t.Error("redaction must not modify the caller's arguments")
+	}
+
+	second := records[2]
+	if second.Prompt != "" || second.PromptLength != 4 || len(second.PromptSHA256) != 64 {
+		t.Errorf("privacy mode should keep only hash and length: %+v", second)
+	}
+	if call := second.ToolCalls[0]; call.Arguments != nil || len(call.ArgumentsSHA256) != 64 {
+		t.Errorf("privacy mode should hash tool arguments: %+v", call)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	file, err := openRotatingFile(path, 20, 24*time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.now = func() time.Time { return now }
+	file.period = file.periodOf(now)
+
+	line := []byte("0123456789abcdef\n") // 17字节
+	write := func() {
+		t.Helper()
+		if err := file.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write()
+	write() // 超过大小，轮转
+	now = now.Add(time.Minute)
+	write() // 超过大小，轮转
+	now = now.Add(24 * time.Hour)
+	file.maxSize = 0
+	write() // 跨越一天，轮转
+	write()
+	file.Close()
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if len(backups) != 2 {
+		t.Fatalf("got backups %v, want 2 (oldest pruned)", backups)
+	}
+	if filepath.Base(backups[0]) != "audit-20250101T100100Z.jsonl" || filepath.Base(backups[1]) != "audit-20250102T100100Z.jsonl" {
+		t.Errorf("unexpected backups %v", backups)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "\n") != 2 {
+		t.Errorf("current file should hold 2 lines, got %q", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log permissions %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"log"
+	"regexp"
+)
+
+// redactedText 替换敏感内容的文本
+const redactedText = "[REDACTED]"
+
+// redactor 按正则替换敏感内容
+type redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// newRedactor 编译脱敏规则，无效的正则记录日志后跳过
+func newRedactor(patterns []string) *redactor {
+	r := &redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("忽略无效的审计脱敏规则 %q: %v", pattern, err)
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r
+}
+
+// redact 替换文本中所有匹配的内容
+func (r *redactor) redact(text string) string {
+	if text == "" {
+		return text
+	}
+	for _, re := range r.patterns {
+		text = re.ReplaceAllString(text, redactedText)
+	}
+	return text
+}
+
+// redactValue 递归替换JSON值中的字符串，返回新的值，不修改原值
+func (r *redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.redact(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = r.redactValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = r.redactValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotatingFile 只追加写入的日志文件，超过大小或跨越时间周期时轮转
+// 轮转后的文件命名为 <名称>-<UTC时间>.<扩展名>，例如 audit-20250101T000000Z.jsonl
+type rotatingFile struct {
+	path       string
+	maxSize    int64         // 单个文件的最大字节数，0表示不限制
+	interval   time.Duration // 按UTC时间对齐的轮转周期，0表示不按时间轮转
+	maxBackups int           // 保留的历史文件数，0表示全部保留
+
+	file   *os.File
+	size   int64
+	period time.Time // 当前文件所属的时间周期
+	now    func() time.Time
+}
+
+// openRotatingFile 打开（或创建）日志文件
+func openRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("创建审计日志目录失败: %v", err)
+	}
+
+	// 已有文件属于上一次写入时的周期，跨越周期时先轮转
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		if f.interval > 0 && !f.periodOf(info.ModTime()).Equal(f.periodOf(f.now())) {
+			if err := f.rename(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// periodOf 获取时间所属的周期起点
+func (f *rotatingFile) periodOf(t time.Time) time.Time {
+	if f.interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(f.interval)
+}
+
+// open 以追加方式打开日志文件
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取审计日志信息失败: %v", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.period = f.periodOf(f.now())
+	return nil
+}
+
+// Write 写入一条完整的记录，必要时先轮转
+func (f *rotatingFile) Write(data []byte) error {
+	if f.file == nil {
+		return fmt.Errorf("审计日志已关闭")
+	}
+	if f.shouldRotate(int64(len(data))) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return err
+}
+
+// shouldRotate 判断写入前是否需要轮转，空文件不轮转
+func (f *rotatingFile) shouldRotate(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+next > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && !f.periodOf(f.now()).Equal(f.period)
+}
+
+// rotate 关闭当前文件，重命名为历史文件，然后打开新文件
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("关闭审计日志失败: %v", err)
+	}
+	f.file = nil
+	if err := f.rename(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// rename 将当前文件重命名为带时间戳的历史文件，并清理多余的历史文件
+func (f *rotatingFile) rename() error {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext)
+	stamp := f.now().UTC().Format("20060102T150405Z")
+
+	backup := fmt.Sprintf("%s-%s%s", base, stamp, ext)
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s-%s_%d%s", base, stamp, i, ext)
+	}
+	if err := os.Rename(f.path, backup); err != nil {
+		return fmt.Errorf("轮转审计日志失败: %v", err)
+	}
+	f.prune(base, ext)
+	return nil
+}
+
+// prune 删除超出保留数量的最旧历史文件
+func (f *rotatingFile) prune(base, ext string) {
+	if f.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(base + "-*" + ext)
+	if err != nil || len(backups) <= f.maxBackups {
+		return
+	}
+	// 文件名中的时间戳可以按字典序排序
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(old)
+	}
+}
+
+// Close 关闭文件
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
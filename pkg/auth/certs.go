@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+// CertAuthority SSH用户证书校验器
+type CertAuthority struct {
+	caKeys     []ssh.PublicKey
+	principals map[string]bool // 登录用户名不在证书主体中时允许作为会话身份的主体
+	checker    *ssh.CertChecker
+}
+
+// NewCertAuthority 根据配置加载受信任的CA公钥，revoked为nil表示不检查吊销
+func NewCertAuthority(revoked *RevokedKeys) (*CertAuthority, error) {
+	cfg := config.Get().Auth
+	authority := &CertAuthority{
+		principals: make(map[string]bool),
+	}
+
+	for _, entry := range cfg.TrustedUserCAKeys {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		keys, err := parseCAKeys(entry)
+		if err != nil {
+			return nil, fmt.Errorf("无法加载CA公钥 %s: %v", entry, err)
+		}
+		authority.caKeys = append(authority.caKeys, keys...)
+	}
+	for _, principal := range cfg.AuthorizedPrincipals {
+		if principal = strings.TrimSpace(principal); principal != "" {
+			authority.principals[principal] = true
+		}
+	}
+
+	// source-address 选项由ssh库在认证回调返回后根据Permissions.CriticalOptions校验，
+	// 其它critical选项都不支持，CertChecker会拒绝包含这些选项的证书
+	authority.checker = &ssh.CertChecker{
+		IsUserAuthority: authority.isAuthority,
+		IsRevoked:       revoked.CertRevoked,
+	}
+
+	log.Printf("SSH证书认证初始化完成，共加载 %d 个受信任的CA公钥", len(authority.caKeys))
+	return authority, nil
+}
+
+// parseCAKeys 解析CA公钥配置项：公钥字符串，或包含公钥的文件路径
+func parseCAKeys(entry string) ([]ssh.PublicKey, error) {
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(entry)); err == nil {
+		return []ssh.PublicKey{key}, nil
+	}
+
+	data, err := os.ReadFile(expandHome(entry))
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("解析公钥失败: %v", err)
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("文件中没有公钥")
+	}
+	return keys, nil
+}
+
+// isAuthority 判断是否是受信任的CA
+func (a *CertAuthority) isAuthority(key ssh.PublicKey) bool {
+	keyData := key.Marshal()
+	for _, caKey := range a.caKeys {
+		if bytes.Equal(caKey.Marshal(), keyData) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate 校验用户证书：CA、主体、有效期、critical选项、吊销状态和签名，
+// 返回作为会话身份的证书主体
+func (a *CertAuthority) Authenticate(user string, cert *ssh.Certificate) (string, error) {
+	if cert.CertType != ssh.UserCert {
+		return "", fmt.Errorf("不是用户证书")
+	}
+	if !a.isAuthority(cert.SignatureKey) {
+		return "", fmt.Errorf("证书不是由受信任的CA签发")
+	}
+	principal, err := a.principal(user, cert)
+	if err != nil {
+		return "", err
+	}
+	if err := a.checker.CheckCert(principal, cert); err != nil {
+		return "", err
+	}
+	return principal, nil
+}
+
+// principal 选择会话身份：登录用户名在证书主体中时使用登录用户名，
+// 否则使用证书中第一个在 authorized_principals 中的主体
+func (a *CertAuthority) principal(user string, cert *ssh.Certificate) (string, error) {
+	// 没有主体的证书对任何用户都有效，不接受
+	if len(cert.ValidPrincipals) == 0 {
+		return "", fmt.Errorf("证书没有指定主体")
+	}
+	for _, principal := range cert.ValidPrincipals {
+		if principal == user {
+			return principal, nil
+		}
+	}
+	for _, principal := range cert.ValidPrincipals {
+		if a.principals[principal] {
+			return principal, nil
+		}
+	}
+	return "", fmt.Errorf("登录用户名 %s 不在证书主体 %q 中", user, cert.ValidPrincipals)
+}
+
+// GetCAKeyCount 获取受信任的CA公钥数量
+func (a *CertAuthority) GetCAKeyCount() int {
+	return len(a.caKeys)
+}
+
+// CertAuthEnabled 检查SSH证书认证是否启用
+// 与SSH公钥认证一样，只有在设置了密码认证时才生效
+func CertAuthEnabled() bool {
+	cfg := config.Get()
+	return cfg.Auth.Password != "" && len(cfg.Auth.TrustedUserCAKeys) > 0
+}
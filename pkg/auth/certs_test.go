@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+// newTestSigner 生成测试用的Ed25519签名器
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// signUserCert 用CA签发用户证书
+func signUserCert(t *testing.T, ca ssh.Signer, serial uint64, keyID string, principals []string, options map[string]string) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             newTestSigner(t).PublicKey(),
+		Serial:          serial,
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+		Permissions:     ssh.Permissions{CriticalOptions: options},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertAuthority(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Get()
+	saved := cfg.Auth
+	defer func() { cfg.Auth = saved }()
+
+	ca := newTestSigner(t)
+	otherCA := newTestSigner(t)
+	caFile := filepath.Join(dir, "user_ca.pub")
+	os.WriteFile(caFile, ssh.MarshalAuthorizedKey(ca.PublicKey()), 0644)
+
+	cfg.Auth.TrustedUserCAKeys = []string{caFile}
+	cfg.Auth.AuthorizedPrincipals = []string{"alice"}
+	cfg.Auth.RevokedKeys = ""
+	cfg.Auth.RevokedSerials = []string{"100-199"}
+	revoked, err := NewRevokedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority, err := NewCertAuthority(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		user      string
+		cert      *ssh.Certificate
+		principal string // 空表示应拒绝
+	}{
+		{"login name is a principal", "bob", signUserCert(t, ca, 1, "bob", []string{"bob"}, nil), "bob"},
+		{"authorized principal", "gpt-4o", signUserCert(t, ca, 2, "alice", []string{"alice"}, nil), "alice"},
+		{"source-address is supported", "bob", signUserCert(t, ca, 3, "bob", []string{"bob"}, map[string]string{"source-address": "10.0.0.0/8"}), "bob"},
+		{"login name not a principal", "gpt-4o", signUserCert(t, ca, 4, "bob", []string{"bob"}, nil), ""},
+		{"no principals", "bob", signUserCert(t, ca, 5, "any", nil, nil), ""},
+		{"untrusted CA", "bob", signUserCert(t, otherCA, 6, "bob", []string{"bob"}, nil), ""},
+		{"unsupported critical option", "bob", signUserCert(t, ca, 7, "bob", []string{"bob"}, map[string]string{"force-command": "/bin/true"}), ""},
+		{"revoked serial", "bob", signUserCert(t, ca, 150, "bob", []string{"bob"}, nil), ""},
+	}
+	for _, tt := range tests {
+		principal, err := authority.Authenticate(tt.user, tt.cert)
+		if tt.principal == "" {
+			if err == nil {
+				t.Errorf("%s: certificate should be rejected", tt.name)
+			}
+			continue
+		}
+		if err != nil || principal != tt.principal {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, principal, err, tt.principal)
+		}
+	}
+
+	// 有效期
+	cert := signUserCert(t, ca, 8, "bob", []string{"bob"}, nil)
+	authority.checker.Clock = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := authority.Authenticate("bob", cert); err == nil {
+		t.Error("expired certificate should be rejected")
+	}
+	authority.checker.Clock = func() time.Time { return time.Now().Add(-time.Hour) }
+	if _, err := authority.Authenticate("bob", cert); err == nil {
+		t.Error("not yet valid certificate should be rejected")
+	}
+}
+
+// krlSection 构造KRL段
+func krlSection(sectionType byte, data []byte) []byte {
+	return ssh.Marshal(struct {
+		Type byte
+		Data []byte
+	}{sectionType, data})
+}
+
+// krlStrings 构造连续的SSH字符串
+func krlStrings(values ...[]byte) []byte {
+	var data []byte
+	for _, value := range values {
+		data = append(data, ssh.Marshal(struct{ Value []byte }{value})...)
+	}
+	return data
+}
+
+func TestRevokedKeys(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Get()
+	saved := cfg.Auth
+	defer func() { cfg.Auth = saved }()
+
+	ca := newTestSigner(t)
+	otherCA := newTestSigner(t)
+	revokedKey := newTestSigner(t).PublicKey()
+
+	// 证书段：序列号列表、范围、位图（10 和 12）和Key ID，仅适用于ca
+	serialList := make([]byte, 16)
+	binary.BigEndian.PutUint64(serialList, 1)
+	binary.BigEndian.PutUint64(serialList[8:], 3)
+	certSection := ssh.Marshal(struct {
+		CAKey    []byte
+		Reserved []byte
+	}{ca.PublicKey().Marshal(), nil})
+	certSection = append(certSection, krlSection(krlCertSectionSerialList, serialList)...)
+	certSection = append(certSection, krlSection(krlCertSectionSerialRange, ssh.Marshal(struct{ Min, Max uint64 }{20, 29}))...)
+	certSection = append(certSection, krlSection(krlCertSectionSerialBitmap, ssh.Marshal(struct {
+		Offset uint64
+		Bitmap *big.Int
+	}{10, big.NewInt(0b101)}))...)
+	certSection = append(certSection, krlSection(krlCertSectionKeyID, krlStrings([]byte("mallory")))...)
+
+	krl := ssh.Marshal(struct {
+		Magic         uint64
+		FormatVersion uint32
+		KRLVersion    uint64
+		GeneratedDate uint64
+		Flags         uint64
+		Reserved      []byte
+		Comment       string
+	}{binary.BigEndian.Uint64([]byte(krlMagic)), 1, 1, uint64(time.Now().Unix()), 0, nil, "test"})
+	krl = append(krl, krlSection(krlSectionCertificates, certSection)...)
+	krl = append(krl, krlSection(krlSectionExplicitKey, krlStrings(revokedKey.Marshal()))...)
+	krl = append(krl, krlSection(krlSectionSignature, nil)...)
+
+	krlFile := filepath.Join(dir, "revoked.krl")
+	os.WriteFile(krlFile, krl, 0644)
+	cfg.Auth.RevokedKeys = krlFile
+	cfg.Auth.RevokedSerials = nil
+	revoked, err := NewRevokedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cert *ssh.Certificate
+		want bool
+	}{
+		{signUserCert(t, ca, 1, "bob", []string{"bob"}, nil), true},
+		{signUserCert(t, ca, 2, "bob", []string{"bob"}, nil), false},
+		{signUserCert(t, ca, 25, "bob", []string{"bob"}, nil), true},
+		{signUserCert(t, ca, 10, "bob", []string{"bob"}, nil), true},
+		{signUserCert(t, ca, 11, "bob", []string{"bob"}, nil), false},
+		{signUserCert(t, ca, 12, "bob", []string{"bob"}, nil), true},
+		{signUserCert(t, ca, 40, "mallory", []string{"mallory"}, nil), true},
+		{signUserCert(t, otherCA, 1, "mallory", []string{"mallory"}, nil), false}, // 其它CA签发
+	}
+	for _, tt := range tests {
+		if got := revoked.CertRevoked(tt.cert); got != tt.want {
+			t.Errorf("serial %d key_id %s: revoked = %v, want %v", tt.cert.Serial, tt.cert.KeyId, got, tt.want)
+		}
+	}
+	if !revoked.KeyRevoked(revokedKey) || revoked.KeyRevoked(ca.PublicKey()) {
+		t.Error("explicit key revocation not applied")
+	}
+
+	// 文件修改后自动重新加载，文本格式为每行一个公钥
+	os.WriteFile(krlFile, append([]byte("# revoked\n"), ssh.MarshalAuthorizedKey(ca.PublicKey())...), 0644)
+	os.Chtimes(krlFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if revoked.KeyRevoked(revokedKey) {
+		t.Error("revocation list should be reloaded after the file changes")
+	}
+	if !revoked.CertRevoked(signUserCert(t, ca, 2, "bob", []string{"bob"}, nil)) {
+		t.Error("certificates signed by a revoked CA should be revoked")
+	}
+
+	// 重新加载失败时继续使用上次加载的列表
+	os.WriteFile(krlFile, []byte("not a key\n"), 0644)
+	os.Chtimes(krlFile, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	if !revoked.KeyRevoked(ca.PublicKey()) {
+		t.Error("previous revocation list should be kept when reloading fails")
+	}
+
+	if _, err := parseSerialRanges([]string{"9-3"}); err == nil {
+		t.Error("invalid serial range should be rejected")
+	}
+}
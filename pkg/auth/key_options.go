@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+// 角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// KeyOptions authorized_keys 中公钥的选项
+type KeyOptions struct {
+	From       string    // from= 允许的来源地址（逗号分隔的CIDR或IP通配符，!表示排除）
+	ExpiryTime time.Time // expiry-time= 过期时间，零值表示不过期
+	NoPty      bool      // no-pty，或 restrict 且没有 pty
+
+	// sshai专用选项
+	User  string // sshai-user= 会话身份，替代登录用户名
+	Model string // sshai-model= 默认模型（支持通配符，如 qwen*）
+	Role  string // sshai-role= 角色（admin 或 user）
+
+	Comment string // 公钥注释，用于日志
+}
+
+// ignoredKeyOptions 不适用于本服务的OpenSSH选项（服务器不支持端口转发、代理转发等功能），直接忽略
+var ignoredKeyOptions = map[string]bool{
+	"no-port-forwarding":  true,
+	"no-agent-forwarding": true,
+	"no-x11-forwarding":   true,
+	"no-user-rc":          true,
+	"port-forwarding":     true,
+	"agent-forwarding":    true,
+	"x11-forwarding":      true,
+	"user-rc":             true,
+}
+
+// expiryTimeLayouts expiry-time 支持的格式（与OpenSSH相同，末尾加Z表示UTC，否则为服务器本地时间）
+var expiryTimeLayouts = []string{"20060102", "200601021504", "20060102150405"}
+
+// parseKeyOptions 解析 ssh.ParseAuthorizedKey 返回的选项，不支持的选项（如 command=）返回错误
+func parseKeyOptions(options []string) (KeyOptions, error) {
+	var result KeyOptions
+	restrict, pty := false, false
+	for _, option := range options {
+		name, value, hasValue := strings.Cut(option, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if hasValue {
+			value = unquoteOption(value)
+		}
+
+		switch {
+		case name == "restrict":
+			restrict = true
+		case name == "pty":
+			pty = true
+		case name == "no-pty":
+			result.NoPty = true
+		case ignoredKeyOptions[name]:
+		case !hasValue:
+			return result, fmt.Errorf("不支持的选项 %s", name)
+		case name == "from":
+			if err := validateFrom(value); err != nil {
+				return result, err
+			}
+			result.From = value
+		case name == "expiry-time":
+			expiry, err := parseExpiryTime(value)
+			if err != nil {
+				return result, err
+			}
+			result.ExpiryTime = expiry
+		case name == "sshai-user":
+			result.User = value
+		case name == "sshai-model":
+			if _, err := path.Match(value, ""); err != nil {
+				return result, fmt.Errorf("无效的模型通配符 %q", value)
+			}
+			result.Model = value
+		case name == "sshai-role":
+			if value != RoleAdmin && value != RoleUser {
+				return result, fmt.Errorf("无效的角色 %q（支持 admin, user）", value)
+			}
+			result.Role = value
+		default:
+			return result, fmt.Errorf("不支持的选项 %s", name)
+		}
+	}
+	if restrict && !pty {
+		result.NoPty = true
+	}
+	return result, nil
+}
+
+// unquoteOption 去掉选项值两端的引号，并还原转义的引号
+func unquoteOption(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+	}
+	return value
+}
+
+// parseExpiryTime 解析 expiry-time 选项
+func parseExpiryTime(value string) (time.Time, error) {
+	location := time.Local
+	if strings.HasSuffix(value, "Z") || strings.HasSuffix(value, "z") {
+		value, location = value[:len(value)-1], time.UTC
+	}
+	for _, layout := range expiryTimeLayouts {
+		if len(value) == len(layout) {
+			if expiry, err := time.ParseInLocation(layout, value, location); err == nil {
+				return expiry, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("无效的过期时间 %q（格式为 YYYYMMDD[HHMM[SS]][Z]）", value)
+}
+
+// validateFrom 检查 from 选项中的CIDR是否有效
+func validateFrom(patterns string) error {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "!")
+		if pattern == "" {
+			return fmt.Errorf("from 选项包含空地址")
+		}
+		if strings.Contains(pattern, "/") {
+			if _, _, err := net.ParseCIDR(pattern); err != nil {
+				return fmt.Errorf("from 选项中的CIDR无效: %s", pattern)
+			}
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("from 选项中的地址无效: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// matchFrom 判断客户端IP是否符合 from 选项：匹配任一地址且不匹配任何以!开头的地址
+// 地址可以是CIDR，也可以是带 * 和 ? 通配符的IP（不做反向DNS解析，不支持主机名）
+func matchFrom(patterns string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	address := ip.String()
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		var ok bool
+		if strings.Contains(pattern, "/") {
+			_, network, err := net.ParseCIDR(pattern)
+			ok = err == nil && network.Contains(ip)
+		} else {
+			ok, _ = path.Match(pattern, address)
+		}
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// check 检查公钥选项是否允许本次登录
+func (o *KeyOptions) check(remoteIP net.IP, now time.Time) error {
+	if !o.ExpiryTime.IsZero() && !now.Before(o.ExpiryTime) {
+		return fmt.Errorf("公钥已于 %s 过期", o.ExpiryTime.Format("2006-01-02 15:04:05"))
+	}
+	if o.From != "" && !matchFrom(o.From, remoteIP) {
+		return fmt.Errorf("客户端地址 %s 不符合 from=%q", remoteIP, o.From)
+	}
+	return nil
+}
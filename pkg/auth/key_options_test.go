@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+func TestParseKeyOptions(t *testing.T) {
+	options, err := parseKeyOptions([]string{
+		"restrict", `from="10.0.0.0/8,!10.1.2.3"`, `expiry-time="20300101Z"`,
+		`sshai-user="alice"`, "sshai-model=qwen*", "sshai-role=admin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.NoPty || options.User != "alice" || options.Model != "qwen*" || options.Role != RoleAdmin {
+		t.Errorf("unexpected options: %+v", options)
+	}
+	if !options.ExpiryTime.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry time: %v", options.ExpiryTime)
+	}
+
+	if options, _ := parseKeyOptions([]string{"restrict", "pty"}); options.NoPty {
+		t.Error("restrict,pty should allow a pty")
+	}
+	for _, invalid := range [][]string{
+		{`command="/bin/false"`},
+		{"sshai-role=root"},
+		{"expiry-time=2030"},
+		{"from=10.0.0.0/33"},
+	} {
+		if _, err := parseKeyOptions(invalid); err == nil {
+			t.Errorf("%q should be rejected", invalid)
+		}
+	}
+}
+
+func TestKeyOptionsCheck(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	options := KeyOptions{From: "10.0.0.0/8,192.168.1.*,!10.1.2.3", ExpiryTime: now.Add(time.Hour)}
+
+	for ip, allowed := range map[string]bool{
+		"10.9.9.9":    true,
+		"192.168.1.7": true,
+		"10.1.2.3":    false,
+		"172.16.0.1":  false,
+	} {
+		if err := options.check(net.ParseIP(ip), now); (err == nil) != allowed {
+			t.Errorf("from check for %s: got %v, want allowed=%v", ip, err, allowed)
+		}
+	}
+	if err := options.check(net.ParseIP("10.9.9.9"), now.Add(2*time.Hour)); err == nil {
+		t.Error("expired key should be rejected")
+	}
+}
+
+func TestAuthorizedKeysReload(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Auth
+	defer func() { cfg.Auth = saved }()
+
+	alice, bob := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	line := func(options string, key ssh.PublicKey) string {
+		return strings.TrimSpace(options + " " + string(ssh.MarshalAuthorizedKey(key)))
+	}
+	file := filepath.Join(t.TempDir(), "authorized_keys")
+	write := func(lines ...string) {
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(line(`from="127.0.0.0/8",sshai-user=alice-dev`, alice), line(`command="ls"`, bob))
+
+	cfg.Auth.AuthorizedKeys = nil
+	cfg.Auth.AuthorizedKeysFile = file
+	manager, err := NewAuthorizedKeysManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222}
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2222}
+	if options, err := manager.Authorize(alice, local); err != nil || options.User != "alice-dev" {
+		t.Errorf("alice should be authorized as alice-dev: %v", err)
+	}
+	if _, err := manager.Authorize(alice, remote); err == nil {
+		t.Error("alice should be rejected outside from=")
+	}
+	if _, err := manager.Authorize(bob, local); err == nil {
+		t.Error("key with unsupported command= option should be skipped")
+	}
+
+	// 修改文件后无需重启即可生效（修改时间精度不足时通过文件大小区分）
+	write(line("sshai-role=user", bob) + " bob@laptop")
+	os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if _, err := manager.Authorize(alice, local); err == nil {
+		t.Error("alice should be rejected after removal from the file")
+	}
+	if options, err := manager.Authorize(bob, remote); err != nil || options.Role != RoleUser || options.Comment != "bob@laptop" {
+		t.Errorf("bob should be authorized after reload: %v %+v", err, options)
+	}
+}
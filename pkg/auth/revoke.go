@@ -0,0 +1,393 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+// krlMagic OpenSSH KRL文件头（PROTOCOL.krl）
+const krlMagic = "SSHKRL\n\x00"
+
+// KRL段类型
+const (
+	krlSectionCertificates      = 1
+	krlSectionExplicitKey       = 2
+	krlSectionFingerprintSHA1   = 3
+	krlSectionSignature         = 4
+	krlSectionFingerprintSHA256 = 5
+
+	krlCertSectionSerialList   = 0x20
+	krlCertSectionSerialRange  = 0x21
+	krlCertSectionSerialBitmap = 0x22
+	krlCertSectionKeyID        = 0x23
+)
+
+// serialRange 证书序列号范围（包含两端）
+type serialRange struct {
+	min, max uint64
+}
+
+// certRevocation 某个CA吊销的证书，caKey为空表示适用于所有CA
+type certRevocation struct {
+	caKey   []byte
+	serials []serialRange
+	keyIDs  map[string]bool
+}
+
+// revocationList 吊销的公钥和证书
+type revocationList struct {
+	keys   map[string]bool // 公钥blob
+	sha1   map[string]bool // 公钥blob的SHA1
+	sha256 map[string]bool // 公钥blob的SHA256
+	certs  []*certRevocation
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{
+		keys:   make(map[string]bool),
+		sha1:   make(map[string]bool),
+		sha256: make(map[string]bool),
+	}
+}
+
+// keyRevoked 判断公钥是否被吊销
+func (l *revocationList) keyRevoked(key ssh.PublicKey) bool {
+	blob := key.Marshal()
+	if l.keys[string(blob)] {
+		return true
+	}
+	if len(l.sha1) > 0 {
+		sum := sha1.Sum(blob)
+		if l.sha1[string(sum[:])] {
+			return true
+		}
+	}
+	if len(l.sha256) > 0 {
+		sum := sha256.Sum256(blob)
+		if l.sha256[string(sum[:])] {
+			return true
+		}
+	}
+	return false
+}
+
+// certRevoked 判断证书是否被吊销：证书公钥、签发CA被吊销，或按序列号、Key ID吊销
+func (l *revocationList) certRevoked(cert *ssh.Certificate) bool {
+	if l.keyRevoked(cert.Key) || l.keyRevoked(cert.SignatureKey) {
+		return true
+	}
+	caKey := cert.SignatureKey.Marshal()
+	for _, revocation := range l.certs {
+		if len(revocation.caKey) > 0 && !bytes.Equal(revocation.caKey, caKey) {
+			continue
+		}
+		if serialRevoked(revocation.serials, cert.Serial) || revocation.keyIDs[cert.KeyId] {
+			return true
+		}
+	}
+	return false
+}
+
+// serialRevoked 判断序列号是否在吊销范围内
+func serialRevoked(ranges []serialRange, serial uint64) bool {
+	for _, r := range ranges {
+		if serial >= r.min && serial <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRevokedKeys 解析吊销列表文件：OpenSSH KRL（ssh-keygen -k 生成），或每行一个公钥的文本文件
+func parseRevokedKeys(data []byte) (*revocationList, error) {
+	if bytes.HasPrefix(data, []byte(krlMagic)) {
+		return parseKRL(data)
+	}
+
+	list := newRevocationList()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行解析失败: %v", lineNum, err)
+		}
+		list.keys[string(key.Marshal())] = true
+	}
+	return list, scanner.Err()
+}
+
+// parseKRL 解析OpenSSH KRL，KRL中的签名段不做校验
+func parseKRL(data []byte) (*revocationList, error) {
+	var header struct {
+		Magic         uint64
+		FormatVersion uint32
+		KRLVersion    uint64
+		GeneratedDate uint64
+		Flags         uint64
+		Reserved      []byte
+		Comment       string
+		Rest          []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("KRL文件头无效: %v", err)
+	}
+	if header.FormatVersion != 1 {
+		return nil, fmt.Errorf("不支持的KRL格式版本 %d", header.FormatVersion)
+	}
+
+	list := newRevocationList()
+	rest := header.Rest
+	for len(rest) > 0 {
+		var section struct {
+			Type byte
+			Data []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(rest, &section); err != nil {
+			return nil, fmt.Errorf("KRL段无效: %v", err)
+		}
+		rest = section.Rest
+
+		var err error
+		switch section.Type {
+		case krlSectionCertificates:
+			err = list.parseCertSection(section.Data)
+		case krlSectionExplicitKey:
+			err = parseStrings(section.Data, list.keys)
+		case krlSectionFingerprintSHA1:
+			err = parseStrings(section.Data, list.sha1)
+		case krlSectionFingerprintSHA256:
+			err = parseStrings(section.Data, list.sha256)
+		case krlSectionSignature:
+			// 签名段位于文件末尾
+			return list, nil
+		default:
+			err = fmt.Errorf("未知的KRL段类型 %d", section.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// parseCertSection 解析KRL的证书段
+func (l *revocationList) parseCertSection(data []byte) error {
+	var header struct {
+		CAKey    []byte
+		Reserved []byte
+		Rest     []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("KRL证书段无效: %v", err)
+	}
+	revocation := &certRevocation{caKey: header.CAKey, keyIDs: make(map[string]bool)}
+
+	rest := header.Rest
+	for len(rest) > 0 {
+		var section struct {
+			Type byte
+			Data []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(rest, &section); err != nil {
+			return fmt.Errorf("KRL证书段无效: %v", err)
+		}
+		rest = section.Rest
+
+		switch section.Type {
+		case krlCertSectionSerialList:
+			if len(section.Data)%8 != 0 {
+				return fmt.Errorf("KRL序列号列表长度无效")
+			}
+			for i := 0; i < len(section.Data); i += 8 {
+				serial := binary.BigEndian.Uint64(section.Data[i:])
+				revocation.serials = append(revocation.serials, serialRange{serial, serial})
+			}
+		case krlCertSectionSerialRange:
+			var r struct{ Min, Max uint64 }
+			if err := ssh.Unmarshal(section.Data, &r); err != nil {
+				return fmt.Errorf("KRL序列号范围无效: %v", err)
+			}
+			revocation.serials = append(revocation.serials, serialRange{r.Min, r.Max})
+		case krlCertSectionSerialBitmap:
+			var bitmap struct {
+				Offset uint64
+				Bitmap *big.Int
+			}
+			if err := ssh.Unmarshal(section.Data, &bitmap); err != nil {
+				return fmt.Errorf("KRL序列号位图无效: %v", err)
+			}
+			revocation.serials = append(revocation.serials, bitmapRanges(bitmap.Offset, bitmap.Bitmap)...)
+		case krlCertSectionKeyID:
+			if err := parseStrings(section.Data, revocation.keyIDs); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("未知的KRL证书段类型 %#x", section.Type)
+		}
+	}
+	l.certs = append(l.certs, revocation)
+	return nil
+}
+
+// bitmapRanges 将序列号位图（第i位表示序列号offset+i）转换为连续的范围
+func bitmapRanges(offset uint64, bitmap *big.Int) []serialRange {
+	var ranges []serialRange
+	for i := 0; i < bitmap.BitLen(); i++ {
+		if bitmap.Bit(i) == 0 {
+			continue
+		}
+		serial := offset + uint64(i)
+		if n := len(ranges); n > 0 && ranges[n-1].max+1 == serial {
+			ranges[n-1].max = serial
+			continue
+		}
+		ranges = append(ranges, serialRange{serial, serial})
+	}
+	return ranges
+}
+
+// parseStrings 解析连续的SSH字符串
+func parseStrings(data []byte, set map[string]bool) error {
+	for len(data) > 0 {
+		var item struct {
+			Value []byte
+			Rest  []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(data, &item); err != nil {
+			return fmt.Errorf("KRL条目无效: %v", err)
+		}
+		set[string(item.Value)] = true
+		data = item.Rest
+	}
+	return nil
+}
+
+// parseSerialRanges 解析配置中的序列号列表，支持单个序列号和 "min-max" 范围
+func parseSerialRanges(values []string) ([]serialRange, error) {
+	var ranges []serialRange
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		minStr, maxStr, isRange := strings.Cut(value, "-")
+		if !isRange {
+			maxStr = minStr
+		}
+		min, err := strconv.ParseUint(strings.TrimSpace(minStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的证书序列号: %s", value)
+		}
+		max, err := strconv.ParseUint(strings.TrimSpace(maxStr), 10, 64)
+		if err != nil || max < min {
+			return nil, fmt.Errorf("无效的证书序列号: %s", value)
+		}
+		ranges = append(ranges, serialRange{min, max})
+	}
+	return ranges, nil
+}
+
+// RevokedKeys 吊销列表，吊销列表文件修改后在下次认证时自动重新加载
+type RevokedKeys struct {
+	file    string
+	serials []serialRange // 配置中吊销的证书序列号，适用于所有CA
+
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	list    *revocationList
+}
+
+// NewRevokedKeys 根据配置创建吊销列表，未配置时返回nil
+func NewRevokedKeys() (*RevokedKeys, error) {
+	cfg := config.Get().Auth
+	if cfg.RevokedKeys == "" && len(cfg.RevokedSerials) == 0 {
+		return nil, nil
+	}
+
+	serials, err := parseSerialRanges(cfg.RevokedSerials)
+	if err != nil {
+		return nil, err
+	}
+	revoked := &RevokedKeys{file: expandHome(cfg.RevokedKeys), serials: serials, list: newRevocationList()}
+	if revoked.file != "" {
+		if err := revoked.reload(); err != nil {
+			return nil, fmt.Errorf("加载吊销列表 %s 失败: %v", revoked.file, err)
+		}
+	}
+	return revoked, nil
+}
+
+// reload 吊销列表文件有变化时重新加载，调用方需持有锁（初始化时除外）
+func (r *RevokedKeys) reload() error {
+	info, err := os.Stat(r.file)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return nil
+	}
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return err
+	}
+	list, err := parseRevokedKeys(data)
+	if err != nil {
+		return err
+	}
+	r.list, r.modTime, r.size = list, info.ModTime(), info.Size()
+	log.Printf("已加载吊销列表 %s", r.file)
+	return nil
+}
+
+// current 获取当前的吊销列表，重新加载失败时继续使用上次加载的列表
+func (r *RevokedKeys) current() *revocationList {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file != "" {
+		if err := r.reload(); err != nil {
+			log.Printf("警告：重新加载吊销列表 %s 失败，继续使用上次加载的列表: %v", r.file, err)
+		}
+	}
+	return r.list
+}
+
+// KeyRevoked 判断公钥是否被吊销
+func (r *RevokedKeys) KeyRevoked(key ssh.PublicKey) bool {
+	if r == nil {
+		return false
+	}
+	return r.current().keyRevoked(key)
+}
+
+// CertRevoked 判断证书是否被吊销
+func (r *RevokedKeys) CertRevoked(cert *ssh.Certificate) bool {
+	if r == nil {
+		return false
+	}
+	return serialRevoked(r.serials, cert.Serial) || r.current().certRevoked(cert)
+}
@@ -2,77 +2,97 @@ package auth
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
 	"sshai/pkg/config"
 )
 
+// authorizedKey 授权公钥及其选项
+type authorizedKey struct {
+	key     ssh.PublicKey
+	options KeyOptions
+}
+
+// ErrKeyNotAuthorized 公钥不在授权列表中（区别于公钥存在但不满足选项限制）
+var ErrKeyNotAuthorized = errors.New("公钥未授权")
+
 // AuthorizedKeysManager SSH公钥管理器
+// 公钥文件修改后在下次认证时自动重新加载
 type AuthorizedKeysManager struct {
-	keys []ssh.PublicKey
+	mutex      sync.Mutex
+	configKeys []authorizedKey // 配置文件中的公钥
+	fileKeys   []authorizedKey // 公钥文件中的公钥
+	file       string
+	modTime    time.Time
+	size       int64
+	now        func() time.Time
 }
 
 // NewAuthorizedKeysManager 创建新的SSH公钥管理器
 func NewAuthorizedKeysManager() (*AuthorizedKeysManager, error) {
 	cfg := config.Get()
 	manager := &AuthorizedKeysManager{
-		keys: make([]ssh.PublicKey, 0),
+		configKeys: make([]authorizedKey, 0),
+		now:        time.Now,
 	}
 
 	// 加载配置中的公钥列表
 	for _, keyStr := range cfg.Auth.AuthorizedKeys {
 		if keyStr = strings.TrimSpace(keyStr); keyStr != "" {
-			if err := manager.addKeyFromString(keyStr); err != nil {
+			entry, err := parseAuthorizedKeyLine(keyStr)
+			if err != nil {
 				log.Printf("警告：无法解析公钥: %v", err)
+				continue
 			}
+			manager.configKeys = append(manager.configKeys, entry)
 		}
 	}
 
 	// 加载公钥文件（如果配置了）
 	if cfg.Auth.AuthorizedKeysFile != "" {
-		if err := manager.loadKeysFromFile(cfg.Auth.AuthorizedKeysFile); err != nil {
+		manager.file = expandHome(cfg.Auth.AuthorizedKeysFile)
+		if err := manager.reload(); err != nil {
 			log.Printf("警告：无法加载公钥文件 %s: %v", cfg.Auth.AuthorizedKeysFile, err)
 		}
 	}
 
-	log.Printf("SSH公钥管理器初始化完成，共加载 %d 个公钥", len(manager.keys))
+	log.Printf("SSH公钥管理器初始化完成，共加载 %d 个公钥", len(manager.configKeys)+len(manager.fileKeys))
 	return manager, nil
 }
 
-// addKeyFromString 从字符串添加公钥
-func (m *AuthorizedKeysManager) addKeyFromString(keyStr string) error {
-	// 解析SSH公钥字符串
-	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyStr))
+// parseAuthorizedKeyLine 解析一行 authorized_keys 格式的公钥（包括选项和注释）
+func parseAuthorizedKeyLine(line string) (authorizedKey, error) {
+	publicKey, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
 	if err != nil {
-		return fmt.Errorf("解析公钥失败: %v", err)
+		return authorizedKey{}, fmt.Errorf("解析公钥失败: %v", err)
 	}
-
-	m.keys = append(m.keys, publicKey)
-	return nil
-}
-
-// loadKeysFromFile 从文件加载公钥
-func (m *AuthorizedKeysManager) loadKeysFromFile(filePath string) error {
-	// 展开用户主目录路径
-	if strings.HasPrefix(filePath, "~/") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("无法获取用户主目录: %v", err)
-		}
-		filePath = strings.Replace(filePath, "~", homeDir, 1)
+	keyOptions, err := parseKeyOptions(options)
+	if err != nil {
+		return authorizedKey{}, fmt.Errorf("公钥 %s 的选项无效: %v", ssh.FingerprintSHA256(publicKey), err)
 	}
+	keyOptions.Comment = comment
+	return authorizedKey{key: publicKey, options: keyOptions}, nil
+}
 
+// loadKeysFromFile 从文件加载公钥，无法解析的行会被跳过
+func loadKeysFromFile(filePath string) ([]authorizedKey, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("无法打开公钥文件: %v", err)
+		return nil, fmt.Errorf("无法打开公钥文件: %v", err)
 	}
 	defer file.Close()
 
+	var keys []authorizedKey
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
 	for scanner.Scan() {
@@ -84,37 +104,116 @@ func (m *AuthorizedKeysManager) loadKeysFromFile(filePath string) error {
 			continue
 		}
 
-		if err := m.addKeyFromString(line); err != nil {
+		entry, err := parseAuthorizedKeyLine(line)
+		if err != nil {
 			log.Printf("警告：公钥文件第 %d 行解析失败: %v", lineNum, err)
+			continue
 		}
+		keys = append(keys, entry)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取公钥文件失败: %v", err)
+		return nil, fmt.Errorf("读取公钥文件失败: %v", err)
+	}
+
+	return keys, nil
+}
+
+// reload 公钥文件有变化时重新加载，文件被删除时清空其中的公钥，调用方需持有锁（初始化时除外）
+func (m *AuthorizedKeysManager) reload() error {
+	info, err := os.Stat(m.file)
+	if os.IsNotExist(err) {
+		if m.fileKeys != nil {
+			log.Printf("公钥文件 %s 已删除，其中的公钥不再有效", m.file)
+		}
+		m.fileKeys, m.modTime, m.size = nil, time.Time{}, 0
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(m.modTime) && info.Size() == m.size {
+		return nil
 	}
 
+	keys, err := loadKeysFromFile(m.file)
+	if err != nil {
+		return err
+	}
+	reloaded := !m.modTime.IsZero()
+	m.fileKeys, m.modTime, m.size = keys, info.ModTime(), info.Size()
+	if reloaded {
+		log.Printf("公钥文件 %s 已修改，重新加载了 %d 个公钥", m.file, len(keys))
+	}
 	return nil
 }
 
-// VerifyPublicKey 验证公钥是否在授权列表中
-func (m *AuthorizedKeysManager) VerifyPublicKey(key ssh.PublicKey) bool {
+// entries 获取当前所有的授权公钥
+func (m *AuthorizedKeysManager) entries() []authorizedKey {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.file != "" {
+		if err := m.reload(); err != nil && !os.IsNotExist(err) {
+			log.Printf("警告：重新加载公钥文件 %s 失败，继续使用上次加载的公钥: %v", m.file, err)
+		}
+	}
+	entries := make([]authorizedKey, 0, len(m.configKeys)+len(m.fileKeys))
+	return append(append(entries, m.configKeys...), m.fileKeys...)
+}
+
+// Authorize 验证公钥是否在授权列表中，并检查公钥选项（过期时间、来源地址），返回公钥的选项
+// 公钥不在列表中时返回 ErrKeyNotAuthorized
+// 同一个公钥出现多次时使用第一个满足选项限制的条目（与OpenSSH一致）
+func (m *AuthorizedKeysManager) Authorize(key ssh.PublicKey, remoteAddr net.Addr) (*KeyOptions, error) {
+	if m == nil {
+		return nil, ErrKeyNotAuthorized
+	}
 	keyData := key.Marshal()
-	keyType := key.Type()
+	remoteIP := addrIP(remoteAddr)
 
-	for _, authorizedKey := range m.keys {
-		if authorizedKey.Type() == keyType {
-			if string(authorizedKey.Marshal()) == string(keyData) {
-				return true
-			}
+	lastErr := ErrKeyNotAuthorized
+	for _, entry := range m.entries() {
+		if !bytes.Equal(entry.key.Marshal(), keyData) {
+			continue
 		}
+		if err := entry.options.check(remoteIP, m.now()); err != nil {
+			lastErr = err
+			continue
+		}
+		options := entry.options
+		return &options, nil
+	}
+	return nil, lastErr
+}
+
+// addrIP 获取地址中的IP
+func addrIP(addr net.Addr) net.IP {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+	if addr == nil {
+		return nil
 	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
 
-	return false
+// expandHome 展开路径中的用户主目录（~/）
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return strings.Replace(path, "~", homeDir, 1)
+		}
+	}
+	return path
 }
 
 // GetKeyCount 获取已加载的公钥数量
 func (m *AuthorizedKeysManager) GetKeyCount() int {
-	return len(m.keys)
+	return len(m.entries())
 }
 
 // IsEnabled 检查SSH公钥认证是否启用
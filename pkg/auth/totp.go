@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+
+	"sshai/pkg/config"
+)
+
+// TOTP参数（RFC 6238，与主流验证器App的默认值一致）
+const (
+	totpPeriod           = 30 // 时间步长（秒）
+	totpDigits           = 6
+	totpSecretSize       = 20 // 密钥长度（字节），与HMAC-SHA1输出长度相同
+	recoveryCodeBytes    = 5  // 恢复码的随机字节数（40位）
+	defaultTOTPFile      = "totp_secrets.json"
+	defaultTOTPIssuer    = "SSHAI"
+	defaultRecoveryCodes = 10
+)
+
+// 恢复码哈希的scrypt参数（交互式登录的推荐值），每个用户使用随机的盐
+const (
+	recoverySaltSize = 16
+	scryptN          = 1 << 15
+	scryptR          = 8
+	scryptP          = 1
+	scryptKeyLen     = 32
+)
+
+// ErrInvalidTOTPCode 验证码或恢复码错误
+var ErrInvalidTOTPCode = errors.New("验证码错误")
+
+// totpEncoding 密钥的Base32编码（不带填充，验证器App的标准格式）
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// hotp 计算HOTP验证码（RFC 4226）
+func hotp(secret []byte, counter uint64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// validateTOTP 校验验证码，允许前后skew个时间步的偏差，返回匹配的时间步
+func validateTOTP(secret, code string, now time.Time, skew int) (uint64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := uint64(now.Unix()) / totpPeriod
+	for i := -skew; i <= skew; i++ {
+		step := current + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateTOTPSecret 生成新的TOTP密钥（Base32编码）
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI 生成验证器App使用的 otpauth:// 链接（用于生成二维码）
+func TOTPURI(user, secret string) string {
+	issuer := config.Get().Auth.TOTP.Issuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(user)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// GenerateRecoveryCodes 生成一组一次性恢复码，格式如 abcd-efgh
+func GenerateRecoveryCodes() ([]string, error) {
+	count := config.Get().Auth.TOTP.RecoveryCodes
+	if count <= 0 {
+		count = defaultRecoveryCodes
+	}
+	codes := make([]string, count)
+	buf := make([]byte, recoveryCodeBytes)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		// 5字节正好编码为8个Base32字符
+		code := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 恢复码只保存加盐的scrypt哈希，比较时忽略大小写、空格和连字符
+// salt 为空时是旧版本保存的无盐SHA256哈希，只用于校验已有的恢复码
+func hashRecoveryCode(code, salt string) (string, error) {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if salt == "" {
+		sum := sha256.Sum256([]byte(code))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return "", fmt.Errorf("无效的恢复码盐: %v", err)
+	}
+	key, err := scrypt.Key([]byte(code), saltBytes, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// newRecoverySalt 生成恢复码哈希使用的盐
+func newRecoverySalt() (string, error) {
+	salt := make([]byte, recoverySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// totpUser 一个用户的TOTP绑定信息
+type totpUser struct {
+	Secret        string    `json:"secret"`
+	EnrolledAt    time.Time `json:"enrolled_at"`
+	LastStep      uint64    `json:"last_step"`               // 最近一次使用的时间步，防止验证码重放
+	RecoveryCodes []string  `json:"recovery_codes"`          // 未使用的恢复码（scrypt哈希）
+	RecoverySalt  string    `json:"recovery_salt,omitempty"` // 恢复码哈希的盐，为空表示旧版本的无盐SHA256哈希
+}
+
+// totpFile TOTP密钥文件格式
+type totpFile struct {
+	Users map[string]*totpUser `json:"users"`
+}
+
+// TOTPStore 保存每个用户的TOTP密钥和恢复码
+// 每次操作都重新读取文件，管理员删除文件中的用户即可让其重新绑定
+type TOTPStore struct {
+	mutex sync.Mutex
+	path  string
+	skew  int
+	now   func() time.Time
+}
+
+// NewTOTPStore 根据配置创建TOTP存储
+func NewTOTPStore() *TOTPStore {
+	cfg := config.Get().Auth.TOTP
+	path := cfg.SecretsFile
+	if path == "" {
+		path = defaultTOTPFile
+	}
+	skew := cfg.Skew
+	if skew <= 0 {
+		skew = 1
+	}
+	return &TOTPStore{path: expandHome(path), skew: skew, now: time.Now}
+}
+
+// load 读取密钥文件，文件不存在时返回空数据，调用方需持有锁
+func (s *TOTPStore) load() (*totpFile, error) {
+	data := &totpFile{Users: make(map[string]*totpUser)}
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, data); err != nil {
+		return nil, fmt.Errorf("解析TOTP密钥文件失败: %v", err)
+	}
+	if data.Users == nil {
+		data.Users = make(map[string]*totpUser)
+	}
+	return data, nil
+}
+
+// save 写入密钥文件（先写临时文件再重命名），调用方需持有锁
+func (s *TOTPStore) save(data *totpFile) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Enrolled 判断用户是否已绑定TOTP
+func (s *TOTPStore) Enrolled(user string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	return data.Users[user] != nil, nil
+}
+
+// Verify 校验验证码或恢复码，恢复码使用后失效，返回是否使用了恢复码和剩余恢复码数量
+func (s *TOTPStore) Verify(user, code string) (usedRecovery bool, remaining int, err error) {
+	code = strings.TrimSpace(code)
+	remaining, salt, err := s.verifyCode(user, code)
+	if !errors.Is(err, ErrInvalidTOTPCode) {
+		return false, remaining, err
+	}
+
+	// 计算恢复码哈希较慢，不持有锁
+	hash, err := hashRecoveryCode(code, salt)
+	if err != nil {
+		return false, 0, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return false, 0, err
+	}
+	entry := data.Users[user]
+	if entry == nil || entry.RecoverySalt != salt {
+		// 计算哈希期间用户被删除或重新绑定
+		return false, 0, ErrInvalidTOTPCode
+	}
+	for i, recovery := range entry.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recovery), []byte(hash)) == 1 {
+			entry.RecoveryCodes = append(entry.RecoveryCodes[:i], entry.RecoveryCodes[i+1:]...)
+			return true, len(entry.RecoveryCodes), s.save(data)
+		}
+	}
+	return false, 0, ErrInvalidTOTPCode
+}
+
+// verifyCode 校验TOTP验证码，返回剩余恢复码数量；不是有效的验证码时返回 ErrInvalidTOTPCode 和用户恢复码哈希的盐
+func (s *TOTPStore) verifyCode(user, code string) (remaining int, salt string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return 0, "", err
+	}
+	entry := data.Users[user]
+	if entry == nil {
+		return 0, "", fmt.Errorf("用户未绑定TOTP")
+	}
+	step, ok := validateTOTP(entry.Secret, code, s.now(), s.skew)
+	if !ok {
+		return 0, entry.RecoverySalt, ErrInvalidTOTPCode
+	}
+	if step <= entry.LastStep {
+		return 0, "", fmt.Errorf("验证码已使用过")
+	}
+	entry.LastStep = step
+	return len(entry.RecoveryCodes), "", s.save(data)
+}
+
+// Enroll 校验用户输入的第一个验证码后保存密钥和恢复码
+// 已绑定的用户不能再次绑定，避免同时登录的另一个会话覆盖已绑定的密钥
+func (s *TOTPStore) Enroll(user, secret, code string, recoveryCodes []string) error {
+	step, ok := validateTOTP(secret, strings.TrimSpace(code), s.now(), s.skew)
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	salt, err := newRecoverySalt()
+	if err != nil {
+		return err
+	}
+	hashes := make([]string, len(recoveryCodes))
+	for i, recovery := range recoveryCodes {
+		if hashes[i], err = hashRecoveryCode(recovery, salt); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	if data.Users[user] != nil {
+		return fmt.Errorf("用户已绑定TOTP")
+	}
+	data.Users[user] = &totpUser{Secret: secret, EnrolledAt: s.now().UTC(), LastStep: step, RecoveryCodes: hashes, RecoverySalt: salt}
+	return s.save(data)
+}
+
+// TOTPEnabled 检查TOTP两步验证是否启用
+// 无密码模式下任何人都可以使用任意用户名登录，不启用两步验证
+func TOTPEnabled() bool {
+	cfg := config.Get()
+	return cfg.Auth.Password != "" && cfg.Auth.TOTP.Enabled
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 6238 附录B的SHA1测试向量（取后6位）
+	secret := []byte("12345678901234567890")
+	tests := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range tests {
+		if got := hotp(secret, uint64(unix)/totpPeriod); got != want {
+			t.Errorf("hotp at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTPStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := &TOTPStore{path: filepath.Join(t.TempDir(), "totp.json"), skew: 1, now: func() time.Time { return now }}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	codeAt := func(offset int) string {
+		return hotp(key, uint64(now.Unix()/totpPeriod+int64(offset)))
+	}
+	recoveryCodes := []string{"abcd-efgh", "ijkl-mnop"}
+
+	if err := store.Enroll("alice", secret, "000000", recoveryCodes); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("enrolling with a wrong code should fail, got %v", err)
+	}
+	if err := store.Enroll("alice", secret, codeAt(0), recoveryCodes); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Enroll("alice", secret, codeAt(1), recoveryCodes); err == nil {
+		t.Error("enrolled user should not be enrolled again")
+	}
+	if info, err := os.Stat(store.path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secrets file should be saved with 0600 permissions: %v", err)
+	}
+
+	// 绑定时使用的验证码不能再次使用，下一个时间步的验证码在允许偏差内
+	if _, _, err := store.Verify("alice", codeAt(0)); err == nil {
+		t.Error("code used for enrollment should not be accepted again")
+	}
+	if _, _, err := store.Verify("alice", codeAt(1)); err != nil {
+		t.Errorf("code within skew should be accepted: %v", err)
+	}
+	if _, _, err := store.Verify("alice", codeAt(2)); err == nil {
+		t.Error("code outside skew should be rejected")
+	}
+
+	// 恢复码忽略大小写和连字符，只能使用一次
+	used, remaining, err := store.Verify("alice", "IJKLMNOP")
+	if err != nil || !used || remaining != 1 {
+		t.Errorf("recovery code: used=%v remaining=%d err=%v", used, remaining, err)
+	}
+	if _, _, err := store.Verify("alice", "ijkl-mnop"); err == nil {
+		t.Error("recovery code should only be usable once")
+	}
+
+	if enrolled, _ := store.Enrolled("bob"); enrolled {
+		t.Error("bob should not be enrolled")
+	}
+	if _, _, err := store.Verify("bob", codeAt(0)); err == nil {
+		t.Error("unenrolled user should not be verified")
+	}
+
+	codes, err := GenerateRecoveryCodes()
+	if err != nil || len(codes) != defaultRecoveryCodes || len(codes[0]) != 9 {
+		t.Errorf("unexpected recovery codes %v: %v", codes, err)
+	}
+}
+
+func TestRecoveryCodeHashes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := &TOTPStore{path: filepath.Join(t.TempDir(), "totp.json"), skew: 1, now: func() time.Time { return now }}
+	secret, _ := GenerateTOTPSecret()
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err := store.Enroll("alice", secret, hotp(key, uint64(now.Unix()/totpPeriod)), []string{"abcd-efgh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新绑定的恢复码保存加盐的哈希，不是无盐的SHA256
+	legacy, _ := hashRecoveryCode("abcd-efgh", "")
+	content, _ := os.ReadFile(store.path)
+	if strings.Contains(string(content), legacy) || !strings.Contains(string(content), `"recovery_salt"`) {
+		t.Errorf("recovery codes should be stored as salted hashes:\n%s", content)
+	}
+
+	// 旧版本保存的无盐SHA256哈希仍然可以使用
+	data := fmt.Sprintf(`{"users":{"bob":{"secret":%q,"recovery_codes":[%q]}}}`, secret, legacy)
+	if err := os.WriteFile(store.path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if used, remaining, err := store.Verify("bob", "ABCD EFGH"); err != nil || !used || remaining != 0 {
+		t.Errorf("legacy recovery code: used=%v remaining=%d err=%v", used, remaining, err)
+	}
+	if _, _, err := store.Verify("bob", "abcd-efgh"); err == nil {
+		t.Error("legacy recovery code should only be usable once")
+	}
+}
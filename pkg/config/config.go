@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -17,18 +18,102 @@ type MCPServer struct {
 	Enabled   bool              `yaml:"enabled"`   // 是否启用
 }
 
+// ToolPolicy 工具策略：允许使用哪些MCP服务器的工具
+type ToolPolicy struct {
+	MCPServers []string `yaml:"mcp_servers"` // 允许使用的MCP服务器，为空表示全部
+	NoTools    bool     `yaml:"no_tools"`    // 不使用任何MCP工具
+}
+
+// Persona 角色配置：独立的系统提示词、默认模型、温度和可用的MCP服务器
+type Persona struct {
+	Name         string  `yaml:"name"`          // 角色名称，使用该名称作为登录用户名时自动选择（如 ssh reviewer@host）
+	Description  string  `yaml:"description"`   // 在 /persona 列表中显示的说明
+	SystemPrompt string  `yaml:"system_prompt"` // 系统提示词，为空时使用 prompt.system_prompt
+	Model        string  `yaml:"model"`         // 默认模型（支持通配符，如 qwen*），为空时按原有方式选择
+	Temperature  float64 `yaml:"temperature"`   // 温度，0表示使用 api.temperature
+	ToolPolicy   `yaml:",inline"`
+}
+
+// Command 配置文件中定义的命令，交互模式通过 /名称 使用，命令模式通过 ssh host 名称 使用
+type Command struct {
+	Name           string  `yaml:"name"`            // 命令名称（不含 /），如 translate
+	Description    string  `yaml:"description"`     // 在 /help 中显示的说明
+	Prompt         string  `yaml:"prompt"`          // 提示词模板，{{.Input}} 为命令参数或stdin内容；不引用 .Input 时输入附加在提示词之后
+	Model          string  `yaml:"model"`           // 使用的模型（支持通配符），为空时使用会话当前的模型
+	Temperature    float64 `yaml:"temperature"`     // 温度，0表示使用会话的温度
+	IncludeContext bool    `yaml:"include_context"` // 交互模式下是否在当前对话上下文中执行（问答会保留在上下文中）
+}
+
+// RouteMatch 路由规则的匹配条件，所有设置了的条件都满足时规则匹配，都没有设置时匹配所有会话
+type RouteMatch struct {
+	User           string            `yaml:"user"`            // 登录用户名（正则）
+	Identity       string            `yaml:"identity"`        // 会话身份（正则），证书主体或公钥选项 sshai-user
+	KeyComment     string            `yaml:"key_comment"`     // 登录公钥的注释（正则）
+	KeyFingerprint string            `yaml:"key_fingerprint"` // 登录公钥的指纹（如 SHA256:...）
+	ClientVersion  string            `yaml:"client_version"`  // 客户端版本（正则），如 ^SSH-2.0-OpenSSH
+	RemoteCIDR     []string          `yaml:"remote_cidr"`     // 客户端地址，在任一CIDR中即匹配
+	Env            map[string]string `yaml:"env"`             // 客户端通过env请求传递的环境变量（值为正则）
+}
+
+// RouteRule 会话路由规则，按顺序匹配，第一个匹配的规则决定会话的模型、角色、语言和工具策略
+type RouteRule struct {
+	Name       string     `yaml:"name"`     // 规则名称，用于 /whoami 和日志
+	Match      RouteMatch `yaml:"match"`    // 匹配条件
+	Model      string     `yaml:"model"`    // 模型（支持通配符）
+	Persona    string     `yaml:"persona"`  // 角色名称
+	Language   string     `yaml:"language"` // 界面语言: zh-cn, en-us
+	ToolPolicy `yaml:",inline"`
+}
+
+// RemoteHost 远程运维工具可以连接的主机
+type RemoteHost struct {
+	Name        string   `yaml:"name"`        // 主机名称，模型调用工具时使用
+	Description string   `yaml:"description"` // 主机说明，如用途和环境
+	Address     string   `yaml:"address"`     // 地址，如 10.0.0.1:22（省略端口时为22）
+	User        string   `yaml:"user"`        // 登录用户名
+	Password    string   `yaml:"password"`    // 登录密码（可选）
+	KeyFile     string   `yaml:"key_file"`    // 私钥文件路径（可选）
+	Passphrase  string   `yaml:"passphrase"`  // 私钥的密码（可选）
+	HostKey     string   `yaml:"host_key"`    // 主机公钥（authorized_keys 格式），为空时使用 known_hosts 验证
+	Allow       []string `yaml:"allow"`       // 该主机额外允许的命令
+	Deny        []string `yaml:"deny"`        // 该主机额外禁止的命令
+	Readonly    []string `yaml:"readonly"`    // 该主机额外的只读命令（不需要确认）
+}
+
+// HostKey 主机密钥配置
+type HostKey struct {
+	File        string `yaml:"file"`        // 私钥文件路径，不存在时自动生成
+	Type        string `yaml:"type"`        // 生成密钥的类型: ed25519（默认）, ecdsa, rsa
+	Certificate string `yaml:"certificate"` // CA签发的主机证书文件（可选，如 ssh_host_ed25519_key-cert.pub）
+}
+
 // Config 配置结构体
 type Config struct {
 	Server struct {
-		Port           string `yaml:"port"`
-		WelcomeMessage string `yaml:"welcome_message"`
-		PromptTemplate string `yaml:"prompt_template"`
+		Port            string `yaml:"port"`
+		WelcomeMessage  string `yaml:"welcome_message"`
+		PromptTemplate  string `yaml:"prompt_template"`
+		ShutdownTimeout int    `yaml:"shutdown_timeout"` // 关闭服务时等待正在生成的回答完成的最长时间（秒）
 	} `yaml:"server"`
 	Auth struct {
 		Password           string   `yaml:"password"`
 		LoginPrompt        string   `yaml:"login_prompt"`
 		AuthorizedKeys     []string `yaml:"authorized_keys"`      // SSH公钥列表，支持多个
 		AuthorizedKeysFile string   `yaml:"authorized_keys_file"` // SSH公钥文件路径（可选）
+		// SSH用户证书认证
+		TrustedUserCAKeys    []string `yaml:"trusted_user_ca_keys"`   // 受信任的用户证书CA公钥，每项为公钥或公钥文件路径
+		AuthorizedPrincipals []string `yaml:"authorized_principals"` // 证书主体与登录用户名不同时，允许作为会话身份的主体
+		RevokedKeys          string   `yaml:"revoked_keys"`          // 吊销列表文件（OpenSSH KRL或公钥列表），修改后自动重新加载
+		RevokedSerials       []string `yaml:"revoked_serials"`       // 吊销的证书序列号，支持范围如 "100-200"
+		// TOTP两步验证：密码或公钥认证通过后，通过keyboard-interactive输入验证码
+		TOTP struct {
+			Enabled         bool   `yaml:"enabled"`
+			Issuer          string `yaml:"issuer"`           // 验证器App中显示的名称，默认 SSHAI
+			SecretsFile     string `yaml:"secrets_file"`     // 每个用户的TOTP密钥和恢复码，默认 totp_secrets.json
+			RequireEnrolled bool   `yaml:"require_enrolled"` // 只允许已绑定的用户登录，关闭首次登录时绑定（首次绑定只对证书主体、sshai-user 开放）
+			RecoveryCodes   int    `yaml:"recovery_codes"`   // 绑定时生成的一次性恢复码数量，默认10
+			Skew            int    `yaml:"skew"`             // 允许的时间偏差（30秒为一步），默认1
+		} `yaml:"totp"`
 	} `yaml:"auth"`
 	API struct {
 		BaseURL      string  `yaml:"base_url"`
@@ -38,12 +123,51 @@ type Config struct {
 		Temperature  float64 `yaml:"temperature"` // AI模型温度设置，控制回答的随机性 (0.0-2.0)
 	} `yaml:"api"`
 	Display struct {
-		LineWidth                 int `yaml:"line_width"`
-		ThinkingAnimationInterval int `yaml:"thinking_animation_interval"`
-		LoadingAnimationInterval  int `yaml:"loading_animation_interval"`
+		LineWidth                 int    `yaml:"line_width"`
+		ThinkingAnimationInterval int    `yaml:"thinking_animation_interval"`
+		LoadingAnimationInterval  int    `yaml:"loading_animation_interval"`
+		RenderMode                string `yaml:"render_mode"` // 交互模式回答的渲染方式: markdown（默认）, plain
 	} `yaml:"display"`
+	History struct {
+		Enabled         bool     `yaml:"enabled"`          // 是否按用户持久化输入历史（只保存证书、公钥登录的会话，密码和无密码登录不保存）
+		Dir             string   `yaml:"dir"`              // 历史文件目录，每个用户一个文件
+		MaxSize         int      `yaml:"max_size"`         // 每个用户保留的最大条数
+		ExcludePatterns []string `yaml:"exclude_patterns"` // 匹配这些正则的输入不写入历史文件（如包含密钥的行）
+	} `yaml:"history"`
+	Admin struct {
+		Users []string `yaml:"users"` // 管理员用户名，只匹配经过验证的会话身份（证书主体、公钥选项 sshai-user）
+		Keys  []string `yaml:"keys"`  // 管理员SSH公钥，使用这些公钥登录的用户拥有管理员权限
+	} `yaml:"admin"`
+	Limits struct {
+		MaxAuthTries        int      `yaml:"max_auth_tries"`         // 每个连接允许的认证尝试次数，0使用默认值6
+		MaxConnections      int      `yaml:"max_connections"`        // 全局最大并发连接数，0表示不限制
+		MaxConnectionsPerIP int      `yaml:"max_connections_per_ip"` // 单个IP的最大并发连接数，0表示不限制
+		HandshakeTimeout    int      `yaml:"handshake_timeout"`      // SSH握手（包括认证）超时时间（秒），0使用默认值30
+		AllowCIDRs          []string `yaml:"allow_cidrs"`            // 允许连接的地址段，为空表示允许所有地址
+		DenyCIDRs           []string `yaml:"deny_cidrs"`             // 拒绝连接的地址段，优先于allow_cidrs
+		Ban                 struct {
+			MaxFailures int `yaml:"max_failures"` // 统计窗口内认证失败达到该次数后封禁，0表示不封禁
+			Window      int `yaml:"window"`       // 失败次数统计窗口（秒）
+			Duration    int `yaml:"duration"`     // 封禁时长（秒）
+		} `yaml:"ban"`
+	} `yaml:"limits"`
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"` // 是否启用Prometheus指标端点
+		Listen  string `yaml:"listen"`  // 监听地址，如 127.0.0.1:9090
+		Path    string `yaml:"path"`    // 指标路径，默认 /metrics
+	} `yaml:"metrics"`
+	Audit struct {
+		Enabled        bool     `yaml:"enabled"`         // 是否启用审计日志
+		File           string   `yaml:"file"`            // 审计日志文件路径（JSON Lines格式）
+		PrivacyMode    bool     `yaml:"privacy_mode"`    // 隐私模式：只记录提示词和工具参数的哈希与长度
+		MaxSizeMB      int      `yaml:"max_size_mb"`     // 单个文件的最大大小（MB），超过后轮转
+		RotateHours    int      `yaml:"rotate_hours"`    // 按时间轮转的周期（小时，按UTC对齐），0表示不按时间轮转
+		MaxBackups     int      `yaml:"max_backups"`     // 保留的历史文件数，0表示全部保留
+		RedactPatterns []string `yaml:"redact_patterns"` // 匹配这些正则的内容替换为[REDACTED]
+	} `yaml:"audit"`
 	Security struct {
-		HostKeyFile string `yaml:"host_key_file"`
+		HostKeyFile string    `yaml:"host_key_file"` // RSA主机密钥文件（旧配置，仍然支持）
+		HostKeys    []HostKey `yaml:"host_keys"`     // 主机密钥列表，每种类型一个
 	} `yaml:"security"`
 	I18n struct {
 		Language string `yaml:"language"` // 支持的语言: zh-cn, en-us
@@ -54,7 +178,50 @@ type Config struct {
 		AssistantPrompt string `yaml:"assistant_prompt"` // 助手回复前缀
 		StdinPrompt     string `yaml:"stdin_prompt"`     // stdin输入分析提示词
 		ExecPrompt      string `yaml:"exec_prompt"`      // exec命令处理提示词
+		PromptsDir      string `yaml:"prompts_dir"`      // 提示词目录，模板中可通过 {{include "文件名"}} 引用其中的文件
 	} `yaml:"prompt"`
+	Personas []Persona   `yaml:"personas"` // 角色列表，可通过登录用户名或 /persona 命令选择
+	Routes   []RouteRule `yaml:"routes"`   // 会话路由规则
+	Commands []Command   `yaml:"commands"` // 自定义命令
+	KnowledgeBase struct {
+		Enabled        bool     `yaml:"enabled"`         // 是否启用知识库检索
+		Dirs           []string `yaml:"dirs"`            // 索引的目录
+		Extensions     []string `yaml:"extensions"`      // 索引的文件扩展名，为空时使用默认列表（Markdown、文本和常见代码）
+		IndexFile      string   `yaml:"index_file"`      // 索引文件，默认 kb_index.json
+		EmbeddingModel string   `yaml:"embedding_model"` // 向量模型（调用 /embeddings 接口），为空或接口不可用时使用BM25
+		ChunkSize      int      `yaml:"chunk_size"`      // 每段的最大字节数，默认1500
+		TopK           int      `yaml:"top_k"`           // 每次检索注入的段落数，默认4
+		MaxFileSize    int64    `yaml:"max_file_size"`   // 跳过大于该大小的文件（字节），默认1MB
+	} `yaml:"knowledge_base"`
+	Workspace struct {
+		Enabled     bool   `yaml:"enabled"`       // 是否为每个会话提供临时工作区和文件工具，会话结束时删除
+		Dir         string `yaml:"dir"`           // 工作区所在的目录，默认为系统临时目录
+		MaxBytes    int64  `yaml:"max_bytes"`     // 每个工作区的总大小上限（字节），默认10MB
+		MaxFileSize int64  `yaml:"max_file_size"` // 单个文件的大小上限（字节），默认1MB
+		MaxFiles    int    `yaml:"max_files"`     // 每个工作区的文件数上限（目录也计入），默认200
+	} `yaml:"workspace"`
+	Tools struct {
+		Builtin  bool     `yaml:"builtin"`  // 是否向模型提供内置工具（时间、计算、编码、JSON查询、正则、JavaScript），在进程内执行，不需要MCP
+		Disabled []string `yaml:"disabled"` // 不提供的内置工具名称
+		// JavaScript run_js 工具的执行限制
+		JavaScript struct {
+			Timeout   int `yaml:"timeout"`    // 最长执行时间（秒），默认5
+			MaxMemory int `yaml:"max_memory"` // 内存限制（MB，按进程堆增长估算），默认64
+			MaxOutput int `yaml:"max_output"` // console 输出的最大字节数，默认16384
+			MaxInput  int `yaml:"max_input"`  // input 参数的最大字节数，默认1048576
+		} `yaml:"javascript"`
+	} `yaml:"tools"`
+	Remote struct {
+		Enabled         bool         `yaml:"enabled"`          // 是否提供远程运维工具（通过SSH在清单中的主机上执行命令）
+		KnownHosts      string       `yaml:"known_hosts"`      // 验证主机公钥的 known_hosts 文件，默认为 ~/.ssh/known_hosts
+		Timeout         int          `yaml:"timeout"`          // 命令执行超时（秒），默认30
+		ApprovalTimeout int          `yaml:"approval_timeout"` // 等待用户确认的时间（秒），默认120
+		MaxOutput       int          `yaml:"max_output"`       // 返回给模型的最大输出字节数，默认16384
+		Allow           []string     `yaml:"allow"`            // 允许的命令（通配符，按命令前缀匹配），为空表示全部
+		Deny            []string     `yaml:"deny"`             // 禁止的命令，优先于 allow
+		Readonly        []string     `yaml:"readonly"`         // 不需要确认的只读命令，为空时使用内置列表
+		Hosts           []RemoteHost `yaml:"hosts"`            // 主机清单
+	} `yaml:"remote"`
 	MCP struct {
 		Enabled         bool        `yaml:"enabled"`          // 是否启用MCP功能
 		RefreshInterval int         `yaml:"refresh_interval"` // 工具列表刷新间隔（秒）
@@ -65,6 +232,9 @@ type Config struct {
 // GlobalConfig 全局配置实例
 var GlobalConfig Config
 
+// loadedPath 最近一次加载的配置文件路径，用于重新加载
+var loadedPath string
+
 // Load 加载配置文件
 func Load(configPath string) error {
 	data, err := os.ReadFile(configPath)
@@ -77,6 +247,28 @@ func Load(configPath string) error {
 		return fmt.Errorf("解析配置文件失败: %v", err)
 	}
 
+	loadedPath = configPath
+	return nil
+}
+
+// Reload 重新加载配置文件，解析失败时保留当前配置
+// 已建立的连接和已启动的组件（如MCP连接、主机密钥）不受影响，新请求使用新配置
+func Reload() error {
+	if loadedPath == "" {
+		return fmt.Errorf("尚未加载配置文件")
+	}
+
+	data, err := os.ReadFile(loadedPath)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+
+	var newConfig Config
+	if err := yaml.Unmarshal(data, &newConfig); err != nil {
+		return fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	GlobalConfig = newConfig
 	return nil
 }
 
@@ -84,3 +276,60 @@ func Load(configPath string) error {
 func Get() *Config {
 	return &GlobalConfig
 }
+
+// FindPersona 根据名称查找角色（不区分大小写），不存在时返回nil
+func FindPersona(name string) *Persona {
+	for _, persona := range GlobalConfig.Personas {
+		if name != "" && strings.EqualFold(persona.Name, name) {
+			found := persona
+			return &found
+		}
+	}
+	return nil
+}
+
+// FindCommand 根据名称查找自定义命令（不区分大小写），不存在时返回nil
+func FindCommand(name string) *Command {
+	for _, command := range GlobalConfig.Commands {
+		if name != "" && strings.EqualFold(command.Name, name) {
+			found := command
+			return &found
+		}
+	}
+	return nil
+}
+
+// AllowsMCPServer 判断角色是否可以使用该MCP服务器的工具，nil表示未选择角色
+func (p *Persona) AllowsMCPServer(server string) bool {
+	if p == nil {
+		return true
+	}
+	return p.ToolPolicy.Allows(server)
+}
+
+// Allows 判断工具策略是否允许使用该MCP服务器的工具
+func (t ToolPolicy) Allows(server string) bool {
+	if t.NoTools {
+		return false
+	}
+	if len(t.MCPServers) == 0 {
+		return true
+	}
+	for _, allowed := range t.MCPServers {
+		if allowed == server {
+			return true
+		}
+	}
+	return false
+}
+
+// String 工具策略的说明
+func (t ToolPolicy) String() string {
+	if t.NoTools {
+		return "none"
+	}
+	if len(t.MCPServers) == 0 {
+		return "all"
+	}
+	return strings.Join(t.MCPServers, ",")
+}
@@ -51,6 +51,8 @@ type LanguageMessages struct {
 		AutoSelected    string `yaml:"auto_selected"`
 		MultipleMatches string `yaml:"multiple_matches"`
 		NoMatches       string `yaml:"no_matches"`
+		PatternSelected string `yaml:"pattern_selected"`
+		PatternMultiple string `yaml:"pattern_multiple"`
 		NoAvailable     string `yaml:"no_available"`
 		AutoOnly        string `yaml:"auto_only"`
 		SelectPrompt    string `yaml:"select_prompt"`
@@ -165,6 +167,11 @@ func GetLanguage() Language {
 
 // T 翻译函数
 func T(key string, args ...interface{}) string {
+	return TL("", key, args...)
+}
+
+// TL 使用指定语言翻译，lang为空时使用当前语言
+func TL(lang Language, key string, args ...interface{}) string {
 	if globalI18n == nil {
 		return key
 	}
@@ -172,8 +179,12 @@ func T(key string, args ...interface{}) string {
 	globalI18n.mutex.RLock()
 	defer globalI18n.mutex.RUnlock()
 
-	// 尝试从当前语言获取翻译
-	if flatMessages, exists := globalI18n.flatMessages[globalI18n.currentLang]; exists {
+	if lang == "" {
+		lang = globalI18n.currentLang
+	}
+
+	// 尝试从指定语言获取翻译
+	if flatMessages, exists := globalI18n.flatMessages[lang]; exists {
 		if message, exists := flatMessages[key]; exists {
 			if len(args) > 0 {
 				return fmt.Sprintf(message, args...)
@@ -183,7 +194,7 @@ func T(key string, args ...interface{}) string {
 	}
 
 	// 回退到中文
-	if globalI18n.currentLang != LanguageZhCN {
+	if lang != LanguageZhCN {
 		if flatMessages, exists := globalI18n.flatMessages[LanguageZhCN]; exists {
 			if message, exists := flatMessages[key]; exists {
 				if len(args) > 0 {
@@ -198,6 +209,16 @@ func T(key string, args ...interface{}) string {
 	return key
 }
 
+// IsAvailable 判断是否支持该语言
+func IsAvailable(lang Language) bool {
+	for _, available := range GetAvailableLanguages() {
+		if available == lang {
+			return true
+		}
+	}
+	return false
+}
+
 // loadLanguages 加载所有语言
 func (i *I18n) loadLanguages() error {
 	// 加载默认语言
@@ -205,11 +226,14 @@ func (i *I18n) loadLanguages() error {
 		return err
 	}
 
-	// 如果当前语言不是中文，也加载中文作为回退
-	if i.currentLang != LanguageZhCN {
-		if err := i.loadLanguage(LanguageZhCN); err != nil {
-			// 中文加载失败不是致命错误，记录但继续
-			fmt.Printf("Warning: Failed to load Chinese language pack: %v\n", err)
+	// 也加载其它语言：中文作为回退，其它语言用于按会话设置的语言（见 TL）
+	for _, lang := range GetAvailableLanguages() {
+		if lang == i.currentLang {
+			continue
+		}
+		if err := i.loadLanguage(lang); err != nil {
+			// 其它语言加载失败不是致命错误，记录但继续
+			fmt.Printf("Warning: Failed to load language pack %s: %v\n", lang, err)
 		}
 	}
 
@@ -270,6 +294,8 @@ func (i *I18n) flattenMessages(messages *LanguageMessages) map[string]string {
 	flat["model.auto_selected"] = messages.Model.AutoSelected
 	flat["model.multiple_matches"] = messages.Model.MultipleMatches
 	flat["model.no_matches"] = messages.Model.NoMatches
+	flat["model.pattern_selected"] = messages.Model.PatternSelected
+	flat["model.pattern_multiple"] = messages.Model.PatternMultiple
 	flat["model.no_available"] = messages.Model.NoAvailable
 	flat["model.auto_only"] = messages.Model.AutoOnly
 	flat["model.select_prompt"] = messages.Model.SelectPrompt
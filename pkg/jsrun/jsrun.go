@@ -0,0 +1,280 @@
+// Package jsrun 在嵌入的JavaScript引擎（goja，纯Go实现）中执行代码
+// 运行环境中没有文件、网络和定时器，只提供 console、input 和 parseCSV；限制执行时间、内存和输出大小
+// 脚本在子进程（同一个可执行文件，见 Main）中执行，超过内存限制时只有子进程退出，不影响服务进程
+package jsrun
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// maxCallStackSize 最大调用深度，防止无限递归
+	maxCallStackSize = 10000
+	// maxConcurrent 同时执行的脚本（子进程）数，所有脚本最多共使用 maxConcurrent 倍的内存限制
+	maxConcurrent = 4
+	// memoryCheckInterval 检查内存使用的间隔
+	memoryCheckInterval = 20 * time.Millisecond
+)
+
+// slots 限制同时执行的脚本数
+var slots = make(chan struct{}, maxConcurrent)
+
+// Limits 执行限制
+type Limits struct {
+	Timeout   time.Duration // 最长执行时间
+	MaxMemory uint64        // 脚本最多使用的内存字节数，Linux 上由子进程的地址空间限制保证
+	MaxOutput int           // console 输出的最大字节数
+}
+
+// Result 执行结果
+type Result struct {
+	Output string // console 输出
+	Value  string // 最后一个表达式的值，undefined 时为空
+	Error  string // 异常或被中断的原因，成功时为空
+}
+
+// String 作为工具结果返回给模型的文本
+func (r Result) String() string {
+	var parts []string
+	if r.Output != "" {
+		parts = append(parts, "输出:\n"+strings.TrimSuffix(r.Output, "\n"))
+	}
+	if r.Value != "" {
+		parts = append(parts, "结果: "+r.Value)
+	}
+	if r.Error != "" {
+		parts = append(parts, "错误: "+r.Error)
+	}
+	if len(parts) == 0 {
+		return "（没有输出，请使用 console.log 输出结果）"
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Run 在子进程中执行代码，input 可以在脚本中通过全局变量 input 读取
+// 超时、超过内存或输出限制、ctx 被取消时中断执行，原因记录在 Result.Error 中
+func Run(ctx context.Context, code, input string, limits Limits) Result {
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		return Result{Error: "已取消"}
+	}
+	return runWorker(ctx, request{Code: code, Input: input, Limits: limits})
+}
+
+// execute 在当前进程中执行代码
+func execute(ctx context.Context, code, input string, limits Limits) Result {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(maxCallStackSize)
+	output := &outputBuffer{limit: limits.MaxOutput, vm: vm}
+	if err := setupGlobals(vm, output, input); err != nil {
+		return Result{Error: err.Error()}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go watch(ctx, vm, limits, done)
+
+	result := Result{}
+	value, err := runString(vm, code)
+	if err != nil {
+		result.Error = errorMessage(err)
+	} else if value != nil && !goja.IsUndefined(value) {
+		result.Value = stringify(vm, value, true)
+	}
+	result.Output = output.String()
+	return result
+}
+
+// runString 执行代码，引擎内部的panic作为错误返回
+func runString(vm *goja.Runtime, code string) (value goja.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("执行失败: %v", r)
+		}
+	}()
+	return vm.RunString(code)
+}
+
+// watch 超时、ctx 取消或内存使用超过限制时中断执行
+// 子进程中只执行一个脚本，堆的增长都来自该脚本；内存检查使一般的增长能正常中断并返回已有的输出，
+// 检查间隔内的大块分配由子进程的内存限制拦截
+func watch(ctx context.Context, vm *goja.Runtime, limits Limits, done chan struct{}) {
+	timer := time.NewTimer(limits.Timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	baseline := heapBytes()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			vm.Interrupt("已取消")
+			return
+		case <-timer.C:
+			vm.Interrupt(fmt.Sprintf("执行超时（超过 %s）", limits.Timeout))
+			return
+		case <-ticker.C:
+			if limits.MaxMemory == 0 || heapBytes() < baseline+limits.MaxMemory {
+				continue
+			}
+			// 堆中可能有尚未回收的对象，回收后再确认
+			runtime.GC()
+			if heapBytes() >= baseline+limits.MaxMemory {
+				vm.Interrupt(fmt.Sprintf("内存使用超过限制（%dMB）", limits.MaxMemory>>20))
+				return
+			}
+		}
+	}
+}
+
+// heapBytes 当前堆中对象占用的字节数
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// errorMessage 异常或中断的说明
+func errorMessage(err error) string {
+	switch e := err.(type) {
+	case *goja.InterruptedError:
+		return fmt.Sprint(e.Value())
+	case *goja.Exception:
+		return e.Error()
+	case *goja.CompilerSyntaxError:
+		return "语法错误: " + e.Error()
+	}
+	return err.Error()
+}
+
+// setupGlobals 设置全局变量：console、print、input 和 parseCSV
+func setupGlobals(vm *goja.Runtime, output *outputBuffer, input string) error {
+	log := func(call goja.FunctionCall) goja.Value {
+		parts := make([]string, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			parts[i] = stringify(vm, arg, false)
+		}
+		output.WriteLine(strings.Join(parts, " "))
+		return goja.Undefined()
+	}
+	console := vm.NewObject()
+	for _, name := range []string{"log", "info", "warn", "error", "debug"} {
+		if err := console.Set(name, log); err != nil {
+			return err
+		}
+	}
+	if err := vm.Set("console", console); err != nil {
+		return err
+	}
+	if err := vm.Set("print", log); err != nil {
+		return err
+	}
+	if err := vm.Set("input", input); err != nil {
+		return err
+	}
+	return vm.Set("parseCSV", func(call goja.FunctionCall) goja.Value {
+		return parseCSV(vm, call)
+	})
+}
+
+// parseCSV 解析CSV文本：parseCSV(text, {header: true, separator: ";"})
+// 默认返回二维数组，header 为 true 时以第一行为字段名返回对象数组
+func parseCSV(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	reader := csv.NewReader(strings.NewReader(call.Argument(0).String()))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header := false
+	if options, ok := call.Argument(1).Export().(map[string]interface{}); ok {
+		header, _ = options["header"].(bool)
+		if separator, ok := options["separator"].(string); ok && separator != "" {
+			reader.Comma = []rune(separator)[0]
+		}
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		panic(vm.NewGoError(fmt.Errorf("CSV解析失败: %v", err)))
+	}
+	if !header || len(records) == 0 {
+		rows := make([]interface{}, len(records))
+		for i, record := range records {
+			row := make([]interface{}, len(record))
+			for j, field := range record {
+				row[j] = field
+			}
+			rows[i] = row
+		}
+		return vm.ToValue(rows)
+	}
+
+	fields := records[0]
+	rows := make([]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(fields))
+		for j, name := range fields {
+			if j < len(record) {
+				row[name] = record[j]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return vm.ToValue(rows)
+}
+
+// stringify 将值转换为文本：字符串原样输出，其它值使用 JSON.stringify（indent为true时格式化）
+func stringify(vm *goja.Runtime, value goja.Value, indent bool) string {
+	if value == nil || goja.IsUndefined(value) {
+		return "undefined"
+	}
+	if _, ok := value.Export().(string); ok {
+		return value.String()
+	}
+	if json, ok := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify")); ok {
+		space := goja.Undefined()
+		if indent {
+			space = vm.ToValue(2)
+		}
+		if result, err := json(goja.Undefined(), value, goja.Null(), space); err == nil && !goja.IsUndefined(result) {
+			return result.String()
+		}
+	}
+	return value.String()
+}
+
+// outputBuffer 收集 console 输出，超过限制时中断执行
+type outputBuffer struct {
+	builder strings.Builder
+	limit   int
+	vm      *goja.Runtime
+}
+
+func (o *outputBuffer) WriteLine(line string) {
+	if o.limit > 0 && o.builder.Len()+len(line)+1 > o.limit {
+		remaining := o.limit - o.builder.Len()
+		if remaining > 0 {
+			o.builder.WriteString(line[:min(remaining, len(line))])
+		}
+		o.vm.Interrupt(fmt.Sprintf("输出超过限制（%d 字节）", o.limit))
+		return
+	}
+	o.builder.WriteString(line)
+	o.builder.WriteString("\n")
+}
+
+func (o *outputBuffer) String() string {
+	return o.builder.String()
+}
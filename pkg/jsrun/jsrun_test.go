@@ -0,0 +1,88 @@
+package jsrun
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLimits = Limits{Timeout: 2 * time.Second, MaxMemory: 64 << 20, MaxOutput: 1024}
+
+func TestMain(m *testing.M) {
+	Main()
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	result := Run(context.Background(), `console.log("sum", [1, 2, 3].reduce((a, b) => a + b)); ({ok: true})`, "", testLimits)
+	if result.Error != "" || result.Output != "sum 6\n" || result.Value != "{\n  \"ok\": true\n}" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	csv := "name,amount\nalice,10\nbob,32.5\n"
+	result = Run(context.Background(), `parseCSV(input, {header: true}).reduce((s, r) => s + Number(r.amount), 0)`, csv, testLimits)
+	if result.Error != "" || result.Value != "42.5" {
+		t.Errorf("unexpected csv result: %+v", result)
+	}
+
+	result = Run(context.Background(), `console.log("before"); null.x`, "", testLimits)
+	if result.Output != "before\n" || !strings.Contains(result.Error, "TypeError") {
+		t.Errorf("exception should be reported with the output: %+v", result)
+	}
+	if result := Run(context.Background(), `function (`, "", testLimits); result.Error == "" {
+		t.Error("syntax error should be reported")
+	}
+	for _, code := range []string{`require("fs")`, `fetch("http://example.com")`, `setTimeout(() => 1, 0)`} {
+		if result := Run(context.Background(), code, "", testLimits); result.Error == "" {
+			t.Errorf("%s should not be available", code)
+		}
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	limits := testLimits
+	limits.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	result := Run(context.Background(), `while (true) {}`, "", limits)
+	if !strings.Contains(result.Error, "超时") || time.Since(start) > 2*time.Second {
+		t.Errorf("infinite loop should time out: %+v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if result := Run(ctx, `for (;;) {}`, "", testLimits); result.Error != "已取消" {
+		t.Errorf("cancelled run: %+v", result)
+	}
+
+	result = Run(context.Background(), `for (let i = 0; ; i++) console.log("line " + i)`, "", testLimits)
+	if !strings.Contains(result.Error, "输出超过限制") || len(result.Output) > testLimits.MaxOutput {
+		t.Errorf("output should be limited: %d bytes, %q", len(result.Output), result.Error)
+	}
+
+	limits = testLimits
+	limits.MaxMemory = 16 << 20
+	limits.Timeout = 10 * time.Second
+	result = Run(context.Background(), `const a = []; for (;;) a.push({i: a.length, s: "x" + a.length})`, "", limits)
+	if !strings.Contains(result.Error, "内存") {
+		t.Errorf("memory growth should be interrupted: %+v", result)
+	}
+	// 检查间隔内的大块分配由子进程的内存限制拦截
+	if !raceEnabled {
+		for _, code := range []string{`'x'.repeat(400 * 1024 * 1024).length`, `let s = "x"; for (;;) s += s`} {
+			result = Run(context.Background(), code, "", testLimits)
+			if !strings.Contains(result.Error, "内存") {
+				t.Errorf("%s should exceed the memory limit: %+v", code, result)
+			}
+		}
+		result = Run(context.Background(), `'x'.repeat(16 * 1024 * 1024).length`, "", testLimits)
+		if result.Error != "" || result.Value != "16777216" {
+			t.Errorf("allocation within the limit should succeed: %+v", result)
+		}
+	}
+
+	if result := Run(context.Background(), `function f() { return f() } f()`, "", testLimits); result.Error == "" {
+		t.Error("unbounded recursion should fail")
+	}
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package jsrun
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// memoryMargin 内存限制之外留给Go运行时的地址空间（按块保留的堆区域、线程栈等）
+const memoryMargin = 256 << 20
+
+// limitMemory 将当前进程的地址空间限制为当前大小加上 max，超过时分配内存失败，进程退出
+func limitMemory(max uint64) error {
+	size, err := addressSpace()
+	if err != nil {
+		return err
+	}
+	limit := size + max + memoryMargin
+	return syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: limit, Max: limit})
+}
+
+// addressSpace 当前进程的地址空间大小（/proc/self/status 中的 VmSize）
+func addressSpace() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "VmSize:"); found {
+			kilobytes, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("无法解析 VmSize: %v", err)
+			}
+			return kilobytes << 10, nil
+		}
+	}
+	return 0, fmt.Errorf("/proc/self/status 中没有 VmSize")
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package jsrun
+
+// limitMemory 其它系统上不限制子进程的地址空间，只依靠内存检查和 debug.SetMemoryLimit
+func limitMemory(max uint64) error {
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package jsrun
+
+// raceEnabled 竞态检测需要大量预留的影子内存，与子进程的地址空间限制冲突
+const raceEnabled = true
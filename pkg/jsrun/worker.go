@@ -0,0 +1,131 @@
+package jsrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+const (
+	// workerEnv 设置了该环境变量的进程是执行脚本的子进程
+	workerEnv = "SSHAI_JSRUN_WORKER"
+	// workerGrace 子进程启动和返回结果的时间，超过执行时间加上该时间仍未退出的子进程被终止
+	workerGrace = 2 * time.Second
+	// maxStderr 保留的子进程错误输出字节数
+	maxStderr = 4096
+)
+
+// request 发送给子进程的执行请求
+type request struct {
+	Code   string `json:"code"`
+	Input  string `json:"input"`
+	Limits Limits `json:"limits"`
+}
+
+// Main 作为子进程启动时（设置了 workerEnv）从标准输入读取请求，执行后将结果写入标准输出并退出，否则直接返回
+// 使用 Run 的程序（包括测试）需要在 main（TestMain）开始时调用
+func Main() {
+	if os.Getenv(workerEnv) == "" {
+		return
+	}
+	os.Exit(serveWorker(os.Stdin, os.Stdout))
+}
+
+// serveWorker 设置内存限制后执行请求
+func serveWorker(in io.Reader, out io.Writer) int {
+	var req request
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		fmt.Fprintf(os.Stderr, "读取请求失败: %v\n", err)
+		return 1
+	}
+	if req.Limits.MaxMemory > 0 {
+		debug.SetMemoryLimit(int64(req.Limits.MaxMemory))
+		if err := limitMemory(req.Limits.MaxMemory); err != nil {
+			fmt.Fprintf(os.Stderr, "设置内存限制失败: %v\n", err)
+			return 1
+		}
+	}
+	result := execute(context.Background(), req.Code, req.Input, req.Limits)
+	if err := json.NewEncoder(out).Encode(result); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// runWorker 启动子进程执行请求，ctx 取消或子进程超时未退出时终止子进程
+func runWorker(ctx context.Context, req request) Result {
+	if os.Getenv(workerEnv) != "" {
+		// 程序没有调用 Main，不再启动子进程，避免递归
+		return Result{Error: "执行环境错误: 子进程没有处理执行请求"}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return Result{Error: fmt.Sprintf("启动执行进程失败: %v", err)}
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+
+	workerCtx, cancel := context.WithTimeout(ctx, req.Limits.Timeout+workerGrace)
+	defer cancel()
+	cmd := exec.CommandContext(workerCtx, executable)
+	cmd.Env = []string{workerEnv + "=1", "GOMAXPROCS=2"}
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout bytes.Buffer
+	stderr := &limitedWriter{limit: maxStderr}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	switch {
+	case ctx.Err() != nil:
+		return Result{Error: "已取消"}
+	case workerCtx.Err() != nil:
+		return Result{Error: fmt.Sprintf("执行超时（超过 %s）", req.Limits.Timeout)}
+	case err == nil:
+		var result Result
+		if err := json.Unmarshal(stdout.Bytes(), &result); err == nil {
+			return result
+		}
+	}
+	return Result{Error: workerError(stderr.String(), req.Limits)}
+}
+
+// workerError 子进程异常退出的原因，超过内存限制时Go运行时报告内存不足
+func workerError(stderr string, limits Limits) string {
+	for _, message := range []string{"out of memory", "cannot allocate memory", "failed to create new OS thread"} {
+		if strings.Contains(stderr, message) {
+			return fmt.Sprintf("内存使用超过限制（%dMB）", limits.MaxMemory>>20)
+		}
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(stderr), "\n")
+	if line == "" {
+		return "执行进程异常退出"
+	}
+	return "执行进程异常退出: " + line
+}
+
+// limitedWriter 只保留前 limit 个字节
+type limitedWriter struct {
+	buffer bytes.Buffer
+	limit  int
+}
+
+func (w *limitedWriter) Write(data []byte) (int, error) {
+	if remaining := w.limit - w.buffer.Len(); remaining > 0 {
+		w.buffer.Write(data[:min(remaining, len(data))])
+	}
+	return len(data), nil
+}
+
+func (w *limitedWriter) String() string {
+	return w.buffer.String()
+}
@@ -0,0 +1,112 @@
+package kb
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// bm25Index 根据段落内容构建的BM25统计信息，加载索引时构建，不保存到索引文件
+type bm25Index struct {
+	termFreqs []map[string]int // 每段的词频
+	docLens   []int            // 每段的词数
+	docFreqs  map[string]int   // 包含该词的段落数
+	avgLen    float64
+}
+
+// newBM25Index 为段落建立BM25统计信息
+func newBM25Index(chunks []Chunk) *bm25Index {
+	index := &bm25Index{
+		termFreqs: make([]map[string]int, len(chunks)),
+		docLens:   make([]int, len(chunks)),
+		docFreqs:  make(map[string]int),
+	}
+	total := 0
+	for i, chunk := range chunks {
+		freqs := make(map[string]int)
+		tokens := tokenize(chunk.Source + "\n" + chunk.Text)
+		for _, token := range tokens {
+			freqs[token]++
+		}
+		for token := range freqs {
+			index.docFreqs[token]++
+		}
+		index.termFreqs[i] = freqs
+		index.docLens[i] = len(tokens)
+		total += len(tokens)
+	}
+	if len(chunks) > 0 {
+		index.avgLen = float64(total) / float64(len(chunks))
+	}
+	return index
+}
+
+// scores 计算查询与每段的BM25得分
+func (b *bm25Index) scores(query string) []float64 {
+	scores := make([]float64, len(b.termFreqs))
+	n := float64(len(b.termFreqs))
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		df := float64(b.docFreqs[term])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i, freqs := range b.termFreqs {
+			tf := float64(freqs[term])
+			if tf == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(b.docLens[i])/b.avgLen
+			scores[i] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return scores
+}
+
+// tokenize 分词：字母数字按单词切分并转为小写，中日韩文字使用单字和相邻两字
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	var prevHan rune
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens = append(tokens, string(r))
+			if prevHan != 0 {
+				tokens = append(tokens, string([]rune{prevHan, r}))
+			}
+			prevHan = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flush()
+		}
+		prevHan = 0
+	}
+	flush()
+	return tokens
+}
+
+// isCJK 判断是否为中日韩文字（这些文字没有空格分词）
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
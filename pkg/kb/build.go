@@ -0,0 +1,276 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+
+	"sshai/pkg/config"
+)
+
+// embedBatchSize 每次调用 /embeddings 接口的段落数
+const embedBatchSize = 32
+
+// defaultExtensions 默认索引的文件扩展名
+var defaultExtensions = []string{
+	".md", ".markdown", ".txt", ".rst", ".adoc",
+	".go", ".py", ".js", ".ts", ".java", ".c", ".h", ".cpp", ".rs", ".rb", ".php", ".sh",
+	".yaml", ".yml", ".json", ".toml", ".ini", ".conf", ".sql",
+}
+
+// Build 扫描配置的目录重新建立索引并保存到索引文件
+// 配置了向量模型时调用 /embeddings 接口生成向量（复用上次索引中内容未变化的段落的向量），接口不可用时只使用BM25
+func Build(ctx context.Context) (*Index, error) {
+	cfg := config.Get().KnowledgeBase
+	if len(cfg.Dirs) == 0 {
+		return nil, fmt.Errorf("未配置知识库目录 knowledge_base.dirs")
+	}
+
+	index := &Index{BuiltAt: time.Now()}
+	for _, dir := range cfg.Dirs {
+		files, chunks, err := indexDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		index.Files += files
+		index.Chunks = append(index.Chunks, chunks...)
+	}
+
+	if cfg.EmbeddingModel != "" && len(index.Chunks) > 0 {
+		if err := index.embedChunks(ctx, cfg.EmbeddingModel, Current()); err != nil {
+			log.Printf("向量接口不可用，知识库使用BM25检索: %v", err)
+			for i := range index.Chunks {
+				index.Chunks[i].Vector = nil
+			}
+		} else {
+			index.EmbeddingModel = cfg.EmbeddingModel
+		}
+	}
+
+	index.bm25 = newBM25Index(index.Chunks)
+	if err := index.save(indexPath()); err != nil {
+		return nil, fmt.Errorf("保存知识库索引失败: %v", err)
+	}
+	return index, nil
+}
+
+// EnsureIndex 启用了知识库但还没有索引文件时建立索引（服务启动时在后台调用）
+func EnsureIndex() {
+	if !config.Get().KnowledgeBase.Enabled || len(config.Get().KnowledgeBase.Dirs) == 0 {
+		return
+	}
+	if _, err := os.Stat(indexPath()); err == nil {
+		return
+	}
+	log.Println("知识库索引不存在，正在建立索引...")
+	index, err := Build(context.Background())
+	if err != nil {
+		log.Printf("建立知识库索引失败: %v", err)
+		return
+	}
+	log.Printf("知识库索引已建立: %d 个文件，%d 段，%s", index.Files, len(index.Chunks), index.Mode())
+}
+
+// indexDir 索引一个目录，返回文件数和段落
+func indexDir(dir string) (int, []Chunk, error) {
+	cfg := config.Get().KnowledgeBase
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = defaultExtensions
+	}
+	maxSize := cfg.MaxFileSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxFileSize
+	}
+	chunkSize := cfg.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, nil, err
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return 0, nil, fmt.Errorf("知识库目录不可用: %s", dir)
+	}
+
+	files := 0
+	var chunks []Chunk
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("索引知识库时跳过 %s: %v", path, err)
+			return nil
+		}
+		// 跳过隐藏文件和目录（如 .git）
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() || !hasExtension(path, extensions) {
+			return nil
+		}
+		if info, err := entry.Info(); err != nil || info.Size() > maxSize {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || !isText(content) {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		source := filepath.ToSlash(filepath.Join(filepath.Base(root), rel))
+		chunks = append(chunks, splitChunks(source, string(content), chunkSize)...)
+		files++
+		return nil
+	})
+	return files, chunks, err
+}
+
+// hasExtension 判断文件扩展名是否在列表中（不区分大小写）
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, allowed := range extensions {
+		if ext == strings.ToLower(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// isText 判断内容是否为文本（合法的UTF-8且不含NUL字符）
+func isText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.Contains(content, []byte{0})
+}
+
+// splitChunks 按行将文件切分为不超过size字节的段落，Markdown标题处另起一段
+func splitChunks(source, content string, size int) []Chunk {
+	var chunks []Chunk
+	var current strings.Builder
+	start := 1
+	emit := func(end int) {
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		if text != "" {
+			sum := sha256.Sum256([]byte(source + "\n" + text))
+			chunks = append(chunks, Chunk{Source: source, StartLine: start, EndLine: end, Text: text, Hash: hex.EncodeToString(sum[:])})
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, line := range lines {
+		lineNo := i + 1
+		heading := strings.HasPrefix(line, "#") && isMarkdown(source)
+		if current.Len() > 0 && (current.Len()+len(line) > size || (heading && current.Len() > size/4)) {
+			emit(lineNo - 1)
+			start = lineNo
+		}
+		// 超长的行单独成段并截断
+		if len(line) > size {
+			line = truncateUTF8(line, size)
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	emit(len(lines))
+	return chunks
+}
+
+// isMarkdown 判断是否为Markdown文件
+func isMarkdown(source string) bool {
+	ext := strings.ToLower(filepath.Ext(source))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// truncateUTF8 截断字符串到不超过n字节，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// embedChunks 为所有段落生成向量，上次索引使用相同模型且内容未变化的段落复用原来的向量
+func (idx *Index) embedChunks(ctx context.Context, model string, previous *Index) error {
+	cached := make(map[string][]float32)
+	if previous != nil && previous.EmbeddingModel == model {
+		for _, chunk := range previous.Chunks {
+			cached[chunk.Hash] = chunk.Vector
+		}
+	}
+
+	var pending []int
+	for i := range idx.Chunks {
+		if vector, ok := cached[idx.Chunks[i].Hash]; ok {
+			idx.Chunks[i].Vector = vector
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	for begin := 0; begin < len(pending); begin += embedBatchSize {
+		end := begin + embedBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		inputs := make([]string, 0, end-begin)
+		for _, i := range pending[begin:end] {
+			inputs = append(inputs, idx.Chunks[i].Source+"\n"+idx.Chunks[i].Text)
+		}
+		vectors, err := embed(ctx, model, inputs)
+		if err != nil {
+			return err
+		}
+		for j, i := range pending[begin:end] {
+			idx.Chunks[i].Vector = vectors[j]
+		}
+	}
+	return nil
+}
+
+// embed 调用 /embeddings 接口获取向量
+func embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	cfg := config.Get()
+	clientConfig := openai.DefaultConfig(cfg.API.APIKey)
+	clientConfig.BaseURL = cfg.API.BaseURL
+	timeout := time.Duration(cfg.API.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	clientConfig.HTTPClient = &http.Client{Timeout: timeout}
+
+	resp, err := openai.NewClientWithConfig(clientConfig).CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: inputs,
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(inputs) {
+		return nil, fmt.Errorf("/embeddings 返回了 %d 个向量，预期 %d 个", len(resp.Data), len(inputs))
+	}
+	vectors := make([][]float32, len(inputs))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("/embeddings 返回的序号无效: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
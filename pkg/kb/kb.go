@@ -0,0 +1,259 @@
+// Package kb 本地知识库：索引配置的目录（Markdown、文本和代码），检索相关段落并附带引用注入到问题中
+// 配置了向量模型且 /embeddings 接口可用时按向量相似度检索，否则使用BM25
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sshai/pkg/config"
+)
+
+const (
+	defaultIndexFile   = "kb_index.json"
+	defaultChunkSize   = 1500
+	defaultTopK        = 4
+	defaultMaxFileSize = 1 << 20
+)
+
+// Chunk 索引中的一段内容
+type Chunk struct {
+	Source    string    `json:"source"`           // 文件路径（目录名/相对路径）
+	StartLine int       `json:"start_line"`       // 起始行号（从1开始）
+	EndLine   int       `json:"end_line"`         // 结束行号
+	Text      string    `json:"text"`             // 内容
+	Hash      string    `json:"hash"`             // 内容的SHA-256，重建索引时复用未变化段落的向量
+	Vector    []float32 `json:"vector,omitempty"` // 向量，使用BM25时为空
+}
+
+// Citation 引用来源，如 runbooks/db.md:10-42
+func (c Chunk) Citation() string {
+	return fmt.Sprintf("%s:%d-%d", c.Source, c.StartLine, c.EndLine)
+}
+
+// Index 知识库索引
+type Index struct {
+	BuiltAt        time.Time `json:"built_at"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"` // 生成向量使用的模型，为空表示只使用BM25
+	Files          int       `json:"files"`
+	Chunks         []Chunk   `json:"chunks"`
+
+	bm25 *bm25Index
+}
+
+// Result 检索结果
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// store 当前加载的索引，索引文件变化后（如执行 sshai kb reindex）自动重新加载
+var store struct {
+	mutex   sync.Mutex
+	index   *Index
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// indexPath 索引文件路径
+func indexPath() string {
+	if path := config.Get().KnowledgeBase.IndexFile; path != "" {
+		return path
+	}
+	return defaultIndexFile
+}
+
+// topK 每次检索的段落数
+func topK() int {
+	if k := config.Get().KnowledgeBase.TopK; k > 0 {
+		return k
+	}
+	return defaultTopK
+}
+
+// Current 获取当前索引，没有索引文件或加载失败时返回nil
+func Current() *Index {
+	path := indexPath()
+	info, err := os.Stat(path)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if err != nil {
+		store.index = nil
+		return nil
+	}
+	if store.index != nil && store.path == path && store.modTime.Equal(info.ModTime()) && store.size == info.Size() {
+		return store.index
+	}
+
+	index, err := loadIndex(path)
+	if err != nil {
+		log.Printf("加载知识库索引失败: %v", err)
+		return store.index
+	}
+	store.index, store.path, store.modTime, store.size = index, path, info.ModTime(), info.Size()
+	return index
+}
+
+// loadIndex 读取索引文件并建立BM25统计信息
+func loadIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("解析索引文件 %s 失败: %v", path, err)
+	}
+	index.bm25 = newBM25Index(index.Chunks)
+	return &index, nil
+}
+
+// save 写入索引文件（写入临时文件后重命名）并替换当前索引
+func (idx *Index) save(path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.index, store.path = idx, path
+	if info, err := os.Stat(path); err == nil {
+		store.modTime, store.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// Mode 检索方式说明
+func (idx *Index) Mode() string {
+	if idx.EmbeddingModel != "" {
+		return "向量 (" + idx.EmbeddingModel + ")"
+	}
+	return "BM25"
+}
+
+// Status 知识库状态说明，用于 /help 和 /kb
+func Status() string {
+	cfg := config.Get().KnowledgeBase
+	if !cfg.Enabled {
+		return "未启用"
+	}
+	index := Current()
+	if index == nil {
+		return "尚未建立索引（执行 sshai kb reindex 建立）"
+	}
+	return fmt.Sprintf("%d 个文件，%d 段，%s，更新于 %s", index.Files, len(index.Chunks), index.Mode(), index.BuiltAt.Local().Format("2006-01-02 15:04"))
+}
+
+// Search 检索与查询最相关的k个段落
+// 索引有向量时按向量相似度排序，查询的向量获取失败时使用BM25
+func Search(ctx context.Context, query string, k int) ([]Result, error) {
+	index := Current()
+	if index == nil {
+		return nil, fmt.Errorf("知识库尚未建立索引")
+	}
+	if k <= 0 {
+		k = topK()
+	}
+	return index.search(ctx, query, k), nil
+}
+
+func (idx *Index) search(ctx context.Context, query string, k int) []Result {
+	var scores []float64
+	if idx.EmbeddingModel != "" {
+		vectors, err := embed(ctx, idx.EmbeddingModel, []string{query})
+		if err == nil && len(vectors) == 1 {
+			scores = make([]float64, len(idx.Chunks))
+			for i, chunk := range idx.Chunks {
+				scores[i] = cosine(vectors[0], chunk.Vector)
+			}
+		} else {
+			log.Printf("获取查询向量失败，使用BM25检索: %v", err)
+		}
+	}
+	if scores == nil {
+		scores = idx.bm25.scores(query)
+	}
+
+	var results []Result
+	for i, score := range scores {
+		if score > 0 {
+			results = append(results, Result{Chunk: idx.Chunks[i], Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// cosine 计算两个向量的余弦相似度
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Augment 检索与问题相关的段落，将其连同引用编号加入问题
+// 返回新的问题和使用的段落，知识库未启用、没有索引或没有相关内容时返回原问题
+func Augment(ctx context.Context, question string) (string, []Result) {
+	if !config.Get().KnowledgeBase.Enabled || Current() == nil {
+		return question, nil
+	}
+	results, err := Search(ctx, question, 0)
+	if err != nil || len(results) == 0 {
+		return question, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("以下是从知识库检索到的参考资料。如果回答使用了其中的内容，请用 [编号] 标注来源；资料与问题无关时请忽略。\n\n")
+	for i, result := range results {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", i+1, result.Citation(), strings.TrimSpace(result.Text))
+	}
+	b.WriteString("问题：")
+	b.WriteString(question)
+	return b.String(), results
+}
+
+// Citations 引用来源列表，如 [1] runbooks/db.md:10-42
+func Citations(results []Result) []string {
+	citations := make([]string, len(results))
+	for i, result := range results {
+		citations[i] = fmt.Sprintf("[%d] %s", i+1, result.Citation())
+	}
+	return citations
+}
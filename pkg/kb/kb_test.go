@@ -0,0 +1,156 @@
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"sshai/pkg/config"
+)
+
+func TestTokenize(t *testing.T) {
+	got := strings.Join(tokenize("Restart nginx_proxy 服务器, v2"), "|")
+	if want := "restart|nginx_proxy|服|务|服务|器|务器|v2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	content := "# Intro\nhello\n\n# Failover\n" + strings.Repeat("step\n", 10)
+	chunks := splitChunks("docs/db.md", content, 30)
+	if len(chunks) < 3 || chunks[0].Text != "# Intro\nhello" || chunks[0].StartLine != 1 || chunks[0].EndLine != 3 {
+		t.Fatalf("unexpected chunks: %+v", chunks)
+	}
+	if chunks[1].StartLine != 4 || !strings.HasPrefix(chunks[1].Text, "# Failover") {
+		t.Errorf("markdown heading should start a new chunk: %+v", chunks[1])
+	}
+	for _, chunk := range chunks {
+		if len(chunk.Text) > 30 {
+			t.Errorf("chunk exceeds size: %q", chunk.Text)
+		}
+	}
+}
+
+// setupKB 创建测试目录并配置知识库
+func setupKB(t *testing.T) {
+	cfg := config.Get()
+	saved, savedAPI := cfg.KnowledgeBase, cfg.API
+	t.Cleanup(func() { cfg.KnowledgeBase, cfg.API = saved, savedAPI })
+
+	dir := filepath.Join(t.TempDir(), "runbooks")
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("db/failover.md", "# 数据库主从切换\n先确认从库延迟，然后执行 promote 命令。\n")
+	write("nginx.txt", "Reload nginx with systemctl reload nginx after editing the config.\n")
+	write(".git/config", "ignored failover")
+	write("image.md", "binary\x00failover")
+	write("notes.bin", "failover")
+
+	cfg.KnowledgeBase.Enabled = true
+	cfg.KnowledgeBase.Dirs = []string{dir}
+	cfg.KnowledgeBase.IndexFile = filepath.Join(t.TempDir(), "index", "kb.json")
+	cfg.KnowledgeBase.TopK = 2
+	cfg.KnowledgeBase.EmbeddingModel = ""
+}
+
+func TestBuildAndSearchBM25(t *testing.T) {
+	setupKB(t)
+	if Current() != nil {
+		t.Fatal("index should not exist before building")
+	}
+
+	index, err := Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Files != 2 || index.Mode() != "BM25" {
+		t.Errorf("hidden, binary and unknown files should be skipped: %d files, %s", index.Files, index.Mode())
+	}
+
+	results, err := Search(context.Background(), "如何做主从切换", 0)
+	if err != nil || len(results) == 0 || results[0].Citation() != "runbooks/db/failover.md:1-2" {
+		t.Fatalf("unexpected results: %+v %v", results, err)
+	}
+	if results, _ := Search(context.Background(), "reload NGINX", 0); len(results) != 1 || results[0].Source != "runbooks/nginx.txt" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	message, used := Augment(context.Background(), "nginx 怎么重新加载")
+	if len(used) != 1 || !strings.Contains(message, "[1] runbooks/nginx.txt:1-1") || !strings.HasSuffix(message, "问题：nginx 怎么重新加载") {
+		t.Errorf("unexpected augmented message: %q", message)
+	}
+	if message, used := Augment(context.Background(), "unrelated question"); used != nil || message != "unrelated question" {
+		t.Error("question without related passages should be unchanged")
+	}
+	if !strings.Contains(Status(), "2 个文件") {
+		t.Errorf("unexpected status: %s", Status())
+	}
+}
+
+func TestBuildWithEmbeddings(t *testing.T) {
+	setupKB(t)
+	var embedded int32
+	var fail atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() || r.URL.Path != "/embeddings" {
+			http.Error(w, `{"error":{"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		atomic.AddInt32(&embedded, int32(len(req.Input)))
+		// 按是否包含nginx生成二维向量
+		var data []map[string]interface{}
+		for i, input := range req.Input {
+			vector := []float32{1, 0}
+			if strings.Contains(strings.ToLower(input), "nginx") {
+				vector = []float32{0, 1}
+			}
+			data = append(data, map[string]interface{}{"object": "embedding", "index": i, "embedding": vector})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data})
+	}))
+	defer server.Close()
+
+	cfg := config.Get()
+	cfg.API.BaseURL = server.URL
+	cfg.KnowledgeBase.EmbeddingModel = "embed-small"
+
+	index, err := Build(context.Background())
+	if err != nil || index.EmbeddingModel != "embed-small" || embedded != 2 {
+		t.Fatalf("embeddings should be used: %v %+v embedded=%d", err, index, embedded)
+	}
+	if results, _ := Search(context.Background(), "web server nginx", 1); len(results) != 1 || results[0].Source != "runbooks/nginx.txt" {
+		t.Errorf("vector search returned %+v", results)
+	}
+
+	// 重建索引时复用未变化段落的向量（之前只为查询获取过一次向量）
+	if _, err := Build(context.Background()); err != nil || embedded != 3 {
+		t.Errorf("unchanged chunks should not be embedded again: embedded=%d %v", embedded, err)
+	}
+
+	// 查询向量获取失败时使用BM25
+	fail.Store(true)
+	if results, _ := Search(context.Background(), "主从切换", 1); len(results) != 1 || results[0].Source != "runbooks/db/failover.md" {
+		t.Errorf("search should fall back to BM25: %+v", results)
+	}
+
+	// 接口不可用时只使用BM25建立索引
+	cfg.KnowledgeBase.EmbeddingModel = "embed-large"
+	if index, err := Build(context.Background()); err != nil || index.EmbeddingModel != "" || index.Chunks[0].Vector != nil {
+		t.Errorf("index should fall back to BM25: %v %+v", err, index)
+	}
+}
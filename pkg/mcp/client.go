@@ -16,6 +16,7 @@ import (
 
 	"sshai/pkg/config"
 	"sshai/pkg/i18n"
+	"sshai/pkg/metrics"
 )
 
 // Tool MCP工具信息
@@ -450,8 +451,12 @@ func (m *MCPManager) CallToolWithOptions(toolName string, arguments map[string]i
 		Arguments: arguments,
 	}
 
+	start := time.Now()
+	metrics.ToolCalls.Inc(tool.ServerName)
 	result, err := client.CallTool(ctx, params)
+	metrics.ObserveSince(metrics.ToolCallDuration, start, tool.ServerName)
 	if err != nil {
+		metrics.ToolCallErrors.Inc(tool.ServerName)
 		if channel != nil && showOutput {
 			channel.Write([]byte(fmt.Sprintf("❌ %s: %v\r\n", i18n.T("mcp.tool_error"), err)))
 		}
@@ -460,6 +465,7 @@ func (m *MCPManager) CallToolWithOptions(toolName string, arguments map[string]i
 
 	// 处理结果
 	if result.IsError {
+		metrics.ToolCallErrors.Inc(tool.ServerName)
 		log.Printf("MCP工具执行错误: IsError=%v", result.IsError)
 		log.Printf("MCP工具错误内容数量: %d", len(result.Content))
 		for i, content := range result.Content {
@@ -514,6 +520,44 @@ func (m *MCPManager) RefreshTools() {
 	}
 }
 
+// RestartServer 断开并重新连接指定的MCP服务器，然后刷新工具列表
+func (m *MCPManager) RestartServer(name string) error {
+	cfg := config.Get()
+	if !cfg.MCP.Enabled {
+		return fmt.Errorf("MCP功能未启用")
+	}
+
+	var serverCfg *config.MCPServer
+	for i := range cfg.MCP.Servers {
+		if cfg.MCP.Servers[i].Name == name {
+			serverCfg = &cfg.MCP.Servers[i]
+			break
+		}
+	}
+	if serverCfg == nil {
+		return fmt.Errorf("未找到MCP服务器: %s", name)
+	}
+	if !serverCfg.Enabled {
+		return fmt.Errorf("MCP服务器 %s 未启用", name)
+	}
+
+	log.Printf("重启MCP服务器: %s", name)
+	m.mutex.Lock()
+	if client, ok := m.clients[name]; ok {
+		if err := client.Close(); err != nil {
+			log.Printf("关闭MCP客户端 %s 失败: %v", name, err)
+		}
+		delete(m.clients, name)
+	}
+	m.mutex.Unlock()
+
+	if err := m.connectToServer(*serverCfg); err != nil {
+		m.refreshTools()
+		return err
+	}
+	return m.refreshTools()
+}
+
 // GetServerStatus 获取服务器状态
 func (m *MCPManager) GetServerStatus() map[string]bool {
 	m.mutex.RLock()
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"sshai/pkg/version"
+)
+
+// Default 全局指标注册表，/metrics 端点输出其中的所有指标
+var Default = NewRegistry()
+
+// 各阶段耗时直方图的桶（秒）
+var (
+	firstTokenBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60}
+	requestBuckets    = []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600}
+	toolCallBuckets   = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+)
+
+// SSH连接和认证
+var (
+	ConnectionsActive = Default.NewGaugeVec("sshai_ssh_connections_active",
+		"当前已建立的SSH连接数")
+	ConnectionsTotal = Default.NewCounterVec("sshai_ssh_connections_total",
+		"已建立的SSH连接总数")
+	HandshakeFailures = Default.NewCounterVec("sshai_ssh_handshake_failures_total",
+		"SSH握手失败（包括认证失败后断开）的连接数")
+	SessionsActive = Default.NewGaugeVec("sshai_ssh_sessions_active",
+		"当前打开的SSH会话通道数")
+	AuthAttempts = Default.NewCounterVec("sshai_auth_attempts_total",
+		"SSH认证尝试次数，按认证方式和结果区分", "method", "result")
+	RejectedConnections = Default.NewCounterVec("sshai_ssh_rejected_connections_total",
+		"在SSH握手前被拒绝的连接数，按原因区分", "reason")
+	Bans = Default.NewCounterVec("sshai_auth_bans_total",
+		"因认证失败次数过多触发的临时封禁次数")
+)
+
+// AI请求
+var (
+	Requests = Default.NewCounterVec("sshai_ai_requests_total",
+		"发送到上游API的流式请求数，按模型区分", "model")
+	TimeToFirstToken = Default.NewHistogramVec("sshai_ai_time_to_first_token_seconds",
+		"从发送请求到收到第一个token的耗时", firstTokenBuckets, "model")
+	RequestDuration = Default.NewHistogramVec("sshai_ai_request_duration_seconds",
+		"流式请求的总耗时（包括工具调用）", requestBuckets, "model")
+	UpstreamErrors = Default.NewCounterVec("sshai_ai_upstream_errors_total",
+		"上游API错误数，按HTTP状态码区分（network表示网络错误）", "status")
+	ModelCacheRequests = Default.NewCounterVec("sshai_model_cache_requests_total",
+		"模型列表缓存的查询次数，按是否命中区分", "result")
+)
+
+// MCP工具调用
+var (
+	ToolCalls = Default.NewCounterVec("sshai_mcp_tool_calls_total",
+		"MCP工具调用次数，按服务器区分", "server")
+	ToolCallDuration = Default.NewHistogramVec("sshai_mcp_tool_call_duration_seconds",
+		"MCP工具调用耗时，按服务器区分", toolCallBuckets, "server")
+	ToolCallErrors = Default.NewCounterVec("sshai_mcp_tool_call_errors_total",
+		"MCP工具调用失败次数（包括工具返回的错误），按服务器区分", "server")
+)
+
+// 构建信息
+var buildInfo = Default.NewGaugeVec("sshai_build_info",
+	"构建信息，值恒为1", "version", "commit")
+
+func init() {
+	buildInfo.Set(1, version.Version, version.GitCommit)
+}
+
+// ObserveSince 记录从start开始的耗时（秒）
+func ObserveSince(h *HistogramVec, start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// StatusLabel 将HTTP状态码转换为标签值，0表示没有收到响应
+func StatusLabel(statusCode int) string {
+	if statusCode == 0 {
+		return "network"
+	}
+	return strconv.Itoa(statusCode)
+}
@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricType 指标类型，对应Prometheus文本格式中的TYPE
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// labelSeparator 组合标签值时使用的分隔符，不会出现在正常的标签值中
+const labelSeparator = "\xff"
+
+// family 一个指标名下所有标签组合的数据
+type family struct {
+	name       string
+	help       string
+	kind       metricType
+	labelNames []string
+	buckets    []float64 // 仅直方图使用，升序
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+// series 一组标签值对应的数据
+type series struct {
+	labelValues []string
+	value       float64  // 计数器和仪表盘的值
+	counts      []uint64 // 直方图每个桶的计数（非累计）
+	count       uint64   // 直方图观测次数
+	sum         float64  // 直方图观测值之和
+}
+
+// get 获取标签值对应的数据，不存在时创建，调用方需持有锁
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值，实际为 %d 个", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, labelSeparator)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec 按标签区分的计数器，只能增加
+type CounterVec struct{ f *family }
+
+// Inc 计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 计数增加指定值，负数会被忽略
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.f.mutex.Lock()
+	defer c.f.mutex.Unlock()
+	c.f.get(labelValues).value += delta
+}
+
+// Value 获取当前计数，主要用于测试
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.f.mutex.Lock()
+	defer c.f.mutex.Unlock()
+	return c.f.get(labelValues).value
+}
+
+// GaugeVec 按标签区分的仪表盘，可增可减
+type GaugeVec struct{ f *family }
+
+// Inc 值加一
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec 值减一
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Add 值增加指定数量
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.get(labelValues).value += delta
+}
+
+// Set 设置值
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.get(labelValues).value = value
+}
+
+// Value 获取当前值，主要用于测试
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	return g.f.get(labelValues).value
+}
+
+// HistogramVec 按标签区分的直方图
+type HistogramVec struct{ f *family }
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.f.mutex.Lock()
+	defer h.f.mutex.Unlock()
+	s := h.f.get(labelValues)
+	for i, upper := range h.f.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count 获取观测次数，主要用于测试
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.f.mutex.Lock()
+	defer h.f.mutex.Unlock()
+	return h.f.get(labelValues).count
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mutex    sync.RWMutex
+	families []*family
+	names    map[string]bool
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register 注册指标，名称重复时panic（属于编程错误）
+func (r *Registry) register(f *family) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.names[f.name] {
+		panic(fmt.Sprintf("指标 %s 重复注册", f.name))
+	}
+	r.names[f.name] = true
+	r.families = append(r.families, f)
+}
+
+// newFamily 创建并注册指标
+func (r *Registry) newFamily(name, help string, kind metricType, buckets []float64, labelNames []string) *family {
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	r.register(f)
+	return f
+}
+
+// NewCounterVec 创建并注册计数器
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{f: r.newFamily(name, help, typeCounter, nil, labelNames)}
+}
+
+// NewGaugeVec 创建并注册仪表盘
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{f: r.newFamily(name, help, typeGauge, nil, labelNames)}
+}
+
+// NewHistogramVec 创建并注册直方图，buckets为各个桶的上限
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{f: r.newFamily(name, help, typeHistogram, sorted, labelNames)}
+}
+
+// WriteText 按Prometheus文本格式（0.0.4）输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.RLock()
+	families := append([]*family(nil), r.families...)
+	r.mutex.RUnlock()
+
+	var b strings.Builder
+	for _, f := range families {
+		f.writeText(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeText 输出一个指标的HELP、TYPE和所有数据行
+func (f *family) writeText(b *strings.Builder) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.kind)
+
+	// 没有标签的指标即使没有数据也输出0，便于查询
+	if len(f.labelNames) == 0 {
+		f.get(nil)
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != typeHistogram {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, upper := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// formatLabels 格式化标签，extraName非空时追加一个标签（直方图的le）
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatValue 格式化数值
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeHelp 转义HELP文本中的反斜杠和换行
+func escapeHelp(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(text)
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("test_requests_total", "请求数", "model")
+	active := registry.NewGaugeVec("test_active", "活跃连接")
+	latency := registry.NewHistogramVec("test_latency_seconds", "延迟", []float64{1, 0.5}, "model")
+
+	requests.Inc(`gpt"4`)
+	requests.Add(2, "llama\n3")
+	requests.Add(-1, "llama\n3") // 计数器不能减少
+	active.Inc()
+	active.Inc()
+	active.Dec()
+	latency.Observe(0.2, "m")
+	latency.Observe(0.7, "m")
+	latency.Observe(3, "m")
+
+	var b strings.Builder
+	if err := registry.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_requests_total 请求数
+# TYPE test_requests_total counter
+test_requests_total{model="gpt\"4"} 1
+test_requests_total{model="llama\n3"} 2
+# HELP test_active 活跃连接
+# TYPE test_active gauge
+test_active 1
+# HELP test_latency_seconds 延迟
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{model="m",le="0.5"} 1
+test_latency_seconds_bucket{model="m",le="1"} 2
+test_latency_seconds_bucket{model="m",le="+Inf"} 3
+test_latency_seconds_sum{model="m"} 3.9
+test_latency_seconds_count{model="m"} 3
+`
+	if b.String() != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Default.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body := recorder.Body.String()
+	for _, name := range []string{"sshai_ssh_connections_active 0", "# TYPE sshai_ai_time_to_first_token_seconds histogram", "sshai_build_info{"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("metrics output missing %q", name)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	Default.Handler().ServeHTTP(recorder, httptest.NewRequest("POST", "/metrics", nil))
+	if recorder.Code != 405 {
+		t.Errorf("POST should be rejected, got %d", recorder.Code)
+	}
+}
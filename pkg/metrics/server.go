@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// contentType Prometheus文本格式的Content-Type
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler 返回输出指标的HTTP处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		if req.Method == http.MethodHead {
+			return
+		}
+		if err := r.WriteText(w); err != nil {
+			log.Printf("输出指标失败: %v", err)
+		}
+	})
+}
+
+// StartServer 在后台启动指标HTTP服务，path为空时使用 /metrics
+func StartServer(listen, path string) (*http.Server, error) {
+	if path == "" {
+		path = "/metrics"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, Default.Handler())
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// 先监听端口，这样地址被占用等错误可以直接返回
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("指标服务异常退出: %v", err)
+		}
+	}()
+
+	log.Printf("指标服务已启动: http://%s%s", listener.Addr(), path)
+	return server, nil
+}
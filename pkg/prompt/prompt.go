@@ -0,0 +1,154 @@
+// Package prompt 渲染提示词模板（text/template），模板中可以使用会话变量并引用提示词目录中的文件
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"sshai/pkg/config"
+)
+
+const (
+	// DefaultStdinPrompt 未配置 prompt.stdin_prompt 时使用的提示词
+	DefaultStdinPrompt = "请分析以下内容并提供相关的帮助或建议："
+	// DefaultExecPrompt 未配置 prompt.exec_prompt 时使用的提示词
+	DefaultExecPrompt = "请回答以下问题或执行以下任务："
+
+	// maxIncludeDepth include 的最大嵌套层数，防止文件相互引用导致无限递归
+	maxIncludeDepth = 8
+)
+
+// Data 提示词模板中可用的变量
+type Data struct {
+	User          string   // 会话身份
+	LoginName     string   // 登录用户名
+	Model         string   // 当前模型
+	Persona       string   // 当前角色，未选择角色时为空
+	Lang          string   // 界面语言，如 zh-cn
+	RemoteAddr    string   // 客户端地址
+	ClientVersion string   // 客户端版本，如 SSH-2.0-OpenSSH_9.6
+	Tools         []string // 当前会话可用的工具名称
+	Input         string   // 自定义命令的输入（命令参数或stdin内容）
+	Date          string   // 当前日期（2006-01-02），为空时渲染时自动填充
+	Time          string   // 当前时间（15:04），为空时渲染时自动填充
+}
+
+// IsTemplate 判断文本是否包含模板语法，不包含时无需渲染
+func IsTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// Render 渲染提示词模板，name 用于错误信息
+func Render(name, text string, data Data) (string, error) {
+	if !IsTemplate(text) {
+		return text, nil
+	}
+	now := time.Now()
+	if data.Date == "" {
+		data.Date = now.Format("2006-01-02")
+	}
+	if data.Time == "" {
+		data.Time = now.Format("15:04")
+	}
+	return render(name, text, data, 0)
+}
+
+// RenderFile 渲染提示词目录中的模板文件
+func RenderFile(file string, data Data) (string, error) {
+	text, err := readPromptFile(file)
+	if err != nil {
+		return "", err
+	}
+	return Render(file, text, data)
+}
+
+func render(name, text string, data Data, depth int) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcMap(data, depth)).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析提示词模板 %s 失败: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("渲染提示词模板 %s 失败: %v", name, err)
+	}
+	return buf.String(), nil
+}
+
+// funcMap 模板中可用的函数，只包含字符串处理、时间格式化和读取提示词目录中的文件
+func funcMap(data Data, depth int) template.FuncMap {
+	return template.FuncMap{
+		"include": func(file string) (string, error) {
+			if depth >= maxIncludeDepth {
+				return "", fmt.Errorf("include 嵌套超过 %d 层", maxIncludeDepth)
+			}
+			text, err := readPromptFile(file)
+			if err != nil {
+				return "", err
+			}
+			return render(file, text, data, depth+1)
+		},
+		"date": func(layout string) string {
+			return time.Now().Format(layout)
+		},
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"join":      func(sep string, items []string) string { return strings.Join(items, sep) },
+		"has":       func(item string, items []string) bool { return contains(items, item) },
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	}
+}
+
+// readPromptFile 读取提示词目录（prompt.prompts_dir）中的文件，不允许访问目录之外的文件
+func readPromptFile(file string) (string, error) {
+	dir := config.Get().Prompt.PromptsDir
+	if dir == "" {
+		return "", fmt.Errorf("未配置提示词目录 prompt.prompts_dir，无法引用 %s", file)
+	}
+	if filepath.IsAbs(file) {
+		return "", fmt.Errorf("只能引用提示词目录中的文件: %s", file)
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("提示词目录不可用: %v", err)
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, file))
+	if err != nil {
+		return "", fmt.Errorf("提示词文件不可用: %v", err)
+	}
+	// 符号链接解析后仍需位于提示词目录中
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("只能引用提示词目录中的文件: %s", file)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取提示词文件失败: %v", err)
+	}
+	return string(content), nil
+}
+
+func contains(items []string, item string) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sshai/pkg/config"
+)
+
+func TestRender(t *testing.T) {
+	data := Data{User: "alice", Model: "qwen", Lang: "en-us", RemoteAddr: "10.0.0.1:5555", Tools: []string{"git_log", "search"}}
+
+	text := `{{.User}}@{{.RemoteAddr}} {{.Model}} {{upper .Lang}} [{{join "," .Tools}}] {{if has "search" .Tools}}can search{{end}} {{default "none" .Persona}}`
+	got, err := Render("system_prompt", text, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice@10.0.0.1:5555 qwen EN-US [git_log,search] can search none"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, _ := Render("system_prompt", "{{.Date}}", data); len(got) != len("2006-01-02") {
+		t.Errorf("date should be filled automatically, got %q", got)
+	}
+
+	// 不含模板语法的提示词原样返回
+	if got, err := Render("plain", "100% {literal}", data); err != nil || got != "100% {literal}" {
+		t.Errorf("plain prompt changed: %q %v", got, err)
+	}
+	for _, invalid := range []string{"{{.Missing}}", "{{.User", `{{env "HOME"}}`} {
+		if _, err := Render("invalid", invalid, data); err == nil {
+			t.Errorf("%q should fail to render", invalid)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Prompt.PromptsDir
+	defer func() { cfg.Prompt.PromptsDir = saved }()
+
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "common"), 0755)
+	write(filepath.Join(dir, "common", "rules.md"), "rules for {{.User}}")
+	write(filepath.Join(dir, "ops.md"), `ops: {{include "common/rules.md"}}`)
+	write(filepath.Join(dir, "loop.md"), `{{include "loop.md"}}`)
+	write(outside, "secret")
+	os.Symlink(outside, filepath.Join(dir, "link.md"))
+
+	data := Data{User: "bob"}
+	if _, err := Render("system_prompt", `{{include "ops.md"}}`, data); err == nil {
+		t.Error("include should fail without prompts_dir")
+	}
+
+	cfg.Prompt.PromptsDir = dir
+	if got, err := Render("system_prompt", `{{include "ops.md"}}`, data); err != nil || got != "ops: rules for bob" {
+		t.Errorf("nested include: %q %v", got, err)
+	}
+	for _, file := range []string{"../" + filepath.Base(filepath.Dir(outside)) + "/secret.txt", outside, "link.md", "loop.md", "missing.md"} {
+		if got, err := Render("system_prompt", `{{include "`+file+`"}}`, data); err == nil || strings.Contains(got, "secret") {
+			t.Errorf("include %q should be rejected", file)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package remote 远程运维工具：通过SSH在主机清单中的主机上执行命令
+// 命令需要满足允许和禁止规则，非只读命令需要用户在终端中确认，每条命令都记录审计日志
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"sshai/pkg/config"
+)
+
+const (
+	defaultTimeout         = 30 * time.Second
+	defaultApprovalTimeout = 120 * time.Second
+	defaultMaxOutput       = 16 << 10
+	// dialTimeout 连接和SSH握手的超时时间
+	dialTimeout = 10 * time.Second
+)
+
+// Enabled 是否启用了远程运维工具（需要配置至少一台主机）
+func Enabled() bool {
+	cfg := config.Get().Remote
+	return cfg.Enabled && len(cfg.Hosts) > 0
+}
+
+// limits 配置的超时时间和输出限制，未配置时使用默认值
+func limits() (timeout, approvalTimeout time.Duration, maxOutput int) {
+	cfg := config.Get().Remote
+	timeout, approvalTimeout, maxOutput = defaultTimeout, defaultApprovalTimeout, defaultMaxOutput
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	if cfg.ApprovalTimeout > 0 {
+		approvalTimeout = time.Duration(cfg.ApprovalTimeout) * time.Second
+	}
+	if cfg.MaxOutput > 0 {
+		maxOutput = cfg.MaxOutput
+	}
+	return timeout, approvalTimeout, maxOutput
+}
+
+// findHost 按名称查找主机（不区分大小写）
+func findHost(name string) (*config.RemoteHost, error) {
+	hosts := config.Get().Remote.Hosts
+	for i := range hosts {
+		if strings.EqualFold(hosts[i].Name, name) {
+			return &hosts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("主机 %s 不在主机清单中", name)
+}
+
+// rulesFor 主机的命令规则：全局规则加上主机自己的规则
+func rulesFor(host *config.RemoteHost) Rules {
+	cfg := config.Get().Remote
+	readonly := cfg.Readonly
+	if len(readonly) == 0 {
+		readonly = defaultReadonly
+	}
+	return Rules{
+		Allow:    append(append([]string{}, cfg.Allow...), host.Allow...),
+		Deny:     append(append([]string{}, cfg.Deny...), host.Deny...),
+		Readonly: append(append([]string{}, readonly...), host.Readonly...),
+	}
+}
+
+// address 主机地址，省略端口时使用22
+func address(host *config.RemoteHost) string {
+	if _, _, err := net.SplitHostPort(host.Address); err == nil {
+		return host.Address
+	}
+	return net.JoinHostPort(host.Address, "22")
+}
+
+// clientConfig 主机的SSH客户端配置：私钥和密码认证，按 host_key 或 known_hosts 验证主机公钥
+func clientConfig(host *config.RemoteHost) (*ssh.ClientConfig, error) {
+	var methods []ssh.AuthMethod
+	if host.KeyFile != "" {
+		data, err := os.ReadFile(expandHome(host.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("读取私钥失败: %v", err)
+		}
+		var signer ssh.Signer
+		if host.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(host.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析私钥失败: %v", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if host.Password != "" {
+		password := host.Password
+		methods = append(methods, ssh.Password(password), ssh.KeyboardInteractive(
+			func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("主机 %s 没有配置密码或私钥", host.Name)
+	}
+
+	hostKeyCallback, err := hostKeyCallback(host)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            host.User,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}, nil
+}
+
+// hostKeyCallback 验证主机公钥：优先使用主机配置的 host_key，否则使用 known_hosts 文件
+func hostKeyCallback(host *config.RemoteHost) (ssh.HostKeyCallback, error) {
+	if host.HostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(host.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("解析主机 %s 的 host_key 失败: %v", host.Name, err)
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+	path := config.Get().Remote.KnownHosts
+	if path == "" {
+		path = "~/.ssh/known_hosts"
+	}
+	callback, err := knownhosts.New(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("主机 %s 没有配置 host_key，读取 known_hosts 失败: %v", host.Name, err)
+	}
+	return callback, nil
+}
+
+// Output 命令的执行结果
+type Output struct {
+	Text      string // 标准输出和标准错误（超过限制时截断）
+	Size      int    // 输出的总字节数
+	ExitCode  int    // 退出码，-1表示没有收到退出码（如被信号终止）
+	Truncated bool   // 输出是否被截断
+}
+
+// Execute 在主机上执行命令，ctx 取消或超时时断开连接
+func Execute(ctx context.Context, host *config.RemoteHost, command string, maxOutput int) (*Output, error) {
+	clientConfig, err := clientConfig(host)
+	if err != nil {
+		return nil, err
+	}
+	addr := address(host)
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接 %s 失败: %v", host.Name, err)
+	}
+	// 握手期间 ctx 取消时关闭连接
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, contextError(ctx)
+		}
+		return nil, fmt.Errorf("连接 %s 失败: %v", host.Name, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("创建SSH会话失败: %v", err)
+	}
+	defer session.Close()
+
+	output := &limitedBuffer{limit: maxOutput}
+	session.Stdout = output
+	session.Stderr = output
+	err = session.Run(command)
+	if ctx.Err() != nil {
+		return nil, contextError(ctx)
+	}
+
+	result := &Output{Text: output.String(), Size: output.size, Truncated: output.size > maxOutput}
+	var exitError *ssh.ExitError
+	var missingError *ssh.ExitMissingError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitError):
+		result.ExitCode = exitError.ExitStatus()
+	case errors.As(err, &missingError):
+		result.ExitCode = -1
+	default:
+		return nil, fmt.Errorf("执行命令失败: %v", err)
+	}
+	return result, nil
+}
+
+// contextError ctx 结束的原因
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("命令执行超时")
+	}
+	return fmt.Errorf("命令已取消")
+}
+
+// limitedBuffer 只保留前 limit 字节的输出，记录总字节数，标准输出和标准错误可能同时写入
+type limitedBuffer struct {
+	mutex   sync.Mutex
+	builder strings.Builder
+	limit   int
+	size    int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.size += len(p)
+	if remaining := b.limit - b.builder.Len(); remaining > 0 {
+		b.builder.Write(p[:min(remaining, len(p))])
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return strings.ToValidUTF8(b.builder.String(), "")
+}
+
+// expandHome 展开路径中的用户主目录（~/）
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[2:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,330 @@
+package remote
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/audit"
+	"sshai/pkg/config"
+)
+
+// testServer 进程内的SSH服务器，记录收到的命令，按命令返回预设的输出和退出码
+type testServer struct {
+	addr    string
+	hostKey ssh.PublicKey
+	mutex   sync.Mutex
+	ran     []string
+}
+
+func (s *testServer) commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.ran...)
+}
+
+func startServer(t *testing.T) *testServer {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "ops" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &testServer{addr: listener.Addr().String(), hostKey: signer.PublicKey()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, serverConfig)
+		}
+	}()
+	return server
+}
+
+func (s *testServer) serve(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				length := binary.BigEndian.Uint32(req.Payload)
+				command := string(req.Payload[4 : 4+length])
+				req.Reply(true, nil)
+				s.mutex.Lock()
+				s.ran = append(s.ran, command)
+				s.mutex.Unlock()
+
+				status := 0
+				switch command {
+				case "uptime":
+					channel.Write([]byte("up 3 days\n"))
+				case "systemctl restart nginx":
+					channel.Write([]byte("restarted\n"))
+				case "cat /var/log/big":
+					channel.Write([]byte(strings.Repeat("x", 1000)))
+				case "ls /missing":
+					channel.Stderr().Write([]byte("ls: /missing: No such file or directory\n"))
+					status = 2
+				case "sleep 60":
+					time.Sleep(2 * time.Second)
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+				return
+			}
+		}()
+	}
+}
+
+// testOperator 预设确认结果，记录请求确认的命令
+type testOperator struct {
+	approve bool
+	asked   []string
+}
+
+func (o *testOperator) Approve(ctx context.Context, host, command string) (bool, error) {
+	o.asked = append(o.asked, host+": "+command)
+	return o.approve, nil
+}
+
+func (o *testOperator) AuditIdentity(mode string) audit.Identity {
+	return audit.Identity{SessionID: 7, User: "alice", Mode: mode}
+}
+
+// setup 配置指向测试服务器的主机清单，并启用审计日志
+func setup(t *testing.T, server *testServer) string {
+	cfg := config.Get()
+	savedRemote, savedAudit := cfg.Remote, cfg.Audit
+	t.Cleanup(func() {
+		audit.Close()
+		cfg.Remote, cfg.Audit = savedRemote, savedAudit
+	})
+	cfg.Remote.Enabled = true
+	cfg.Remote.Timeout = 1
+	cfg.Remote.MaxOutput = 100
+	cfg.Remote.Allow = nil
+	cfg.Remote.Readonly = nil
+	cfg.Remote.Deny = []string{"rm -rf*", "reboot"}
+	cfg.Remote.Hosts = []config.RemoteHost{{
+		Name:     "web1",
+		Address:  server.addr,
+		User:     "ops",
+		Password: "secret",
+		HostKey:  string(ssh.MarshalAuthorizedKey(server.hostKey)),
+		Deny:     []string{"systemctl stop*"},
+	}}
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg.Audit.Enabled = true
+	cfg.Audit.File = auditFile
+	cfg.Audit.PrivacyMode = false
+	if err := audit.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return auditFile
+}
+
+func TestRulesCheck(t *testing.T) {
+	rules := Rules{Deny: []string{"rm -rf*", "shutdown"}, Readonly: defaultReadonly}
+	cases := []struct {
+		command  string
+		readonly bool
+		allowed  bool
+	}{
+		{"uptime", true, true},
+		{"df -h | sort -k5 && free -m", true, true},
+		{"grep -i error /var/log/nginx/error.log 2>&1 | tail -n 50", true, true},
+		{"cut -d' ' -f1 access.log | sort | uniq -c | sort -rn -k1 | head", true, true},
+		{"systemctl status nginx", true, true},
+		{"systemctl restart nginx", false, true},
+		{"cat /etc/hosts > /tmp/hosts", false, true},
+		{"uptime >/dev/null 2>&1; df -h 2>/dev/null|sort", true, true},
+		{"ls &>/dev/null", true, true},
+		{"echo pwned >/dev/nullx", false, true},
+		{"cat a &>/dev/null.sh", false, true},
+		{"cat a 2>/dev/null/x", false, true},
+		{"echo $(id)", false, false},
+		{"cat `rm -rf ~`", false, false},
+		{"diff <(ls) >(rm -rf /)", false, false},
+		{"sort -o /etc/passwd x", false, true},
+		{"sort -uo /etc/passwd x", false, true},
+		{"sort --out=/etc/passwd x", false, true},
+		{"sort --compress-program=sh x", false, true},
+		{"sort -t o -k2 x", true, true},
+		{"sort -to x", true, true},
+		{"uniq -c in", true, true},
+		{"uniq -f 1 in out", false, true},
+		{"date -s 2020-01-01", false, true},
+		{"ip addr a 1.2.3.4/24 dev eth0", false, true},
+		{"ip link s eth0 down", false, true},
+		{"ip r d default", false, true},
+		{"dmesg -rc", false, true},
+		{"ss -tK", false, true},
+		{"journalctl --vacuum-size=1M", false, true},
+		{"hostname newname", false, true},
+		{"uptime; rm -rf /", false, false},
+		{"sudo rm -rf /var", false, false},
+		{"sudo -u root rm -rf /var", false, false},
+		{"sudo -iu root rm -rf /var", false, false},
+		{"/bin/rm -rf /", false, false},
+		{"env LANG=C rm -rf /", false, false},
+		{"env -S 'rm -rf /'", false, false},
+		{"find / | xargs -n 1 rm -rf", false, false},
+		{"timeout -s KILL 5 nice -n 10 rm -rf /", false, false},
+		{"LANG=C 'r'm -rf /", false, false},
+		{"$CMD -rf /", false, false},
+		{"sudo cat /etc/hosts", true, true},
+		{"sudo -i", false, true},
+		{"ls && shutdown", false, false},
+		{"shutdownx", false, true},
+		{"", false, false},
+	}
+	for _, c := range cases {
+		readonly, err := rules.Check(c.command)
+		if (err == nil) != c.allowed || readonly != c.readonly {
+			t.Errorf("%q: readonly=%v err=%v, want readonly=%v allowed=%v", c.command, readonly, err, c.readonly, c.allowed)
+		}
+	}
+
+	allowOnly := Rules{Allow: []string{"systemctl * nginx", "uptime"}}
+	if _, err := allowOnly.Check("systemctl reload nginx"); err != nil {
+		t.Errorf("allowed command rejected: %v", err)
+	}
+	if _, err := allowOnly.Check("uptime && systemctl reload php-fpm"); err == nil {
+		t.Error("command outside the allowlist should be rejected")
+	}
+	for _, command := range []string{"uptime $(rm -rf ~)", "uptime `reboot`", "/usr/bin/env rm -rf /"} {
+		if _, err := allowOnly.Check(command); err == nil {
+			t.Errorf("%q should not pass the allowlist", command)
+		}
+	}
+}
+
+func TestRemoteExec(t *testing.T) {
+	server := startServer(t)
+	auditFile := setup(t, server)
+	operator := &testOperator{}
+	ctx := context.Background()
+
+	// 只读命令不需要确认
+	result, err := run(ctx, operator, "WEB1", "uptime")
+	if err != nil || result != "退出码: 0\nup 3 days" || len(operator.asked) != 0 {
+		t.Errorf("readonly command: %q %v, asked %v", result, err, operator.asked)
+	}
+	// 非零退出码和标准错误作为结果返回
+	result, err = run(ctx, operator, "web1", "ls /missing")
+	if err != nil || !strings.HasPrefix(result, "退出码: 2\nls: /missing") {
+		t.Errorf("failing command: %q %v", result, err)
+	}
+
+	// 拒绝确认时不执行
+	if _, err := run(ctx, operator, "web1", "systemctl restart nginx"); err == nil || len(operator.asked) != 1 {
+		t.Errorf("denied command should fail: %v, asked %v", err, operator.asked)
+	}
+	operator.approve = true
+	if result, err := run(ctx, operator, "web1", "systemctl restart nginx"); err != nil || result != "退出码: 0\nrestarted" {
+		t.Errorf("approved command: %q %v", result, err)
+	}
+	if _, err := run(ctx, nil, "web1", "systemctl restart nginx"); err == nil {
+		t.Error("non-readonly command without an operator should fail")
+	}
+
+	// 全局和主机的禁止规则，不在清单中的主机
+	for _, command := range []string{"rm -rf /", "systemctl stop nginx"} {
+		if _, err := run(ctx, operator, "web1", command); err == nil {
+			t.Errorf("%s should be rejected", command)
+		}
+	}
+	if _, err := run(ctx, operator, "db1", "uptime"); err == nil {
+		t.Error("unknown host should be rejected")
+	}
+
+	// 输出截断和超时
+	result, err = run(ctx, operator, "web1", "cat /var/log/big")
+	if err != nil || !strings.Contains(result, "输出共 1000 字节，只返回前 100 字节") {
+		t.Errorf("output should be truncated: %q %v", result, err)
+	}
+	if _, err := run(ctx, operator, "web1", "sleep 60"); err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Errorf("long command should time out: %v", err)
+	}
+
+	want := []string{"uptime", "ls /missing", "systemctl restart nginx", "cat /var/log/big", "sleep 60"}
+	if got := server.commands(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("server ran %v, want %v", got, want)
+	}
+
+	audit.Close()
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 10 {
+		t.Errorf("expected 10 audit records, got %d:\n%s", len(lines), data)
+	}
+	for _, expected := range []string{`"approval":"readonly"`, `"approval":"approved"`, `"approval":"denied"`, `"approval":"rejected"`, `"exit_code":2`, `"user":"alice"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("audit log should contain %s", expected)
+		}
+	}
+}
+
+func TestHostKeyVerification(t *testing.T) {
+	server := startServer(t)
+	setup(t, server)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewPublicKey(other)
+	config.Get().Remote.Hosts[0].HostKey = string(ssh.MarshalAuthorizedKey(otherKey))
+
+	if _, err := run(context.Background(), nil, "web1", "uptime"); err == nil {
+		t.Error("mismatched host key should be rejected")
+	}
+	if len(server.commands()) != 0 {
+		t.Error("command should not run on a host with an unexpected key")
+	}
+
+	config.Get().Remote.Hosts[0].HostKey = ""
+	config.Get().Remote.KnownHosts = filepath.Join(t.TempDir(), "missing")
+	if _, err := run(context.Background(), nil, "web1", "uptime"); err == nil {
+		t.Error("host without host_key or known_hosts should be rejected")
+	}
+}
@@ -0,0 +1,314 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultReadonly 内置的只读命令，执行前不需要确认
+// 只包含没有写入、修改或终止模式的查看类命令：find、awk、env 可以执行其它命令，
+// ip、ss、dmesg、journalctl、date、hostname 等有修改系统的选项（且支持选项合并和缩写），都不在其中
+// sort 和 uniq 可以写文件，由 writeModes 检查具体用法
+var defaultReadonly = []string{
+	"cat", "head", "tail", "ls", "pwd", "echo", "uptime", "uname", "whoami", "id", "w", "who", "last",
+	"df", "du", "free", "ps", "pgrep", "top -b*", "vmstat", "iostat", "mpstat", "nproc", "lscpu", "lsblk",
+	"lsof", "netstat", "ping -c*", "dig", "nslookup", "getent", "grep", "egrep", "zgrep", "wc", "sort", "uniq",
+	"cut", "tr", "jq", "column", "stat", "md5sum", "sha256sum", "printenv",
+	"systemctl status", "systemctl is-active", "systemctl is-enabled", "systemctl list-units", "systemctl show",
+	"docker ps", "docker logs", "docker inspect", "docker images", "docker stats --no-stream",
+	"kubectl get", "kubectl describe", "kubectl logs", "kubectl top",
+}
+
+// writeMode 只读命令中会写文件的用法
+type writeMode struct {
+	withArgument string   // 需要参数的短选项
+	writeShort   string   // 会写文件的短选项
+	writeLong    []string // 会写文件或执行其它程序的长选项（可以缩写为前缀）
+	maxOperands  int      // 最多的操作数，更多时会写文件，-1表示不限制
+}
+
+// writeModes 有写文件用法的只读命令
+// sort -o 写文件、--compress-program 执行其它程序；uniq 的第二个操作数是输出文件
+var writeModes = map[string]writeMode{
+	"sort": {withArgument: "kSTto", writeShort: "o", writeLong: []string{"output", "compress-program"}, maxOperands: -1},
+	"uniq": {withArgument: "fsw", maxOperands: 1},
+}
+
+// wrappers 执行其它命令的包装命令及其需要参数的选项，匹配规则前去掉包装命令，按被执行的命令匹配
+// 如 sudo -u www rm 按 rm 匹配；timeout 的第一个操作数是时长
+var wrappers = map[string][]string{
+	"sudo":    {"-u", "-g", "-C", "-D", "-h", "-p", "-r", "-t", "-U", "-T", "--user", "--group", "--close-from", "--chdir", "--host", "--prompt", "--role", "--type", "--other-user", "--command-timeout"},
+	"env":     {"-u", "-C", "--unset", "--chdir"},
+	"nice":    {"-n", "--adjustment"},
+	"xargs":   {"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s", "--arg-file", "--delimiter", "--max-lines", "--max-args", "--max-procs", "--max-chars", "--process-slot-var"},
+	"timeout": {"-s", "-k", "--signal", "--kill-after"},
+	"nohup":   nil,
+	"command": nil,
+	"exec":    {"-a"},
+}
+
+// Rules 主机的命令规则
+type Rules struct {
+	Allow    []string // 允许的命令，为空表示全部
+	Deny     []string // 禁止的命令，优先于 Allow
+	Readonly []string // 不需要确认的只读命令
+}
+
+// Check 检查命令是否可以执行，返回是否为只读命令（不需要确认）
+// 命令按 |、&&、||、; 分成多条简单命令，每条都需要满足规则；引号中的分隔符也会被拆分，结果只会更严格
+// 配置了 allow 或 deny 时，无法检查的命令（命令替换、进程替换、由变量或通配符组成的命令名）直接拒绝
+func (r Rules) Check(command string) (bool, error) {
+	segments := splitCommand(command)
+	if len(segments) == 0 {
+		return false, fmt.Errorf("命令为空")
+	}
+	if len(r.Allow) > 0 || len(r.Deny) > 0 {
+		for _, syntax := range []string{"$(", "`", "<(", ">("} {
+			if strings.Contains(command, syntax) {
+				return false, fmt.Errorf("配置了命令规则时不能使用 %s", syntax)
+			}
+		}
+		for _, segment := range segments {
+			if name := strings.Fields(segment)[0]; strings.ContainsAny(name, "$*?[") {
+				return false, fmt.Errorf("无法检查命令 %q，命令名不能包含变量或通配符", segment)
+			}
+		}
+	}
+	for _, segment := range segments {
+		if pattern := matchAny(r.Deny, segment); pattern != "" {
+			return false, fmt.Errorf("命令 %q 被规则 %q 禁止", segment, pattern)
+		}
+		if len(r.Allow) > 0 && matchAny(r.Allow, segment) == "" {
+			return false, fmt.Errorf("命令 %q 不在允许的命令列表中", segment)
+		}
+	}
+
+	if hasSideEffectSyntax(command) {
+		return false, nil
+	}
+	for _, segment := range segments {
+		if matchAny(r.Readonly, segment) == "" || mutates(segment) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// mutates 只读命令是否以会写文件的方式使用，短选项可以合并（如 sort -uo 文件），长选项可以缩写（如 --out）
+func mutates(segment string) bool {
+	words := strings.Fields(segment)
+	mode, ok := writeModes[words[0]]
+	if !ok {
+		return false
+	}
+	operands := 0
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case word == "--":
+			operands += len(words) - i - 1
+			i = len(words)
+		case strings.HasPrefix(word, "--"):
+			name, _, _ := strings.Cut(word[2:], "=")
+			for _, option := range mode.writeLong {
+				if strings.HasPrefix(option, name) {
+					return true
+				}
+			}
+		case strings.HasPrefix(word, "-") && len(word) > 1:
+			for j := 1; j < len(word); j++ {
+				if strings.IndexByte(mode.writeShort, word[j]) >= 0 {
+					return true
+				}
+				if strings.IndexByte(mode.withArgument, word[j]) >= 0 {
+					if j == len(word)-1 {
+						i++ // 参数是下一个词
+					}
+					break
+				}
+			}
+		default:
+			operands++
+		}
+	}
+	return mode.maxOperands >= 0 && operands > mode.maxOperands
+}
+
+// hasSideEffectSyntax 命令中是否有重定向、命令替换或后台执行，它们可能写文件或执行其它命令，都需要确认
+// 不写文件的重定向（2>&1、2>/dev/null 等）除外
+func hasSideEffectSyntax(command string) bool {
+	command = strings.ReplaceAll(stripRedirects(command), "&&", "")
+	return strings.ContainsAny(command, "<>`&") || strings.Contains(command, "$(")
+}
+
+// stripRedirects 去掉不写文件的重定向，重定向后面必须是空白、命令分隔符或命令结尾
+// 如 >/dev/nullx 写入文件 /dev/nullx，不会被去掉
+func stripRedirects(command string) string {
+	for _, redirect := range []string{"2>&1", "&>/dev/null", "2>/dev/null", ">/dev/null"} {
+		var b strings.Builder
+		for {
+			index := strings.Index(command, redirect)
+			if index < 0 {
+				break
+			}
+			end := index + len(redirect)
+			b.WriteString(command[:index])
+			if end == len(command) || strings.IndexByte(" \t\n|&;)", command[end]) >= 0 {
+				b.WriteString(" ")
+			} else {
+				b.WriteString(redirect)
+			}
+			command = command[end:]
+		}
+		b.WriteString(command)
+		command = b.String()
+	}
+	return command
+}
+
+// splitCommand 将命令按 |、&&、||、; 和换行拆分为简单命令，每条命令都经过 normalizeCommand 处理
+func splitCommand(command string) []string {
+	fields := strings.FieldsFunc(stripRedirects(command), func(r rune) bool {
+		return r == '|' || r == '&' || r == ';' || r == '\n'
+	})
+	var segments []string
+	for _, field := range fields {
+		if segment := normalizeCommand(field); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// normalizeCommand 规范化简单命令：去掉开头的变量赋值、包装命令（sudo、env、xargs 等）及其选项，
+// 去掉命令名中的引号和反斜杠并只保留文件名（/bin/rm 为 rm），合并多余的空白
+// 包装命令后面没有命令时（如 sudo -i）保留包装命令本身
+func normalizeCommand(command string) string {
+	words := strings.Fields(command)
+	for {
+		for len(words) > 0 && isAssignment(words[0]) {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			return ""
+		}
+		name := commandName(words[0])
+		options, ok := wrappers[name]
+		if !ok {
+			words[0] = name
+			return strings.Join(words, " ")
+		}
+		rest := skipOptions(words[1:], options)
+		if name == "timeout" && len(rest) > 0 {
+			rest = rest[1:] // 时长
+		}
+		if len(rest) == 0 {
+			words[0] = name
+			return strings.Join(words, " ")
+		}
+		words = rest
+	}
+}
+
+// commandName 去掉引号和反斜杠后的命令文件名
+func commandName(word string) string {
+	word = strings.NewReplacer(`"`, "", "'", "", `\`, "").Replace(word)
+	if index := strings.LastIndex(word, "/"); index >= 0 && index < len(word)-1 {
+		word = word[index+1:]
+	}
+	return word
+}
+
+// isAssignment 是否为命令前的变量赋值，如 LANG=C
+func isAssignment(word string) bool {
+	name, _, found := strings.Cut(word, "=")
+	if !found || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// skipOptions 跳过包装命令的选项（包括 env 的变量赋值），返回被执行的命令
+// withArgument 中的选项需要参数：长选项的参数在 = 之后或下一个词，短选项可以与其它选项合并（如 -iu root）
+func skipOptions(words []string, withArgument []string) []string {
+	takesArgument := func(option string) bool {
+		for _, candidate := range withArgument {
+			if candidate == option {
+				return true
+			}
+		}
+		return false
+	}
+	for len(words) > 0 {
+		word := words[0]
+		switch {
+		case word == "--":
+			return words[1:]
+		case strings.HasPrefix(word, "--"):
+			words = words[1:]
+			if !strings.Contains(word, "=") && takesArgument(word) && len(words) > 0 {
+				words = words[1:]
+			}
+		case strings.HasPrefix(word, "-") && len(word) > 1:
+			words = words[1:]
+			for i := 1; i < len(word); i++ {
+				if takesArgument("-" + word[i:i+1]) {
+					if i == len(word)-1 && len(words) > 0 {
+						words = words[1:]
+					}
+					break
+				}
+			}
+		case isAssignment(word):
+			words = words[1:]
+		default:
+			return words
+		}
+	}
+	return words
+}
+
+// matchAny 返回第一个匹配命令的规则，没有匹配时返回空字符串
+func matchAny(patterns []string, segment string) string {
+	for _, pattern := range patterns {
+		if matchCommand(pattern, segment) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchCommand 规则按词前缀匹配命令，* 匹配任意字符（包括空格）
+// 如 "systemctl status" 匹配 "systemctl status nginx"，但不匹配 "systemctl statusx"
+func matchCommand(pattern, segment string) bool {
+	pattern = strings.Join(strings.Fields(pattern), " ")
+	if pattern == "" {
+		return false
+	}
+	return wildcardMatch(pattern, segment) || wildcardMatch(pattern+" *", segment)
+}
+
+// wildcardMatch 通配符匹配，只支持 *
+func wildcardMatch(pattern, text string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == text
+	}
+	if !strings.HasPrefix(text, parts[0]) {
+		return false
+	}
+	text = text[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(text, part)
+		if index < 0 {
+			return false
+		}
+		text = text[index+len(part):]
+	}
+	return strings.HasSuffix(text, parts[len(parts)-1])
+}
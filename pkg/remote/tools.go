@@ -0,0 +1,192 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/audit"
+	"sshai/pkg/config"
+)
+
+// ServerName 远程运维工具所属的服务器名称，角色和路由规则的 mcp_servers 中使用该名称允许远程运维工具
+const ServerName = "remote"
+
+// 审计日志中命令的确认方式
+const (
+	approvalReadonly = "readonly" // 只读命令，不需要确认
+	approvalApproved = "approved" // 用户确认执行
+	approvalDenied   = "denied"   // 用户拒绝或无法确认
+	approvalRejected = "rejected" // 被命令规则禁止
+)
+
+// Operator 使用远程运维工具的会话
+type Operator interface {
+	// Approve 请用户确认在主机上执行命令，无法确认（如非交互会话）时返回错误
+	Approve(ctx context.Context, host, command string) (bool, error)
+	// AuditIdentity 审计日志中的会话身份
+	AuditIdentity(mode string) audit.Identity
+}
+
+// tool 远程运维工具
+type tool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	call        func(ctx context.Context, arguments map[string]interface{}) (string, error)
+}
+
+func (t *tool) Name() string                       { return t.name }
+func (t *tool) Description() string                { return t.description }
+func (t *tool) Parameters() map[string]interface{} { return t.parameters }
+func (t *tool) ServerName() string                 { return ServerName }
+func (t *tool) Enabled() bool                      { return Enabled() }
+
+// Timeout 包括等待用户确认的时间
+func (t *tool) Timeout() time.Duration {
+	timeout, approvalTimeout, _ := limits()
+	return approvalTimeout + timeout + dialTimeout
+}
+
+func (t *tool) Call(ctx context.Context, arguments map[string]interface{}) (string, error) {
+	return t.call(ctx, arguments)
+}
+
+// Tools 远程运维工具：列出主机清单、在主机上执行命令
+func Tools(operator Operator) []ai.NativeTool {
+	return []ai.NativeTool{
+		&tool{
+			name:        "remote_hosts",
+			description: "列出可以通过 remote_exec 执行命令的主机",
+			parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+			call: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				return listHosts(), nil
+			},
+		},
+		&tool{
+			name: "remote_exec",
+			description: "通过SSH在主机清单中的主机上执行shell命令，返回退出码和输出（标准输出和标准错误）。" +
+				"查看类的只读命令直接执行，其它命令需要用户确认；优先使用只读命令排查问题，每次执行一条目的明确的命令",
+			parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"host":    map[string]interface{}{"type": "string", "description": "主机名称（remote_hosts 列出的名称）"},
+					"command": map[string]interface{}{"type": "string", "description": "要执行的shell命令"},
+				},
+				"required": []string{"host", "command"},
+			},
+			call: func(ctx context.Context, arguments map[string]interface{}) (string, error) {
+				host, _ := arguments["host"].(string)
+				command, _ := arguments["command"].(string)
+				return run(ctx, operator, host, strings.TrimSpace(command))
+			},
+		},
+	}
+}
+
+// listHosts 主机清单（不包含凭据）
+func listHosts() string {
+	var b strings.Builder
+	for _, host := range config.Get().Remote.Hosts {
+		fmt.Fprintf(&b, "%s  %s@%s", host.Name, host.User, address(&host))
+		if host.Description != "" {
+			fmt.Fprintf(&b, "  %s", host.Description)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// run 检查规则、请用户确认后在主机上执行命令，并记录审计日志
+func run(ctx context.Context, operator Operator, hostName, command string) (string, error) {
+	record := &audit.RemoteCommand{Host: hostName, Command: command, Approval: approvalRejected}
+	start := time.Now()
+	host, err := findHost(hostName)
+	if err != nil {
+		logCommand(operator, record, start, err)
+		return "", err
+	}
+	record.Host = host.Name
+
+	readonly, err := rulesFor(host).Check(command)
+	if err != nil {
+		logCommand(operator, record, start, err)
+		return "", err
+	}
+
+	timeout, approvalTimeout, maxOutput := limits()
+	record.Approval = approvalReadonly
+	if !readonly {
+		record.Approval = approvalDenied
+		approved, err := approve(ctx, operator, host.Name, command, approvalTimeout)
+		if err == nil && !approved {
+			err = fmt.Errorf("用户拒绝在 %s 上执行该命令", host.Name)
+		}
+		if err != nil {
+			logCommand(operator, record, start, err)
+			return "", err
+		}
+		record.Approval = approvalApproved
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	output, err := Execute(ctx, host, command, maxOutput)
+	if err != nil {
+		logCommand(operator, record, start, err)
+		return "", err
+	}
+	record.ExitCode = &output.ExitCode
+	record.OutputLength = output.Size
+	logCommand(operator, record, start, nil)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "退出码: %d\n", output.ExitCode)
+	b.WriteString(output.Text)
+	if output.Truncated {
+		fmt.Fprintf(&b, "\n...（输出共 %d 字节，只返回前 %d 字节）", output.Size, maxOutput)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// approve 请用户确认，超过 approvalTimeout 没有回答时视为拒绝
+func approve(ctx context.Context, operator Operator, host, command string, approvalTimeout time.Duration) (bool, error) {
+	if operator == nil {
+		return false, fmt.Errorf("非交互会话无法确认，只能执行只读命令")
+	}
+	ctx, cancel := context.WithTimeout(ctx, approvalTimeout)
+	defer cancel()
+	approved, err := operator.Approve(ctx, host, command)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return false, fmt.Errorf("等待用户确认超时")
+	}
+	return approved, err
+}
+
+// logCommand 记录服务器日志和审计日志
+func logCommand(operator Operator, record *audit.RemoteCommand, start time.Time, err error) {
+	result := "完成"
+	if err != nil {
+		result = err.Error()
+	} else if record.ExitCode != nil {
+		result = fmt.Sprintf("退出码 %d", *record.ExitCode)
+	}
+	log.Printf("远程命令 [%s %s] %s: %s", record.Host, record.Approval, record.Command, result)
+
+	entry := audit.Record{
+		Event:      audit.EventRemote,
+		Remote:     record,
+		StartTime:  &start,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if operator != nil {
+		entry.Identity = operator.AuditIdentity("")
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	audit.Log(entry)
+}
@@ -0,0 +1,288 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/auth"
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+	"sshai/pkg/mcp"
+	"sshai/pkg/ui"
+)
+
+// 认证成功后记录在Permissions.Extensions中的信息
+const (
+	permKeyFingerprint = "pubkey-fp"      // 公钥指纹
+	permKeyComment     = "pubkey-comment" // 公钥注释，用于路由规则
+	permCertPrincipal  = "cert-principal" // 证书认证时作为会话身份的证书主体
+	permKeyUser        = "sshai-user"     // 公钥选项 sshai-user=，作为会话身份
+	permKeyModel       = "sshai-model"    // 公钥选项 sshai-model=，默认模型通配符
+	permKeyRole        = "sshai-role"     // 公钥选项 sshai-role=
+	permNoPty          = "no-pty"         // 公钥选项 no-pty 或 restrict，禁止分配伪终端
+)
+
+// isAdminKey 判断公钥是否是配置的管理员公钥
+func isAdminKey(key ssh.PublicKey) bool {
+	keyData := key.Marshal()
+	for _, keyStr := range config.Get().Admin.Keys {
+		adminKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(keyStr)))
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(adminKey.Marshal(), keyData) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeKey 检查公钥的授权和选项，不在授权列表中的管理员公钥同样可以登录（没有选项）
+// 管理员公钥同时出现在授权列表中时必须满足其中的选项限制（from=、expiry-time=）
+func authorizeKey(keyManager *auth.AuthorizedKeysManager, key ssh.PublicKey, remoteAddr net.Addr) (*auth.KeyOptions, error) {
+	options, err := keyManager.Authorize(key, remoteAddr)
+	if errors.Is(err, auth.ErrKeyNotAuthorized) && isAdminKey(key) {
+		return nil, nil
+	}
+	return options, err
+}
+
+// isAdminConnection 判断连接是否拥有管理员权限：
+// 使用管理员公钥登录，或经过验证的会话身份（证书主体、公钥选项 sshai-user）在管理员列表中
+// 公钥选项 sshai-role 优先：admin 直接拥有管理员权限，user 则不会通过会话身份获得管理员权限
+func isAdminConnection(conn *ssh.ServerConn) bool {
+	cfg := config.Get()
+	if conn.Permissions == nil {
+		return false
+	}
+	switch conn.Permissions.Extensions[permKeyRole] {
+	case auth.RoleAdmin:
+		return true
+	case auth.RoleUser:
+		return false
+	}
+	if fp := conn.Permissions.Extensions[permKeyFingerprint]; fp != "" {
+		for _, keyStr := range cfg.Admin.Keys {
+			adminKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(keyStr)))
+			if err == nil && ssh.FingerprintSHA256(adminKey) == fp {
+				return true
+			}
+		}
+	}
+
+	// 登录用户名由客户端任意指定（密码是所有用户共用的），不能作为管理员凭据
+	if !verifiedIdentity(conn.Permissions) {
+		return false
+	}
+	for _, user := range cfg.Admin.Users {
+		if user == connIdentity(conn) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifiedIdentity 会话身份是否经过验证：证书主体由CA签发，sshai-user 由公钥的配置指定
+func verifiedIdentity(perms *ssh.Permissions) bool {
+	return perms != nil && (perms.Extensions[permCertPrincipal] != "" || perms.Extensions[permKeyUser] != "")
+}
+
+// handleAdminCommand 处理admin命令
+func handleAdminCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	if session == nil || !session.Admin {
+		channel.Write([]byte(ui.BrightRedText("❌ 权限不足：该命令仅限管理员使用\r\n\r\n")))
+		return ""
+	}
+
+	if len(args) == 0 {
+		writeAdminUsage(channel)
+		return ""
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "sessions", "ls":
+		handleAdminSessions(channel, session)
+	case "kick":
+		handleAdminKick(channel, args[1:], session)
+	case "broadcast":
+		handleAdminBroadcast(channel, args[1:], session)
+	case "mcp":
+		handleAdminMCP(channel, args[1:], session)
+	case "reload":
+		handleAdminReload(channel, session)
+	default:
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 未知的管理员命令: %s\r\n", args[0]))))
+		writeAdminUsage(channel)
+	}
+	return ""
+}
+
+// writeAdminUsage 显示管理员命令用法
+func writeAdminUsage(channel ssh.Channel) {
+	channel.Write([]byte("用法:\r\n"))
+	channel.Write([]byte("  /admin sessions               列出当前连接的会话\r\n"))
+	channel.Write([]byte("  /admin kick <ID> [原因]       断开指定会话\r\n"))
+	channel.Write([]byte("  /admin broadcast <消息>       向所有会话发送消息\r\n"))
+	channel.Write([]byte("  /admin mcp restart <服务器>   重启MCP服务器连接\r\n"))
+	channel.Write([]byte("  /admin reload                 重新加载配置文件\r\n\r\n"))
+}
+
+// handleAdminSessions 列出所有会话
+func handleAdminSessions(channel ssh.Channel, current *Session) {
+	sessions := sessionRegistry.List()
+	lines := []string{
+		"| ID | 用户 | 地址 | 模型 | 时长 | 进行中的请求 |",
+		"|--:|---|---|---|--:|---|",
+	}
+	now := time.Now()
+	for _, session := range sessions {
+		info := session.Snapshot()
+		id := strconv.Itoa(info.ID)
+		if info.ID == current.ID {
+			id += "*"
+		}
+		user := info.Username
+		if info.Admin {
+			user += " (admin)"
+		}
+		model := info.Model
+		if model == "" {
+			model = "-"
+		}
+		if info.Persona != "" {
+			model += " [" + info.Persona + "]"
+		}
+		request := "-"
+		if info.Request != "" {
+			request = fmt.Sprintf("%s (%s)", previewText(info.Request, 30), formatDuration(now.Sub(info.RequestStart)))
+		}
+		lines = append(lines, fmt.Sprintf("| %s | %s | %s | %s | %s | %s |",
+			id, escapeTableCell(user), info.RemoteAddr, escapeTableCell(model),
+			formatDuration(now.Sub(info.StartTime)), escapeTableCell(request)))
+	}
+
+	channel.Write([]byte(ui.BrightCyanText(fmt.Sprintf("👥 当前会话 (%d 个，* 为当前会话):\r\n", len(sessions)))))
+	channel.Write([]byte(strings.ReplaceAll(ui.RenderTable(lines), "\n", "\r\n")))
+	channel.Write([]byte("\r\n"))
+}
+
+// handleAdminKick 断开指定会话
+func handleAdminKick(channel ssh.Channel, args []string, current *Session) {
+	if len(args) == 0 {
+		channel.Write([]byte("用法: /admin kick <ID> [原因]\r\n\r\n"))
+		return
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 无效的会话ID: %s\r\n\r\n", args[0]))))
+		return
+	}
+	if id == current.ID {
+		channel.Write([]byte(ui.BrightRedText("❌ 不能断开自己的会话，请使用 exit 退出\r\n\r\n")))
+		return
+	}
+	target, ok := sessionRegistry.Get(id)
+	if !ok {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 会话 #%d 不存在\r\n\r\n", id))))
+		return
+	}
+
+	reason := "管理员断开了你的连接"
+	if len(args) > 1 {
+		reason += ": " + strings.Join(args[1:], " ")
+	}
+	target.Kick(reason)
+	log.Printf("管理员 %s 断开了会话 #%d (用户: %s)", current.Username, id, target.Username)
+	channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 已断开会话 #%d (%s)\r\n\r\n", id, target.Username))))
+}
+
+// handleAdminBroadcast 向所有会话广播消息
+func handleAdminBroadcast(channel ssh.Channel, args []string, current *Session) {
+	message := strings.TrimSpace(strings.Join(args, " "))
+	if message == "" {
+		channel.Write([]byte("用法: /admin broadcast <消息>\r\n\r\n"))
+		return
+	}
+
+	delivered := 0
+	for _, session := range sessionRegistry.List() {
+		if session.ID == current.ID {
+			continue
+		}
+		if session.Notify(fmt.Sprintf("📢 管理员广播 (%s): %s", current.Username, message)) {
+			delivered++
+		}
+	}
+	log.Printf("管理员 %s 广播消息: %s", current.Username, message)
+	channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 已向 %d 个会话发送广播\r\n\r\n", delivered))))
+}
+
+// handleAdminMCP 管理MCP服务器
+func handleAdminMCP(channel ssh.Channel, args []string, current *Session) {
+	if len(args) < 2 || strings.ToLower(args[0]) != "restart" {
+		channel.Write([]byte("用法: /admin mcp restart <服务器>\r\n\r\n"))
+		return
+	}
+
+	manager := mcp.GetGlobalManager()
+	if manager == nil {
+		channel.Write([]byte(ui.BrightRedText("❌ MCP管理器不可用\r\n\r\n")))
+		return
+	}
+
+	name := args[1]
+	channel.Write([]byte(fmt.Sprintf("🔄 正在重启MCP服务器 %s ...\r\n", name)))
+	log.Printf("管理员 %s 重启MCP服务器: %s", current.Username, name)
+	if err := manager.RestartServer(name); err != nil {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 重启失败: %v\r\n\r\n", err))))
+		return
+	}
+	channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ MCP服务器 %s 已重启，当前共 %d 个工具\r\n\r\n", name, len(manager.GetTools())))))
+}
+
+// handleAdminReload 重新加载配置文件
+func handleAdminReload(channel ssh.Channel, current *Session) {
+	oldLanguage := config.Get().I18n.Language
+	if err := config.Reload(); err != nil {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 重新加载配置失败: %v\r\n\r\n", err))))
+		return
+	}
+	log.Printf("管理员 %s 重新加载了配置文件", current.Username)
+
+	// 语言设置变化时切换语言
+	if language := config.Get().I18n.Language; language != "" && language != oldLanguage {
+		if err := i18n.SetLanguage(i18n.Language(language)); err != nil {
+			channel.Write([]byte(ui.BrightYellowText(fmt.Sprintf("⚠ 切换语言失败: %v\r\n", err))))
+		}
+	}
+
+	channel.Write([]byte(ui.BrightGreenText("✅ 配置已重新加载，新的请求和会话将使用新配置\r\n")))
+	channel.Write([]byte("   （监听端口、主机密钥和已建立的MCP连接需要重启服务或使用 /admin mcp restart 生效）\r\n\r\n"))
+}
+
+// formatDuration 格式化时长，如 1h02m、3m05s、12s
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// escapeTableCell 转义表格单元格中的竖线
+func escapeTableCell(text string) string {
+	return strings.ReplaceAll(text, "|", "/")
+}
@@ -0,0 +1,157 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+	"sshai/pkg/ui"
+)
+
+// addConfigCommands 将配置文件中定义的命令加入命令列表，与内置命令同名时忽略
+func addConfigCommands(commands map[string]CustomCommand) {
+	for _, command := range config.Get().Commands {
+		name := "/" + strings.TrimPrefix(command.Name, "/")
+		if name == "/" || strings.ContainsAny(command.Name, " \t") {
+			log.Printf("警告：自定义命令名称无效: %q", command.Name)
+			continue
+		}
+		if existing, exists := commands[name]; exists {
+			if existing.Command == nil {
+				log.Printf("警告：自定义命令 %s 与内置命令同名，已忽略", name)
+			}
+			continue
+		}
+		description := command.Description
+		if description == "" {
+			description = "自定义命令"
+		}
+		found := command
+		commands[name] = CustomCommand{Name: name, Description: description, Command: &found}
+	}
+}
+
+// configCommandNames 配置的命令名称（按字母排序），用于 /help
+func configCommandNames(commands map[string]CustomCommand) []string {
+	var names []string
+	for name, cmd := range commands {
+		if cmd.Command != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findConfigCommand 判断交互输入是否为配置的命令，返回命令和参数
+func findConfigCommand(input string) (*config.Command, string) {
+	name, args := nextWord(input)
+	if cmd, exists := getCustomCommands()[name]; exists && cmd.Command != nil {
+		return cmd.Command, args
+	}
+	return nil, ""
+}
+
+// commandMessage 渲染命令的提示词，提示词没有引用 {{.Input}} 时输入附加在提示词之后
+func commandMessage(assistant *ai.Assistant, command *config.Command, input string) string {
+	message := assistant.RenderCommandPrompt("commands."+command.Name, command.Prompt, input)
+	if strings.Contains(command.Prompt, ".Input") {
+		return message
+	}
+	if message == "" {
+		return input
+	}
+	if input == "" {
+		return message
+	}
+	return message + "\n\n" + input
+}
+
+// commandModel 命令使用的模型，命令没有指定模型时使用current
+func commandModel(command *config.Command, current string) string {
+	if command.Model == "" {
+		return current
+	}
+	return ai.DefaultModelForPattern(command.Model)
+}
+
+// newSessionAssistant 创建命令模式（exec、stdin）使用的AI助手：会话的角色、工具策略和提示词变量
+func newSessionAssistant(session *Session, model, mode string) *ai.Assistant {
+	assistant := ai.NewAssistant(session.Username)
+	assistant.SetPersona(sessionPersona(session))
+	assistant.SetToolPolicy(session.toolPolicy())
+	assistant.SetSessionTools(session.sessionTools())
+	assistant.SetPromptData(session.promptData())
+	assistant.SetModel(model)
+	assistant.SetAuditIdentity(session.AuditIdentity(mode))
+	return assistant
+}
+
+// runConfigCommand 在交互模式中执行配置的命令
+// 命令设置了 include_context 时在当前对话上下文中执行，否则使用独立的上下文
+func runConfigCommand(channel ssh.Channel, assistant *ai.Assistant, session *Session, command *config.Command, input string, interrupt chan bool) {
+	target := assistant
+	if !command.IncludeContext {
+		target = ai.NewAssistant(session.Username)
+		target.SetPersona(assistant.GetPersona())
+		target.SetToolPolicy(session.toolPolicy())
+		target.SetSessionTools(session.sessionTools())
+		target.SetPromptData(session.promptData())
+		target.SetLanguage(session.Language())
+		target.SetRenderMode(assistant.GetRenderMode())
+		target.SetTerminal(assistant.Terminal())
+		target.SetAuditIdentity(session.AuditIdentity("interactive"))
+	}
+
+	// 临时切换到命令指定的模型和温度，执行完成后恢复
+	previous := target.GetCurrentModel()
+	target.SetModel(commandModel(command, assistant.GetCurrentModel()))
+	target.SetTemperature(command.Temperature)
+	defer func() {
+		target.SetModel(previous)
+		target.SetTemperature(0)
+	}()
+
+	message := commandMessage(target, command, input)
+	if strings.TrimSpace(message) == "" {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 命令 /%s 需要输入内容\r\n\r\n", command.Name))))
+		return
+	}
+	target.ProcessMessage(message, channel, interrupt)
+}
+
+// handleConfigCommandExec 在命令模式中执行配置的命令（如 ssh host translate "hello" 或 git diff | ssh host review），返回退出码
+// 命令后没有参数时从stdin读取输入
+func handleConfigCommandExec(channel ssh.Channel, session *Session, execReq *execRequest, signals *signalState) int {
+	command := execReq.Command
+	input := execReq.Prompt
+	if input == "" {
+		input = tryReadStdinInput(channel)
+		if input != "" && !isTextContent(input) {
+			channel.Stderr().Write([]byte("错误：检测到非文本内容，本系统仅支持处理纯文本内容\r\n"))
+			return ExitInput
+		}
+	}
+
+	assistant := newSessionAssistant(session, commandModel(command, sessionDefaultModel(session)), "exec")
+	assistant.SetTemperature(command.Temperature)
+	message := commandMessage(assistant, command, input)
+	if strings.TrimSpace(message) == "" {
+		channel.Stderr().Write([]byte(fmt.Sprintf("错误：命令 %s 需要输入内容\r\n", command.Name)))
+		return ExitInput
+	}
+
+	renderer := newRendererForFormat(channel, execReq.Format, session.Language())
+	if _, err := assistant.ProcessMessageWithRenderer(message, channel, renderer, signals.interrupt, false); err != nil {
+		return exitCodeForError(err, signals.signal())
+	}
+	if execReq.Format == FormatText {
+		channel.Write([]byte("\r\n"))
+	}
+	return ExitOK
+}
@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+)
+
+func TestConfigCommands(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Commands
+	defer func() { cfg.Commands = saved }()
+	cfg.Commands = []config.Command{
+		{Name: "translate", Description: "中英互译", Prompt: "Translate for {{.User}}: {{.Input}}", Model: "mt-model", Temperature: 0.2},
+		{Name: "review", Prompt: "Review the following diff"},
+		{Name: "help", Prompt: "shadowed"},
+		{Name: "bad name"},
+	}
+
+	commands := getCustomCommands()
+	if commands["/translate"].Command == nil || commands["/review"].Description != "自定义命令" {
+		t.Error("config commands should be registered")
+	}
+	if commands["/help"].Command != nil || commands["/bad name"].Command != nil {
+		t.Error("built-in commands should take precedence and invalid names should be skipped")
+	}
+	if matches := getCommandMatches("/tr"); len(matches) != 1 || matches[0] != "/translate" {
+		t.Errorf("config commands should be tab-completed, got %v", matches)
+	}
+
+	channel := &recordingChannel{}
+	handleHelpCommand(channel, nil, nil, NewConversationHistory(), "", nil)
+	if !strings.Contains(channel.String(), "中英互译") {
+		t.Error("config commands should be listed in /help")
+	}
+
+	command, args := findConfigCommand("/translate hello world")
+	if command == nil || command.Name != "translate" || args != "hello world" {
+		t.Fatalf("unexpected command lookup: %+v %q", command, args)
+	}
+	if command, _ := findConfigCommand("/help"); command != nil {
+		t.Error("built-in command should not be run as a config command")
+	}
+
+	assistant := ai.NewAssistant("alice")
+	if message := commandMessage(assistant, command, "hello"); message != "Translate for alice: hello" {
+		t.Errorf("unexpected message: %q", message)
+	}
+	review := config.FindCommand("REVIEW")
+	if message := commandMessage(assistant, review, "diff --git"); message != "Review the following diff\n\ndiff --git" {
+		t.Errorf("input should be appended when the prompt does not use it: %q", message)
+	}
+	if model := commandModel(command, "current"); model != "mt-model" {
+		t.Errorf("command model should be used, got %q", model)
+	}
+
+	// 命令模式: ssh host translate --format json "hello"、git diff | ssh host review
+	req, err := parseExecCommand(`translate --format json hello`)
+	if err != nil || req.Command == nil || req.Command.Name != "translate" || req.Format != FormatJSON || req.Prompt != "hello" {
+		t.Errorf("unexpected exec request: %+v %v", req, err)
+	}
+	if req, _ := parseExecCommand("review"); req.Command == nil || req.Prompt != "" {
+		t.Errorf("command without input should read stdin: %+v", req)
+	}
+	if req, _ := parseExecCommand("reviewing my code"); req.Command != nil {
+		t.Error("only the exact command name should be treated as a verb")
+	}
+}
@@ -0,0 +1,863 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"sshai/pkg/ui"
+	"sshai/pkg/utils"
+)
+
+// KeyCode 按键类型
+type KeyCode int
+
+const (
+	KeyRune      KeyCode = iota // 普通字符
+	KeyCtrl                     // Ctrl组合键，Rune为对应的小写字母（Ctrl+A为'a'）
+	KeyAlt                      // Alt组合键（ESC前缀），Rune为对应字符
+	KeyEnter                    // 回车
+	KeyTab                      // Tab
+	KeyBackspace                // 退格
+	KeyDelete                   // Delete（ESC[3~）
+	KeyUp                       // 上方向键
+	KeyDown                     // 下方向键
+	KeyLeft                     // 左方向键
+	KeyRight                    // 右方向键
+	KeyHome                     // Home
+	KeyEnd                      // End
+	KeyWordLeft                 // Ctrl/Alt+左方向键
+	KeyWordRight                // Ctrl/Alt+右方向键
+	KeyPaste                    // 括号粘贴的内容，Text为粘贴文本
+	KeyUnknown                  // 无法识别的转义序列
+)
+
+// Key 解析后的按键
+type Key struct {
+	Code KeyCode
+	Rune rune
+	Text string
+}
+
+const (
+	pasteEnd = "\x1b[201~" // 括号粘贴结束标记（开始标记ESC[200~在csiKey中处理）
+
+	enableBracketedPaste  = "\x1b[?2004h" // 开启括号粘贴模式
+	disableBracketedPaste = "\x1b[?2004l" // 关闭括号粘贴模式
+
+	maxEscapeLength = 32 // 转义序列最大长度，超过则丢弃
+)
+
+// keyDecoder 将终端输入的字节流解析为按键，支持跨多次读取的转义序列和UTF-8字符
+type keyDecoder struct {
+	pending []byte // 未解析完整的字节
+	pasting bool   // 是否处于括号粘贴中
+	paste   []byte // 已接收的粘贴内容
+	lastCR  bool   // 上一个字节是否是回车，用于忽略紧随其后的换行
+}
+
+// Feed 输入一段字节，返回其中所有完整的按键
+func (d *keyDecoder) Feed(data []byte) []Key {
+	var keys []Key
+	buf := append(d.pending, data...)
+	d.pending = nil
+
+	for len(buf) > 0 {
+		if d.pasting {
+			d.paste = append(d.paste, buf...)
+			buf = nil
+			idx := bytes.Index(d.paste, []byte(pasteEnd))
+			if idx < 0 {
+				break
+			}
+			keys = append(keys, Key{Code: KeyPaste, Text: normalizePaste(string(d.paste[:idx]))})
+			buf = append([]byte(nil), d.paste[idx+len(pasteEnd):]...)
+			d.paste = nil
+			d.pasting = false
+			continue
+		}
+
+		key, n := d.decode(buf)
+		if n == 0 {
+			// 输入不完整，等待后续数据
+			d.pending = append([]byte(nil), buf...)
+			break
+		}
+		buf = buf[n:]
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	return keys
+}
+
+// decode 从buf开头解析一个按键，返回按键和消耗的字节数；字节数为0表示输入不完整
+func (d *keyDecoder) decode(buf []byte) (*Key, int) {
+	b := buf[0]
+	lastCR := d.lastCR
+	d.lastCR = b == 13
+
+	switch {
+	case b == 27:
+		return d.decodeEscape(buf)
+	case b == 13:
+		return &Key{Code: KeyEnter}, 1
+	case b == 10:
+		// 部分客户端回车会发送\r\n，忽略其中的\n；单独的\n（Ctrl+J）插入换行
+		if lastCR {
+			return nil, 1
+		}
+		return &Key{Code: KeyCtrl, Rune: 'j'}, 1
+	case b == 9:
+		return &Key{Code: KeyTab}, 1
+	case b == 127 || b == 8:
+		return &Key{Code: KeyBackspace}, 1
+	case b >= 1 && b <= 26:
+		return &Key{Code: KeyCtrl, Rune: rune('a' + b - 1)}, 1
+	case b < 32:
+		return nil, 1
+	}
+
+	if !utf8.FullRune(buf) {
+		return nil, 0
+	}
+	r, size := utf8.DecodeRune(buf)
+	if r == utf8.RuneError {
+		// 跳过无效字符
+		return nil, size
+	}
+	return &Key{Code: KeyRune, Rune: r}, size
+}
+
+// decodeEscape 解析以ESC开头的转义序列
+func (d *keyDecoder) decodeEscape(buf []byte) (*Key, int) {
+	if len(buf) < 2 {
+		return nil, 0
+	}
+
+	switch buf[1] {
+	case '[':
+		// CSI序列：参数字节0x30-0x3F，中间字节0x20-0x2F，结束字节0x40-0x7E
+		end := 2
+		for end < len(buf) && buf[end] >= 0x20 && buf[end] <= 0x3F {
+			end++
+		}
+		if end >= len(buf) {
+			if len(buf) > maxEscapeLength {
+				return nil, len(buf)
+			}
+			return nil, 0
+		}
+		return d.csiKey(string(buf[2:end]), buf[end]), end + 1
+	case 'O':
+		// SS3序列（应用光标模式）
+		if len(buf) < 3 {
+			return nil, 0
+		}
+		if code, ok := ss3Keys[buf[2]]; ok {
+			return &Key{Code: code}, 3
+		}
+		return &Key{Code: KeyUnknown}, 3
+	case 127, 8:
+		return &Key{Code: KeyAlt, Rune: 127}, 2
+	case 13:
+		return &Key{Code: KeyAlt, Rune: '\r'}, 2
+	case 27:
+		// 连续两个ESC，丢弃第一个
+		return nil, 1
+	}
+
+	if !utf8.FullRune(buf[1:]) {
+		return nil, 0
+	}
+	r, size := utf8.DecodeRune(buf[1:])
+	return &Key{Code: KeyAlt, Rune: unicode.ToLower(r)}, 1 + size
+}
+
+// ss3Keys SS3序列结束字节对应的按键
+var ss3Keys = map[byte]KeyCode{
+	'A': KeyUp, 'B': KeyDown, 'C': KeyRight, 'D': KeyLeft, 'H': KeyHome, 'F': KeyEnd,
+}
+
+// csiKey 根据CSI序列的参数和结束字节确定按键
+func (d *keyDecoder) csiKey(params string, final byte) *Key {
+	// 带修饰键的方向键，如 ESC[1;5C（Ctrl）或 ESC[1;3C（Alt）
+	modified := strings.HasSuffix(params, ";5") || strings.HasSuffix(params, ";3")
+	switch final {
+	case 'A':
+		return &Key{Code: KeyUp}
+	case 'B':
+		return &Key{Code: KeyDown}
+	case 'C':
+		if modified {
+			return &Key{Code: KeyWordRight}
+		}
+		return &Key{Code: KeyRight}
+	case 'D':
+		if modified {
+			return &Key{Code: KeyWordLeft}
+		}
+		return &Key{Code: KeyLeft}
+	case 'H':
+		return &Key{Code: KeyHome}
+	case 'F':
+		return &Key{Code: KeyEnd}
+	case '~':
+		switch params {
+		case "1", "7":
+			return &Key{Code: KeyHome}
+		case "4", "8":
+			return &Key{Code: KeyEnd}
+		case "3":
+			return &Key{Code: KeyDelete}
+		case "200":
+			d.pasting = true
+			return nil
+		case "201":
+			return nil
+		}
+	}
+	return &Key{Code: KeyUnknown}
+}
+
+// normalizePaste 规范化粘贴内容：统一换行符，Tab替换为空格，去除其它控制字符
+func normalizePaste(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// InputState 输入状态管理
+type InputState struct {
+	buffer     []rune       // 使用rune数组以更好地处理中文
+	cursorPos  int          // 光标位置（以rune为单位）
+	displayPos int          // 显示位置（以字符宽度为单位）
+	cursorRow  int          // 光标相对提示符所在行的行号（输入超过终端宽度或包含换行时）
+	terminal   *ui.Terminal // 会话终端状态，用于计算折行
+}
+
+// NewInputState 创建新的输入状态
+func NewInputState() *InputState {
+	return &InputState{
+		buffer:     make([]rune, 0),
+		cursorPos:  0,
+		displayPos: 0,
+	}
+}
+
+// String 返回当前输入的字符串
+func (is *InputState) String() string {
+	return string(is.buffer)
+}
+
+// Clear 清空输入状态
+func (is *InputState) Clear() {
+	is.buffer = is.buffer[:0]
+	is.cursorPos = 0
+	is.displayPos = 0
+	is.cursorRow = 0
+}
+
+// SetText 设置输入文本
+func (is *InputState) SetText(text string) {
+	is.buffer = []rune(text)
+	is.cursorPos = len(is.buffer)
+	is.displayPos = calculateDisplayWidth(is.buffer)
+}
+
+// InsertRune 在光标位置插入字符
+func (is *InputState) InsertRune(r rune) {
+	is.InsertText(string(r))
+}
+
+// InsertText 在光标位置插入文本
+func (is *InputState) InsertText(text string) {
+	runes := []rune(text)
+	buffer := make([]rune, 0, len(is.buffer)+len(runes))
+	buffer = append(buffer, is.buffer[:is.cursorPos]...)
+	buffer = append(buffer, runes...)
+	buffer = append(buffer, is.buffer[is.cursorPos:]...)
+	is.buffer = buffer
+	is.cursorPos += len(runes)
+	is.updateDisplayPos()
+}
+
+// DeleteRune 删除光标前的字符
+func (is *InputState) DeleteRune() bool {
+	if is.cursorPos > 0 {
+		is.buffer = append(is.buffer[:is.cursorPos-1], is.buffer[is.cursorPos:]...)
+		is.cursorPos--
+		is.updateDisplayPos()
+		return true
+	}
+	return false
+}
+
+// DeleteForward 删除光标处的字符
+func (is *InputState) DeleteForward() bool {
+	if is.cursorPos < len(is.buffer) {
+		is.buffer = append(is.buffer[:is.cursorPos], is.buffer[is.cursorPos+1:]...)
+		return true
+	}
+	return false
+}
+
+// MoveCursorLeft 向左移动光标
+func (is *InputState) MoveCursorLeft() bool {
+	if is.cursorPos > 0 {
+		is.cursorPos--
+		is.updateDisplayPos()
+		return true
+	}
+	return false
+}
+
+// MoveCursorRight 向右移动光标
+func (is *InputState) MoveCursorRight() bool {
+	if is.cursorPos < len(is.buffer) {
+		is.cursorPos++
+		is.updateDisplayPos()
+		return true
+	}
+	return false
+}
+
+// MoveCursorToStart 移动光标到开始
+func (is *InputState) MoveCursorToStart() {
+	is.cursorPos = 0
+	is.displayPos = 0
+}
+
+// MoveCursorToEnd 移动光标到结束
+func (is *InputState) MoveCursorToEnd() {
+	is.cursorPos = len(is.buffer)
+	is.updateDisplayPos()
+}
+
+// MoveCursorTo 移动光标到指定位置
+func (is *InputState) MoveCursorTo(pos int) {
+	is.cursorPos = pos
+	is.updateDisplayPos()
+}
+
+// wordStart 返回光标前一个单词的起始位置（单词由字母和数字组成）
+func (is *InputState) wordStart() int {
+	pos := is.cursorPos
+	for pos > 0 && !isWordRune(is.buffer[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(is.buffer[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// wordEnd 返回光标后一个单词的结束位置
+func (is *InputState) wordEnd() int {
+	pos := is.cursorPos
+	for pos < len(is.buffer) && !isWordRune(is.buffer[pos]) {
+		pos++
+	}
+	for pos < len(is.buffer) && isWordRune(is.buffer[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// fieldStart 返回光标前以空白分隔的单词起始位置（Ctrl+W使用）
+func (is *InputState) fieldStart() int {
+	pos := is.cursorPos
+	for pos > 0 && unicode.IsSpace(is.buffer[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(is.buffer[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// Kill 删除[start, end)范围内的文本并返回被删除的内容，光标移动到start
+func (is *InputState) Kill(start, end int) string {
+	if start >= end {
+		return ""
+	}
+	killed := string(is.buffer[start:end])
+	is.buffer = append(is.buffer[:start], is.buffer[end:]...)
+	is.cursorPos = start
+	is.updateDisplayPos()
+	return killed
+}
+
+// updateDisplayPos 更新显示位置
+func (is *InputState) updateDisplayPos() {
+	is.displayPos = calculateDisplayWidth(is.buffer[:is.cursorPos])
+}
+
+// isWordRune 判断是否是单词字符
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// calculateDisplayWidth 计算字符串的显示宽度
+func calculateDisplayWidth(runes []rune) int {
+	return utils.GetDisplayWidth(string(runes))
+}
+
+// continuationPrompt 多行输入时后续行的提示符
+var continuationPrompt = ui.BrightBlack + "... " + ui.Reset
+
+// terminalPosition 计算在指定列数的终端上输出文本后光标所在的行和列
+// 宽字符放不下时会整体折到下一行；正好写满一行时光标视为位于下一行行首
+func terminalPosition(text string, columns int) (row, col int) {
+	for _, r := range text {
+		if r == '\n' {
+			row++
+			col = 0
+			continue
+		}
+		w := utils.RuneWidth(r)
+		if columns > 0 && col+w > columns {
+			row++
+			col = 0
+		}
+		col += w
+	}
+	if columns > 0 && col >= columns {
+		row++
+		col = 0
+	}
+	return row, col
+}
+
+// clearCurrentLine 清除当前输入并重新显示提示符和输入内容
+// 按折行和换行后的行数清除，避免窄终端或多行输入时残留旧内容
+func clearCurrentLine(out io.Writer, inputState *InputState, prompt string) {
+	columns := 0
+	if inputState.terminal != nil {
+		columns = inputState.terminal.Width()
+	}
+
+	var b strings.Builder
+
+	// 回到提示符所在行的行首
+	if inputState.cursorRow > 0 {
+		b.WriteString(fmt.Sprintf("\033[%dA", inputState.cursorRow))
+	}
+	b.WriteString("\r")
+
+	// 清除到屏幕末尾 - 使用ANSI转义序列
+	b.WriteString("\033[J")
+
+	// 显示提示符和当前输入内容，换行后显示续行提示符
+	plainContinuation := ui.StripANSI(continuationPrompt)
+	text := inputState.String()
+	b.WriteString(prompt)
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"+continuationPrompt))
+
+	plainPrompt := ui.StripANSI(prompt)
+	endRow, endCol := terminalPosition(plainPrompt+strings.ReplaceAll(text, "\n", "\n"+plainContinuation), columns)
+	if columns > 0 && endCol == 0 && !strings.HasSuffix(text, "\n") && endRow > 0 {
+		// 正好写满一行时终端光标停在行尾，需要手动换到下一行
+		b.WriteString("\r\n")
+	}
+
+	// 将光标移动到正确位置
+	beforeCursor := string(inputState.buffer[:inputState.cursorPos])
+	row, col := terminalPosition(plainPrompt+strings.ReplaceAll(beforeCursor, "\n", "\n"+plainContinuation), columns)
+	if endRow > row {
+		b.WriteString(fmt.Sprintf("\033[%dA", endRow-row))
+	}
+	b.WriteString("\r")
+	if col > 0 {
+		b.WriteString(fmt.Sprintf("\033[%dC", col))
+	}
+	inputState.cursorRow = row
+
+	out.Write([]byte(b.String()))
+}
+
+// refreshLine 刷新当前行显示
+func refreshLine(out io.Writer, inputState *InputState, prompt string) {
+	clearCurrentLine(out, inputState, prompt)
+}
+
+// EditorEvent 编辑器处理按键后需要会话处理的事件
+type EditorEvent int
+
+const (
+	EditorNone      EditorEvent = iota // 按键已由编辑器处理
+	EditorSubmit                       // 回车提交输入
+	EditorInterrupt                    // Ctrl+C
+	EditorEOF                          // 空行时按Ctrl+D
+	EditorTab                          // Tab补全
+)
+
+// reverseSearch Ctrl+R反向历史搜索状态
+type reverseSearch struct {
+	query    string // 搜索关键字
+	index    int    // 当前匹配的历史索引，-1表示没有匹配
+	original string // 开始搜索前的输入，取消搜索时恢复
+}
+
+// LineEditor readline风格的行编辑器
+type LineEditor struct {
+	out       io.Writer
+	prompt    string
+	state     *InputState
+	history   *CommandHistory
+	killRing  string         // 最近删除的文本，Ctrl+Y粘贴
+	lastKill  bool           // 上一个操作是否是删除，连续删除的文本会合并
+	search    *reverseSearch // 非nil表示正在进行反向搜索
+	suspended bool           // 暂停输出，回答输出期间继续接受按键但不回显
+}
+
+// NewLineEditor 创建行编辑器
+func NewLineEditor(out io.Writer, history *CommandHistory, terminal *ui.Terminal) *LineEditor {
+	state := NewInputState()
+	state.terminal = terminal
+	return &LineEditor{
+		out:     out,
+		state:   state,
+		history: history,
+	}
+}
+
+// SetPrompt 设置提示符
+func (e *LineEditor) SetPrompt(prompt string) {
+	e.prompt = prompt
+}
+
+// State 获取输入状态
+func (e *LineEditor) State() *InputState {
+	return e.state
+}
+
+// Reset 清空当前输入和搜索状态
+func (e *LineEditor) Reset() {
+	e.state.Clear()
+	e.search = nil
+	e.lastKill = false
+}
+
+// Suspend 暂停输出，之后的按键只修改输入内容不回显
+func (e *LineEditor) Suspend() {
+	e.suspended = true
+}
+
+// Resume 恢复输出，并在当前位置重绘提示符和已输入的内容
+func (e *LineEditor) Resume() {
+	e.suspended = false
+	e.state.cursorRow = 0
+	e.refresh()
+}
+
+// PrintAbove 在输入行上方输出一条消息，然后重绘输入行
+// 暂停时（回答输出期间）消息单独成行插入输出中
+func (e *LineEditor) PrintAbove(text string) {
+	text = strings.ReplaceAll(text, "\n", "\r\n")
+	if e.suspended {
+		e.out.Write([]byte("\r\n" + text + "\r\n"))
+		return
+	}
+	if e.state.cursorRow > 0 {
+		e.out.Write([]byte(fmt.Sprintf("\033[%dA", e.state.cursorRow)))
+	}
+	e.out.Write([]byte("\r\033[J" + text + "\r\n"))
+	e.Resume()
+}
+
+// write 输出到终端，暂停时丢弃
+func (e *LineEditor) write(text string) {
+	if !e.suspended {
+		e.out.Write([]byte(text))
+	}
+}
+
+// refresh 重绘输入行
+func (e *LineEditor) refresh() {
+	if e.suspended {
+		return
+	}
+	prompt := e.prompt
+	if e.search != nil {
+		label := "reverse-i-search"
+		if e.search.index < 0 && e.search.query != "" {
+			label = "failed reverse-i-search"
+		}
+		prompt = fmt.Sprintf("(%s)`%s': ", label, e.search.query)
+	}
+	refreshLine(e.out, e.state, prompt)
+}
+
+// kill 删除文本并保存到killRing，连续删除时合并
+func (e *LineEditor) kill(start, end int, backward bool) {
+	killed := e.state.Kill(start, end)
+	if killed == "" {
+		return
+	}
+	if e.lastKill {
+		if backward {
+			e.killRing = killed + e.killRing
+		} else {
+			e.killRing += killed
+		}
+	} else {
+		e.killRing = killed
+	}
+	e.refresh()
+}
+
+// HandleKey 处理一个按键，返回需要会话处理的事件和提交的输入
+func (e *LineEditor) HandleKey(key Key) (EditorEvent, string) {
+	if e.search != nil {
+		if done := e.handleSearchKey(key); done {
+			return EditorNone, ""
+		}
+	}
+
+	isKill := false
+	defer func() { e.lastKill = isKill }()
+
+	state := e.state
+	switch key.Code {
+	case KeyEnter:
+		return e.submit()
+	case KeyTab:
+		return EditorTab, ""
+	case KeyRune:
+		state.InsertRune(key.Rune)
+		e.refresh()
+	case KeyPaste:
+		state.InsertText(key.Text)
+		e.refresh()
+	case KeyBackspace:
+		if state.DeleteRune() {
+			e.refresh()
+		}
+	case KeyDelete:
+		if state.DeleteForward() {
+			e.refresh()
+		}
+	case KeyLeft:
+		if state.MoveCursorLeft() {
+			e.refresh()
+		}
+	case KeyRight:
+		if state.MoveCursorRight() {
+			e.refresh()
+		}
+	case KeyHome:
+		state.MoveCursorToStart()
+		e.refresh()
+	case KeyEnd:
+		state.MoveCursorToEnd()
+		e.refresh()
+	case KeyWordLeft:
+		state.MoveCursorTo(state.wordStart())
+		e.refresh()
+	case KeyWordRight:
+		state.MoveCursorTo(state.wordEnd())
+		e.refresh()
+	case KeyUp:
+		e.historyPrevious()
+	case KeyDown:
+		e.historyNext()
+	case KeyAlt:
+		isKill = e.handleAltKey(key.Rune)
+	case KeyCtrl:
+		return e.handleCtrlKey(key.Rune, &isKill)
+	}
+	return EditorNone, ""
+}
+
+// handleAltKey 处理Alt组合键，返回是否是删除操作
+func (e *LineEditor) handleAltKey(r rune) bool {
+	state := e.state
+	switch r {
+	case 'b': // 向后移动一个单词
+		state.MoveCursorTo(state.wordStart())
+		e.refresh()
+	case 'f': // 向前移动一个单词
+		state.MoveCursorTo(state.wordEnd())
+		e.refresh()
+	case 'd': // 删除光标后的单词
+		e.kill(state.cursorPos, state.wordEnd(), false)
+		return true
+	case 127: // Alt+Backspace 删除光标前的单词
+		e.kill(state.wordStart(), state.cursorPos, true)
+		return true
+	case '\r': // Alt+Enter 插入换行
+		state.InsertRune('\n')
+		e.refresh()
+	}
+	return false
+}
+
+// handleCtrlKey 处理Ctrl组合键
+func (e *LineEditor) handleCtrlKey(r rune, isKill *bool) (EditorEvent, string) {
+	state := e.state
+	switch r {
+	case 'a': // 移动到行首
+		state.MoveCursorToStart()
+		e.refresh()
+	case 'e': // 移动到行尾
+		state.MoveCursorToEnd()
+		e.refresh()
+	case 'b':
+		if state.MoveCursorLeft() {
+			e.refresh()
+		}
+	case 'f':
+		if state.MoveCursorRight() {
+			e.refresh()
+		}
+	case 'c':
+		state.MoveCursorToEnd()
+		e.refresh()
+		e.write("^C\r\n")
+		e.Reset()
+		return EditorInterrupt, ""
+	case 'd': // 空行时退出，否则删除光标处的字符
+		if len(state.buffer) == 0 {
+			return EditorEOF, ""
+		}
+		if state.DeleteForward() {
+			e.refresh()
+		}
+	case 'h':
+		if state.DeleteRune() {
+			e.refresh()
+		}
+	case 'j': // 插入换行
+		state.InsertRune('\n')
+		e.refresh()
+	case 'k': // 删除到行尾
+		e.kill(state.cursorPos, len(state.buffer), false)
+		*isKill = true
+	case 'u': // 删除到行首
+		e.kill(0, state.cursorPos, true)
+		*isKill = true
+	case 'w': // 删除光标前以空白分隔的单词
+		e.kill(state.fieldStart(), state.cursorPos, true)
+		*isKill = true
+	case 'y': // 粘贴最近删除的文本
+		if e.killRing != "" {
+			state.InsertText(e.killRing)
+			e.refresh()
+		}
+	case 'l': // 清屏
+		e.write("\033[H\033[2J")
+		state.cursorRow = 0
+		e.refresh()
+	case 'p':
+		e.historyPrevious()
+	case 'n':
+		e.historyNext()
+	case 'r': // 反向搜索历史
+		e.search = &reverseSearch{index: -1, original: state.String()}
+		e.refresh()
+	}
+	return EditorNone, ""
+}
+
+// handleSearchKey 处理反向搜索中的按键，返回按键是否已被消耗
+// 未被消耗的按键会在退出搜索后按普通编辑处理
+func (e *LineEditor) handleSearchKey(key Key) bool {
+	search := e.search
+	switch {
+	case key.Code == KeyRune || key.Code == KeyPaste:
+		text := key.Text
+		if key.Code == KeyRune {
+			text = string(key.Rune)
+		}
+		search.query += text
+		// 关键字变长时当前匹配仍可能满足，从当前匹配开始查找
+		before := len(e.history.commands)
+		if search.index >= 0 {
+			before = search.index + 1
+		}
+		e.searchFrom(before)
+		return true
+	case key.Code == KeyBackspace:
+		if search.query != "" {
+			runes := []rune(search.query)
+			search.query = string(runes[:len(runes)-1])
+			e.searchFrom(len(e.history.commands))
+		}
+		return true
+	case key.Code == KeyCtrl && key.Rune == 'r':
+		// 继续查找更早的匹配
+		if search.index > 0 {
+			e.searchFrom(search.index)
+		} else {
+			e.refresh()
+		}
+		return true
+	case key.Code == KeyCtrl && key.Rune == 'g':
+		// 取消搜索，恢复原来的输入
+		e.state.SetText(search.original)
+		e.search = nil
+		e.refresh()
+		return true
+	}
+
+	// 其它按键接受当前匹配并退出搜索
+	e.search = nil
+	e.refresh()
+	return false
+}
+
+// searchFrom 从历史索引before之前开始查找包含关键字的命令
+func (e *LineEditor) searchFrom(before int) {
+	search := e.search
+	if search.query == "" {
+		search.index = -1
+		e.state.SetText(search.original)
+		e.refresh()
+		return
+	}
+	if before > len(e.history.commands) {
+		before = len(e.history.commands)
+	}
+	if idx := e.history.Search(search.query, before); idx >= 0 {
+		search.index = idx
+		e.state.SetText(e.history.commands[idx])
+	} else if search.index < 0 || !strings.Contains(e.history.commands[search.index], search.query) {
+		search.index = -1
+	}
+	e.refresh()
+}
+
+// historyPrevious 显示上一条历史命令
+func (e *LineEditor) historyPrevious() {
+	e.state.SetText(e.history.GetPrevious())
+	e.refresh()
+}
+
+// historyNext 显示下一条历史命令
+func (e *LineEditor) historyNext() {
+	e.state.SetText(e.history.GetNext())
+	e.refresh()
+}
+
+// submit 提交当前输入
+func (e *LineEditor) submit() (EditorEvent, string) {
+	// 输入折行时先把光标移到末尾，避免后续输出覆盖输入内容
+	if e.state.cursorPos < len(e.state.buffer) {
+		e.state.MoveCursorToEnd()
+		e.refresh()
+	}
+	line := e.state.String()
+	e.write("\r\n")
+	e.Reset()
+	return EditorSubmit, line
+}
@@ -0,0 +1,156 @@
+package ssh
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"sshai/pkg/ui"
+)
+
+// replayKeystrokes 将录制的按键字节流（可分多次读取）输入编辑器，返回提交的输入和最后的编辑内容
+func replayKeystrokes(history []string, chunks ...string) (submitted []string, current string, events []EditorEvent) {
+	commands := NewCommandHistory()
+	for _, cmd := range history {
+		commands.AddCommand(cmd)
+	}
+	terminal := ui.NewTerminal()
+	terminal.SetSize(20, 24)
+	editor := NewLineEditor(&bytes.Buffer{}, commands, terminal)
+	editor.SetPrompt("> ")
+
+	decoder := &keyDecoder{}
+	for _, chunk := range chunks {
+		for _, key := range decoder.Feed([]byte(chunk)) {
+			event, line := editor.HandleKey(key)
+			if event == EditorSubmit {
+				submitted = append(submitted, line)
+			}
+			if event != EditorNone {
+				events = append(events, event)
+			}
+		}
+	}
+	return submitted, editor.State().String(), events
+}
+
+func TestLineEditorKeystrokes(t *testing.T) {
+	tests := []struct {
+		name      string
+		history   []string
+		chunks    []string
+		submitted []string
+		current   string
+	}{
+		{
+			name:      "plain input with CRLF enter",
+			chunks:    []string{"hello\r\n", "world\r"},
+			submitted: []string{"hello", "world"},
+		},
+		{
+			name:      "arrow keys split across reads",
+			chunks:    []string{"ac\x1b", "[D", "b\x1b[C", "d\r"},
+			submitted: []string{"abcd"},
+		},
+		{
+			name:      "home end and delete",
+			chunks:    []string{"bc\x1b[Ha\x1b[Fd\x1b[H\x1b[3~\x1bOF!\r"},
+			submitted: []string{"bcd!"},
+		},
+		{
+			name:      "alt word movement",
+			chunks:    []string{"one two three\x1bbX\x1bb\x1bbY\x1bfZ\r"},
+			submitted: []string{"one YtwoZ Xthree"},
+		},
+		{
+			name:      "ctrl word movement",
+			chunks:    []string{"foo bar\x1b[1;5DX\x1b[1;5C!\r"},
+			submitted: []string{"foo Xbar!"},
+		},
+		{
+			name:      "ctrl-w and yank",
+			chunks:    []string{"git commit -m\x17\x17\x01\x19 \r"},
+			submitted: []string{"commit -m git "},
+		},
+		{
+			name:      "ctrl-k and ctrl-u",
+			chunks:    []string{"hello world\x01\x06\x06\x06\x06\x06\x0b\x15bye\x19\r"},
+			submitted: []string{"byehello world"},
+		},
+		{
+			name:      "alt-d and alt-backspace",
+			chunks:    []string{"alpha beta gamma\x1b\x7f\x01\x1bd\r"},
+			submitted: []string{" beta "},
+		},
+		{
+			name:      "bracketed paste keeps newlines in one message",
+			chunks:    []string{"see:\x1b[200~func main() {\r\n\tfmt", ".Println(1)\r\n}\x1b[2", "01~\r"},
+			submitted: []string{"see:func main() {\n    fmt.Println(1)\n}"},
+		},
+		{
+			name:      "alt-enter inserts newline",
+			chunks:    []string{"a\x1b\rb\r"},
+			submitted: []string{"a\nb"},
+		},
+		{
+			name:      "east asian input and backspace",
+			chunks:    []string{"你好", "\xe4\xb8", "\x96\xe7\x95\x8c\x7f\x7f\r"},
+			submitted: []string{"你好"},
+		},
+		{
+			name:      "history navigation",
+			history:   []string{"first", "second"},
+			chunks:    []string{"\x1b[A\x1b[A\x1b[B!\r"},
+			submitted: []string{"second!"},
+		},
+		{
+			name:      "reverse search",
+			history:   []string{"git status", "ls -la", "git commit"},
+			chunks:    []string{"\x12git\x12\x1b[F -v\r"},
+			submitted: []string{"git status -v"},
+		},
+		{
+			name:      "reverse search accepts on enter",
+			history:   []string{"make test", "go build"},
+			chunks:    []string{"\x12mak\r"},
+			submitted: []string{"make test"},
+		},
+		{
+			name:    "reverse search cancel restores input",
+			history: []string{"make test"},
+			chunks:  []string{"draft\x12make\x07"},
+			current: "draft",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitted, current, _ := replayKeystrokes(tt.history, tt.chunks...)
+			if !reflect.DeepEqual(submitted, tt.submitted) {
+				t.Errorf("submitted %q, want %q", submitted, tt.submitted)
+			}
+			if current != tt.current {
+				t.Errorf("current input %q, want %q", current, tt.current)
+			}
+		})
+	}
+}
+
+func TestLineEditorEvents(t *testing.T) {
+	_, current, events := replayKeystrokes(nil, "abc\x03", "/he\t", "\x15\x04")
+	want := []EditorEvent{EditorInterrupt, EditorTab, EditorEOF}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events %v, want %v", events, want)
+	}
+	if current != "" {
+		t.Errorf("input should be empty, got %q", current)
+	}
+}
+
+func TestInputStateDisplayWidth(t *testing.T) {
+	state := NewInputState()
+	state.InsertText("aé中😀")
+	if state.displayPos != 6 {
+		t.Errorf("display width = %d, want 6", state.displayPos)
+	}
+}
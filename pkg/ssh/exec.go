@@ -0,0 +1,97 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+)
+
+// 输出格式
+const (
+	FormatText   = "text"   // 终端文本（默认）
+	FormatJSON   = "json"   // 结束时输出一个完整的JSON对象
+	FormatNDJSON = "ndjson" // 每个增量输出一行JSON事件
+)
+
+// execRequest 解析后的exec命令
+type execRequest struct {
+	Format  string          // 输出格式
+	Prompt  string          // 用户输入的问题，为空时从stdin读取
+	Command *config.Command // 配置文件中定义的命令（如 translate、review），nil表示普通问题
+}
+
+// parseExecCommand 解析exec命令
+// 支持 `ask [--format json|ndjson|text] [问题]` 和 `<配置的命令> [--format ...] [输入]` 的形式，其余内容原样作为问题
+// 只有在 ask 后面紧跟选项或没有其他内容时才将其视为命令动词，避免误吞自然语言中的 "ask"
+func parseExecCommand(command string) (*execRequest, error) {
+	req := &execRequest{Format: FormatText}
+	rest := strings.TrimSpace(command)
+
+	if word, remain := nextWord(rest); word == "ask" {
+		if next, _ := nextWord(remain); next == "" || strings.HasPrefix(next, "--") {
+			rest = remain
+		}
+	} else if cmd := config.FindCommand(word); cmd != nil {
+		req.Command = cmd
+		rest = remain
+	}
+
+	for {
+		word, remain := nextWord(rest)
+		switch {
+		case word == "--format":
+			value, after := nextWord(remain)
+			if value == "" {
+				return nil, fmt.Errorf("--format 需要指定参数")
+			}
+			req.Format = value
+			rest = after
+		case strings.HasPrefix(word, "--format="):
+			req.Format = strings.TrimPrefix(word, "--format=")
+			rest = remain
+		case word == "--":
+			rest = remain
+			goto done
+		default:
+			goto done
+		}
+	}
+
+done:
+	switch req.Format {
+	case FormatText, FormatJSON, FormatNDJSON:
+	default:
+		return nil, fmt.Errorf("不支持的输出格式: %s（可选: text, json, ndjson）", req.Format)
+	}
+
+	req.Prompt = rest
+	return req, nil
+}
+
+// nextWord 返回第一个以空白分隔的单词和剩余内容
+func nextWord(text string) (string, string) {
+	text = strings.TrimLeft(text, " \t")
+	if idx := strings.IndexAny(text, " \t"); idx >= 0 {
+		return text[:idx], strings.TrimLeft(text[idx:], " \t")
+	}
+	return text, ""
+}
+
+// newRendererForFormat 根据输出格式创建渲染器，language为文本格式中提示文字的语言
+func newRendererForFormat(channel ssh.Channel, format string, language i18n.Language) ai.Renderer {
+	switch format {
+	case FormatJSON:
+		return ai.NewJSONRenderer(channel, false)
+	case FormatNDJSON:
+		return ai.NewJSONRenderer(channel, true)
+	default:
+		renderer := ai.NewTerminalRenderer(channel)
+		renderer.SetLanguage(language)
+		return renderer
+	}
+}
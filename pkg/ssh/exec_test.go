@@ -0,0 +1,40 @@
+package ssh
+
+import "testing"
+
+func TestParseExecCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		format  string
+		prompt  string
+		wantErr bool
+	}{
+		{"你好", FormatText, "你好", false},
+		{"ask --format json what is go", FormatJSON, "what is go", false},
+		{"ask --format=ndjson hello  world", FormatNDJSON, "hello  world", false},
+		{"--format json", FormatJSON, "", false},
+		{"ask", FormatText, "", false},
+		{"ask me anything", FormatText, "ask me anything", false},
+		{"ask --format -- --format is a flag", FormatText, "", true},
+		{"ask --format json -- --format is a flag", FormatJSON, "--format is a flag", false},
+		{"ask --format xml hi", "", "", true},
+		{"ask --format", "", "", true},
+	}
+
+	for _, tt := range tests {
+		req, err := parseExecCommand(tt.command)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseExecCommand(%q) expected error", tt.command)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseExecCommand(%q) unexpected error: %v", tt.command, err)
+			continue
+		}
+		if req.Format != tt.format || req.Prompt != tt.prompt {
+			t.Errorf("parseExecCommand(%q) = {%q, %q}, want {%q, %q}", tt.command, req.Format, req.Prompt, tt.format, tt.prompt)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package ssh
+
+import (
+	"log"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+)
+
+// exec/stdin模式下的退出码
+const (
+	ExitOK          = 0   // 成功
+	ExitGeneral     = 1   // 未分类错误
+	ExitInput       = 2   // 输入内容错误（为空、非文本等）
+	ExitAuth        = 3   // 上游API认证失败
+	ExitQuota       = 4   // 上游API配额不足或被限流
+	ExitUpstream    = 5   // 上游API服务错误或网络错误
+	ExitInterrupted = 130 // 被中断（等同于SIGINT）
+)
+
+// signalNumbers SSH信号名称到信号编号的映射（RFC 4254 6.10）
+var signalNumbers = map[string]int{
+	"HUP":  1,
+	"INT":  2,
+	"QUIT": 3,
+	"KILL": 9,
+	"TERM": 15,
+}
+
+// signalState 记录会话收到的信号，并通过中断通道取消正在进行的请求
+type signalState struct {
+	mutex     sync.Mutex
+	received  string
+	interrupt chan bool
+}
+
+// newSignalState 创建信号状态
+func newSignalState() *signalState {
+	return &signalState{
+		interrupt: make(chan bool, 1),
+	}
+}
+
+// handle 处理signal请求，payload格式: [string signal name]
+func (s *signalState) handle(payload []byte) bool {
+	var msg struct {
+		Signal string
+	}
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		log.Printf("解析signal请求失败: %v", err)
+		return false
+	}
+
+	switch msg.Signal {
+	case "INT", "TERM", "HUP", "QUIT", "KILL":
+	default:
+		log.Printf("忽略不支持的信号: %s", msg.Signal)
+		return false
+	}
+
+	log.Printf("收到信号: SIG%s", msg.Signal)
+	s.mutex.Lock()
+	s.received = msg.Signal
+	s.mutex.Unlock()
+
+	s.cancel()
+	return true
+}
+
+// cancel 非阻塞发送中断信号，取消正在进行的请求
+func (s *signalState) cancel() {
+	select {
+	case s.interrupt <- true:
+	default:
+	}
+}
+
+// signal 返回收到的信号名称，没有收到则为空
+func (s *signalState) signal() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.received
+}
+
+// exitCodeForError 根据AI请求错误计算退出码
+func exitCodeForError(err error, signal string) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	switch ai.KindOf(err) {
+	case ai.ErrorKindInput:
+		return ExitInput
+	case ai.ErrorKindAuth:
+		return ExitAuth
+	case ai.ErrorKindQuota:
+		return ExitQuota
+	case ai.ErrorKindUpstream:
+		return ExitUpstream
+	case ai.ErrorKindInterrupted:
+		if num, ok := signalNumbers[signal]; ok {
+			return 128 + num
+		}
+		return ExitInterrupted
+	default:
+		return ExitGeneral
+	}
+}
+
+// sendExitStatus 发送exit-status请求，让客户端得到命令的退出码
+func sendExitStatus(channel ssh.Channel, code int) {
+	payload := ssh.Marshal(&struct {
+		Status uint32
+	}{uint32(code)})
+	if _, err := channel.SendRequest("exit-status", false, payload); err != nil {
+		log.Printf("发送exit-status失败: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+)
+
+func TestExitCodeForError(t *testing.T) {
+	kind := func(kind ai.ErrorKind) error {
+		return &ai.RequestError{Kind: kind, Err: errors.New("failed")}
+	}
+	tests := []struct {
+		err    error
+		signal string
+		want   int
+	}{
+		{nil, "", ExitOK},
+		{errors.New("unclassified"), "", ExitGeneral},
+		{kind(ai.ErrorKindUnknown), "", ExitGeneral},
+		{kind(ai.ErrorKindInput), "", ExitInput},
+		{kind(ai.ErrorKindAuth), "", ExitAuth},
+		{kind(ai.ErrorKindQuota), "", ExitQuota},
+		{kind(ai.ErrorKindUpstream), "", ExitUpstream},
+		{fmt.Errorf("wrapped: %w", kind(ai.ErrorKindQuota)), "", ExitQuota},
+		// 被信号中断时退出码为 128+信号编号，与shell一致
+		{ai.ErrInterrupted, "", ExitInterrupted},
+		{ai.ErrInterrupted, "HUP", 129},
+		{ai.ErrInterrupted, "INT", 130},
+		{ai.ErrInterrupted, "QUIT", 131},
+		{ai.ErrInterrupted, "KILL", 137},
+		{ai.ErrInterrupted, "TERM", 143},
+		{ai.ErrInterrupted, "USR1", ExitInterrupted},
+		// 只有中断错误使用信号编号
+		{kind(ai.ErrorKindUpstream), "TERM", ExitUpstream},
+	}
+
+	for _, tt := range tests {
+		if got := exitCodeForError(tt.err, tt.signal); got != tt.want {
+			t.Errorf("exitCodeForError(%v, %q) = %d, want %d", tt.err, tt.signal, got, tt.want)
+		}
+	}
+}
+
+func TestSignalStateHandle(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		handled bool
+		signal  string
+	}{
+		{ssh.Marshal(&struct{ Signal string }{"INT"}), true, "INT"},
+		{ssh.Marshal(&struct{ Signal string }{"TERM"}), true, "TERM"},
+		{ssh.Marshal(&struct{ Signal string }{"USR1"}), false, ""},
+		{ssh.Marshal(&struct{ Signal string }{"WINCH"}), false, ""},
+		{[]byte{0, 0}, false, ""},
+	}
+
+	for _, tt := range tests {
+		state := newSignalState()
+		if handled := state.handle(tt.payload); handled != tt.handled {
+			t.Errorf("handle(%q) = %v, want %v", tt.payload, handled, tt.handled)
+		}
+		if state.signal() != tt.signal {
+			t.Errorf("handle(%q) recorded signal %q, want %q", tt.payload, state.signal(), tt.signal)
+		}
+		// 只有支持的信号取消正在进行的请求
+		select {
+		case <-state.interrupt:
+			if !tt.handled {
+				t.Errorf("handle(%q) should not interrupt", tt.payload)
+			}
+		default:
+			if tt.handled {
+				t.Errorf("handle(%q) should interrupt", tt.payload)
+			}
+		}
+	}
+}
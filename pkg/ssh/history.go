@@ -0,0 +1,288 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"sshai/pkg/config"
+)
+
+const (
+	defaultHistorySize = 1000      // 默认保留的历史条数
+	defaultHistoryDir  = "history" // 默认历史文件目录
+)
+
+// CommandHistory 命令历史结构体
+type CommandHistory struct {
+	commands []string
+	index    int           // 当前历史索引，-1表示没有在浏览历史
+	maxSize  int           // 最多保留的条数
+	store    *historyStore // 持久化存储，nil表示只保存在内存中
+}
+
+// NewCommandHistory 创建新的命令历史
+func NewCommandHistory() *CommandHistory {
+	return &CommandHistory{
+		commands: make([]string, 0),
+		index:    -1,
+		maxSize:  historySize(),
+	}
+}
+
+// LoadCommandHistory 加载 owner 的持久化命令历史，未启用持久化或 owner 为空时返回内存中的历史
+// owner 应为经过验证的身份（见 Session.historyOwner），登录用户名可以任意填写，不能用来区分用户
+func LoadCommandHistory(owner string) *CommandHistory {
+	history := NewCommandHistory()
+	cfg := config.Get()
+	if !cfg.History.Enabled || owner == "" {
+		return history
+	}
+
+	dir := cfg.History.Dir
+	if dir == "" {
+		dir = defaultHistoryDir
+	}
+	store := &historyStore{
+		path:    filepath.Join(dir, historyFileName(owner)),
+		exclude: compileHistoryPatterns(cfg.History.ExcludePatterns),
+	}
+	commands, err := store.load(history.maxSize)
+	if err != nil {
+		log.Printf("加载 %s 的命令历史失败: %v", owner, err)
+	}
+	history.commands = commands
+	history.store = store
+	return history
+}
+
+// historyOwner 持久化命令历史的所有者：经过验证的会话身份，只有公钥指纹时使用指纹，
+// 否则（密码或无密码登录）返回空，历史只保存在内存中
+func (s *Session) historyOwner() string {
+	switch {
+	case s.verified:
+		return s.Username
+	case s.keyFingerprint != "":
+		return s.keyFingerprint
+	}
+	return ""
+}
+
+// historySize 获取配置的历史条数
+func historySize() int {
+	if size := config.Get().History.MaxSize; size > 0 {
+		return size
+	}
+	return defaultHistorySize
+}
+
+// AddCommand 添加命令到历史，已存在的相同命令会被移到末尾
+func (h *CommandHistory) AddCommand(cmd string) {
+	h.index = -1 // 重置索引
+	if cmd == "" {
+		return
+	}
+	h.commands = appendDeduped(h.commands, cmd, h.maxSize)
+	if h.store != nil {
+		if err := h.store.append(cmd); err != nil {
+			log.Printf("保存命令历史失败: %v", err)
+		}
+	}
+}
+
+// GetPrevious 获取上一个命令
+func (h *CommandHistory) GetPrevious() string {
+	if len(h.commands) == 0 {
+		return ""
+	}
+
+	if h.index == -1 {
+		h.index = len(h.commands) - 1
+	} else if h.index > 0 {
+		h.index--
+	}
+
+	return h.commands[h.index]
+}
+
+// GetNext 获取下一个命令
+func (h *CommandHistory) GetNext() string {
+	if len(h.commands) == 0 || h.index == -1 {
+		return ""
+	}
+
+	if h.index < len(h.commands)-1 {
+		h.index++
+		return h.commands[h.index]
+	} else {
+		h.index = -1
+		return ""
+	}
+}
+
+// Search 从索引before之前向前查找包含关键字的命令，返回其索引，未找到返回-1
+func (h *CommandHistory) Search(query string, before int) int {
+	for i := before - 1; i >= 0 && i < len(h.commands); i-- {
+		if strings.Contains(h.commands[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendDeduped 追加命令并移除之前相同的命令，超过maxSize时丢弃最旧的
+func appendDeduped(commands []string, cmd string, maxSize int) []string {
+	for i, existing := range commands {
+		if existing == cmd {
+			commands = append(commands[:i], commands[i+1:]...)
+			break
+		}
+	}
+	commands = append(commands, cmd)
+	if maxSize > 0 && len(commands) > maxSize {
+		commands = commands[len(commands)-maxSize:]
+	}
+	return commands
+}
+
+// historyStore 每个用户一个的历史文件，每行一条JSON字符串（支持多行输入）
+// 同一用户的多个会话通过追加写入共享历史，加载时去重并压缩文件
+type historyStore struct {
+	path    string
+	exclude []*regexp.Regexp // 匹配的输入不写入文件
+}
+
+// historyFileMutex 保护同一进程内对历史文件的压缩重写
+var historyFileMutex sync.Mutex
+
+// load 读取历史文件，返回去重后最多maxSize条命令；文件中有多余条目时重写文件
+func (s *historyStore) load(maxSize int) ([]string, error) {
+	historyFileMutex.Lock()
+	defer historyFileMutex.Unlock()
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var commands []string
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines++
+		var cmd string
+		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil || cmd == "" || s.excluded(cmd) {
+			continue
+		}
+		commands = appendDeduped(commands, cmd, 0)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && len(commands) > maxSize {
+		commands = commands[len(commands)-maxSize:]
+	}
+
+	if lines > len(commands) {
+		if err := s.rewrite(commands); err != nil {
+			log.Printf("压缩命令历史文件失败: %v", err)
+		}
+	}
+	return commands, nil
+}
+
+// append 追加一条命令，匹配排除规则的命令不保存
+func (s *historyStore) append(cmd string) error {
+	if s.excluded(cmd) {
+		return nil
+	}
+	line, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	historyFileMutex.Lock()
+	defer historyFileMutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// rewrite 用给定的命令重写历史文件（写入临时文件后重命名）
+func (s *historyStore) rewrite(commands []string) error {
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, cmd := range commands {
+		line, _ := json.Marshal(cmd)
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// excluded 判断命令是否匹配排除规则（如包含密钥、密码）
+func (s *historyStore) excluded(cmd string) bool {
+	for _, pattern := range s.exclude {
+		if pattern.MatchString(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileHistoryPatterns 编译排除规则，无效的规则记录日志后忽略
+func compileHistoryPatterns(patterns []string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Printf("忽略无效的历史排除规则 %q: %v", pattern, err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// historyFileName 根据用户名生成安全的文件名，字母、数字、'-'和'_'以外的字符转义为%xx
+func historyFileName(username string) string {
+	var b strings.Builder
+	for _, c := range []byte(username) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			b.WriteString(fmt.Sprintf("%%%02x", c))
+		}
+	}
+	return b.String() + ".history"
+}
@@ -0,0 +1,81 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sshai/pkg/config"
+)
+
+func TestPersistentCommandHistory(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.History
+	defer func() { cfg.History = saved }()
+
+	dir := t.TempDir()
+	cfg.History.Enabled = true
+	cfg.History.Dir = dir
+	cfg.History.MaxSize = 3
+	cfg.History.ExcludePatterns = []string{`(?i)password\s*=`, `[invalid`}
+
+	history := LoadCommandHistory("alice")
+	for _, cmd := range []string{"one", "two", "PASSWORD=hunter2", "three\nmultiline", "one", "four"} {
+		history.AddCommand(cmd)
+	}
+
+	// 新会话加载历史：去重、排除敏感输入并限制条数
+	reloaded := LoadCommandHistory("alice")
+	want := []string{"three\nmultiline", "one", "four"}
+	if !reflect.DeepEqual(reloaded.commands, want) {
+		t.Errorf("reloaded history = %q, want %q", reloaded.commands, want)
+	}
+	if reloaded.GetPrevious() != "four" {
+		t.Error("up arrow should return the latest command from the previous session")
+	}
+
+	// 加载时压缩文件，只保留有效条目
+	data, err := os.ReadFile(filepath.Join(dir, "alice.history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != len(want) {
+		t.Errorf("history file has %d lines after compaction, want %d", lines, len(want))
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("secret input should not be persisted")
+	}
+
+	// 其它用户的历史互不影响
+	if other := LoadCommandHistory("../bob"); len(other.commands) != 0 {
+		t.Errorf("unexpected history for another user: %q", other.commands)
+	}
+	if name := historyFileName("../bob"); name != "%2e%2e%2fbob.history" {
+		t.Errorf("unsafe history file name %q", name)
+	}
+
+	// 未经验证的身份不读写历史文件
+	anonymous := LoadCommandHistory("")
+	anonymous.AddCommand("five")
+	if len(anonymous.commands) != 1 || anonymous.store != nil {
+		t.Errorf("history should not be persisted without a verified identity: %q", anonymous.commands)
+	}
+}
+
+func TestHistoryOwner(t *testing.T) {
+	cases := []struct {
+		session *Session
+		want    string
+	}{
+		{&Session{Username: "alice", verified: true, keyFingerprint: "SHA256:abc"}, "alice"},
+		{&Session{Username: "alice", keyFingerprint: "SHA256:abc"}, "SHA256:abc"},
+		{&Session{Username: "alice"}, ""},
+	}
+	for _, c := range cases {
+		if got := c.session.historyOwner(); got != c.want {
+			t.Errorf("historyOwner(%+v) = %q, want %q", c.session, got, c.want)
+		}
+	}
+}
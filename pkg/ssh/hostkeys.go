@@ -0,0 +1,270 @@
+package ssh
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+// 主机密钥类型
+const (
+	HostKeyEd25519 = "ed25519"
+	HostKeyECDSA   = "ecdsa"
+	HostKeyRSA     = "rsa"
+)
+
+// OpenSSH主机密钥更新扩展（PROTOCOL 2.5）
+const (
+	hostKeysRequest      = "hostkeys-00@openssh.com"
+	hostKeysProveRequest = "hostkeys-prove-00@openssh.com"
+)
+
+// rsaHostKeyBits 新生成的RSA主机密钥长度
+const rsaHostKeyBits = 4096
+
+// hostKeys 服务器加载的主机密钥
+type hostKeys struct {
+	signers []ssh.Signer // 主机密钥，用于密钥交换、公告和证明
+	certs   []ssh.Signer // 主机证书，只用于密钥交换
+}
+
+// loadHostKeys 按配置加载所有主机密钥，不存在的密钥文件会自动生成
+// security.host_key_file 为旧配置（RSA密钥），仍然支持
+func loadHostKeys() (*hostKeys, error) {
+	cfg := config.Get().Security
+
+	entries := cfg.HostKeys
+	if cfg.HostKeyFile != "" {
+		entries = append([]config.HostKey{{File: cfg.HostKeyFile, Type: HostKeyRSA}}, entries...)
+	}
+	if len(entries) == 0 {
+		entries = []config.HostKey{{File: "host_key.pem", Type: HostKeyRSA}}
+	}
+
+	keys := &hostKeys{}
+	seen := make(map[string]string) // 密钥算法 -> 文件，同一算法只能使用一个密钥
+	for _, entry := range entries {
+		signer, err := loadOrGenerateHostKey(entry.File, entry.Type)
+		if err != nil {
+			return nil, fmt.Errorf("主机密钥 %s: %v", entry.File, err)
+		}
+		keyType := signer.PublicKey().Type()
+		if previous, ok := seen[keyType]; ok {
+			log.Printf("警告：主机密钥 %s 与 %s 类型相同（%s），已忽略", entry.File, previous, keyType)
+			continue
+		}
+		seen[keyType] = entry.File
+		keys.signers = append(keys.signers, signer)
+		log.Printf("已加载主机密钥 %s (%s %s)", entry.File, keyType, ssh.FingerprintSHA256(signer.PublicKey()))
+
+		if entry.Certificate != "" {
+			certSigner, err := loadHostCertificate(signer, entry.Certificate)
+			if err != nil {
+				return nil, fmt.Errorf("主机证书 %s: %v", entry.Certificate, err)
+			}
+			keys.certs = append(keys.certs, certSigner)
+			log.Printf("已加载主机证书 %s", entry.Certificate)
+		}
+	}
+	return keys, nil
+}
+
+// addTo 将主机密钥和证书添加到服务器配置
+func (k *hostKeys) addTo(sshConfig *ssh.ServerConfig) {
+	for _, signer := range k.signers {
+		sshConfig.AddHostKey(signer)
+	}
+	for _, cert := range k.certs {
+		sshConfig.AddHostKey(cert)
+	}
+}
+
+// loadOrGenerateHostKey 加载主机密钥，文件不存在时生成指定类型的密钥并保存
+func loadOrGenerateHostKey(file, keyType string) (ssh.Signer, error) {
+	if keyData, err := os.ReadFile(file); err == nil {
+		signer, err := ssh.ParsePrivateKey(keyData)
+		if err != nil {
+			return nil, fmt.Errorf("解析密钥失败: %v", err)
+		}
+		if keyType != "" && !hostKeyTypeMatches(signer.PublicKey(), keyType) {
+			log.Printf("警告：主机密钥 %s 的实际类型为 %s，与配置的 %s 不一致", file, signer.PublicKey().Type(), keyType)
+		}
+		return signer, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取密钥失败: %v", err)
+	}
+
+	privateKey, err := generateHostPrivateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "sshai host key")
+	if err != nil {
+		return nil, fmt.Errorf("序列化密钥失败: %v", err)
+	}
+	if dir := filepath.Dir(file); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("创建密钥目录失败: %v", err)
+		}
+	}
+	if err := os.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+		log.Printf("警告：无法保存主机密钥 %s: %v", file, err)
+		return signer, nil
+	}
+	// 同时保存公钥，便于分发到known_hosts或用CA签发主机证书
+	if err := os.WriteFile(file+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		log.Printf("警告：无法保存主机公钥 %s.pub: %v", file, err)
+	}
+	log.Printf("已生成并保存新的主机密钥 %s", file)
+	return signer, nil
+}
+
+// generateHostPrivateKey 生成指定类型的私钥，类型为空时生成Ed25519密钥
+func generateHostPrivateKey(keyType string) (crypto.PrivateKey, error) {
+	switch strings.ToLower(keyType) {
+	case "", HostKeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case HostKeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case HostKeyRSA:
+		return rsa.GenerateKey(rand.Reader, rsaHostKeyBits)
+	default:
+		return nil, fmt.Errorf("不支持的主机密钥类型: %s（支持 ed25519, ecdsa, rsa）", keyType)
+	}
+}
+
+// hostKeyTypeMatches 判断公钥是否是配置的类型
+func hostKeyTypeMatches(key ssh.PublicKey, keyType string) bool {
+	switch strings.ToLower(keyType) {
+	case HostKeyEd25519:
+		return key.Type() == ssh.KeyAlgoED25519
+	case HostKeyECDSA:
+		return strings.HasPrefix(key.Type(), "ecdsa-sha2-")
+	case HostKeyRSA:
+		return key.Type() == ssh.KeyAlgoRSA
+	}
+	return true
+}
+
+// loadHostCertificate 加载CA签发的主机证书，证书必须与主机密钥匹配
+func loadHostCertificate(signer ssh.Signer, file string) (ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取证书失败: %v", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析证书失败: %v", err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("不是SSH证书")
+	}
+	if cert.CertType != ssh.HostCert {
+		return nil, fmt.Errorf("不是主机证书")
+	}
+	// NewCertSigner 会检查证书中的公钥与主机密钥是否一致
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// announceHostKeys 向客户端公告服务器的所有主机密钥（hostkeys-00@openssh.com）
+// 启用UpdateHostKeys的OpenSSH客户端会据此更新known_hosts，轮换密钥前先添加新密钥即可让客户端提前学习
+func announceHostKeys(conn ssh.Conn, keys *hostKeys) {
+	var payload []byte
+	for _, signer := range keys.signers {
+		payload = append(payload, ssh.Marshal(struct{ Key []byte }{signer.PublicKey().Marshal()})...)
+	}
+	if _, _, err := conn.SendRequest(hostKeysRequest, false, payload); err != nil {
+		log.Printf("公告主机密钥失败: %v", err)
+	}
+}
+
+// handleGlobalRequests 处理连接级别的请求，只支持主机密钥证明，其它请求全部拒绝
+func handleGlobalRequests(conn ssh.Conn, reqs <-chan *ssh.Request, keys *hostKeys) {
+	for req := range reqs {
+		if req.Type != hostKeysProveRequest {
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+		response, err := proveHostKeys(conn.SessionID(), req.Payload, keys.signers)
+		if err != nil {
+			log.Printf("主机密钥证明失败: %v", err)
+		}
+		req.Reply(err == nil, response)
+	}
+}
+
+// proveHostKeys 对客户端请求证明的每个主机密钥签名
+// 签名内容为 string "hostkeys-prove-00@openssh.com" || string session_id || string hostkey
+func proveHostKeys(sessionID, payload []byte, signers []ssh.Signer) ([]byte, error) {
+	var response []byte
+	for len(payload) > 0 {
+		var msg struct {
+			Key  []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(payload, &msg); err != nil {
+			return nil, fmt.Errorf("解析请求失败: %v", err)
+		}
+		payload = msg.Rest
+
+		signer := findHostKey(signers, msg.Key)
+		if signer == nil {
+			return nil, fmt.Errorf("请求证明的不是本服务器的主机密钥")
+		}
+
+		data := ssh.Marshal(struct {
+			Request   string
+			SessionID []byte
+			Key       []byte
+		}{hostKeysProveRequest, sessionID, msg.Key})
+
+		signature, err := signHostKeyProof(signer, data)
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, ssh.Marshal(struct{ Signature []byte }{ssh.Marshal(signature)})...)
+	}
+	return response, nil
+}
+
+// findHostKey 根据公钥查找主机密钥
+func findHostKey(signers []ssh.Signer, key []byte) ssh.Signer {
+	for _, signer := range signers {
+		if string(signer.PublicKey().Marshal()) == string(key) {
+			return signer
+		}
+	}
+	return nil
+}
+
+// signHostKeyProof 签名主机密钥证明，RSA密钥使用rsa-sha2-512（与OpenSSH一致，不使用SHA-1）
+func signHostKeyProof(signer ssh.Signer, data []byte) (*ssh.Signature, error) {
+	if signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok {
+			return algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+		}
+	}
+	return signer.Sign(rand.Reader, data)
+}
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/config"
+)
+
+func TestLoadHostKeys(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Get()
+	saved := cfg.Security
+	defer func() { cfg.Security = saved }()
+
+	// CA签发的主机证书
+	_, caKey, _ := ed25519.GenerateKey(rand.Reader)
+	caSigner, _ := ssh.NewSignerFromKey(caKey)
+	edFile := filepath.Join(dir, "keys", "ssh_host_ed25519_key")
+	edSigner, err := loadOrGenerateHostKey(edFile, HostKeyEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             edSigner.PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"sshai.example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		t.Fatal(err)
+	}
+	certFile := edFile + "-cert.pub"
+	os.WriteFile(certFile, ssh.MarshalAuthorizedKey(cert), 0644)
+
+	cfg.Security.HostKeyFile = ""
+	cfg.Security.HostKeys = []config.HostKey{
+		{File: edFile, Type: HostKeyEd25519, Certificate: certFile},
+		{File: filepath.Join(dir, "keys", "ssh_host_ecdsa_key"), Type: HostKeyECDSA},
+		{File: filepath.Join(dir, "duplicate_ed25519_key"), Type: HostKeyEd25519},
+	}
+	keys, err := loadHostKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys.signers) != 2 || len(keys.certs) != 1 {
+		t.Fatalf("got %d keys and %d certs, want 2 and 1", len(keys.signers), len(keys.certs))
+	}
+	if string(keys.signers[0].PublicKey().Marshal()) != string(edSigner.PublicKey().Marshal()) {
+		t.Error("existing host key should be loaded instead of regenerated")
+	}
+	if keys.signers[1].PublicKey().Type() != ssh.KeyAlgoECDSA256 {
+		t.Errorf("unexpected ecdsa key type %s", keys.signers[1].PublicKey().Type())
+	}
+	if keys.certs[0].PublicKey().Type() != ssh.CertAlgoED25519v01 {
+		t.Errorf("unexpected certificate type %s", keys.certs[0].PublicKey().Type())
+	}
+	if info, err := os.Stat(edFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("host key should be saved with 0600 permissions: %v", err)
+	}
+	if _, err := os.Stat(edFile + ".pub"); err != nil {
+		t.Errorf("public key should be saved alongside the host key: %v", err)
+	}
+
+	// 证书与主机密钥不匹配时报错
+	cfg.Security.HostKeys = []config.HostKey{{File: filepath.Join(dir, "keys", "ssh_host_ecdsa_key"), Certificate: certFile}}
+	if _, err := loadHostKeys(); err == nil {
+		t.Error("certificate for a different key should be rejected")
+	}
+}
+
+func TestProveHostKeys(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edSigner, _ := ssh.NewSignerFromKey(edKey)
+	rsaSigner, _ := ssh.NewSignerFromKey(rsaKey)
+	signers := []ssh.Signer{edSigner, rsaSigner}
+	sessionID := []byte("session-id")
+
+	var payload []byte
+	for _, signer := range signers {
+		payload = append(payload, ssh.Marshal(struct{ Key []byte }{signer.PublicKey().Marshal()})...)
+	}
+	response, err := proveHostKeys(sessionID, payload, signers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 客户端按请求顺序校验每个签名
+	for _, signer := range signers {
+		var msg struct {
+			Signature []byte
+			Rest      []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(response, &msg); err != nil {
+			t.Fatal(err)
+		}
+		response = msg.Rest
+
+		var signature ssh.Signature
+		if err := ssh.Unmarshal(msg.Signature, &signature); err != nil {
+			t.Fatal(err)
+		}
+		data := ssh.Marshal(struct {
+			Request   string
+			SessionID []byte
+			Key       []byte
+		}{hostKeysProveRequest, sessionID, signer.PublicKey().Marshal()})
+		if err := signer.PublicKey().Verify(data, &signature); err != nil {
+			t.Errorf("invalid proof for %s: %v", signer.PublicKey().Type(), err)
+		}
+		if signer == rsaSigner && signature.Format != ssh.KeyAlgoRSASHA512 {
+			t.Errorf("rsa proof should use rsa-sha2-512, got %s", signature.Format)
+		}
+	}
+
+	// 请求证明其它密钥时拒绝
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	unknown := ssh.Marshal(struct{ Key []byte }{otherSigner.PublicKey().Marshal()})
+	if _, err := proveHostKeys(sessionID, unknown, signers); err == nil {
+		t.Error("proving an unknown key should fail")
+	}
+}
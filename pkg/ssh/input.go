@@ -0,0 +1,66 @@
+package ssh
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// inputReader 在单独的goroutine中读取客户端输入，
+// 使会话主循环可以同时等待键盘输入和AI请求完成
+type inputReader struct {
+	ssh.Channel
+	data    chan []byte   // 读取到的输入数据
+	done    chan struct{} // 停止读取
+	err     error         // 读取结束的原因，data关闭后有效
+	pending []byte        // Read未取完的数据
+}
+
+// newInputReader 创建输入读取器并开始读取
+func newInputReader(channel ssh.Channel) *inputReader {
+	r := &inputReader{
+		Channel: channel,
+		data:    make(chan []byte),
+		done:    make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// loop 持续读取channel直到出错或停止
+func (r *inputReader) loop() {
+	defer close(r.data)
+	buffer := make([]byte, 1024)
+	for {
+		n, err := r.Channel.Read(buffer)
+		if n > 0 {
+			chunk := append([]byte(nil), buffer[:n]...)
+			select {
+			case r.data <- chunk:
+			case <-r.done:
+				return
+			}
+		}
+		if err != nil {
+			r.err = err
+			return
+		}
+	}
+}
+
+// Read 实现ssh.Channel接口，供命令（如模型选择）在主循环中同步读取输入
+func (r *inputReader) Read(data []byte) (int, error) {
+	if len(r.pending) == 0 {
+		chunk, ok := <-r.data
+		if !ok {
+			return 0, r.err
+		}
+		r.pending = chunk
+	}
+	n := copy(data, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// stop 停止读取，之后读取到的数据会被丢弃
+func (r *inputReader) stop() {
+	close(r.done)
+}
@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+	"sshai/pkg/kb"
+	"sshai/pkg/ui"
+)
+
+// augmentQuestion 会话开启了知识库检索时，将检索到的段落加入问题，返回新的问题和引用来源
+func augmentQuestion(session *Session, question string) (string, []string) {
+	if !session.KnowledgeBaseOn() {
+		return question, nil
+	}
+	message, results := kb.Augment(context.Background(), question)
+	return message, kb.Citations(results)
+}
+
+// kbStatusLine 知识库状态行，用于 /help 和 /kb，未启用知识库时返回空
+func kbStatusLine(session *Session) string {
+	if !config.Get().KnowledgeBase.Enabled {
+		return ""
+	}
+	state := "开启"
+	if !session.KnowledgeBaseOn() {
+		state = "关闭"
+	}
+	return fmt.Sprintf("📚 知识库: %s（当前会话: %s）", kb.Status(), state)
+}
+
+// handleKBCommand 处理kb命令：查看状态、开启或关闭检索、搜索知识库
+func handleKBCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	if !config.Get().KnowledgeBase.Enabled {
+		channel.Write([]byte(ui.BrightYellowText("⚠️  没有启用知识库（knowledge_base）\r\n\r\n")))
+		return ""
+	}
+
+	subcommand := ""
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+	switch subcommand {
+	case "", "status":
+		channel.Write([]byte(ui.BrightCyanText(kbStatusLine(session)) + "\r\n"))
+		channel.Write([]byte("用法: /kb on|off|search <关键词>\r\n\r\n"))
+	case "on", "off":
+		session.SetKnowledgeBase(subcommand == "on")
+		if subcommand == "on" {
+			channel.Write([]byte(ui.BrightGreenText("✅ 已开启知识库检索，提问时会附带相关资料\r\n\r\n")))
+		} else {
+			channel.Write([]byte(ui.BrightGreenText("✅ 已关闭知识库检索\r\n\r\n")))
+		}
+	case "search":
+		query := strings.Join(args[1:], " ")
+		if query == "" {
+			channel.Write([]byte("用法: /kb search <关键词>\r\n\r\n"))
+			return ""
+		}
+		writeKBSearch(channel, assistant, query)
+	default:
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 未知的子命令: %s\r\n", args[0]))))
+		channel.Write([]byte("用法: /kb on|off|search <关键词>\r\n\r\n"))
+	}
+	return ""
+}
+
+// writeKBSearch 显示知识库搜索结果：引用来源、得分和内容预览
+func writeKBSearch(channel ssh.Channel, assistant *ai.Assistant, query string) {
+	results, err := kb.Search(context.Background(), query, 0)
+	if err != nil {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ %v\r\n\r\n", err))))
+		return
+	}
+	if len(results) == 0 {
+		channel.Write([]byte(ui.BrightYellowText("📚 没有找到相关内容\r\n\r\n")))
+		return
+	}
+
+	width := assistant.WrapWidth() - 4
+	if width < 20 {
+		width = 20
+	}
+	channel.Write([]byte(ui.BrightCyanText(fmt.Sprintf("📚 搜索结果 (%s):\r\n", query))))
+	for i, result := range results {
+		channel.Write([]byte(fmt.Sprintf("  %s %s %s\r\n", ui.BrightYellowText(fmt.Sprintf("[%d]", i+1)), result.Citation(), fmt.Sprintf("(%.3f)", result.Score))))
+		preview := previewText(strings.Join(strings.Fields(result.Text), " "), width)
+		channel.Write([]byte("    " + preview + "\r\n"))
+	}
+	channel.Write([]byte("\r\n"))
+}
@@ -0,0 +1,279 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"sshai/pkg/config"
+	"sshai/pkg/metrics"
+)
+
+// 连接限制的默认值
+const (
+	defaultHandshakeTimeout = 30 * time.Second
+	defaultBanWindow        = 10 * time.Minute
+	defaultBanDuration      = 15 * time.Minute
+	maxTrackedFailures      = 4096 // 失败记录超过该数量时清理过期记录
+)
+
+// failureRecord 一个IP或用户名在统计窗口内的认证失败记录
+type failureRecord struct {
+	count       int
+	windowStart time.Time
+	bannedUntil time.Time
+}
+
+// authGuard 按IP和用户名统计认证失败次数，超过阈值后临时封禁
+// 用户名封禁只拒绝密码认证，避免攻击者通过猜测密码锁定使用公钥登录的用户
+type authGuard struct {
+	mutex       sync.Mutex
+	maxFailures int
+	window      time.Duration
+	duration    time.Duration
+	records     map[string]*failureRecord
+	now         func() time.Time
+}
+
+// newAuthGuard 根据配置创建认证失败跟踪器，未配置失败次数时返回nil（不封禁）
+func newAuthGuard() *authGuard {
+	cfg := config.Get().Limits.Ban
+	if cfg.MaxFailures <= 0 {
+		return nil
+	}
+	guard := &authGuard{
+		maxFailures: cfg.MaxFailures,
+		window:      time.Duration(cfg.Window) * time.Second,
+		duration:    time.Duration(cfg.Duration) * time.Second,
+		records:     make(map[string]*failureRecord),
+		now:         time.Now,
+	}
+	if guard.window <= 0 {
+		guard.window = defaultBanWindow
+	}
+	if guard.duration <= 0 {
+		guard.duration = defaultBanDuration
+	}
+	return guard
+}
+
+// ipKey 和 userKey 生成失败记录的键
+func ipKey(ip string) string     { return "ip:" + ip }
+func userKey(user string) string { return "user:" + user }
+
+// recordFailure 记录一次认证失败，返回本次是否触发了封禁
+func (g *authGuard) recordFailure(ip, user string) bool {
+	if g == nil {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := g.now()
+	if len(g.records) > maxTrackedFailures {
+		g.prune(now)
+	}
+
+	banned := false
+	for _, key := range []string{ipKey(ip), userKey(user)} {
+		record, ok := g.records[key]
+		if !ok || now.Sub(record.windowStart) > g.window {
+			record = &failureRecord{windowStart: now, bannedUntil: recordBan(record)}
+			g.records[key] = record
+		}
+		record.count++
+		if record.count >= g.maxFailures && !now.Before(record.bannedUntil) {
+			record.bannedUntil = now.Add(g.duration)
+			record.count = 0
+			record.windowStart = now
+			banned = true
+		}
+	}
+	return banned
+}
+
+// fail 记录一次认证失败，触发封禁时记录日志和指标
+func (g *authGuard) fail(ip, user string) {
+	if g.recordFailure(ip, user) {
+		metrics.Bans.Inc()
+		log.Printf("认证失败次数过多，临时封禁: ip=%s, user=%s", ip, user)
+	}
+}
+
+// recordBan 窗口过期重新计数时保留仍然有效的封禁
+func recordBan(record *failureRecord) time.Time {
+	if record == nil {
+		return time.Time{}
+	}
+	return record.bannedUntil
+}
+
+// recordSuccess 认证成功后清除该IP的失败计数（不解除已生效的封禁）
+func (g *authGuard) recordSuccess(ip string) {
+	if g == nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if record, ok := g.records[ipKey(ip)]; ok {
+		record.count = 0
+	}
+}
+
+// ipBanned 判断IP是否处于封禁期
+func (g *authGuard) ipBanned(ip string) bool {
+	return g.banned(ipKey(ip))
+}
+
+// userBanned 判断用户名是否处于封禁期
+func (g *authGuard) userBanned(user string) bool {
+	return g.banned(userKey(user))
+}
+
+// banned 判断键是否处于封禁期
+func (g *authGuard) banned(key string) bool {
+	if g == nil {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	record, ok := g.records[key]
+	return ok && g.now().Before(record.bannedUntil)
+}
+
+// prune 清理窗口和封禁都已过期的记录，调用方需持有锁
+func (g *authGuard) prune(now time.Time) {
+	for key, record := range g.records {
+		if now.Sub(record.windowStart) > g.window && !now.Before(record.bannedUntil) {
+			delete(g.records, key)
+		}
+	}
+}
+
+// connLimiter 限制全局和单个IP的并发连接数，0表示不限制
+type connLimiter struct {
+	mutex    sync.Mutex
+	maxTotal int
+	maxPerIP int
+	total    int
+	perIP    map[string]int
+}
+
+// newConnLimiter 根据配置创建连接数限制器
+func newConnLimiter() *connLimiter {
+	cfg := config.Get().Limits
+	return &connLimiter{
+		maxTotal: cfg.MaxConnections,
+		maxPerIP: cfg.MaxConnectionsPerIP,
+		perIP:    make(map[string]int),
+	}
+}
+
+// acquire 占用一个连接名额，超过限制时返回原因
+func (l *connLimiter) acquire(ip string) (bool, string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return false, "max_connections"
+	}
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return false, "max_connections_per_ip"
+	}
+	l.total++
+	l.perIP[ip]++
+	return true, ""
+}
+
+// release 释放连接名额
+func (l *connLimiter) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// ipFilter 按CIDR列表过滤客户端地址：先检查拒绝列表，允许列表非空时只接受其中的地址
+type ipFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newIPFilter 解析CIDR列表，单个IP地址视为/32或/128
+func newIPFilter(allow, deny []string) (*ipFilter, error) {
+	filter := &ipFilter{}
+	var err error
+	if filter.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if filter.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseCIDRs 解析CIDR列表
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的IP地址: %s", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的CIDR: %s", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allowed 判断IP是否允许连接
+func (f *ipFilter) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range f.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, network := range f.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP 获取连接的客户端IP
+func remoteIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAuthGuard(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	guard := &authGuard{
+		maxFailures: 3,
+		window:      time.Minute,
+		duration:    10 * time.Minute,
+		records:     make(map[string]*failureRecord),
+		now:         func() time.Time { return now },
+	}
+
+	// 窗口过期后重新计数
+	guard.recordFailure("1.2.3.4", "alice")
+	guard.recordFailure("1.2.3.4", "alice")
+	now = now.Add(2 * time.Minute)
+	if guard.recordFailure("1.2.3.4", "alice") || guard.ipBanned("1.2.3.4") {
+		t.Fatal("failures outside the window should not trigger a ban")
+	}
+
+	// 成功登录清除IP计数，但用户名计数保留
+	guard.recordSuccess("1.2.3.4")
+	guard.recordFailure("1.2.3.4", "alice")
+	if !guard.recordFailure("5.6.7.8", "alice") {
+		t.Fatal("third failure for the username should trigger a ban")
+	}
+	if !guard.userBanned("alice") || guard.ipBanned("1.2.3.4") || guard.userBanned("bob") {
+		t.Error("only the username should be banned")
+	}
+
+	for i := 0; i < 3; i++ {
+		guard.recordFailure("9.9.9.9", "user"+string(rune('a'+i)))
+	}
+	if !guard.ipBanned("9.9.9.9") {
+		t.Error("ip should be banned after repeated failures with different usernames")
+	}
+
+	now = now.Add(11 * time.Minute)
+	if guard.ipBanned("9.9.9.9") || guard.userBanned("alice") {
+		t.Error("bans should expire")
+	}
+
+	var disabled *authGuard
+	if disabled.recordFailure("1.2.3.4", "alice") || disabled.ipBanned("1.2.3.4") {
+		t.Error("nil guard should never ban")
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	limiter := &connLimiter{maxTotal: 3, maxPerIP: 2, perIP: make(map[string]int)}
+
+	if ok, _ := limiter.acquire("a"); !ok {
+		t.Fatal("first connection should be accepted")
+	}
+	limiter.acquire("a")
+	if ok, reason := limiter.acquire("a"); ok || reason != "max_connections_per_ip" {
+		t.Errorf("per-ip limit not enforced: %v %q", ok, reason)
+	}
+	limiter.acquire("b")
+	if ok, reason := limiter.acquire("c"); ok || reason != "max_connections" {
+		t.Errorf("global limit not enforced: %v %q", ok, reason)
+	}
+
+	limiter.release("a")
+	if ok, _ := limiter.acquire("c"); !ok {
+		t.Error("released slot should be reusable")
+	}
+	limiter.release("a")
+	if _, exists := limiter.perIP["a"]; exists {
+		t.Error("ip entry should be removed when it has no connections")
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	filter, err := newIPFilter([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"}, []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"10.2.3.4":        true,
+		"10.1.2.3":        false, // 拒绝列表优先
+		"192.168.1.5":     true,
+		"192.168.1.6":     false,
+		"2001:db8::1":     true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+	}
+	for ip, want := range tests {
+		if got := filter.allowed(net.ParseIP(ip)); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	open, _ := newIPFilter(nil, nil)
+	if !open.allowed(net.ParseIP("8.8.8.8")) {
+		t.Error("empty filter should allow everything")
+	}
+	if _, err := newIPFilter([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Error("invalid CIDR should be rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+	"sshai/pkg/ui"
+)
+
+// defaultPersonaName /persona 命令中表示恢复默认设置（全局系统提示词和全部工具）的名称
+const defaultPersonaName = "default"
+
+// loginPersona 获取登录用户名对应的角色（如 ssh reviewer@host），没有同名角色时返回nil
+func loginPersona(session *Session) *config.Persona {
+	return config.FindPersona(session.LoginName)
+}
+
+// sessionPersona 获取会话使用的角色：路由规则指定的角色优先，其次是登录用户名对应的角色
+func sessionPersona(session *Session) *config.Persona {
+	if route := session.Route(); route != nil && route.Rule.Persona != "" {
+		if persona := config.FindPersona(route.Rule.Persona); persona != nil {
+			return persona
+		}
+		log.Printf("警告：路由规则 %s 中的角色 %q 不存在", route.Name(), route.Rule.Persona)
+	}
+	return loginPersona(session)
+}
+
+// sessionModelPattern 获取会话指定的模型（可以是通配符）：
+// 公钥指定的模型优先，其次是路由规则的模型，再次是角色的模型，都没有时返回空
+func sessionModelPattern(session *Session, persona *config.Persona) string {
+	if session.ModelPattern != "" {
+		return session.ModelPattern
+	}
+	if route := session.Route(); route != nil && route.Rule.Model != "" {
+		return route.Rule.Model
+	}
+	if persona != nil {
+		return persona.Model
+	}
+	return ""
+}
+
+// sessionDefaultModel 非交互模式（exec、stdin）使用的模型，会话没有指定模型时使用默认模型
+func sessionDefaultModel(session *Session) string {
+	return ai.DefaultModelForPattern(sessionModelPattern(session, sessionPersona(session)))
+}
+
+// selectSessionModel 交互模式下选择会话指定的模型，通配符匹配多个模型时让用户选择
+// 会话没有指定模型时返回空
+func selectSessionModel(channel ssh.Channel, models []ai.ModelInfo, session *Session, persona *config.Persona) string {
+	pattern := sessionModelPattern(session, persona)
+	if pattern == "" {
+		return ""
+	}
+	if model := ai.SelectModelByPattern(channel, models, pattern, session.Language()); model != "" {
+		return model
+	}
+	return ai.DefaultModelForPattern(pattern)
+}
+
+// handlePersonaCommand 处理persona命令：不带参数时列出角色，带参数时切换角色并清空对话上下文
+func handlePersonaCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	if len(args) == 0 {
+		writePersonaList(channel, assistant.GetPersona())
+		return ""
+	}
+
+	persona := config.FindPersona(args[0])
+	if persona == nil && !strings.EqualFold(args[0], defaultPersonaName) {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 角色不存在: %s\r\n", args[0]))))
+		channel.Write([]byte("输入 /persona 查看可用角色\r\n\r\n"))
+		return ""
+	}
+
+	assistant.SetPersona(persona)
+	conversationHistory.Clear()
+	name := ""
+	if persona != nil {
+		name = persona.Name
+		channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 已切换到角色: %s，对话上下文已清空\r\n", name))))
+	} else {
+		channel.Write([]byte(ui.BrightGreenText("✅ 已恢复默认设置，对话上下文已清空\r\n")))
+	}
+	session.SetPersona(name)
+	conversationHistory.AddMessage("system", fmt.Sprintf("切换角色: %s", args[0]))
+
+	// 角色指定了模型时同时切换模型
+	if persona != nil && persona.Model != "" {
+		if model := ai.DefaultModelForPattern(persona.Model); model != assistant.GetCurrentModel() {
+			assistant.SetModel(model)
+			channel.Write([]byte(fmt.Sprintf("✅ 已切换到模型: %s\r\n\r\n", ui.BrightGreenText(model))))
+			return model
+		}
+	}
+	channel.Write([]byte("\r\n"))
+	return ""
+}
+
+// writePersonaList 显示配置的角色列表，当前角色用*标记
+func writePersonaList(channel ssh.Channel, current *config.Persona) {
+	personas := config.Get().Personas
+	if len(personas) == 0 {
+		channel.Write([]byte(ui.BrightYellowText("⚠️  没有配置角色（personas）\r\n\r\n")))
+		return
+	}
+
+	maxNameLen := len(defaultPersonaName)
+	for _, persona := range personas {
+		if len(persona.Name) > maxNameLen {
+			maxNameLen = len(persona.Name)
+		}
+	}
+	writeEntry := func(name, description string, active bool) {
+		marker := " "
+		if active {
+			marker = ui.BrightGreenText("*")
+		}
+		padding := strings.Repeat(" ", maxNameLen-len(name)+2)
+		channel.Write([]byte(fmt.Sprintf("  %s %s%s%s\r\n", marker, ui.BrightYellowText(name), padding, description)))
+	}
+
+	channel.Write([]byte(ui.BrightCyanText("🎭 可用角色 (* 为当前角色):\r\n")))
+	writeEntry(defaultPersonaName, "默认设置", current == nil)
+	for _, persona := range personas {
+		description := persona.Description
+		if persona.Model != "" {
+			description = strings.TrimSpace(fmt.Sprintf("%s (模型: %s)", description, persona.Model))
+		}
+		writeEntry(persona.Name, description, current != nil && current.Name == persona.Name)
+	}
+	channel.Write([]byte("\r\n用法: /persona <名称>，切换角色会清空对话上下文\r\n\r\n"))
+}
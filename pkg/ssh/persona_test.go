@@ -0,0 +1,59 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+)
+
+func TestPersonaCommand(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Personas
+	defer func() { cfg.Personas = saved }()
+	cfg.Personas = []config.Persona{
+		{Name: "reviewer", SystemPrompt: "review code", Model: "review-model", ToolPolicy: config.ToolPolicy{MCPServers: []string{"git"}}},
+		{Name: "translator", SystemPrompt: "translate", ToolPolicy: config.ToolPolicy{NoTools: true}},
+	}
+
+	session := &Session{Username: "alice", LoginName: "Reviewer"}
+	if persona := loginPersona(session); persona == nil || persona.Name != "reviewer" {
+		t.Fatalf("login name should select the reviewer persona, got %+v", persona)
+	}
+	if model := sessionDefaultModel(session); model != "review-model" {
+		t.Errorf("exec mode should use the persona model, got %q", model)
+	}
+	session.ModelPattern = "key-model"
+	if model := sessionDefaultModel(session); model != "key-model" {
+		t.Errorf("key model should take precedence, got %q", model)
+	}
+
+	assistant := ai.NewAssistant("alice")
+	history := NewConversationHistory()
+	history.AddMessage("user", "hello")
+	channel := &recordingChannel{}
+	if model := handlePersonaCommand(channel, assistant, []string{"reviewer"}, history, "", session); model != "review-model" {
+		t.Errorf("switching persona should switch to its model, got %q", model)
+	}
+	if assistant.GetPersona() == nil || session.Snapshot().Persona != "reviewer" {
+		t.Error("persona should be recorded on the assistant and the session")
+	}
+	if len(history.GetMessages()) != 1 {
+		t.Error("switching persona should reset the conversation")
+	}
+
+	handlePersonaCommand(channel, assistant, []string{"nobody"}, history, "", session)
+	if assistant.GetPersona() == nil || !strings.Contains(channel.String(), "角色不存在") {
+		t.Error("unknown persona should be rejected without changing the current one")
+	}
+	handlePersonaCommand(channel, assistant, []string{"default"}, history, "", session)
+	if assistant.GetPersona() != nil || session.Snapshot().Persona != "" {
+		t.Error("/persona default should restore the default settings")
+	}
+
+	reviewer, translator := config.FindPersona("reviewer"), config.FindPersona("translator")
+	if !reviewer.AllowsMCPServer("git") || reviewer.AllowsMCPServer("bing") || translator.AllowsMCPServer("git") {
+		t.Error("persona MCP server filter is wrong")
+	}
+}
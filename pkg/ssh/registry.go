@@ -0,0 +1,411 @@
+package ssh
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/audit"
+	"sshai/pkg/auth"
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+	"sshai/pkg/prompt"
+	"sshai/pkg/workspace"
+)
+
+// Session 已建立的SSH连接，由Server.handleConnection注册到会话注册表
+type Session struct {
+	ID            int
+	Username      string // 会话身份：证书认证时为证书主体，公钥设置了 sshai-user 时为该用户名，否则为登录用户名
+	LoginName     string // SSH登录用户名，用于按用户名匹配模型
+	RemoteAddr    string
+	ClientVersion string
+	Admin         bool   // 是否拥有管理员权限
+	ModelPattern  string // 公钥选项 sshai-model 指定的模型（可以是通配符）
+	StartTime     time.Time
+
+	conn           ssh.Conn
+	notices        chan string     // 需要显示给用户的通知（如管理员广播）
+	totpEnroll     *auth.TOTPStore // 非nil表示用户未绑定TOTP，需要在会话开始时绑定
+	noPty          bool            // 公钥选项禁止分配伪终端
+	keyFingerprint string          // 登录公钥的指纹，非公钥认证时为空
+	keyComment     string          // 登录公钥的注释
+	certPrincipal  string          // 证书认证时的证书主体
+	verified       bool            // 会话身份是否经过验证（证书主体或公钥选项 sshai-user）
+	closeOnce      sync.Once
+
+	mutex        sync.Mutex
+	model        string
+	persona      string               // 当前角色，空表示未选择角色
+	route        *sessionRoute        // 匹配的路由规则，nil表示没有匹配的规则
+	language     i18n.Language        // 路由规则设置的界面语言，空表示使用当前语言
+	kbOff        bool                 // 通过 /kb off 关闭了知识库检索
+	workspace    *workspace.Workspace // 会话工作区，第一次使用时创建
+	approver     *approver            // 交互会话中确认远程命令，nil表示无法确认
+	request      string               // 正在处理的请求，空表示空闲
+	requestStart time.Time            // 请求开始时间
+	cancel       func()               // 取消正在处理的请求
+	draining     bool                 // 服务器正在关闭，不再接受新的请求
+}
+
+// SessionSnapshot 会话状态快照，用于展示
+type SessionSnapshot struct {
+	ID            int
+	Username      string
+	RemoteAddr    string
+	ClientVersion string
+	Admin         bool
+	StartTime     time.Time
+	Model         string
+	Persona       string
+	Request       string
+	RequestStart  time.Time
+}
+
+// SetModel 记录会话当前使用的模型
+func (s *Session) SetModel(model string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.model = model
+}
+
+// SetPersona 记录会话当前使用的角色
+func (s *Session) SetPersona(persona string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.persona = persona
+}
+
+// SetRoute 记录会话匹配的路由规则及其设置的界面语言
+func (s *Session) SetRoute(route *sessionRoute) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.route = route
+	s.language = routeLanguage(route)
+}
+
+// Route 获取会话匹配的路由规则，nil表示没有匹配的规则
+func (s *Session) Route() *sessionRoute {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.route
+}
+
+// Language 获取会话的界面语言，空表示使用当前语言
+func (s *Session) Language() i18n.Language {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.language
+}
+
+// SetKnowledgeBase 开启或关闭会话的知识库检索
+func (s *Session) SetKnowledgeBase(on bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.kbOff = !on
+}
+
+// KnowledgeBaseOn 判断会话是否使用知识库检索（配置启用且没有通过 /kb off 关闭）
+func (s *Session) KnowledgeBaseOn() bool {
+	if s == nil || !config.Get().KnowledgeBase.Enabled {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.kbOff
+}
+
+// T 使用会话的界面语言翻译
+func (s *Session) T(key string, args ...interface{}) string {
+	return i18n.TL(s.Language(), key, args...)
+}
+
+// toolPolicy 获取路由规则的工具策略，nil表示不限制
+func (s *Session) toolPolicy() *config.ToolPolicy {
+	route := s.Route()
+	if route == nil {
+		return nil
+	}
+	return &route.Rule.ToolPolicy
+}
+
+// promptData 提示词模板中的会话变量，模型、角色和工具由AI助手填充
+func (s *Session) promptData() prompt.Data {
+	language := s.Language()
+	if language == "" {
+		language = i18n.GetLanguage()
+	}
+	return prompt.Data{
+		User:          s.Username,
+		LoginName:     s.LoginName,
+		Lang:          string(language),
+		RemoteAddr:    s.RemoteAddr,
+		ClientVersion: s.ClientVersion,
+	}
+}
+
+// authDescription 会话的认证方式说明
+func (s *Session) authDescription() string {
+	switch {
+	case s.certPrincipal != "":
+		return "证书 (主体 " + s.certPrincipal + ")"
+	case s.keyFingerprint != "" && s.keyComment != "":
+		return "公钥 " + s.keyFingerprint + " (" + s.keyComment + ")"
+	case s.keyFingerprint != "":
+		return "公钥 " + s.keyFingerprint
+	case config.Get().Auth.Password != "":
+		return "密码"
+	default:
+		return "无需认证"
+	}
+}
+
+// BeginRequest 记录正在处理的请求，cancel用于在服务器关闭时取消请求
+func (s *Session) BeginRequest(prompt string, cancel func()) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.request = prompt
+	s.requestStart = time.Now()
+	s.cancel = cancel
+}
+
+// EndRequest 清除正在处理的请求
+func (s *Session) EndRequest() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.request = ""
+	s.cancel = nil
+}
+
+// Idle 是否没有正在处理的请求
+func (s *Session) Idle() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.request == ""
+}
+
+// CancelRequest 取消正在处理的请求
+func (s *Session) CancelRequest() {
+	s.mutex.Lock()
+	cancel := s.cancel
+	s.mutex.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Draining 服务器是否正在关闭（当前请求完成后会话将结束）
+func (s *Session) Draining() bool {
+	if s == nil {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.draining
+}
+
+// drain 标记服务器正在关闭并通知用户，只通知一次
+func (s *Session) drain(message string) {
+	s.mutex.Lock()
+	already := s.draining
+	s.draining = true
+	s.mutex.Unlock()
+	if !already {
+		s.Notify(message)
+	}
+}
+
+// Notices 获取通知通道，nil会话返回nil（select时永远阻塞）
+func (s *Session) Notices() <-chan string {
+	if s == nil {
+		return nil
+	}
+	return s.notices
+}
+
+// Notify 向会话发送通知，通知队列已满时丢弃
+func (s *Session) Notify(message string) bool {
+	select {
+	case s.notices <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// pendingTOTPEnrollment 用户需要绑定TOTP时返回TOTP存储
+func (s *Session) pendingTOTPEnrollment() *auth.TOTPStore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.totpEnroll
+}
+
+// completeTOTPEnrollment 绑定完成后，同一连接的其它会话通道不再需要绑定
+func (s *Session) completeTOTPEnrollment() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.totpEnroll = nil
+}
+
+// AuditIdentity 获取审计日志中的会话身份
+func (s *Session) AuditIdentity(mode string) audit.Identity {
+	if s == nil {
+		return audit.Identity{Mode: mode}
+	}
+	return audit.Identity{
+		SessionID:  s.ID,
+		User:       s.Username,
+		RemoteAddr: s.RemoteAddr,
+		Mode:       mode,
+	}
+}
+
+// Kick 通知用户后断开连接
+func (s *Session) Kick(reason string) {
+	s.Notify(reason)
+	s.closeAfter(200 * time.Millisecond)
+}
+
+// closeAfter 延迟一段时间后断开连接（留出时间让通知输出到客户端），多次调用只生效一次
+func (s *Session) closeAfter(delay time.Duration) {
+	s.closeOnce.Do(func() {
+		go func() {
+			time.Sleep(delay)
+			s.conn.Close()
+		}()
+	})
+}
+
+// Snapshot 获取会话状态快照
+func (s *Session) Snapshot() SessionSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SessionSnapshot{
+		ID:            s.ID,
+		Username:      s.Username,
+		RemoteAddr:    s.RemoteAddr,
+		ClientVersion: s.ClientVersion,
+		Admin:         s.Admin,
+		StartTime:     s.StartTime,
+		Model:         s.model,
+		Persona:       s.persona,
+		Request:       s.request,
+		RequestStart:  s.requestStart,
+	}
+}
+
+// SessionRegistry 会话注册表
+type SessionRegistry struct {
+	mutex    sync.RWMutex
+	nextID   int
+	sessions map[int]*Session
+}
+
+// NewSessionRegistry 创建会话注册表
+func NewSessionRegistry() *SessionRegistry {
+	return &SessionRegistry{
+		nextID:   1,
+		sessions: make(map[int]*Session),
+	}
+}
+
+// connIdentity 获取连接的会话身份，证书认证时使用证书主体，公钥设置了 sshai-user 时使用该用户名
+func connIdentity(conn ssh.Conn) string {
+	if serverConn, ok := conn.(*ssh.ServerConn); ok {
+		return permIdentity(serverConn, serverConn.Permissions)
+	}
+	return conn.User()
+}
+
+// connExtension 获取连接认证时记录的扩展信息
+func connExtension(conn ssh.Conn, name string) string {
+	if serverConn, ok := conn.(*ssh.ServerConn); ok && serverConn.Permissions != nil {
+		return serverConn.Permissions.Extensions[name]
+	}
+	return ""
+}
+
+// connVerified 连接的会话身份是否经过验证
+func connVerified(conn ssh.Conn) bool {
+	serverConn, ok := conn.(*ssh.ServerConn)
+	return ok && verifiedIdentity(serverConn.Permissions)
+}
+
+// sessionRegistry 全局会话注册表
+var sessionRegistry = NewSessionRegistry()
+
+// Register 注册新连接，返回分配了ID的会话
+func (r *SessionRegistry) Register(conn ssh.Conn, admin bool) *Session {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	session := &Session{
+		ID:             r.nextID,
+		Username:       connIdentity(conn),
+		LoginName:      conn.User(),
+		RemoteAddr:     conn.RemoteAddr().String(),
+		ClientVersion:  string(conn.ClientVersion()),
+		Admin:          admin,
+		ModelPattern:   connExtension(conn, permKeyModel),
+		StartTime:      time.Now(),
+		conn:           conn,
+		noPty:          connExtension(conn, permNoPty) != "",
+		keyFingerprint: connExtension(conn, permKeyFingerprint),
+		keyComment:     connExtension(conn, permKeyComment),
+		certPrincipal:  connExtension(conn, permCertPrincipal),
+		verified:       connVerified(conn),
+		notices:        make(chan string, 16),
+	}
+	r.sessions[session.ID] = session
+	r.nextID++
+	return session
+}
+
+// Unregister 移除会话
+func (r *SessionRegistry) Unregister(session *Session) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.sessions, session.ID)
+}
+
+// Get 根据ID获取会话
+func (r *SessionRegistry) Get(id int) (*Session, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	session, ok := r.sessions[id]
+	return session, ok
+}
+
+// List 获取所有会话，按ID排序
+func (r *SessionRegistry) List() []*Session {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// Count 获取会话数量
+func (r *SessionRegistry) Count() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.sessions)
+}
@@ -0,0 +1,168 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/auth"
+	"sshai/pkg/config"
+)
+
+// fakeConn 仅实现会话注册表需要的ssh.Conn方法
+type fakeConn struct {
+	ssh.Conn
+	user string
+}
+
+func (c *fakeConn) User() string          { return c.user }
+func (c *fakeConn) RemoteAddr() net.Addr  { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2200} }
+func (c *fakeConn) ClientVersion() []byte { return []byte("SSH-2.0-test") }
+
+func TestSessionRegistry(t *testing.T) {
+	registry := NewSessionRegistry()
+	alice := registry.Register(&fakeConn{user: "alice"}, true)
+	bob := registry.Register(&fakeConn{user: "bob"}, false)
+
+	if alice.ID == bob.ID || registry.Count() != 2 {
+		t.Fatalf("unexpected ids %d/%d, count %d", alice.ID, bob.ID, registry.Count())
+	}
+	if list := registry.List(); list[0] != alice || list[1] != bob {
+		t.Error("sessions should be listed in id order")
+	}
+
+	bob.SetModel("gpt-4")
+	cancelled := false
+	bob.BeginRequest("hello", func() { cancelled = true })
+	info := bob.Snapshot()
+	if info.Model != "gpt-4" || info.Request != "hello" || info.RemoteAddr != "127.0.0.1:2200" {
+		t.Errorf("unexpected snapshot %+v", info)
+	}
+	if bob.Idle() {
+		t.Error("session with a request in flight should not be idle")
+	}
+	bob.CancelRequest()
+	if !cancelled {
+		t.Error("CancelRequest should call the cancel function")
+	}
+	bob.EndRequest()
+	if bob.Snapshot().Request != "" || !bob.Idle() {
+		t.Error("request should be cleared")
+	}
+
+	// 关闭通知只发送一次
+	bob.drain("shutting down")
+	bob.drain("shutting down")
+	if !bob.Draining() || len(bob.notices) != 1 {
+		t.Errorf("drain should notify once, got %d notices", len(bob.notices))
+	}
+	<-bob.notices
+
+	// 通知队列满时丢弃而不阻塞
+	for i := 0; i < cap(bob.notices); i++ {
+		if !bob.Notify("msg") {
+			t.Fatal("notice dropped before queue was full")
+		}
+	}
+	if bob.Notify("overflow") {
+		t.Error("notice should be dropped when queue is full")
+	}
+
+	registry.Unregister(bob)
+	if _, ok := registry.Get(bob.ID); ok || registry.Count() != 1 {
+		t.Error("session should be removed")
+	}
+
+	// nil会话（如测试或非交互路径）的方法不会崩溃
+	var none *Session
+	none.SetModel("x")
+	none.BeginRequest("x", nil)
+	none.EndRequest()
+	if none.Notices() != nil {
+		t.Error("nil session should have no notices")
+	}
+}
+
+func TestAdminCommandRequiresAdmin(t *testing.T) {
+	channel := &recordingChannel{}
+	handleAdminCommand(channel, nil, []string{"sessions"}, nil, "", &Session{Username: "bob"})
+	if !strings.Contains(channel.String(), "权限不足") {
+		t.Errorf("non-admin should be rejected, got %q", channel.String())
+	}
+
+	cfg := config.Get()
+	savedAdmin, savedPassword := cfg.Admin, cfg.Auth.Password
+	defer func() { cfg.Admin, cfg.Auth.Password = savedAdmin, savedPassword }()
+	cfg.Admin.Users = []string{"root"}
+	cfg.Admin.Keys = []string{"not a key"}
+	conn := &ssh.ServerConn{Conn: &fakeConn{user: "root"}}
+
+	cfg.Auth.Password = ""
+	if isAdminConnection(conn) {
+		t.Error("username alone must not grant admin without password auth")
+	}
+	cfg.Auth.Password = "secret"
+	conn.Permissions = &ssh.Permissions{Extensions: map[string]string{}}
+	if isAdminConnection(conn) {
+		t.Error("login name with the shared password must not grant admin")
+	}
+
+	// 经过验证的会话身份：证书主体或公钥选项 sshai-user
+	for _, extension := range []string{permCertPrincipal, permKeyUser} {
+		conn := &ssh.ServerConn{Conn: &fakeConn{user: "guest"}, Permissions: &ssh.Permissions{Extensions: map[string]string{extension: "root"}}}
+		if !isAdminConnection(conn) {
+			t.Errorf("verified identity from %s should be admin", extension)
+		}
+	}
+}
+
+func TestAuthorizeAdminKey(t *testing.T) {
+	cfg := config.Get()
+	savedAdmin, savedAuth := cfg.Admin, cfg.Auth
+	defer func() { cfg.Admin, cfg.Auth = savedAdmin, savedAuth }()
+
+	_, adminKey, _ := ed25519.GenerateKey(rand.Reader)
+	admin, _ := ssh.NewSignerFromKey(adminKey)
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(admin.PublicKey())))
+	cfg.Admin.Keys = []string{line}
+	local := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222}
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2222}
+
+	// 不在授权列表中的管理员公钥可以登录
+	cfg.Auth.AuthorizedKeys, cfg.Auth.AuthorizedKeysFile = nil, ""
+	manager, _ := auth.NewAuthorizedKeysManager()
+	if _, err := authorizeKey(manager, admin.PublicKey(), remote); err != nil {
+		t.Errorf("admin key outside authorized_keys should be accepted: %v", err)
+	}
+	if _, err := authorizeKey(nil, admin.PublicKey(), remote); err != nil {
+		t.Errorf("admin key should be accepted without authorized_keys: %v", err)
+	}
+
+	// 授权列表中的管理员公钥必须满足 from= 限制
+	cfg.Auth.AuthorizedKeys = []string{`from="127.0.0.0/8" ` + line}
+	manager, _ = auth.NewAuthorizedKeysManager()
+	if _, err := authorizeKey(manager, admin.PublicKey(), local); err != nil {
+		t.Errorf("admin key should be accepted inside from=: %v", err)
+	}
+	if _, err := authorizeKey(manager, admin.PublicKey(), remote); err == nil {
+		t.Error("admin key should be rejected outside from=")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewSignerFromKey(otherKey)
+	if _, err := authorizeKey(manager, other.PublicKey(), local); err == nil {
+		t.Error("unknown key should be rejected")
+	}
+}
+
+// recordingChannel 记录写入内容的ssh.Channel
+type recordingChannel struct {
+	ssh.Channel
+	strings.Builder
+}
+
+func (c *recordingChannel) Write(data []byte) (int, error) { return c.Builder.Write(data) }
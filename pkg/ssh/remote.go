@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ui"
+)
+
+// approvalGrace 确认提示出现后的这段时间内收到的输入视为提示出现之前的输入（预先输入、正在传输的粘贴内容），全部丢弃
+const approvalGrace = 300 * time.Millisecond
+
+// approver 在终端中请用户确认远程命令，回答由交互会话的输入循环转交
+// 需要输入 yes 并回车才允许执行，避免预先输入或粘贴的内容意外确认
+type approver struct {
+	channel  ssh.Channel
+	mutex    sync.Mutex
+	answer   chan bool // 非nil表示正在等待确认
+	openedAt time.Time // 显示确认提示的时间
+	typed    []rune    // 已输入的回答
+}
+
+// ask 显示确认提示并等待回答，ctx 结束时视为拒绝
+func (a *approver) ask(ctx context.Context, host, command string) (bool, error) {
+	a.mutex.Lock()
+	if a.answer != nil {
+		a.mutex.Unlock()
+		return false, fmt.Errorf("另一条命令正在等待确认")
+	}
+	answer := make(chan bool, 1)
+	a.answer = answer
+	a.openedAt = time.Now()
+	a.typed = nil
+	a.mutex.Unlock()
+	defer func() {
+		a.mutex.Lock()
+		a.answer = nil
+		a.mutex.Unlock()
+	}()
+
+	a.channel.Write([]byte("\r\n" + ui.BrightYellowText(fmt.Sprintf("⚠️  需要确认: 在 %s 上执行命令", host)) + "\r\n"))
+	a.channel.Write([]byte("    " + strings.ReplaceAll(escapeControl(command), "\n", "\r\n    ") + "\r\n"))
+	a.channel.Write([]byte(ui.BrightCyanText("输入 yes 并回车允许执行，其它输入拒绝: ")))
+	select {
+	case approved := <-answer:
+		if approved {
+			a.channel.Write([]byte("\r\n" + ui.BrightGreenText("✅ 已允许") + "\r\n"))
+		} else {
+			a.channel.Write([]byte("\r\n" + ui.BrightRedText("❌ 已拒绝") + "\r\n"))
+		}
+		return approved, nil
+	case <-ctx.Done():
+		a.channel.Write([]byte("\r\n" + ui.BrightRedText("❌ 没有确认，已取消") + "\r\n"))
+		return false, ctx.Err()
+	}
+}
+
+// escapeControl 将换行以外的控制字符（ESC、\r 等）和不可见的格式字符（如双向文本控制符）显示为转义序列，
+// 避免命令中的终端控制序列覆盖或隐藏需要确认的内容
+func escapeControl(command string) string {
+	var b strings.Builder
+	for _, r := range command {
+		if r != '\n' && (unicode.IsControl(r) || unicode.Is(unicode.Cf, r)) {
+			quoted := strconv.QuoteRune(r)
+			b.WriteString(quoted[1 : len(quoted)-1])
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// handleKey 正在等待确认时处理按键，返回按键是否已被处理；received 为收到该输入的时间
+// 提示出现之前（含 approvalGrace）收到的输入和粘贴内容被丢弃，回车时输入 yes 则允许，Ctrl+C 拒绝
+func (a *approver) handleKey(key Key, received time.Time) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.answer == nil {
+		return false
+	}
+	if received.Before(a.openedAt.Add(approvalGrace)) && !(key.Code == KeyCtrl && key.Rune == 'c') {
+		return true
+	}
+	switch {
+	case key.Code == KeyRune:
+		if len(a.typed) < 16 {
+			a.typed = append(a.typed, key.Rune)
+			a.channel.Write([]byte(string(key.Rune)))
+		}
+		return true
+	case key.Code == KeyBackspace:
+		if len(a.typed) > 0 {
+			a.typed = a.typed[:len(a.typed)-1]
+			a.channel.Write([]byte("\b \b"))
+		}
+		return true
+	case key.Code == KeyEnter:
+		a.answer <- strings.EqualFold(string(a.typed), "yes")
+	case key.Code == KeyCtrl && key.Rune == 'c':
+		a.answer <- false
+	default:
+		// 粘贴内容和其它按键忽略
+		return true
+	}
+	a.answer = nil
+	return true
+}
+
+// setApprover 设置交互会话的确认方式，nil表示无法确认（命令模式）
+func (s *Session) setApprover(a *approver) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.approver = a
+}
+
+// Approve 请用户确认在远程主机上执行命令，只有交互会话可以确认
+func (s *Session) Approve(ctx context.Context, host, command string) (bool, error) {
+	if s == nil {
+		return false, fmt.Errorf("非交互会话无法确认，只能执行只读命令")
+	}
+	s.mutex.Lock()
+	a := s.approver
+	s.mutex.Unlock()
+	if a == nil {
+		return false, fmt.Errorf("非交互会话无法确认，只能执行只读命令")
+	}
+	return a.ask(ctx, host, command)
+}
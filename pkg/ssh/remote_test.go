@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// lockedChannel 可以同时写入的 recordingChannel
+type lockedChannel struct {
+	ssh.Channel
+	mutex   sync.Mutex
+	builder strings.Builder
+}
+
+func (c *lockedChannel) Write(data []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.builder.Write(data)
+}
+
+// askWith 显示确认提示，按顺序转交按键，返回确认结果
+func askWith(t *testing.T, keys []Key, received func(opened time.Time) time.Time) bool {
+	a := &approver{channel: &lockedChannel{}}
+	result := make(chan bool, 1)
+	go func() {
+		approved, _ := a.ask(context.Background(), "web1", "rm -rf /tmp/cache")
+		result <- approved
+	}()
+	for {
+		a.mutex.Lock()
+		waiting := a.answer != nil
+		opened := a.openedAt
+		a.mutex.Unlock()
+		if waiting {
+			for _, key := range keys {
+				a.handleKey(key, received(opened))
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case approved := <-result:
+		return approved
+	case <-time.After(100 * time.Millisecond):
+		// 还在等待确认，按 Ctrl+C 结束
+		a.handleKey(Key{Code: KeyCtrl, Rune: 'c'}, time.Now())
+		<-result
+		return false
+	}
+}
+
+func typed(text string) []Key {
+	var keys []Key
+	for _, r := range text {
+		if r == '\r' {
+			keys = append(keys, Key{Code: KeyEnter})
+		} else {
+			keys = append(keys, Key{Code: KeyRune, Rune: r})
+		}
+	}
+	return keys
+}
+
+func TestApprover(t *testing.T) {
+	afterGrace := func(opened time.Time) time.Time { return opened.Add(approvalGrace + time.Millisecond) }
+
+	if !askWith(t, typed("yes\r"), afterGrace) {
+		t.Error("typing yes and Enter should approve")
+	}
+	if !askWith(t, append(typed("yex"), append([]Key{{Code: KeyBackspace}}, typed("s\r")...)...), afterGrace) {
+		t.Error("backspace should edit the answer")
+	}
+	for _, answer := range []string{"y\r", "yess\r", "no\r", "\r"} {
+		if askWith(t, typed(answer), afterGrace) {
+			t.Errorf("%q should not approve", answer)
+		}
+	}
+	// 粘贴内容被忽略
+	if askWith(t, []Key{{Code: KeyPaste, Text: "yes"}, {Code: KeyEnter}}, afterGrace) {
+		t.Error("pasted text should not approve")
+	}
+	// 提示出现之前和刚出现时收到的输入（预先输入）被丢弃
+	if askWith(t, typed("yes\r"), func(opened time.Time) time.Time { return opened.Add(-time.Second) }) {
+		t.Error("type-ahead should not approve")
+	}
+	if askWith(t, typed("yes\r"), func(opened time.Time) time.Time { return time.Time{} }) {
+		t.Error("leftover input should not approve")
+	}
+}
+
+func TestEscapeControl(t *testing.T) {
+	cases := map[string]string{
+		"uptime":                      "uptime",
+		"rm -rf /\r\x1b[2Kuptime":     `rm -rf /\r\x1b[2Kuptime`,
+		"echo ok\nls":                 "echo ok\nls",
+		"cat \u202egpj.txt\x07\u00a0": `cat \u202egpj.txt\a` + "\u00a0",
+		"printf '\t'":                 `printf '\t'`,
+	}
+	for command, want := range cases {
+		if got := escapeControl(command); got != want {
+			t.Errorf("escapeControl(%q) = %q, want %q", command, got, want)
+		}
+	}
+
+	// 确认提示中不包含命令里的控制序列
+	channel := &lockedChannel{}
+	a := &approver{channel: channel}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.ask(ctx, "web1", "rm -rf /\r\x1b[2Kuptime")
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	if output := channel.builder.String(); strings.Contains(output, "/\r") || strings.Contains(output, "\x1b[2K") {
+		t.Errorf("control characters should be escaped in the prompt: %q", output)
+	}
+}
@@ -0,0 +1,195 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+	"sshai/pkg/ui"
+	"sshai/pkg/utils"
+)
+
+// sessionRoute 会话匹配的路由规则
+type sessionRoute struct {
+	Index   int              // 规则序号（从1开始）
+	Rule    config.RouteRule // 规则（复制，配置重新加载后不受影响）
+	Reasons []string         // 满足的条件，用于 /whoami
+}
+
+// Name 规则的显示名称
+func (r *sessionRoute) Name() string {
+	if r.Rule.Name != "" {
+		return fmt.Sprintf("#%d %s", r.Index, r.Rule.Name)
+	}
+	return fmt.Sprintf("#%d", r.Index)
+}
+
+// matchRoute 按顺序匹配路由规则，返回第一个匹配的规则，没有匹配时返回nil
+// env 获取客户端通过env请求传递的环境变量
+func matchRoute(session *Session, env func(name string) (string, bool)) *sessionRoute {
+	for i, rule := range config.Get().Routes {
+		if reasons, ok := matchRouteRule(rule.Match, session, env); ok {
+			return &sessionRoute{Index: i + 1, Rule: rule, Reasons: reasons}
+		}
+	}
+	return nil
+}
+
+// matchRouteRule 判断会话是否满足规则的所有条件，返回满足的条件
+func matchRouteRule(match config.RouteMatch, session *Session, env func(name string) (string, bool)) ([]string, bool) {
+	var reasons []string
+	check := func(name, pattern, value string) bool {
+		if pattern == "" {
+			return true
+		}
+		if !matchRegexp(pattern, value) {
+			return false
+		}
+		reasons = append(reasons, fmt.Sprintf("%s=~%s", name, pattern))
+		return true
+	}
+
+	if !check("user", match.User, session.LoginName) ||
+		!check("identity", match.Identity, session.Username) ||
+		!check("key_comment", match.KeyComment, session.keyComment) ||
+		!check("client_version", match.ClientVersion, session.ClientVersion) {
+		return nil, false
+	}
+	if match.KeyFingerprint != "" {
+		if session.keyFingerprint == "" || match.KeyFingerprint != session.keyFingerprint {
+			return nil, false
+		}
+		reasons = append(reasons, "key_fingerprint="+match.KeyFingerprint)
+	}
+	if len(match.RemoteCIDR) > 0 {
+		network, ok := matchCIDRs(match.RemoteCIDR, session.RemoteAddr)
+		if !ok {
+			return nil, false
+		}
+		reasons = append(reasons, "remote_cidr="+network)
+	}
+
+	// 按名称排序，保证说明的顺序稳定
+	names := make([]string, 0, len(match.Env))
+	for name := range match.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := env(name)
+		if !ok || !check("env."+name, match.Env[name], value) {
+			return nil, false
+		}
+	}
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, "匹配所有会话")
+	}
+	return reasons, true
+}
+
+// matchRegexp 判断值是否匹配正则，正则无效时记录日志并视为不匹配
+func matchRegexp(pattern, value string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Printf("警告：路由规则中的正则无效 %q: %v", pattern, err)
+		return false
+	}
+	return re.MatchString(value)
+}
+
+// matchCIDRs 判断客户端地址是否在任一CIDR中，返回匹配的CIDR
+func matchCIDRs(cidrs []string, remoteAddr string) (string, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", false
+	}
+	for _, cidr := range cidrs {
+		networks, err := parseCIDRs([]string{cidr})
+		if err != nil {
+			log.Printf("警告：路由规则中的CIDR无效: %v", err)
+			continue
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return cidr, true
+			}
+		}
+	}
+	return "", false
+}
+
+// routeLanguage 获取路由规则设置的界面语言，不支持的语言返回空
+func routeLanguage(route *sessionRoute) i18n.Language {
+	if route == nil || route.Rule.Language == "" {
+		return ""
+	}
+	language := i18n.Language(strings.ToLower(route.Rule.Language))
+	if !i18n.IsAvailable(language) {
+		log.Printf("警告：路由规则 %s 中的语言 %q 不受支持", route.Name(), route.Rule.Language)
+		return ""
+	}
+	return language
+}
+
+// handleWhoamiCommand 处理whoami命令，显示会话身份以及匹配的路由规则和生效的设置
+func handleWhoamiCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	info := session.Snapshot()
+	route := session.Route()
+
+	rows := [][2]string{
+		{"登录用户名", session.LoginName},
+		{"会话身份", session.Username},
+		{"认证方式", session.authDescription()},
+		{"客户端", fmt.Sprintf("%s (%s)", session.ClientVersion, session.RemoteAddr)},
+		{"管理员", map[bool]string{true: "是", false: "否"}[session.Admin]},
+	}
+	if route != nil {
+		rows = append(rows, [2]string{"路由规则", fmt.Sprintf("%s (%s)", route.Name(), strings.Join(route.Reasons, ", "))})
+	} else if len(config.Get().Routes) > 0 {
+		rows = append(rows, [2]string{"路由规则", "没有匹配的规则"})
+	} else {
+		rows = append(rows, [2]string{"路由规则", "未配置"})
+	}
+	persona := info.Persona
+	if persona == "" {
+		persona = "-"
+	}
+	language := string(session.Language())
+	if language == "" {
+		language = string(i18n.GetLanguage())
+	}
+	tools := "all"
+	if route != nil {
+		tools = route.Rule.ToolPolicy.String()
+	}
+	if current := assistant.GetPersona(); current != nil && (current.NoTools || len(current.MCPServers) > 0) {
+		tools += fmt.Sprintf(" (角色: %s)", current.ToolPolicy.String())
+	}
+	rows = append(rows,
+		[2]string{"模型", info.Model},
+		[2]string{"角色", persona},
+		[2]string{"语言", language},
+		[2]string{"工具", tools},
+	)
+
+	channel.Write([]byte(ui.BrightCyanText("🪪 当前会话:\r\n")))
+	for _, row := range rows {
+		padding := strings.Repeat(" ", 12-utils.GetDisplayWidth(row[0]))
+		channel.Write([]byte(fmt.Sprintf("  %s%s%s\r\n", ui.BrightWhiteText(row[0]), padding, row[1])))
+	}
+	channel.Write([]byte("\r\n"))
+	return ""
+}
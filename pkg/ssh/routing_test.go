@@ -0,0 +1,57 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+
+	"sshai/pkg/config"
+	"sshai/pkg/i18n"
+)
+
+func TestMatchRoute(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Routes
+	defer func() { cfg.Routes = saved }()
+	cfg.Routes = []config.RouteRule{
+		{Name: "broken", Match: config.RouteMatch{User: "("}},
+		{Name: "ops", Match: config.RouteMatch{User: "^ops-", RemoteCIDR: []string{"10.0.0.0/8"}}, Model: "ops-model"},
+		{Name: "laptop", Match: config.RouteMatch{KeyComment: "@laptop$", ClientVersion: "OpenSSH"}, Persona: "reviewer"},
+		{Name: "english", Match: config.RouteMatch{Env: map[string]string{"LANG": "^en"}}, Language: "en-us", ToolPolicy: config.ToolPolicy{NoTools: true}},
+		{Name: "default", Model: "default-model"},
+	}
+	noEnv := func(string) (string, bool) { return "", false }
+
+	tests := []struct {
+		name    string
+		session *Session
+		env     func(string) (string, bool)
+		want    string
+	}{
+		{"user and cidr", &Session{LoginName: "ops-alice", RemoteAddr: "10.1.2.3:5555"}, noEnv, "ops"},
+		{"cidr mismatch", &Session{LoginName: "ops-alice", RemoteAddr: "192.0.2.1:5555"}, noEnv, "default"},
+		{"key comment", &Session{LoginName: "a", keyComment: "bob@laptop", ClientVersion: "SSH-2.0-OpenSSH_9.6"}, noEnv, "laptop"},
+		{"env", &Session{LoginName: "a"}, func(name string) (string, bool) { return "en_US.UTF-8", name == "LANG" }, "english"},
+		{"catch-all", &Session{LoginName: "a"}, noEnv, "default"},
+	}
+	for _, test := range tests {
+		route := matchRoute(test.session, test.env)
+		if route == nil || route.Rule.Name != test.want {
+			t.Errorf("%s: got %+v, want rule %s", test.name, route, test.want)
+		}
+	}
+
+	session := &Session{LoginName: "ops-alice", RemoteAddr: "10.1.2.3:5555"}
+	session.SetRoute(matchRoute(session, noEnv))
+	if route := session.Route(); route.Index != 2 || !strings.Contains(strings.Join(route.Reasons, ","), "remote_cidr=10.0.0.0/8") {
+		t.Errorf("unexpected route explanation: %s %v", route.Name(), route.Reasons)
+	}
+	if model := sessionDefaultModel(session); model != "ops-model" {
+		t.Errorf("route model should be used, got %q", model)
+	}
+
+	english := &Session{LoginName: "a"}
+	english.SetRoute(matchRoute(english, func(name string) (string, bool) { return "en", name == "LANG" }))
+	if english.Language() != i18n.LanguageEnUS || english.toolPolicy() == nil || english.toolPolicy().Allows("git") {
+		t.Error("route language and tool policy should apply to the session")
+	}
+}
@@ -1,41 +1,81 @@
 package ssh
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
-	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
+	"sshai/pkg/audit"
 	"sshai/pkg/auth"
 	"sshai/pkg/config"
+	"sshai/pkg/metrics"
 )
 
 // Server SSH服务器结构体
 type Server struct {
-	config     *ssh.ServerConfig
-	keyManager *auth.AuthorizedKeysManager
+	config           *ssh.ServerConfig
+	keyManager       *auth.AuthorizedKeysManager
+	certAuthority    *auth.CertAuthority // 用户证书认证，nil表示未启用
+	revoked          *auth.RevokedKeys   // 吊销的公钥和证书，nil表示未配置
+	totp             *totpVerifier       // TOTP两步验证，nil表示未启用
+	hostKeys         *hostKeys
+	guard            *authGuard   // 认证失败跟踪和临时封禁，nil表示不封禁
+	limiter          *connLimiter // 并发连接数限制
+	filter           *ipFilter    // 客户端地址过滤
+	handshakeTimeout time.Duration
+
+	mutex    sync.Mutex
+	listener net.Listener
+	closing  bool                  // 已调用Shutdown，不再接受新连接
+	conns    map[net.Conn]struct{} // 所有未关闭的连接（包括握手中的连接）
+	wg       sync.WaitGroup        // 等待所有连接处理完成
 }
 
 // NewServer 创建新的SSH服务器
 func NewServer() (*Server, error) {
 	cfg := config.Get()
 
-	// 生成主机密钥
-	hostKey, err := generateHostKey()
+	// 加载主机密钥（不存在时自动生成）
+	hostKeys, err := loadHostKeys()
+	if err != nil {
+		return nil, fmt.Errorf("加载主机密钥失败: %v", err)
+	}
+
+	// 客户端地址过滤
+	filter, err := newIPFilter(cfg.Limits.AllowCIDRs, cfg.Limits.DenyCIDRs)
 	if err != nil {
-		return nil, fmt.Errorf("生成主机密钥失败: %v", err)
+		return nil, fmt.Errorf("解析地址过滤配置失败: %v", err)
 	}
+	guard := newAuthGuard()
+	totp := newTOTPVerifier(guard)
 
 	// SSH服务器配置
 	sshConfig := &ssh.ServerConfig{
 		// 设置自定义SSH Banner
 		ServerVersion: "SSH-2.0-SSHAI.TOP",
+		MaxAuthTries:  cfg.Limits.MaxAuthTries,
+		// 记录每次认证尝试的方式和结果，密码错误计入封禁统计
+		// 两步验证码错误由 totpVerifier 按会话身份记录，与两步验证检查封禁使用相同的用户名
+		AuthLogCallback: func(conn ssh.ConnMetadata, method string, err error) {
+			recordAuthAttempt(conn, method, err)
+			ip := remoteIP(conn.RemoteAddr())
+			var partial *ssh.PartialSuccessError
+			switch {
+			case err == nil:
+				guard.recordSuccess(ip)
+			case errors.As(err, &partial):
+				// 第一步认证成功，等待两步验证
+			case method == "password":
+				guard.fail(ip, conn.User())
+			}
+		},
 	}
 
 	// 初始化SSH公钥管理器
@@ -47,6 +87,21 @@ func NewServer() (*Server, error) {
 		}
 	}
 
+	// 吊销列表同时适用于普通公钥和证书
+	revoked, err := auth.NewRevokedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// 初始化SSH用户证书认证
+	var certAuthority *auth.CertAuthority
+	if auth.CertAuthEnabled() {
+		certAuthority, err = auth.NewCertAuthority(revoked)
+		if err != nil {
+			return nil, fmt.Errorf("SSH证书认证初始化失败: %v", err)
+		}
+	}
+
 	// 根据配置决定认证方式
 	if cfg.Auth.Password == "" {
 		// 无密码认证 - 接受所有连接
@@ -56,26 +111,60 @@ func NewServer() (*Server, error) {
 		// 密码认证模式
 		sshConfig.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 			log.Printf("密码认证尝试: user=%s", conn.User())
+			if guard.userBanned(conn.User()) || guard.ipBanned(remoteIP(conn.RemoteAddr())) {
+				log.Printf("用户 %s 处于封禁期，拒绝密码认证", conn.User())
+				return nil, fmt.Errorf("认证失败次数过多，请稍后再试")
+			}
 			if string(password) == cfg.Auth.Password {
 				log.Printf("用户 %s 密码认证成功", conn.User())
-				return nil, nil
+				return totp.secondFactor(conn, nil)
 			}
 			log.Printf("用户 %s 密码认证失败", conn.User())
 			return nil, fmt.Errorf("密码错误")
 		}
 
-		// SSH公钥认证（仅在设置密码时启用）
-		if keyManager != nil && keyManager.GetKeyCount() > 0 {
+		// SSH公钥认证（仅在设置密码时启用），管理员公钥同样可以登录
+		// 公钥文件修改后自动重新加载，因此即使启动时文件中没有公钥也启用公钥认证
+		if keyManager != nil || len(cfg.Admin.Keys) > 0 || certAuthority != nil {
 			sshConfig.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 				log.Printf("SSH公钥认证尝试: user=%s, key_type=%s", conn.User(), key.Type())
-				if keyManager.VerifyPublicKey(key) {
+				if cert, ok := key.(*ssh.Certificate); ok {
+					perms, err := authenticateCertificate(conn, cert, certAuthority)
+					if err != nil {
+						return nil, err
+					}
+					return totp.secondFactor(conn, perms)
+				}
+				if revoked.KeyRevoked(key) {
+					log.Printf("用户 %s 使用的公钥已被吊销: %s", conn.User(), ssh.FingerprintSHA256(key))
+					return nil, fmt.Errorf("公钥已被吊销")
+				}
+				options, err := authorizeKey(keyManager, key, conn.RemoteAddr())
+				if err != nil {
+					log.Printf("用户 %s SSH公钥认证失败: %v", conn.User(), err)
+					return nil, fmt.Errorf("公钥未授权")
+				}
+				// 记录公钥指纹，连接建立后用于判断管理员权限
+				perms := &ssh.Permissions{
+					Extensions: map[string]string{permKeyFingerprint: ssh.FingerprintSHA256(key)},
+				}
+				if options != nil {
+					addKeyOptions(perms, options)
+					log.Printf("用户 %s SSH公钥认证成功 (%s)", conn.User(), options.Comment)
+				} else {
 					log.Printf("用户 %s SSH公钥认证成功", conn.User())
-					return nil, nil
 				}
-				log.Printf("用户 %s SSH公钥认证失败", conn.User())
-				return nil, fmt.Errorf("公钥未授权")
+				return totp.secondFactor(conn, perms)
+			}
+			keyCount := 0
+			if keyManager != nil {
+				keyCount = keyManager.GetKeyCount()
+			}
+			caCount := 0
+			if certAuthority != nil {
+				caCount = certAuthority.GetCAKeyCount()
 			}
-			log.Printf("SSH服务器配置：密码认证 + SSH公钥认证模式（共 %d 个授权公钥）", keyManager.GetKeyCount())
+			log.Printf("SSH服务器配置：密码认证 + SSH公钥认证模式（共 %d 个授权公钥，%d 个管理员公钥，%d 个受信任的证书CA）", keyCount, len(cfg.Admin.Keys), caCount)
 		} else {
 			// 禁用公钥认证
 			sshConfig.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
@@ -85,11 +174,25 @@ func NewServer() (*Server, error) {
 		}
 	}
 
-	sshConfig.AddHostKey(hostKey)
+	hostKeys.addTo(sshConfig)
+
+	handshakeTimeout := time.Duration(cfg.Limits.HandshakeTimeout) * time.Second
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = defaultHandshakeTimeout
+	}
 
 	return &Server{
-		config:     sshConfig,
-		keyManager: keyManager,
+		config:           sshConfig,
+		keyManager:       keyManager,
+		certAuthority:    certAuthority,
+		totp:             totp,
+		revoked:          revoked,
+		hostKeys:         hostKeys,
+		guard:            guard,
+		limiter:          newConnLimiter(),
+		filter:           filter,
+		handshakeTimeout: handshakeTimeout,
+		conns:            make(map[net.Conn]struct{}),
 	}, nil
 }
 
@@ -104,6 +207,14 @@ func (s *Server) Start() error {
 	}
 	defer listener.Close()
 
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.listener = listener
+	s.mutex.Unlock()
+
 	log.Printf("SSH AI Server listening on port %s", cfg.Server.Port)
 	log.Printf("Connect with: ssh localhost -p %s", cfg.Server.Port)
 
@@ -111,33 +222,191 @@ func (s *Server) Start() error {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if s.isClosing() {
+				// Shutdown关闭了监听器
+				return nil
+			}
 			log.Printf("Failed to accept connection: %v", err)
 			continue
 		}
 
+		// 在SSH握手前检查地址、封禁和连接数
+		ip := remoteIP(conn.RemoteAddr())
+		if reason := s.admit(conn, ip); reason != "" {
+			log.Printf("拒绝来自 %s 的连接: %s", conn.RemoteAddr(), reason)
+			metrics.RejectedConnections.Inc(reason)
+			conn.Close()
+			continue
+		}
+
 		// 处理每个连接
-		go s.handleConnection(conn)
+		if !s.track(conn) {
+			s.limiter.release(ip)
+			conn.Close()
+			return nil
+		}
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			defer s.limiter.release(ip)
+			s.handleConnection(conn)
+		}()
+	}
+}
+
+// isClosing 是否已调用Shutdown
+func (s *Server) isClosing() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closing
+}
+
+// track 记录新连接，服务器正在关闭时返回false
+func (s *Server) track(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// untrack 移除已关闭的连接
+func (s *Server) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, conn)
+}
+
+// Shutdown 优雅关闭服务器：停止接受新连接，通知所有会话，
+// 空闲的会话立即断开，正在生成回答的会话等待回答完成后断开；
+// ctx到期时取消剩余的请求并强制断开所有连接
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		// 每次检查时处理新完成握手的会话
+		for _, session := range sessionRegistry.List() {
+			session.drain(shutdownNotice)
+			if session.Idle() {
+				session.closeAfter(200 * time.Millisecond)
+			}
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			waiting = false
+		case <-ticker.C:
+		}
+	}
+
+	// 超时：取消剩余的请求，留出少量时间输出中断提示后强制断开
+	sessions := sessionRegistry.List()
+	log.Printf("等待会话结束超时，取消 %d 个会话中正在进行的请求", len(sessions))
+	for _, session := range sessions {
+		session.CancelRequest()
+		session.closeAfter(500 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		return ctx.Err()
+	case <-time.After(time.Second):
+	}
+
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	<-done
+	return ctx.Err()
+}
+
+// admit 判断是否接受连接，接受时占用连接名额，拒绝时返回原因
+func (s *Server) admit(conn net.Conn, ip string) string {
+	if !s.filter.allowed(net.ParseIP(ip)) {
+		return "denied"
 	}
+	if s.guard.ipBanned(ip) {
+		return "banned"
+	}
+	if ok, reason := s.limiter.acquire(ip); !ok {
+		return reason
+	}
+	return ""
 }
 
 // handleConnection 处理SSH连接
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	// SSH握手
+	// SSH握手，超时未完成握手和认证的连接直接断开
+	conn.SetDeadline(time.Now().Add(s.handshakeTimeout))
 	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
 	if err != nil {
 		log.Printf("SSH handshake failed: %v", err)
+		metrics.HandshakeFailures.Inc()
 		return
 	}
 	defer sshConn.Close()
+	conn.SetDeadline(time.Time{})
+
+	metrics.ConnectionsTotal.Inc()
+	metrics.ConnectionsActive.Inc()
+	defer metrics.ConnectionsActive.Dec()
 
 	// 获取用户名
 	username := sshConn.User()
 	log.Printf("New SSH connection from %s, user: %s", sshConn.RemoteAddr(), username)
 
-	// 处理全局请求
-	go ssh.DiscardRequests(reqs)
+	// 注册到会话注册表，供管理员查看和管理
+	session := sessionRegistry.Register(sshConn, isAdminConnection(sshConn))
+	defer sessionRegistry.Unregister(session)
+	defer session.closeWorkspace()
+	if session.Admin {
+		log.Printf("用户 %s 以管理员身份登录 (会话 #%d)", username, session.ID)
+	}
+	if s.totp != nil && sshConn.Permissions != nil {
+		if sshConn.Permissions.Extensions[permTOTPEnroll] != "" {
+			session.totpEnroll = s.totp.store
+		}
+		if remaining := sshConn.Permissions.Extensions[permTOTPRecovery]; remaining != "" {
+			session.Notify(fmt.Sprintf("⚠ 本次使用恢复码登录，剩余 %s 个恢复码", remaining))
+		}
+	}
+
+	// 记录会话建立和断开的审计日志
+	audit.Log(audit.Record{Event: audit.EventSessionStart, Identity: session.AuditIdentity("")})
+	defer func() {
+		start := session.StartTime
+		audit.Log(audit.Record{
+			Event:      audit.EventSessionEnd,
+			Identity:   session.AuditIdentity(""),
+			StartTime:  &start,
+			DurationMs: time.Since(start).Milliseconds(),
+		})
+	}()
+
+	// 处理全局请求，并公告主机密钥以便客户端在密钥轮换前学习新密钥
+	go handleGlobalRequests(sshConn, reqs, s.hostKeys)
+	announceHostKeys(sshConn, s.hostKeys)
 
 	// 处理通道
 	for newChannel := range chans {
@@ -153,49 +422,91 @@ func (s *Server) handleConnection(conn net.Conn) {
 		}
 
 		// 处理会话
-		go HandleSession(channel, requests, username)
+		go func() {
+			metrics.SessionsActive.Inc()
+			defer metrics.SessionsActive.Dec()
+			HandleSession(channel, requests, session)
+		}()
 	}
 }
 
-// generateHostKey 生成或加载RSA主机密钥
-func generateHostKey() (ssh.Signer, error) {
-	cfg := config.Get()
-	keyFile := cfg.Security.HostKeyFile
-
-	// 尝试加载现有密钥
-	if keyData, err := os.ReadFile(keyFile); err == nil {
-		privateKey, err := ssh.ParsePrivateKey(keyData)
-		if err == nil {
-			log.Printf("已加载现有主机密钥")
-			return privateKey, nil
-		}
-		log.Printf("无法解析现有密钥文件，将生成新密钥: %v", err)
+// authenticateCertificate 校验用户证书，证书主体作为会话身份记录在Permissions中
+func authenticateCertificate(conn ssh.ConnMetadata, cert *ssh.Certificate, certAuthority *auth.CertAuthority) (*ssh.Permissions, error) {
+	if certAuthority == nil {
+		return nil, fmt.Errorf("证书认证未启用")
+	}
+	principal, err := certAuthority.Authenticate(conn.User(), cert)
+	if err == nil {
+		err = checkSourceAddress(conn.RemoteAddr(), cert.CriticalOptions["source-address"])
 	}
-
-	// 生成新的RSA私钥
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
+		log.Printf("用户 %s SSH证书认证失败 (key_id=%q, serial=%d): %v", conn.User(), cert.KeyId, cert.Serial, err)
 		return nil, err
 	}
+	log.Printf("用户 %s SSH证书认证成功: principal=%s, key_id=%q, serial=%d", conn.User(), principal, cert.KeyId, cert.Serial)
 
-	// 将私钥转换为SSH签名器
-	signer, err := ssh.NewSignerFromKey(privateKey)
-	if err != nil {
-		return nil, err
+	// ssh库在返回后还会根据CriticalOptions再次校验source-address
+	criticalOptions := make(map[string]string, len(cert.CriticalOptions))
+	for name, value := range cert.CriticalOptions {
+		criticalOptions[name] = value
 	}
+	return &ssh.Permissions{
+		CriticalOptions: criticalOptions,
+		Extensions:      map[string]string{permCertPrincipal: principal},
+	}, nil
+}
 
-	// 保存私钥到文件
-	keyBytes := x509.MarshalPKCS1PrivateKey(privateKey)
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: keyBytes,
-	})
+// addKeyOptions 将公钥选项记录到Permissions.Extensions中，连接建立后用于会话身份、模型和权限
+func addKeyOptions(perms *ssh.Permissions, options *auth.KeyOptions) {
+	extensions := map[string]string{
+		permKeyComment: options.Comment,
+		permKeyUser:    options.User,
+		permKeyModel:   options.Model,
+		permKeyRole:    options.Role,
+	}
+	if options.NoPty {
+		extensions[permNoPty] = "1"
+	}
+	for name, value := range extensions {
+		if value != "" {
+			perms.Extensions[name] = value
+		}
+	}
+}
 
-	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
-		log.Printf("警告：无法保存主机密钥: %v", err)
-	} else {
-		log.Printf("已生成并保存新的主机密钥")
+// checkSourceAddress 校验客户端地址是否在证书的source-address选项（逗号分隔的CIDR列表）中
+func checkSourceAddress(addr net.Addr, sourceAddress string) error {
+	if sourceAddress == "" {
+		return nil
+	}
+	networks, err := parseCIDRs(strings.Split(sourceAddress, ","))
+	if err != nil {
+		return fmt.Errorf("证书source-address选项无效: %v", err)
+	}
+	ip := net.ParseIP(remoteIP(addr))
+	for _, network := range networks {
+		if ip != nil && network.Contains(ip) {
+			return nil
+		}
 	}
+	return fmt.Errorf("客户端地址 %s 不在证书允许的来源地址 %s 中", remoteIP(addr), sourceAddress)
+}
+
+// shutdownNotice 服务器关闭时发送给所有会话的通知
+const shutdownNotice = "⚠ 服务器即将关闭：正在生成的回答完成后会话将结束，请稍后重新连接"
 
-	return signer, nil
+// recordAuthAttempt 记录认证指标
+func recordAuthAttempt(conn ssh.ConnMetadata, method string, err error) {
+	result := "success"
+	var partial *ssh.PartialSuccessError
+	if errors.As(err, &partial) {
+		result = "partial"
+	} else if err != nil {
+		// 客户端通常先尝试none方式探测服务器支持的认证方式，这不算认证失败
+		if method == "none" {
+			return
+		}
+		result = "failure"
+	}
+	metrics.AuthAttempts.Inc(method, result)
 }
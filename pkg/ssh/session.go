@@ -14,19 +14,15 @@ import (
 
 	"sshai/pkg/ai"
 	"sshai/pkg/config"
-	"sshai/pkg/i18n"
+	"sshai/pkg/prompt"
 	"sshai/pkg/ui"
+	"sshai/pkg/utils"
 )
 
-// CommandHistory 命令历史结构体
-type CommandHistory struct {
-	commands []string
-	index    int // 当前历史索引，-1表示没有在浏览历史
-}
-
 // ConversationHistory 对话历史结构体
 type ConversationHistory struct {
 	messages []ConversationMessage
+	queued   []string // 回答输出期间输入、等待发送的消息
 	mutex    sync.RWMutex
 }
 
@@ -75,16 +71,70 @@ func (h *ConversationHistory) Clear() {
 	h.messages = h.messages[:0]
 }
 
+// QueuePrompt 将消息加入等待队列，返回队列长度
+func (h *ConversationHistory) QueuePrompt(prompt string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.queued = append(h.queued, prompt)
+	return len(h.queued)
+}
+
+// NextQueued 取出队列中的第一条消息
+func (h *ConversationHistory) NextQueued() (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.queued) == 0 {
+		return "", false
+	}
+	prompt := h.queued[0]
+	h.queued = h.queued[1:]
+	return prompt, true
+}
+
+// QueuedPrompts 获取队列中的所有消息
+func (h *ConversationHistory) QueuedPrompts() []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return append([]string(nil), h.queued...)
+}
+
+// CancelQueued 取消队列中的第index条消息（从0开始）
+func (h *ConversationHistory) CancelQueued(index int) (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if index < 0 || index >= len(h.queued) {
+		return "", false
+	}
+	prompt := h.queued[index]
+	h.queued = append(h.queued[:index], h.queued[index+1:]...)
+	return prompt, true
+}
+
+// ClearQueued 清空队列，返回被清除的消息数
+func (h *ConversationHistory) ClearQueued() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	n := len(h.queued)
+	h.queued = nil
+	return n
+}
+
 // CustomCommand 自定义命令结构体
 type CustomCommand struct {
 	Name        string
 	Description string
-	Handler     func(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string) string
+	Handler     func(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string
+	Command     *config.Command // 配置文件中定义的命令（由AI执行），内置命令为nil
 }
 
 // getCustomCommands 获取自定义命令列表
 func getCustomCommands() map[string]CustomCommand {
-	return map[string]CustomCommand{
+	commands := map[string]CustomCommand{
 		"/help": {
 			Name:        "/help",
 			Description: "显示帮助信息和可用命令",
@@ -110,195 +160,44 @@ func getCustomCommands() map[string]CustomCommand {
 			Description: "切换AI模型",
 			Handler:     handleModelCommand,
 		},
+		"/persona": {
+			Name:        "/persona",
+			Description: "查看或切换角色（系统提示词、模型和工具）",
+			Handler:     handlePersonaCommand,
+		},
+		"/whoami": {
+			Name:        "/whoami",
+			Description: "查看会话身份和匹配的路由规则",
+			Handler:     handleWhoamiCommand,
+		},
+		"/kb": {
+			Name:        "/kb",
+			Description: "知识库检索 (on|off|search <关键词>)",
+			Handler:     handleKBCommand,
+		},
+		"/ws": {
+			Name:        "/ws",
+			Description: "查看会话工作区中的文件 (ls|cat <文件>|rm <文件>)",
+			Handler:     handleWorkspaceCommand,
+		},
+		"/render": {
+			Name:        "/render",
+			Description: "切换回答渲染方式 (plain|markdown)",
+			Handler:     handleRenderCommand,
+		},
+		"/queue": {
+			Name:        "/queue",
+			Description: "查看或取消排队的消息 (cancel <编号>|clear)",
+			Handler:     handleQueueCommand,
+		},
+		"/admin": {
+			Name:        "/admin",
+			Description: "管理员命令 (sessions|kick|broadcast|mcp restart|reload)",
+			Handler:     handleAdminCommand,
+		},
 	}
-}
-
-// NewCommandHistory 创建新的命令历史
-func NewCommandHistory() *CommandHistory {
-	return &CommandHistory{
-		commands: make([]string, 0),
-		index:    -1,
-	}
-}
-
-// AddCommand 添加命令到历史
-func (h *CommandHistory) AddCommand(cmd string) {
-	if cmd != "" && (len(h.commands) == 0 || h.commands[len(h.commands)-1] != cmd) {
-		h.commands = append(h.commands, cmd)
-		// 限制历史命令数量
-		if len(h.commands) > 100 {
-			h.commands = h.commands[1:]
-		}
-	}
-	h.index = -1 // 重置索引
-}
-
-// GetPrevious 获取上一个命令
-func (h *CommandHistory) GetPrevious() string {
-	if len(h.commands) == 0 {
-		return ""
-	}
-
-	if h.index == -1 {
-		h.index = len(h.commands) - 1
-	} else if h.index > 0 {
-		h.index--
-	}
-
-	return h.commands[h.index]
-}
-
-// GetNext 获取下一个命令
-func (h *CommandHistory) GetNext() string {
-	if len(h.commands) == 0 || h.index == -1 {
-		return ""
-	}
-
-	if h.index < len(h.commands)-1 {
-		h.index++
-		return h.commands[h.index]
-	} else {
-		h.index = -1
-		return ""
-	}
-}
-
-// InputState 输入状态管理
-type InputState struct {
-	buffer     []rune // 使用rune数组以更好地处理中文
-	cursorPos  int    // 光标位置（以rune为单位）
-	displayPos int    // 显示位置（以字符宽度为单位）
-}
-
-// NewInputState 创建新的输入状态
-func NewInputState() *InputState {
-	return &InputState{
-		buffer:     make([]rune, 0),
-		cursorPos:  0,
-		displayPos: 0,
-	}
-}
-
-// String 返回当前输入的字符串
-func (is *InputState) String() string {
-	return string(is.buffer)
-}
-
-// Clear 清空输入状态
-func (is *InputState) Clear() {
-	is.buffer = is.buffer[:0]
-	is.cursorPos = 0
-	is.displayPos = 0
-}
-
-// SetText 设置输入文本
-func (is *InputState) SetText(text string) {
-	is.buffer = []rune(text)
-	is.cursorPos = len(is.buffer)
-	is.displayPos = calculateDisplayWidth(is.buffer)
-}
-
-// InsertRune 在光标位置插入字符
-func (is *InputState) InsertRune(r rune) {
-	// 在光标位置插入字符
-	if is.cursorPos >= len(is.buffer) {
-		is.buffer = append(is.buffer, r)
-	} else {
-		is.buffer = append(is.buffer[:is.cursorPos+1], is.buffer[is.cursorPos:]...)
-		is.buffer[is.cursorPos] = r
-	}
-	is.cursorPos++
-	is.updateDisplayPos()
-}
-
-// DeleteRune 删除光标前的字符
-func (is *InputState) DeleteRune() bool {
-	if is.cursorPos > 0 {
-		is.buffer = append(is.buffer[:is.cursorPos-1], is.buffer[is.cursorPos:]...)
-		is.cursorPos--
-		is.updateDisplayPos()
-		return true
-	}
-	return false
-}
-
-// MoveCursorLeft 向左移动光标
-func (is *InputState) MoveCursorLeft() bool {
-	if is.cursorPos > 0 {
-		is.cursorPos--
-		is.updateDisplayPos()
-		return true
-	}
-	return false
-}
-
-// MoveCursorRight 向右移动光标
-func (is *InputState) MoveCursorRight() bool {
-	if is.cursorPos < len(is.buffer) {
-		is.cursorPos++
-		is.updateDisplayPos()
-		return true
-	}
-	return false
-}
-
-// MoveCursorToStart 移动光标到开始
-func (is *InputState) MoveCursorToStart() {
-	is.cursorPos = 0
-	is.displayPos = 0
-}
-
-// MoveCursorToEnd 移动光标到结束
-func (is *InputState) MoveCursorToEnd() {
-	is.cursorPos = len(is.buffer)
-	is.updateDisplayPos()
-}
-
-// updateDisplayPos 更新显示位置
-func (is *InputState) updateDisplayPos() {
-	is.displayPos = calculateDisplayWidth(is.buffer[:is.cursorPos])
-}
-
-// calculateDisplayWidth 计算字符串的显示宽度
-func calculateDisplayWidth(runes []rune) int {
-	width := 0
-	for _, r := range runes {
-		if r < 128 {
-			width++ // ASCII字符宽度为1
-		} else {
-			width += 2 // 中文字符宽度为2
-		}
-	}
-	return width
-}
-
-// clearCurrentLine 清除当前行并重新显示提示符和输入内容
-func clearCurrentLine(channel ssh.Channel, inputState *InputState, prompt string) {
-	// 移动到行首
-	channel.Write([]byte("\r"))
-
-	// 清除整行 - 使用ANSI转义序列
-	channel.Write([]byte("\033[K"))
-
-	// 显示提示符
-	channel.Write([]byte(prompt))
-
-	// 显示当前输入内容
-	if len(inputState.buffer) > 0 {
-		channel.Write([]byte(inputState.String()))
-
-		// 如果光标不在末尾，需要移动光标到正确位置
-		if inputState.cursorPos < len(inputState.buffer) {
-			// 计算需要向左移动的字符数
-			rightPart := inputState.buffer[inputState.cursorPos:]
-			rightWidth := calculateDisplayWidth(rightPart)
-
-			// 向左移动光标
-			for i := 0; i < rightWidth; i++ {
-				channel.Write([]byte("\033[D")) // 向左移动一个位置
-			}
-		}
-	}
+	addConfigCommands(commands)
+	return commands
 }
 
 // ResponseCapture 用于捕获AI响应内容的包装器
@@ -426,7 +325,7 @@ func getCommandMatches(prefix string) []string {
 }
 
 // handleCustomCommand 处理自定义命令
-func handleCustomCommand(channel ssh.Channel, assistant *ai.Assistant, input string, conversationHistory *ConversationHistory, dynamicPrompt string) string {
+func handleCustomCommand(channel ssh.Channel, assistant *ai.Assistant, input string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
 	parts := strings.Fields(input)
 	if len(parts) == 0 {
 		return ""
@@ -439,8 +338,10 @@ func handleCustomCommand(channel ssh.Channel, assistant *ai.Assistant, input str
 	// 添加命令到对话历史
 	conversationHistory.AddMessage("user", input)
 	
-	if cmd, exists := customCommands[command]; exists {
-		newModel := cmd.Handler(channel, assistant, args, conversationHistory, dynamicPrompt)
+	if cmd, exists := customCommands[command]; exists && cmd.Command != nil {
+		channel.Write([]byte(fmt.Sprintf("请等待当前回答完成后再执行 %s\r\n", command)))
+	} else if exists {
+		newModel := cmd.Handler(channel, assistant, args, conversationHistory, dynamicPrompt, session)
 		return newModel // 返回新模型名称（如果有的话）
 	} else {
 		channel.Write([]byte(fmt.Sprintf("未知命令: %s\r\n", command)))
@@ -451,14 +352,19 @@ func handleCustomCommand(channel ssh.Channel, assistant *ai.Assistant, input str
 }
 
 // handleHelpCommand 处理help命令
-func handleHelpCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string) string {
+func handleHelpCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
 	channel.Write([]byte(ui.BrightCyanText("📋 可用的自定义命令:\r\n\r\n")))
 	
 	customCommands := getCustomCommands()
 	// 按字母顺序显示命令，并计算最长命令名的长度用于对齐
-	commands := []string{"/clear", "/help", "/history", "/model", "/new"}
+	commands := []string{"/clear", "/help", "/history", "/kb", "/model", "/new", "/persona", "/queue", "/render", "/whoami", "/ws"}
+	// 管理员命令只对管理员显示
+	if session != nil && session.Admin {
+		commands = append([]string{"/admin"}, commands...)
+	}
 	maxCmdLen := 0
-	for _, cmdName := range commands {
+	configCommands := configCommandNames(customCommands)
+	for _, cmdName := range append(commands, configCommands...) {
 		if len(cmdName) > maxCmdLen {
 			maxCmdLen = len(cmdName)
 		}
@@ -476,6 +382,24 @@ func handleHelpCommand(channel ssh.Channel, assistant *ai.Assistant, args []stri
 		}
 	}
 	
+	// 配置文件中定义的命令
+	if len(configCommands) > 0 {
+		channel.Write([]byte(ui.BrightCyanText("\r\n📝 配置的命令:\r\n\r\n")))
+		for _, cmdName := range configCommands {
+			cmd := customCommands[cmdName]
+			spaces := strings.Repeat(" ", maxCmdLen-len(cmdName)+2)
+			channel.Write([]byte(fmt.Sprintf("  %s%s%s\r\n",
+				ui.BrightYellowText(cmd.Name),
+				spaces,
+				cmd.Description)))
+		}
+	}
+
+	// 知识库索引状态
+	if status := kbStatusLine(session); status != "" {
+		channel.Write([]byte("\r\n" + ui.BrightCyanText(status) + "\r\n"))
+	}
+
 	channel.Write([]byte("\r\n"))
 	channel.Write([]byte(ui.BrightGreenText("💡 提示:\r\n")))
 	channel.Write([]byte("  • 使用 Tab 键可以自动补全命令\r\n"))
@@ -488,7 +412,7 @@ func handleHelpCommand(channel ssh.Channel, assistant *ai.Assistant, args []stri
 }
 
 // handleNewCommand 处理new命令
-func handleNewCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string) string {
+func handleNewCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
 	assistant.ClearContext()
 	conversationHistory.Clear()
 	channel.Write([]byte(ui.BrightGreenText("✅ 对话上下文已清空，开始新对话\r\n\r\n")))
@@ -499,7 +423,7 @@ func handleNewCommand(channel ssh.Channel, assistant *ai.Assistant, args []strin
 }
 
 // handleHistoryCommand 处理history命令
-func handleHistoryCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string) string {
+func handleHistoryCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
 	messages := conversationHistory.GetMessages()
 	
 	// 过滤出用户和助手的消息，排除系统消息和用户指令
@@ -519,6 +443,12 @@ func handleHistoryCommand(channel ssh.Channel, assistant *ai.Assistant, args []s
 	}
 	
 	channel.Write([]byte(ui.BrightCyanText("📝 对话历史记录:\r\n\r\n")))
+
+	// 内容前有两个空格的缩进
+	wrapWidth := assistant.WrapWidth()
+	if wrapWidth > 2 {
+		wrapWidth -= 2
+	}
 	
 	for i, msg := range userAssistantMessages {
 		// 格式化时间
@@ -551,8 +481,8 @@ func handleHistoryCommand(channel ssh.Channel, assistant *ai.Assistant, args []s
 			content = content[:200] + "..."
 		}
 		
-		// 将换行符替换为\r\n，并添加缩进
-		lines := strings.Split(content, "\n")
+		// 按终端宽度折行，将换行符替换为\r\n，并添加缩进
+		lines := strings.Split(utils.WrapText(content, wrapWidth), "\n")
 		for _, line := range lines {
 			channel.Write([]byte(fmt.Sprintf("  %s\r\n", line)))
 		}
@@ -567,7 +497,7 @@ func handleHistoryCommand(channel ssh.Channel, assistant *ai.Assistant, args []s
 }
 
 // handleClearCommand 处理clear命令
-func handleClearCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string) string {
+func handleClearCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
 	// 发送清屏命令
 	channel.Write([]byte("\033[2J\033[H"))
 	
@@ -587,7 +517,7 @@ func handleClearCommand(channel ssh.Channel, assistant *ai.Assistant, args []str
 }
 
 // handleModelCommand 处理model命令
-func handleModelCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string) string {
+func handleModelCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
 	channel.Write([]byte(ui.BrightCyanText("🔄 正在加载模型列表...\r\n")))
 	
 	// 获取可用模型
@@ -623,6 +553,97 @@ func handleModelCommand(channel ssh.Channel, assistant *ai.Assistant, args []str
 	return ""
 }
 
+// handleRenderCommand 处理render命令
+func handleRenderCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	if len(args) == 0 {
+		channel.Write([]byte(fmt.Sprintf("当前渲染方式: %s\r\n", ui.BrightYellowText(assistant.GetRenderMode()))))
+		channel.Write([]byte("用法: /render plain|markdown\r\n\r\n"))
+		return ""
+	}
+
+	mode := strings.ToLower(args[0])
+	if mode != ui.RenderPlain && mode != ui.RenderMarkdown {
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 不支持的渲染方式: %s\r\n", args[0]))))
+		channel.Write([]byte("用法: /render plain|markdown\r\n\r\n"))
+		return ""
+	}
+
+	assistant.SetRenderMode(mode)
+	channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 渲染方式已切换为: %s\r\n\r\n", mode))))
+	conversationHistory.AddMessage("system", fmt.Sprintf("切换渲染方式: %s", mode))
+	return ""
+}
+
+// isQueueCommand 输入是否为 /queue 命令（第一个词完全匹配，"/queueing" 等是普通消息）
+func isQueueCommand(input string) bool {
+	fields := strings.Fields(input)
+	return len(fields) > 0 && fields[0] == "/queue"
+}
+
+// handleQueueCommand 处理queue命令，查看或取消回答输出期间排队的消息
+func handleQueueCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "clear":
+			n := conversationHistory.ClearQueued()
+			channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 已清空 %d 条排队消息\r\n\r\n", n))))
+			return ""
+		case "cancel", "rm":
+			if len(args) > 1 {
+				if index, err := strconv.Atoi(args[1]); err == nil {
+					if prompt, ok := conversationHistory.CancelQueued(index - 1); ok {
+						channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 已取消排队消息 #%d: %s\r\n\r\n", index, previewText(prompt, 40)))))
+						return ""
+					}
+				}
+			}
+			channel.Write([]byte(ui.BrightRedText("❌ 无效的消息编号\r\n")))
+			channel.Write([]byte("用法: /queue cancel <编号>\r\n\r\n"))
+			return ""
+		default:
+			channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 未知的子命令: %s\r\n", args[0]))))
+			channel.Write([]byte("用法: /queue [cancel <编号>|clear]\r\n\r\n"))
+			return ""
+		}
+	}
+
+	prompts := conversationHistory.QueuedPrompts()
+	if len(prompts) == 0 {
+		channel.Write([]byte(ui.BrightYellowText("📭 没有排队的消息\r\n\r\n")))
+		return ""
+	}
+
+	channel.Write([]byte(ui.BrightCyanText(fmt.Sprintf("📋 排队中的消息 (%d 条，当前回答结束后依次发送):\r\n", len(prompts)))))
+	for i, prompt := range prompts {
+		channel.Write([]byte(fmt.Sprintf("  %s %s\r\n", ui.BrightWhiteText(fmt.Sprintf("#%d", i+1)), previewText(prompt, 60))))
+	}
+	channel.Write([]byte("使用 /queue cancel <编号> 取消，/queue clear 全部清空\r\n\r\n"))
+	return ""
+}
+
+// previewText 取文本第一行并按显示宽度截断，用于列表预览
+func previewText(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	preview := lines[0]
+	if utils.GetDisplayWidth(preview) > width {
+		var b strings.Builder
+		used := 0
+		for _, r := range preview {
+			w := utils.RuneWidth(r)
+			if used+w > width-1 {
+				break
+			}
+			b.WriteRune(r)
+			used += w
+		}
+		preview = b.String() + "…"
+	}
+	if len(lines) > 1 {
+		preview += ui.Colorize(fmt.Sprintf(" (+%d行)", len(lines)-1), ui.BrightBlack)
+	}
+	return preview
+}
+
 // showModelSelectionForCommand 为命令显示模型选择界面
 func showModelSelectionForCommand(channel ssh.Channel, models []ai.ModelInfo) string {
 	cfg := config.Get()
@@ -698,11 +719,6 @@ func showModelSelectionForCommand(channel ssh.Channel, models []ai.ModelInfo) st
 	}
 }
 
-// refreshLine 刷新当前行显示
-func refreshLine(channel ssh.Channel, inputState *InputState, prompt string) {
-	clearCurrentLine(channel, inputState, prompt)
-}
-
 // tryReadStdinInput 尝试读取stdin输入（仅在确认有管道输入时调用）
 func tryReadStdinInput(channel ssh.Channel) string {
 	// 使用单个goroutine和正确的退出机制
@@ -762,49 +778,6 @@ func tryReadStdinInput(channel ssh.Channel) string {
 	}
 }
 
-// readAllStdinContent 读取所有stdin内容
-func readAllStdinContent(initialData []byte, channel ssh.Channel) string {
-	var content strings.Builder
-	content.Write(initialData)
-
-	// 继续读取剩余数据
-	buffer := make([]byte, 4096)
-	for {
-		// 使用短超时检查是否还有更多数据
-		done := make(chan int, 1)
-		errorChan := make(chan error, 1)
-
-		go func() {
-			n, err := channel.Read(buffer)
-			if err != nil {
-				errorChan <- err
-				return
-			}
-			done <- n
-		}()
-
-		select {
-		case n := <-done:
-			if n > 0 {
-				content.Write(buffer[:n])
-				// 如果读取的数据小于缓冲区大小，可能已经读完
-				if n < len(buffer) {
-					break
-				}
-			} else {
-				break
-			}
-		case <-errorChan:
-			break
-		case <-time.After(50 * time.Millisecond):
-			// 短超时，没有更多数据
-			break
-		}
-	}
-
-	return content.String()
-}
-
 // min 返回两个整数中的较小值
 func min(a, b int) int {
 	if a < b {
@@ -860,9 +833,9 @@ func isTextContent(content string) bool {
 	return true
 }
 
-// handleStdinCommand 处理通过stdin传入的内容
-func handleStdinCommand(channel ssh.Channel, username, content string) {
-	log.Printf("处理stdin内容，用户: %s，内容长度: %d", username, len(content))
+// handleStdinCommand 处理通过stdin传入的内容，返回退出码
+func handleStdinCommand(channel ssh.Channel, session *Session, content, format string, signals *signalState) int {
+	log.Printf("处理stdin内容，用户: %s，内容长度: %d", session.Username, len(content))
 
 	cfg := config.Get()
 
@@ -871,48 +844,50 @@ func handleStdinCommand(channel ssh.Channel, username, content string) {
 
 	// 检查内容类型
 	if !isTextContent(content) {
-		channel.Write([]byte("错误：检测到非文本内容（如图片、PDF等二进制文件）\r\n"))
-		channel.Write([]byte("本系统仅支持处理纯文本内容，请确保输入的是文本文件。\r\n"))
-		channel.Write([]byte("支持的格式：.txt, .md, .log, .json, .yaml, .xml 等文本文件\r\n"))
-		return
+		channel.Stderr().Write([]byte("错误：检测到非文本内容（如图片、PDF等二进制文件）\r\n"))
+		channel.Stderr().Write([]byte("本系统仅支持处理纯文本内容，请确保输入的是文本文件。\r\n"))
+		channel.Stderr().Write([]byte("支持的格式：.txt, .md, .log, .json, .yaml, .xml 等文本文件\r\n"))
+		return ExitInput
 	}
 
 	// 检查内容长度
 	if len(content) == 0 {
-		channel.Write([]byte("错误：输入内容为空\r\n"))
-		return
+		channel.Stderr().Write([]byte("错误：输入内容为空\r\n"))
+		return ExitInput
 	}
 
-	// 直接使用默认模型，不加载模型列表
-	selectedModel := cfg.API.DefaultModel
+	// 使用公钥指定的模型或默认模型，模型不含通配符时不加载模型列表
+	selectedModel := sessionDefaultModel(session)
 
 	// 创建AI助手
-	assistant := ai.NewAssistant(username)
-	assistant.SetModel(selectedModel)
-
-	// 创建中断通道
-	interrupt := make(chan bool, 1)
+	assistant := newSessionAssistant(session, selectedModel, "stdin")
 
-	// 构造提示消息，使用配置文件中的自定义提示词
+	// 构造提示消息，使用配置文件中的自定义提示词（支持模板变量）
 	stdinPrompt := cfg.Prompt.StdinPrompt
 	if stdinPrompt == "" {
 		// 如果配置为空，使用默认提示词
-		stdinPrompt = "请分析以下内容并提供相关的帮助或建议："
+		stdinPrompt = prompt.DefaultStdinPrompt
 	}
-	prompt := fmt.Sprintf("%s\n\n%s", stdinPrompt, content)
+	message := fmt.Sprintf("%s\n\n%s", assistant.RenderPrompt("stdin_prompt", stdinPrompt), content)
 
 	// 直接处理内容并获取AI响应，不显示动画效果和工具调用信息
-	assistant.ProcessMessageWithFullOptions(prompt, channel, interrupt, false, false)
+	// 会话收到的INT/TERM信号会通过中断通道取消请求
+	renderer := newRendererForFormat(channel, format, session.Language())
+	_, err := assistant.ProcessMessageWithRenderer(message, channel, renderer, signals.interrupt, false)
+	return exitCodeForError(err, signals.signal())
 }
 
 // HandleSession 处理SSH会话
-func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, username string) {
+func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, session *Session) {
 	defer channel.Close()
 
+	username := session.Username
 	var execCommand string
 	isExecMode := false
 	hasPty := false // 标记是否有伪终端
 	execReady := make(chan bool, 1)
+	signals := newSignalState()
+	terminal := ui.NewTerminal() // 终端类型、尺寸和环境变量
 
 	// 处理会话请求
 	go func() {
@@ -928,8 +903,35 @@ func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, username s
 					}
 				}
 			case "pty-req":
+				if session.noPty {
+					// 公钥选项 no-pty / restrict 禁止分配伪终端
+					log.Printf("用户 %s 的公钥禁止分配伪终端，拒绝pty-req请求", username)
+					req.Reply(false, nil)
+					continue
+				}
 				hasPty = true // 标记有伪终端
+				if !handlePtyRequest(terminal, req.Payload) {
+					log.Printf("解析pty-req请求失败")
+				}
 				req.Reply(true, nil)
+			case "window-change":
+				// 客户端终端尺寸变化，后续的输入重绘和回答渲染按新宽度处理
+				ok := handleWindowChange(terminal, req.Payload)
+				if req.WantReply {
+					req.Reply(ok, nil)
+				}
+			case "env":
+				// 记录TERM、COLORTERM、NO_COLOR等环境变量，用于调整颜色输出
+				ok := handleEnvRequest(terminal, req.Payload)
+				if req.WantReply {
+					req.Reply(ok, nil)
+				}
+			case "signal":
+				// 客户端发送的信号（如 INT/TERM），用于取消正在进行的请求
+				ok := signals.handle(req.Payload)
+				if req.WantReply {
+					req.Reply(ok, nil)
+				}
 			case "exec":
 				// 处理执行命令请求
 				if len(req.Payload) > 4 {
@@ -958,9 +960,41 @@ func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, username s
 
 	cfg := config.Get()
 
+	// 按客户端终端的颜色能力调整输出
+	channel = &terminalChannel{Channel: channel, terminal: terminal}
+
+	// 首次登录需要先绑定TOTP两步验证（需要终端显示二维码）
+	if store := session.pendingTOTPEnrollment(); store != nil {
+		if !hasPty {
+			channel.Stderr().Write([]byte("首次登录需要绑定TOTP两步验证，请使用交互模式登录（ssh -t）完成绑定\r\n"))
+			sendExitStatus(channel, ExitGeneral)
+			return
+		}
+		if !enrollTOTP(channel, session, store) {
+			sendExitStatus(channel, ExitGeneral)
+			return
+		}
+		session.completeTOTPEnrollment()
+	}
+
+	// 按顺序匹配路由规则（需要env请求中的环境变量），决定会话的模型、角色、语言和工具策略
+	route := matchRoute(session, terminal.Env)
+	session.SetRoute(route)
+	if route != nil {
+		log.Printf("会话 #%d 匹配路由规则 %s (%s)", session.ID, route.Name(), strings.Join(route.Reasons, ", "))
+	}
+
+	// 路由规则或登录用户名指定了角色时，所有模式都使用该角色
+	if persona := sessionPersona(session); persona != nil {
+		session.SetPersona(persona.Name)
+	}
+
 	// 如果是执行模式且有命令，处理exec命令
 	if isExec && execCommand != "" {
-		handleExecCommand(channel, username, execCommand)
+		session.SetModel(sessionDefaultModel(session))
+		session.BeginRequest(execCommand, signals.cancel)
+		sendExitStatus(channel, handleExecCommand(channel, session, execCommand, signals))
+		session.EndRequest()
 		return
 	}
 
@@ -970,7 +1004,10 @@ func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, username s
 		stdinContent := tryReadStdinInput(channel)
 		if len(stdinContent) > 0 {
 			log.Printf("读取到stdin内容，长度: %d", len(stdinContent))
-			handleStdinCommand(channel, username, stdinContent)
+			session.SetModel(sessionDefaultModel(session))
+			session.BeginRequest(fmt.Sprintf("[stdin %d 字节]", len(stdinContent)), signals.cancel)
+			sendExitStatus(channel, handleStdinCommand(channel, session, stdinContent, FormatText, signals))
+			session.EndRequest()
 			return
 		}
 	}
@@ -985,26 +1022,46 @@ func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, username s
 
 	// 发送欢迎消息
 	if username != "" {
-		channel.Write([]byte(fmt.Sprintf(i18n.T("user.welcome")+", %s!\r\n", username)))
+		channel.Write([]byte(fmt.Sprintf(session.T("user.welcome")+", %s!\r\n", username)))
 	} else {
 		channel.Write([]byte(cfg.Server.WelcomeMessage + "\r\n"))
 	}
 
 	// 获取并选择模型
-	channel.Write([]byte(i18n.T("model.loading") + "\r\n"))
+	channel.Write([]byte(session.T("model.loading") + "\r\n"))
 	models, err := ai.GetAvailableModels()
 	if err != nil {
-		channel.Write([]byte(fmt.Sprintf(i18n.T("model.error", err) + "\r\n")))
+		channel.Write([]byte(fmt.Sprintf(session.T("model.error", err) + "\r\n")))
 		channel.Write([]byte(fmt.Sprintf("使用默认模型: %s\r\n", cfg.API.DefaultModel)))
 		models = []ai.ModelInfo{{ID: cfg.API.DefaultModel}}
 	}
 
-	// 根据用户名匹配模型
-	selectedModel := ai.SelectModelByUsername(channel, models, username)
+	// 路由规则或登录用户名（如 ssh reviewer@host）指定了角色时使用该角色
+	persona := sessionPersona(session)
+	if persona != nil {
+		channel.Write([]byte(fmt.Sprintf("使用角色: %s\r\n", ui.BrightYellowText(persona.Name))))
+	}
+
+	// 优先使用公钥、路由规则或角色指定的模型；配置了路由规则时不再根据用户名猜测模型
+	selectedModel := selectSessionModel(channel, models, session, persona)
+	if selectedModel == "" && len(cfg.Routes) > 0 {
+		selectedModel = ai.SelectModelFromList(channel, models, session.Language())
+	}
+	if selectedModel == "" {
+		selectedModel = ai.SelectModelByUsername(channel, models, session.LoginName, session.Language())
+	}
+	session.SetModel(selectedModel)
 
 	// 创建AI助手
 	assistant := ai.NewAssistant(username)
+	assistant.SetPersona(persona)
+	assistant.SetToolPolicy(session.toolPolicy())
+	assistant.SetSessionTools(session.sessionTools())
+	assistant.SetPromptData(session.promptData())
+	assistant.SetLanguage(session.Language())
 	assistant.SetModel(selectedModel)
+	assistant.SetTerminal(terminal)
+	assistant.SetAuditIdentity(session.AuditIdentity("interactive"))
 
 	// 生成彩色动态提示符
 	hostname := "sshai.top" // 可以从配置或系统获取
@@ -1015,49 +1072,85 @@ func HandleSession(channel ssh.Channel, requests <-chan *ssh.Request, username s
 	conversationHistory := NewConversationHistory()
 	
 	// 处理用户输入
-	handleUserInput(channel, assistant, username, conversationHistory)
+	handleUserInput(channel, assistant, session, conversationHistory)
+	sendExitStatus(channel, ExitOK)
 }
 
-// handleExecCommand 处理执行命令模式
-func handleExecCommand(channel ssh.Channel, username, command string) {
+// handleExecCommand 处理执行命令模式，返回退出码
+func handleExecCommand(channel ssh.Channel, session *Session, command string, signals *signalState) int {
 	cfg := config.Get()
 
 	// 显示执行的命令
 	// channel.Write([]byte(fmt.Sprintf("执行命令: %s\r\n\r\n", command)))
 
-	// 直接使用默认模型，不加载模型列表
-	selectedModel := cfg.API.DefaultModel
+	// 解析命令中的输出格式等选项
+	execReq, err := parseExecCommand(command)
+	if err != nil {
+		channel.Stderr().Write([]byte(fmt.Sprintf("错误：%v\r\n", err)))
+		return ExitInput
+	}
 
-	// 创建AI助手
-	assistant := ai.NewAssistant(username)
-	assistant.SetModel(selectedModel)
+	// 配置的命令（如 ssh host translate "hello"）
+	if execReq.Command != nil {
+		return handleConfigCommandExec(channel, session, execReq, signals)
+	}
+
+	// 只有选项没有问题时，从stdin读取内容（如 `cat file | ssh host ask --format json`）
+	if execReq.Prompt == "" {
+		return handleStdinCommand(channel, session, tryReadStdinInput(channel), execReq.Format, signals)
+	}
+
+	// 使用公钥指定的模型或默认模型，模型不含通配符时不加载模型列表
+	selectedModel := sessionDefaultModel(session)
 
-	// 创建中断通道
-	interrupt := make(chan bool, 1)
+	// 创建AI助手
+	assistant := newSessionAssistant(session, selectedModel, "exec")
 
-	// 构造提示消息，使用配置文件中的自定义提示词
+	// 构造提示消息，使用配置文件中的自定义提示词（支持模板变量）
 	execPrompt := cfg.Prompt.ExecPrompt
 	if execPrompt == "" {
 		// 如果配置为空，使用默认提示词
-		execPrompt = "请回答以下问题或执行以下任务："
+		execPrompt = prompt.DefaultExecPrompt
 	}
-	fullPrompt := fmt.Sprintf("%s\n\n%s", execPrompt, command)
+	question, citations := augmentQuestion(session, execReq.Prompt)
+	fullPrompt := fmt.Sprintf("%s\n\n%s", assistant.RenderPrompt("exec_prompt", execPrompt), question)
 
 	// 直接处理命令并获取AI响应，不显示动画效果和工具调用信息
-	assistant.ProcessMessageWithFullOptions(fullPrompt, channel, interrupt, false, false)
+	// 会话收到的INT/TERM信号会通过中断通道取消请求
+	renderer := newRendererForFormat(channel, execReq.Format, session.Language())
+	if _, err := assistant.ProcessMessageWithRenderer(fullPrompt, channel, renderer, signals.interrupt, false); err != nil {
+		return exitCodeForError(err, signals.signal())
+	}
 
-	// 添加换行符结束
-	channel.Write([]byte("\r\n"))
+	// 文本模式下添加换行符结束，使用了知识库时列出引用来源
+	if execReq.Format == FormatText {
+		channel.Write([]byte("\r\n"))
+		if len(citations) > 0 {
+			channel.Write([]byte("\r\n参考: " + strings.Join(citations, "  ") + "\r\n"))
+		}
+	}
+	return ExitOK
 }
 
 // handleUserInput 处理用户输入
-func handleUserInput(channel ssh.Channel, assistant *ai.Assistant, username string, conversationHistory *ConversationHistory) {
-	buffer := make([]byte, 1024)
-	history := NewCommandHistory()
-	inputState := NewInputState()
-	var escapeSequence []byte      // 用于处理ANSI转义序列
-	var currentInterrupt chan bool // 当前正在使用的中断通道
-	var isProcessing bool          // 标记是否正在处理AI请求
+func handleUserInput(channel ssh.Channel, assistant *ai.Assistant, session *Session, conversationHistory *ConversationHistory) {
+	username := session.Username
+	// 输入在单独的goroutine中读取，回答输出期间仍可编辑输入和排队消息
+	reader := newInputReader(channel)
+	defer reader.stop()
+	channel = reader
+
+	history := LoadCommandHistory(session.historyOwner())
+	decoder := &keyDecoder{}
+	editor := NewLineEditor(channel, history, assistant.Terminal())
+	inputState := editor.State()
+	var currentInterrupt chan bool      // 当前正在使用的中断通道
+	var isProcessing bool               // 标记是否正在处理AI请求
+	turnDone := make(chan struct{}, 1) // AI请求完成通知
+	// 回答期间远程命令的确认由输入循环转交
+	commandApprover := &approver{channel: channel}
+	session.setApprover(commandApprover)
+	defer session.setApprover(nil)
 	var tabCompletionState struct {
 		isActive    bool
 		prefix      string
@@ -1069,224 +1162,221 @@ func handleUserInput(channel ssh.Channel, assistant *ai.Assistant, username stri
 	hostname := "sshai.top" // 可以从配置或系统获取
 	currentModel := assistant.GetCurrentModel()
 	dynamicPrompt := ui.FormatPrompt(username, hostname, currentModel)
+	editor.SetPrompt(dynamicPrompt)
 
-	for {
-		n, err := channel.Read(buffer)
-		if err != nil {
-			log.Printf("读取输入失败: %v", err)
-			return
-		}
+	// 开启括号粘贴，粘贴的多行内容作为一条消息
+	channel.Write([]byte(enableBracketedPaste))
+	defer channel.Write([]byte(disableBracketedPaste))
 
-		data := buffer[:n]
+	// interruptRequest 中断当前AI请求（Ctrl+C或服务器关闭时）
+	interruptRequest := func(ch chan bool) {
+		// 使用 goroutine 异步发送，避免阻塞
+		go func() {
+			select {
+			case ch <- true:
+			case <-time.After(50 * time.Millisecond):
+			}
+		}()
+	}
 
-		// 处理输入数据
-		for i := 0; i < len(data); i++ {
-			b := data[i]
-
-			// 处理ANSI转义序列
-			if len(escapeSequence) > 0 || b == 27 { // ESC键开始转义序列
-				escapeSequence = append(escapeSequence, b)
-
-				// 检查是否是完整的方向键序列
-				if len(escapeSequence) == 3 && escapeSequence[0] == 27 && escapeSequence[1] == 91 {
-					switch escapeSequence[2] {
-					case 65: // 上方向键 ESC[A
-						cmd := history.GetPrevious()
-						inputState.SetText(cmd)
-						refreshLine(channel, inputState, dynamicPrompt)
-					case 66: // 下方向键 ESC[B
-						cmd := history.GetNext()
-						inputState.SetText(cmd)
-						refreshLine(channel, inputState, dynamicPrompt)
-					case 67: // 右方向键 ESC[C
-						if inputState.MoveCursorRight() {
-							// 获取刚移动过的字符，计算其显示宽度
-							if inputState.cursorPos > 0 {
-								movedChar := inputState.buffer[inputState.cursorPos-1]
-								charWidth := 1
-								if movedChar >= 128 {
-									charWidth = 2 // 中文字符宽度为2
-								}
-								// 根据字符宽度移动终端光标
-								for i := 0; i < charWidth; i++ {
-									channel.Write([]byte("\033[C"))
-								}
-							}
-						}
-					case 68: // 左方向键 ESC[D
-						if inputState.cursorPos > 0 {
-							// 获取即将移动过的字符，计算其显示宽度
-							charToMove := inputState.buffer[inputState.cursorPos-1]
-							charWidth := 1
-							if charToMove >= 128 {
-								charWidth = 2 // 中文字符宽度为2
-							}
-							if inputState.MoveCursorLeft() {
-								// 根据字符宽度移动终端光标
-								for i := 0; i < charWidth; i++ {
-									channel.Write([]byte("\033[D"))
-								}
-							}
-						}
-					}
-					escapeSequence = nil
-				} else if len(escapeSequence) > 3 {
-					// 重置转义序列如果太长
-					escapeSequence = nil
+	// startRequest 异步发起AI请求，这样Ctrl+C和后续输入可以在处理过程中被响应
+	startRequest := func(input string, process func(output ssh.Channel, interruptCh chan bool)) {
+		// 设置处理状态，回答输出期间输入不回显
+		isProcessing = true
+		editor.Suspend()
+
+		// 创建新的中断通道用于这次AI请求，服务器关闭时也通过它取消请求
+		currentInterrupt = make(chan bool)
+		interruptCh := currentInterrupt
+		session.BeginRequest(input, func() { interruptRequest(interruptCh) })
+
+		go func() {
+			// 创建一个包装的channel来捕获AI响应
+			responseCapture := &ResponseCapture{
+				originalChannel: channel,
+				content:         strings.Builder{},
+			}
+
+			process(responseCapture, interruptCh)
+
+			// 添加AI响应到对话历史
+			if responseCapture.content.Len() > 0 {
+				conversationHistory.AddMessage("assistant", responseCapture.content.String())
+			}
+
+			turnDone <- struct{}{}
+		}()
+	}
+
+	// submit 处理一条提交的输入，返回是否退出会话
+	submit := func(input string) bool {
+		// 服务器正在关闭，不再处理新的输入
+		if session.Draining() {
+			channel.Write([]byte(ui.BrightYellowText("服务器正在关闭，会话即将结束") + "\r\n"))
+			return true
+		}
+		// 检查是否是配置的命令（由AI执行，与普通消息一样可以中断）
+		if command, args := findConfigCommand(input); command != nil {
+			conversationHistory.AddMessage("user", input)
+			startRequest(input, func(output ssh.Channel, interruptCh chan bool) {
+				runConfigCommand(output, assistant, session, command, args, interruptCh)
+			})
+		} else if strings.HasPrefix(input, "/") {
+			newModel := handleCustomCommand(channel, assistant, input, conversationHistory, dynamicPrompt, session)
+			// 如果模型发生了变化，更新动态提示符
+			if newModel != "" {
+				currentModel = newModel
+				session.SetModel(currentModel)
+				dynamicPrompt = ui.FormatPrompt(username, hostname, currentModel)
+				editor.SetPrompt(dynamicPrompt)
+			}
+		} else if input == "exit" || input == "quit" {
+			channel.Write([]byte(session.T("user.exit") + "\r\n"))
+			return true
+		} else if input != "" {
+			// 添加用户消息到对话历史
+			conversationHistory.AddMessage("user", input)
+			startRequest(input, func(output ssh.Channel, interruptCh chan bool) {
+				// 开启知识库检索时附带相关资料，并显示引用来源
+				message, citations := augmentQuestion(session, input)
+				if len(citations) > 0 {
+					output.Write([]byte(ui.Colorize("📚 参考: "+strings.Join(citations, "  "), ui.BrightBlack) + "\r\n"))
 				}
-				continue
+				assistant.ProcessMessage(message, output, interruptCh)
+			})
+		}
+		return false
+	}
+
+	// runQueued 依次执行排队的消息，直到发起新的AI请求或队列为空，返回是否退出会话
+	runQueued := func() bool {
+		for !isProcessing {
+			input, ok := conversationHistory.NextQueued()
+			if !ok {
+				// 显示提示符和回答期间已输入的内容
+				editor.Resume()
+				return false
+			}
+			// 回显排队的消息，如同刚刚输入
+			channel.Write([]byte(dynamicPrompt + strings.ReplaceAll(input, "\n", "\r\n"+continuationPrompt) + "\r\n"))
+			if submit(input) {
+				return true
 			}
+		}
+		return false
+	}
 
-			// 处理普通字符
-			r, size := utf8.DecodeRune(data[i:])
-			if r == utf8.RuneError && size == 1 {
-				// 跳过无效字符
+	for {
+		var data []byte
+		var received time.Time // 收到输入的时间，剩余的数据为零值
+		if len(reader.pending) > 0 {
+			// 命令读取输入后剩余的数据
+			data, reader.pending = reader.pending, nil
+		} else {
+			select {
+			case chunk, ok := <-reader.data:
+				if !ok {
+					log.Printf("读取输入失败: %v", reader.err)
+					return
+				}
+				data = chunk
+				received = time.Now()
+			case <-turnDone:
+				// 请求完成后清空引用和状态，继续执行排队的消息
+				currentInterrupt = nil
+				isProcessing = false
+				session.EndRequest()
+				if session.Draining() {
+					// 服务器正在关闭，当前回答完成后结束会话
+					channel.Write([]byte(ui.BrightYellowText("服务器正在关闭，会话已结束") + "\r\n"))
+					return
+				}
+				if runQueued() {
+					return
+				}
+				continue
+			case notice := <-session.Notices():
+				// 管理员广播等通知显示在输入行上方
+				editor.PrintAbove(ui.BrightYellowText(notice))
 				continue
 			}
+		}
 
-			// 跳过已处理的字节
-			i += size - 1
+		// 处理输入数据
+		for _, key := range decoder.Feed(data) {
+			if isProcessing {
+				if commandApprover.handleKey(key, received) {
+					continue
+				}
+				// 回答输出期间Ctrl+C中断当前请求，其它按键继续编辑输入
+				if key.Code == KeyCtrl && key.Rune == 'c' {
+					if currentInterrupt != nil {
+						interruptRequest(currentInterrupt)
+					}
+					channel.Write([]byte("\r\n^C\r\n"))
+					continue
+				}
+				if key.Code == KeyTab {
+					continue
+				}
 
-			switch r {
-			case 9: // Tab键 - 自动补全
-				// 如果正在处理AI请求，忽略tab补全
-				if isProcessing {
+				event, line := editor.HandleKey(key)
+				input := strings.TrimSpace(line)
+				if event != EditorSubmit || input == "" {
 					continue
 				}
-				
+				history.AddCommand(input)
+				if isQueueCommand(input) {
+					// 查看和取消排队消息需要立即执行
+					channel.Write([]byte("\r\n"))
+					handleCustomCommand(channel, assistant, input, conversationHistory, dynamicPrompt, session)
+				} else {
+					conversationHistory.QueuePrompt(input)
+				}
+				continue
+			}
+
+			// 重置tab补全状态（当用户输入其他按键时）
+			if key.Code != KeyTab {
+				tabCompletionState.isActive = false
+			}
+
+			event, line := editor.HandleKey(key)
+			switch event {
+			case EditorTab: // Tab键 - 自动补全
 				currentInput := inputState.String()
 				
 				// 如果输入为空，显示帮助信息
 				if currentInput == "" {
 					channel.Write([]byte("\r\n"))
-					handleHelpCommand(channel, assistant, []string{}, conversationHistory, dynamicPrompt)
+					handleHelpCommand(channel, assistant, []string{}, conversationHistory, dynamicPrompt, session)
 					channel.Write([]byte(dynamicPrompt))
 				} else if strings.HasPrefix(currentInput, "/") {
 					// 检查是否是自定义命令的补全
 					handleTabCompletion(channel, inputState, &tabCompletionState, dynamicPrompt)
 				}
-				
-			case 13: // Enter键
-				// 重置tab补全状态
-				tabCompletionState.isActive = false
-				
-				// 如果正在处理AI请求，忽略新的输入
-				if isProcessing {
-					continue
-				}
 
-				input := strings.TrimSpace(inputState.String())
-				channel.Write([]byte("\r\n"))
+			case EditorInterrupt: // Ctrl+C - 放弃当前输入
+				channel.Write([]byte(dynamicPrompt))
+
+			case EditorEOF: // 空行时Ctrl+D - 退出
+				channel.Write([]byte("\r\n" + session.T("user.exit") + "\r\n"))
+				return
+
+			case EditorSubmit: // Enter键
+				input := strings.TrimSpace(line)
 
 				// 添加非空命令到历史记录
 				if input != "" {
 					history.AddCommand(input)
 				}
 
-				// 检查是否是自定义命令
-				if strings.HasPrefix(input, "/") {
-					newModel := handleCustomCommand(channel, assistant, input, conversationHistory, dynamicPrompt)
-					// 如果模型发生了变化，更新动态提示符
-					if newModel != "" {
-						currentModel = newModel
-						dynamicPrompt = ui.FormatPrompt(username, hostname, currentModel)
-					}
-					// 显示提示符
-					channel.Write([]byte(dynamicPrompt))
-				} else if input == "exit" || input == "quit" {
-					channel.Write([]byte(i18n.T("user.exit") + "\r\n"))
+				if submit(input) {
 					return
-				} else if input != "" {
-					// 添加用户消息到对话历史
-					conversationHistory.AddMessage("user", input)
-					
-					// 设置处理状态
-					isProcessing = true
-
-					// 创建新的中断通道用于这次AI请求
-					currentInterrupt = make(chan bool)
-
-					// 异步处理AI请求，这样Ctrl+C可以在处理过程中被响应
-					go func(userInput string, interruptCh chan bool) {
-						// 创建一个包装的channel来捕获AI响应
-						responseCapture := &ResponseCapture{
-							originalChannel: channel,
-							content:         strings.Builder{},
-						}
-						
-						assistant.ProcessMessage(userInput, responseCapture, interruptCh)
-						
-						// 添加AI响应到对话历史
-						if responseCapture.content.Len() > 0 {
-							conversationHistory.AddMessage("assistant", responseCapture.content.String())
-						}
-						
-						// 请求完成后清空引用和状态
-						currentInterrupt = nil
-						isProcessing = false
-						// 显示提示符
-						channel.Write([]byte(dynamicPrompt))
-					}(input, currentInterrupt)
-				} else {
-					// 空输入，直接显示提示符
-					channel.Write([]byte(dynamicPrompt))
-				}
-				// 清空输入状态
-				inputState.Clear()
-
-			case 127, 8: // Backspace/Delete键
-				// 如果正在处理AI请求，忽略编辑操作
-				if isProcessing {
-					continue
-				}
-				if inputState.DeleteRune() {
-					refreshLine(channel, inputState, dynamicPrompt)
-				}
-
-			case 1: // Ctrl+A - 移动到行首
-				// 如果正在处理AI请求，忽略编辑操作
-				if isProcessing {
-					continue
-				}
-				inputState.MoveCursorToStart()
-				refreshLine(channel, inputState, dynamicPrompt)
-
-			case 5: // Ctrl+E - 移动到行尾
-				// 如果正在处理AI请求，忽略编辑操作
-				if isProcessing {
-					continue
-				}
-				inputState.MoveCursorToEnd()
-				refreshLine(channel, inputState, dynamicPrompt)
-
-			case 3: // Ctrl+C
-				// 如果有正在进行的AI请求，发送中断信号
-				if currentInterrupt != nil {
-					// 使用 goroutine 异步发送，避免阻塞
-					go func(ch chan bool) {
-						select {
-						case ch <- true:
-						case <-time.After(50 * time.Millisecond):
-						}
-					}(currentInterrupt)
-				}
-
-				channel.Write([]byte("\r\n^C\r\n"))
-				inputState.Clear()
-				channel.Write([]byte(dynamicPrompt))
-
-			default:
-				// 重置tab补全状态（当用户输入其他字符时）
-				tabCompletionState.isActive = false
-				
-				// 如果正在处理AI请求，忽略字符输入
-				if isProcessing {
-					continue
 				}
-				// 处理所有可打印字符，包括中文
-				if r >= 32 || (r > 127 && utf8.ValidRune(r)) {
-					inputState.InsertRune(r)
-					refreshLine(channel, inputState, dynamicPrompt)
+				// 显示提示符（如果没有发起AI请求）
+				if !isProcessing {
+					editor.Resume()
 				}
 			}
 		}
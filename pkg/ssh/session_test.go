@@ -44,7 +44,7 @@ func TestGetCustomCommands(t *testing.T) {
 	commands := getCustomCommands()
 	
 	// 验证所有必需的命令都存在
-	expectedCommands := []string{"/help", "/new", "/history", "/clear", "/model"}
+	expectedCommands := []string{"/help", "/new", "/history", "/clear", "/model", "/render", "/queue", "/persona", "/whoami", "/kb", "/ws", "/admin"}
 	
 	for _, cmdName := range expectedCommands {
 		if _, exists := commands[cmdName]; !exists {
@@ -80,8 +80,8 @@ func TestGetCommandMatches(t *testing.T) {
 	
 	// 测试空输入
 	matches = getCommandMatches("/")
-	if len(matches) != 5 { // 应该返回所有命令
-		t.Errorf("Expected 5 matches for '/', got %d", len(matches))
+	if len(matches) != 12 { // 应该返回所有命令
+		t.Errorf("Expected 12 matches for '/', got %d", len(matches))
 	}
 }
 
@@ -101,4 +101,50 @@ func TestMessageTimestamp(t *testing.T) {
 	if msgTime.Before(before) || msgTime.After(after) {
 		t.Errorf("Message timestamp %v is not between %v and %v", msgTime, before, after)
 	}
-}
\ No newline at end of file
+}
+func TestConversationQueue(t *testing.T) {
+	history := NewConversationHistory()
+
+	history.QueuePrompt("first")
+	history.QueuePrompt("second")
+	if n := history.QueuePrompt("third"); n != 3 {
+		t.Errorf("Expected queue length 3, got %d", n)
+	}
+
+	// 取消第二条
+	if prompt, ok := history.CancelQueued(1); !ok || prompt != "second" {
+		t.Errorf("Expected to cancel 'second', got %q, %v", prompt, ok)
+	}
+	if _, ok := history.CancelQueued(5); ok {
+		t.Error("Expected cancel with invalid index to fail")
+	}
+
+	// 按顺序取出
+	if prompt, ok := history.NextQueued(); !ok || prompt != "first" {
+		t.Errorf("Expected 'first', got %q", prompt)
+	}
+	if prompts := history.QueuedPrompts(); len(prompts) != 1 || prompts[0] != "third" {
+		t.Errorf("Unexpected queued prompts: %v", prompts)
+	}
+
+	if n := history.ClearQueued(); n != 1 {
+		t.Errorf("Expected 1 cleared prompt, got %d", n)
+	}
+	if _, ok := history.NextQueued(); ok {
+		t.Error("Expected empty queue")
+	}
+
+	// 回答输出期间只有 /queue 命令立即执行，其它输入排队
+	for input, want := range map[string]bool{
+		"/queue":           true,
+		"/queue cancel 2":  true,
+		"/queue\tclear":    true,
+		"/queueing a note": false,
+		"/queue-all":       false,
+		"explain /queue":   false,
+	} {
+		if got := isQueueCommand(input); got != want {
+			t.Errorf("isQueueCommand(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
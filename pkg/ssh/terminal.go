@@ -0,0 +1,79 @@
+package ssh
+
+import (
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ui"
+)
+
+// ptyRequestMsg pty-req请求的payload (RFC 4254 6.2)
+type ptyRequestMsg struct {
+	Term     string
+	Columns  uint32
+	Rows     uint32
+	WidthPx  uint32
+	HeightPx uint32
+	Modes    string
+}
+
+// windowChangeMsg window-change请求的payload (RFC 4254 6.7)
+type windowChangeMsg struct {
+	Columns  uint32
+	Rows     uint32
+	WidthPx  uint32
+	HeightPx uint32
+}
+
+// envRequestMsg env请求的payload (RFC 4254 6.4)
+type envRequestMsg struct {
+	Name  string
+	Value string
+}
+
+// handlePtyRequest 解析pty-req请求并更新终端状态
+func handlePtyRequest(terminal *ui.Terminal, payload []byte) bool {
+	var msg ptyRequestMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+	terminal.SetTerm(msg.Term)
+	terminal.SetSize(int(msg.Columns), int(msg.Rows))
+	return true
+}
+
+// handleWindowChange 解析window-change请求并更新终端尺寸
+func handleWindowChange(terminal *ui.Terminal, payload []byte) bool {
+	var msg windowChangeMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+	terminal.SetSize(int(msg.Columns), int(msg.Rows))
+	return true
+}
+
+// handleEnvRequest 解析env请求并记录环境变量
+func handleEnvRequest(terminal *ui.Terminal, payload []byte) bool {
+	var msg envRequestMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+	terminal.SetEnv(msg.Name, msg.Value)
+	return true
+}
+
+// terminalChannel 按终端颜色深度调整输出的channel包装器
+type terminalChannel struct {
+	ssh.Channel
+	terminal *ui.Terminal
+}
+
+// Write 写入前根据终端能力去除不支持的颜色序列
+func (tc *terminalChannel) Write(data []byte) (int, error) {
+	if tc.terminal.ColorDepth() != ui.ColorNone {
+		return tc.Channel.Write(data)
+	}
+	if _, err := tc.Channel.Write([]byte(tc.terminal.AdaptColors(string(data)))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
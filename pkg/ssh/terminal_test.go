@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ui"
+)
+
+func TestTerminalRequests(t *testing.T) {
+	terminal := ui.NewTerminal()
+
+	pty := ssh.Marshal(ptyRequestMsg{Term: "xterm-256color", Columns: 120, Rows: 40})
+	if !handlePtyRequest(terminal, pty) {
+		t.Fatal("failed to parse pty-req payload")
+	}
+	if width, height := terminal.Size(); width != 120 || height != 40 {
+		t.Errorf("unexpected size %dx%d", width, height)
+	}
+	if terminal.ColorDepth() != ui.Color256 {
+		t.Errorf("expected 256 colors for %q", terminal.Term())
+	}
+
+	if !handleWindowChange(terminal, ssh.Marshal(windowChangeMsg{Columns: 60, Rows: 20})) {
+		t.Fatal("failed to parse window-change payload")
+	}
+	if terminal.Width() != 60 || terminal.WrapWidth(80) != 60 || terminal.WrapWidth(40) != 40 {
+		t.Errorf("unexpected width after window-change: %d", terminal.Width())
+	}
+
+	if handleWindowChange(terminal, []byte{0, 1}) {
+		t.Error("truncated window-change payload should be rejected")
+	}
+
+	handleEnvRequest(terminal, ssh.Marshal(envRequestMsg{Name: "NO_COLOR", Value: "1"}))
+	if terminal.ColorDepth() != ui.ColorNone {
+		t.Error("NO_COLOR should disable colors")
+	}
+	if got := terminal.AdaptColors(ui.Bold + "hi" + ui.Reset + "\033[K"); got != "hi\033[K" {
+		t.Errorf("unexpected color adaptation: %q", got)
+	}
+}
+
+func TestTerminalPosition(t *testing.T) {
+	tests := []struct {
+		text     string
+		columns  int
+		row, col int
+	}{
+		{"> hello", 0, 0, 7},
+		{"> hello", 10, 0, 7},
+		{"> hello123", 10, 1, 0},
+		{"> hello1234", 10, 1, 1},
+		{"> 中文中文中", 10, 1, 2},
+		{"> 中文中文", 9, 1, 2},
+	}
+
+	for _, tt := range tests {
+		row, col := terminalPosition(tt.text, tt.columns)
+		if row != tt.row || col != tt.col {
+			t.Errorf("terminalPosition(%q, %d) = (%d, %d), want (%d, %d)", tt.text, tt.columns, row, col, tt.row, tt.col)
+		}
+	}
+}
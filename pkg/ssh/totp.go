@@ -0,0 +1,230 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/auth"
+	"sshai/pkg/config"
+	"sshai/pkg/ui"
+)
+
+// TOTP相关的Permissions.Extensions
+const (
+	permTOTPEnroll   = "totp-enroll"   // 用户未绑定TOTP，登录后需要在终端中绑定
+	permTOTPRecovery = "totp-recovery" // 使用恢复码登录，值为剩余的恢复码数量
+)
+
+// totpPrompt keyboard-interactive 认证的提示
+const totpPrompt = "验证码 (TOTP) 或恢复码: "
+
+// maxEnrollAttempts 绑定时允许输错验证码的次数
+const maxEnrollAttempts = 3
+
+// totpVerifier 两步验证：密码或公钥认证通过后，通过 keyboard-interactive 输入TOTP验证码或恢复码
+type totpVerifier struct {
+	store *auth.TOTPStore
+	guard *authGuard
+}
+
+// newTOTPVerifier 根据配置创建两步验证，未启用时返回nil
+func newTOTPVerifier(guard *authGuard) *totpVerifier {
+	if !auth.TOTPEnabled() {
+		return nil
+	}
+	return &totpVerifier{store: auth.NewTOTPStore(), guard: guard}
+}
+
+// secondFactor 第一步认证成功后调用：已绑定的用户需要继续输入验证码，
+// 未绑定的用户在允许首次登录绑定时直接登录，并在会话中完成绑定
+// 只有经过验证的会话身份（证书主体、sshai-user）可以首次登录绑定，密码登录的用户名可以任意填写，
+// 否则知道共享密码的人可以抢先为其他用户绑定自己的验证器
+func (v *totpVerifier) secondFactor(conn ssh.ConnMetadata, perms *ssh.Permissions) (*ssh.Permissions, error) {
+	if v == nil {
+		return perms, nil
+	}
+	user := permIdentity(conn, perms)
+	enrolled, err := v.store.Enrolled(user)
+	if err != nil {
+		log.Printf("读取TOTP密钥失败: %v", err)
+		return nil, fmt.Errorf("两步验证暂时不可用")
+	}
+
+	if !enrolled {
+		if config.Get().Auth.TOTP.RequireEnrolled || !verifiedIdentity(perms) {
+			log.Printf("用户 %s 未绑定TOTP，拒绝登录", user)
+			return nil, fmt.Errorf("用户未绑定TOTP")
+		}
+		return withExtension(perms, permTOTPEnroll, "1"), nil
+	}
+
+	return nil, &ssh.PartialSuccessError{
+		Next: ssh.ServerAuthCallbacks{
+			KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+				return v.verify(conn, client, user, perms)
+			},
+		},
+	}
+}
+
+// verify 校验 keyboard-interactive 输入的验证码，成功时返回第一步认证的Permissions
+// 封禁检查和失败记录都使用会话身份 user（证书主体或 sshai-user 可能与登录用户名不同）
+func (v *totpVerifier) verify(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge, user string, perms *ssh.Permissions) (*ssh.Permissions, error) {
+	ip := remoteIP(conn.RemoteAddr())
+	if v.guard.userBanned(user) || v.guard.ipBanned(ip) {
+		log.Printf("用户 %s 处于封禁期，拒绝两步验证", user)
+		return nil, fmt.Errorf("认证失败次数过多，请稍后再试")
+	}
+
+	answers, err := client("", "", []string{totpPrompt}, []bool{false})
+	if err != nil {
+		return nil, err
+	}
+	if len(answers) != 1 {
+		return nil, fmt.Errorf("无效的应答")
+	}
+
+	usedRecovery, remaining, err := v.store.Verify(user, answers[0])
+	if err != nil {
+		log.Printf("用户 %s 两步验证失败: %v", user, err)
+		v.guard.fail(ip, user)
+		return nil, auth.ErrInvalidTOTPCode
+	}
+	if usedRecovery {
+		log.Printf("用户 %s 使用恢复码完成两步验证，剩余 %d 个恢复码", user, remaining)
+		return withExtension(perms, permTOTPRecovery, strconv.Itoa(remaining)), nil
+	}
+	log.Printf("用户 %s 两步验证成功", user)
+	return perms, nil
+}
+
+// permIdentity 获取认证中的会话身份：证书认证时为证书主体，公钥设置了 sshai-user 时为该用户名
+func permIdentity(conn ssh.ConnMetadata, perms *ssh.Permissions) string {
+	if perms != nil {
+		if principal := perms.Extensions[permCertPrincipal]; principal != "" {
+			return principal
+		}
+		if user := perms.Extensions[permKeyUser]; user != "" {
+			return user
+		}
+	}
+	return conn.User()
+}
+
+// withExtension 复制Permissions并添加扩展信息
+func withExtension(perms *ssh.Permissions, name, value string) *ssh.Permissions {
+	result := &ssh.Permissions{Extensions: map[string]string{name: value}}
+	if perms != nil {
+		result.CriticalOptions = perms.CriticalOptions
+		for key, existing := range perms.Extensions {
+			result.Extensions[key] = existing
+		}
+	}
+	return result
+}
+
+// enrollTOTP 在终端中引导用户绑定TOTP：显示二维码和密钥，校验第一个验证码后显示恢复码
+func enrollTOTP(channel ssh.Channel, session *Session, store *auth.TOTPStore) bool {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("生成TOTP密钥失败: %v", err)
+		return false
+	}
+
+	channel.Write([]byte(ui.BrightYellowText("🔐 首次登录需要绑定TOTP两步验证") + "\r\n"))
+	channel.Write([]byte("请使用验证器App（如 Google Authenticator、Microsoft Authenticator）扫描下面的二维码：\r\n\r\n"))
+	if qrCode, err := ui.RenderQRCode(auth.TOTPURI(session.Username, secret)); err == nil {
+		channel.Write([]byte(qrCode))
+	}
+	channel.Write([]byte(fmt.Sprintf("\r\n无法扫描时可以在App中手动输入密钥: %s\r\n\r\n", ui.BoldText(groupSecret(secret)))))
+
+	for attempt := 1; ; attempt++ {
+		channel.Write([]byte("请输入App中显示的6位验证码: "))
+		code, ok := readLine(channel, false)
+		if !ok {
+			channel.Write([]byte(ui.BrightRedText("已取消绑定") + "\r\n"))
+			return false
+		}
+
+		recoveryCodes, err := auth.GenerateRecoveryCodes()
+		if err == nil {
+			err = store.Enroll(session.Username, secret, code, recoveryCodes)
+		}
+		if err == nil {
+			log.Printf("用户 %s 绑定了TOTP (会话 #%d)", session.Username, session.ID)
+			showRecoveryCodes(channel, recoveryCodes)
+			return true
+		}
+
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 绑定失败: %v", err)) + "\r\n"))
+		if !errors.Is(err, auth.ErrInvalidTOTPCode) || attempt >= maxEnrollAttempts {
+			log.Printf("用户 %s 绑定TOTP失败: %v", session.Username, err)
+			return false
+		}
+	}
+}
+
+// showRecoveryCodes 显示恢复码，等待用户确认已保存
+func showRecoveryCodes(channel ssh.Channel, codes []string) {
+	channel.Write([]byte("\r\n" + ui.BrightGreenText("✅ TOTP绑定成功") + "\r\n"))
+	channel.Write([]byte("以下恢复码在无法使用验证器App时代替验证码登录，每个只能使用一次，且只显示这一次，请妥善保存：\r\n\r\n"))
+	for i := 0; i < len(codes); i += 2 {
+		line := "    " + codes[i]
+		if i+1 < len(codes) {
+			line += "    " + codes[i+1]
+		}
+		channel.Write([]byte(ui.BoldText(line) + "\r\n"))
+	}
+	channel.Write([]byte("\r\n按回车键继续..."))
+	readLine(channel, true)
+	channel.Write([]byte("\r\n"))
+}
+
+// groupSecret 将密钥每4个字符分为一组，便于手动输入
+func groupSecret(secret string) string {
+	var groups []string
+	for len(secret) > 4 {
+		groups = append(groups, secret[:4])
+		secret = secret[4:]
+	}
+	return strings.Join(append(groups, secret), " ")
+}
+
+// readLine 读取一行输入（验证码只包含ASCII字符），Ctrl+C、Ctrl+D或连接断开时返回false
+// allowEmpty为false时忽略空行
+func readLine(channel ssh.Channel, allowEmpty bool) (string, bool) {
+	var input []byte
+	buffer := make([]byte, 256)
+	for {
+		n, err := channel.Read(buffer)
+		if err != nil {
+			return "", false
+		}
+		for _, b := range buffer[:n] {
+			switch {
+			case b == '\r' || b == '\n':
+				if len(input) == 0 && !allowEmpty {
+					continue
+				}
+				channel.Write([]byte("\r\n"))
+				return strings.TrimSpace(string(input)), true
+			case b == 3 || b == 4: // Ctrl+C / Ctrl+D
+				channel.Write([]byte("\r\n"))
+				return "", false
+			case b == 127 || b == 8: // Backspace
+				if len(input) > 0 {
+					input = input[:len(input)-1]
+					channel.Write([]byte("\b \b"))
+				}
+			case b >= 0x20 && b < 0x7f && len(input) < 64:
+				input = append(input, b)
+				channel.Write([]byte{b})
+			}
+		}
+	}
+}
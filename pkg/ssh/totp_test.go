@@ -0,0 +1,188 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/auth"
+	"sshai/pkg/config"
+)
+
+// totpAt 计算相对当前时间偏移offset个时间步的TOTP验证码
+func totpAt(secret string, offset int64) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30+offset))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	index := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[index:])&0x7fffffff)%1000000)
+}
+
+// handshake 使用给定的客户端认证方式完成SSH握手，返回服务器端的Permissions
+func handshake(t *testing.T, serverConfig *ssh.ServerConfig, user string, methods ...ssh.AuthMethod) (*ssh.Permissions, error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type result struct {
+		perms *ssh.Permissions
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		serverSide, err := listener.Accept()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer serverSide.Close()
+		conn, _, _, err := ssh.NewServerConn(serverSide, serverConfig)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{perms: conn.Permissions}
+		conn.Close()
+	}()
+
+	clientConfig := &ssh.ClientConfig{User: user, Auth: methods, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	client, err := ssh.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err == nil {
+		defer client.Close()
+	}
+	r := <-done
+	return r.perms, r.err
+}
+
+func TestTOTPSecondFactor(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Auth
+	defer func() { cfg.Auth = saved }()
+	cfg.Auth.Password = "secret"
+	cfg.Auth.TOTP.Enabled = true
+	cfg.Auth.TOTP.SecretsFile = filepath.Join(t.TempDir(), "totp.json")
+	cfg.Auth.TOTP.RequireEnrolled = false
+
+	verifier := newTOTPVerifier(nil)
+	secret, _ := auth.GenerateTOTPSecret()
+	// 绑定时使用的验证码不能再次使用，绑定使用上一个时间步的验证码
+	if err := verifier.store.Enroll("alice", secret, totpAt(secret, -1), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != cfg.Auth.Password {
+				return nil, fmt.Errorf("密码错误")
+			}
+			return verifier.secondFactor(conn, &ssh.Permissions{Extensions: map[string]string{"first": "password"}})
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	answer := func(code string) ssh.AuthMethod {
+		return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			if len(questions) != 1 || questions[0] != totpPrompt || echos[0] {
+				return nil, fmt.Errorf("unexpected challenge %q", questions)
+			}
+			return []string{code}, nil
+		})
+	}
+
+	// 已绑定的用户：密码之后还需要验证码
+	if _, err := handshake(t, serverConfig, "alice", ssh.Password("secret")); err == nil {
+		t.Error("password alone should not be enough for an enrolled user")
+	}
+	if _, err := handshake(t, serverConfig, "alice", ssh.Password("secret"), answer("000000")); err == nil {
+		t.Error("wrong TOTP code should be rejected")
+	}
+	perms, err := handshake(t, serverConfig, "alice", ssh.Password("secret"), answer(totpAt(secret, 0)))
+	if err != nil {
+		t.Fatalf("password + TOTP should succeed: %v", err)
+	}
+	if perms.Extensions["first"] != "password" {
+		t.Error("permissions from the first factor should be kept")
+	}
+
+	// 未绑定的用户：密码登录的用户名未经验证，不能首次登录绑定
+	if _, err := handshake(t, serverConfig, "bob", ssh.Password("secret")); err == nil {
+		t.Error("unenrolled password user should not be allowed to enroll")
+	}
+	// 经过验证的会话身份允许登录，登录后绑定
+	verified := &ssh.Permissions{Extensions: map[string]string{permKeyUser: "bob"}}
+	perms, err = verifier.secondFactor(&fakeConn{user: "guest"}, verified)
+	if err != nil || perms.Extensions[permTOTPEnroll] == "" {
+		t.Errorf("unenrolled verified identity should log in and be asked to enroll: %v", err)
+	}
+	cfg.Auth.TOTP.RequireEnrolled = true
+	if _, err := verifier.secondFactor(&fakeConn{user: "guest"}, verified); err == nil {
+		t.Error("unenrolled user should be rejected when enrollment is required")
+	}
+}
+
+func TestTOTPFailuresBanIdentity(t *testing.T) {
+	cfg := config.Get()
+	saved := cfg.Auth
+	defer func() { cfg.Auth = saved }()
+	cfg.Auth.Password = "secret"
+	cfg.Auth.TOTP.Enabled = true
+	cfg.Auth.TOTP.SecretsFile = filepath.Join(t.TempDir(), "totp.json")
+
+	guard := &authGuard{
+		maxFailures: 2,
+		window:      time.Minute,
+		duration:    time.Minute,
+		records:     make(map[string]*failureRecord),
+		now:         time.Now,
+	}
+	verifier := newTOTPVerifier(guard)
+	secret, _ := auth.GenerateTOTPSecret()
+	if err := verifier.store.Enroll("alice", secret, totpAt(secret, -1), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话身份 alice 来自公钥选项 sshai-user，登录用户名为 root
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostKey)
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return verifier.secondFactor(conn, &ssh.Permissions{Extensions: map[string]string{permKeyUser: "alice"}})
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+	answer := func(code string) ssh.AuthMethod {
+		return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			return []string{code}, nil
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := handshake(t, serverConfig, "root", ssh.Password("secret"), answer("000000")); err == nil {
+			t.Fatal("wrong TOTP code should be rejected")
+		}
+	}
+	if !guard.userBanned("alice") || guard.userBanned("root") {
+		t.Error("TOTP failures should be recorded under the session identity that the ban check uses")
+	}
+	if _, err := handshake(t, serverConfig, "root", ssh.Password("secret"), answer(totpAt(secret, 0))); err == nil {
+		t.Error("banned identity should be rejected even with a valid code")
+	}
+}
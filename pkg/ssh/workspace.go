@@ -0,0 +1,114 @@
+package ssh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"sshai/pkg/ai"
+	"sshai/pkg/remote"
+	"sshai/pkg/ui"
+	"sshai/pkg/workspace"
+)
+
+// Workspace 获取会话工作区（第一次调用时创建），未启用工作区时返回nil
+func (s *Session) Workspace() *workspace.Workspace {
+	if s == nil || !workspace.Enabled() {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.workspace == nil {
+		s.workspace = workspace.New(strconv.Itoa(s.ID))
+	}
+	return s.workspace
+}
+
+// closeWorkspace 会话结束时删除工作区
+func (s *Session) closeWorkspace() {
+	s.mutex.Lock()
+	ws := s.workspace
+	s.workspace = nil
+	s.mutex.Unlock()
+	if ws != nil {
+		ws.Close()
+	}
+}
+
+// sessionTools 只属于该会话的内置工具（工作区的文件工具和远程运维工具）
+func (s *Session) sessionTools() []ai.NativeTool {
+	var tools []ai.NativeTool
+	if ws := s.Workspace(); ws != nil {
+		tools = append(tools, ws.Tools()...)
+	}
+	if remote.Enabled() {
+		tools = append(tools, remote.Tools(s)...)
+	}
+	return tools
+}
+
+// handleWorkspaceCommand 处理ws命令：查看、显示和删除工作区中的文件
+func handleWorkspaceCommand(channel ssh.Channel, assistant *ai.Assistant, args []string, conversationHistory *ConversationHistory, dynamicPrompt string, session *Session) string {
+	ws := session.Workspace()
+	if ws == nil {
+		channel.Write([]byte(ui.BrightYellowText("⚠️  没有启用会话工作区（workspace）\r\n\r\n")))
+		return ""
+	}
+
+	subcommand := "ls"
+	if len(args) > 0 {
+		subcommand = strings.ToLower(args[0])
+	}
+	target := strings.Join(args[min(1, len(args)):], " ")
+	switch subcommand {
+	case "ls", "list":
+		entries, err := ws.List(target)
+		if err != nil {
+			channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ %v\r\n\r\n", err))))
+			return ""
+		}
+		channel.Write([]byte(ui.BrightCyanText("📁 会话工作区（会话结束时删除）:\r\n")))
+		for _, entry := range entries {
+			if entry.IsDir {
+				channel.Write([]byte("  " + ui.BrightBlueText(entry.Path+"/") + "\r\n"))
+			} else {
+				channel.Write([]byte(fmt.Sprintf("  %s  %s\r\n", entry.Path, ui.Colorize(workspace.FormatSize(entry.Size), ui.BrightBlack))))
+			}
+		}
+		files, total := ws.Usage()
+		channel.Write([]byte(fmt.Sprintf("共 %d 个文件和目录，%s\r\n", files, workspace.FormatSize(total))))
+		channel.Write([]byte("用法: /ws [ls [目录]]|cat <文件>|rm <文件>\r\n\r\n"))
+	case "cat":
+		if target == "" {
+			channel.Write([]byte("用法: /ws cat <文件>\r\n\r\n"))
+			return ""
+		}
+		content, err := ws.Read(target)
+		if err != nil {
+			channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ %v\r\n\r\n", err))))
+			return ""
+		}
+		// 原样输出文件内容，便于复制
+		text := strings.ReplaceAll(string(content), "\n", "\r\n")
+		if !strings.HasSuffix(text, "\r\n") {
+			text += "\r\n"
+		}
+		channel.Write([]byte(text + "\r\n"))
+	case "rm":
+		if target == "" {
+			channel.Write([]byte("用法: /ws rm <文件>\r\n\r\n"))
+			return ""
+		}
+		if err := ws.Remove(target); err != nil {
+			channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ %v\r\n\r\n", err))))
+			return ""
+		}
+		channel.Write([]byte(ui.BrightGreenText(fmt.Sprintf("✅ 已删除 %s\r\n\r\n", target))))
+	default:
+		channel.Write([]byte(ui.BrightRedText(fmt.Sprintf("❌ 未知的子命令: %s\r\n", args[0]))))
+		channel.Write([]byte("用法: /ws [ls [目录]]|cat <文件>|rm <文件>\r\n\r\n"))
+	}
+	return ""
+}
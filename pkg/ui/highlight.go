@@ -0,0 +1,134 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageKeywords 各语言的关键字
+var languageKeywords = map[string][]string{
+	"go": {"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+	"python": {"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield", "None", "True", "False", "self"},
+	"javascript": {"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do", "else", "export", "extends", "finally", "for", "function", "if", "import", "in", "instanceof", "let", "new", "of", "return", "switch", "this", "throw", "try", "typeof", "var", "while", "yield", "null", "undefined", "true", "false", "interface", "type", "enum", "implements"},
+	"shell": {"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done", "case", "esac", "in", "function", "return", "local", "export", "echo", "exit", "set", "unset", "source", "sudo", "cd"},
+	"rust": {"as", "async", "await", "break", "const", "continue", "crate", "else", "enum", "extern", "false", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct", "super", "trait", "true", "type", "unsafe", "use", "where", "while"},
+	"java": {"abstract", "boolean", "break", "case", "catch", "class", "continue", "default", "do", "double", "else", "enum", "extends", "final", "finally", "float", "for", "if", "implements", "import", "instanceof", "int", "interface", "long", "new", "package", "private", "protected", "public", "return", "static", "super", "switch", "this", "throw", "throws", "try", "void", "while", "null", "true", "false"},
+	"c": {"auto", "break", "case", "char", "const", "continue", "default", "do", "double", "else", "enum", "extern", "float", "for", "goto", "if", "int", "long", "return", "short", "signed", "sizeof", "static", "struct", "switch", "typedef", "union", "unsigned", "void", "volatile", "while", "class", "namespace", "public", "private", "template", "using", "nullptr", "true", "false", "include", "define"},
+	"sql": {"select", "from", "where", "insert", "into", "values", "update", "set", "delete", "create", "table", "drop", "alter", "index", "join", "left", "right", "inner", "outer", "on", "group", "by", "order", "having", "limit", "and", "or", "not", "null", "as", "distinct", "union", "primary", "key"},
+	"yaml": {"true", "false", "null", "yes", "no"},
+}
+
+// languageAliases 语言别名
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "python3": "python",
+	"js": "javascript", "jsx": "javascript", "ts": "javascript", "tsx": "javascript", "typescript": "javascript", "json": "javascript",
+	"sh": "shell", "bash": "shell", "zsh": "shell", "console": "shell",
+	"rs": "rust", "kotlin": "java", "kt": "java", "cs": "java", "csharp": "java",
+	"cpp": "c", "c++": "c", "h": "c", "hpp": "c",
+	"yml": "yaml", "toml": "yaml", "ini": "yaml", "mysql": "sql", "postgresql": "sql",
+}
+
+// lineCommentPrefixes 各语言的单行注释前缀
+var lineCommentPrefixes = map[string][]string{
+	"go": {"//"}, "javascript": {"//"}, "rust": {"//"}, "java": {"//"}, "c": {"//"},
+	"python": {"#"}, "shell": {"#"}, "yaml": {"#"}, "sql": {"--"},
+}
+
+// HighlightCode 对单行代码进行简单的语法高亮（关键字、字符串、数字、注释）
+func HighlightCode(line, lang string) string {
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	keywords := languageKeywords[lang]
+	if keywords == nil {
+		return line
+	}
+	keywordSet := make(map[string]bool, len(keywords))
+	for _, kw := range keywords {
+		keywordSet[kw] = true
+	}
+	caseInsensitive := lang == "sql"
+
+	var out strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		// 注释：直接输出到行尾
+		if isCommentStart(runes[i:], lang) {
+			out.WriteString(BrightBlack + string(runes[i:]) + Reset)
+			break
+		}
+
+		// 字符串
+		if r == '"' || r == '\'' || r == '`' {
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			out.WriteString(Green + string(runes[i:j+1]) + Reset)
+			i = j + 1
+			continue
+		}
+
+		// 数字
+		if unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])) {
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'x' || (runes[j] >= 'a' && runes[j] <= 'f')) {
+				j++
+			}
+			out.WriteString(Magenta + string(runes[i:j]) + Reset)
+			i = j
+			continue
+		}
+
+		// 标识符和关键字
+		if isIdentRune(r) {
+			j := i
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			lookup := word
+			if caseInsensitive {
+				lookup = strings.ToLower(word)
+			}
+			switch {
+			case keywordSet[lookup]:
+				out.WriteString(Bold + Blue + word + Reset)
+			case j < len(runes) && runes[j] == '(':
+				out.WriteString(Yellow + word + Reset)
+			default:
+				out.WriteString(word)
+			}
+			i = j
+			continue
+		}
+
+		out.WriteRune(r)
+		i++
+	}
+	return out.String()
+}
+
+// isCommentStart 判断是否是注释开始
+func isCommentStart(runes []rune, lang string) bool {
+	for _, prefix := range lineCommentPrefixes[lang] {
+		n := len([]rune(prefix))
+		if len(runes) >= n && string(runes[:n]) == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// isIdentRune 判断是否是标识符字符
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
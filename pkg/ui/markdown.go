@@ -0,0 +1,455 @@
+package ui
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sshai/pkg/utils"
+)
+
+// 渲染模式
+const (
+	RenderPlain    = "plain"    // 原样输出
+	RenderMarkdown = "markdown" // Markdown转ANSI格式
+)
+
+// MarkdownStream 流式Markdown渲染器
+// 模型输出按任意位置切分成数据块，渲染器缓存不完整的行，只对完整的行进行渲染；
+// 表格需要等所有行到齐后才能计算列宽，因此会缓存到表格结束
+type MarkdownStream struct {
+	width     int      // 换行宽度，<=0 表示不换行
+	pending   string   // 尚未遇到换行符的内容
+	inCode    bool     // 是否在代码块中
+	codeLang  string   // 代码块语言
+	codeFence string   // 代码块起始标记（``` 或 ~~~）
+	table     []string // 缓存的表格行
+}
+
+// NewMarkdownStream 创建流式Markdown渲染器
+func NewMarkdownStream(width int) *MarkdownStream {
+	return &MarkdownStream{width: width}
+}
+
+// Write 写入一个数据块，返回可以输出的已渲染内容（使用 \n 换行）
+func (m *MarkdownStream) Write(chunk string) string {
+	m.pending += chunk
+
+	var out strings.Builder
+	for {
+		idx := strings.IndexByte(m.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSuffix(m.pending[:idx], "\r")
+		m.pending = m.pending[idx+1:]
+		out.WriteString(m.renderLine(line))
+	}
+	return out.String()
+}
+
+// Flush 输出所有缓存的内容，在响应结束时调用
+func (m *MarkdownStream) Flush() string {
+	var out strings.Builder
+	if m.pending != "" {
+		line := m.pending
+		m.pending = ""
+		out.WriteString(strings.TrimSuffix(m.renderLine(line), "\n"))
+	}
+	out.WriteString(m.flushTable())
+	if m.inCode {
+		m.inCode = false
+		out.WriteString(Dim + "└" + Reset + "\n")
+	}
+	return out.String()
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletPattern    = regexp.MustCompile(`^(\s*)([-*+])\s+(.*)$`)
+	orderedPattern   = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	taskPattern      = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	rulePattern      = regexp.MustCompile(`^\s*(-\s*){3,}$|^\s*(\*\s*){3,}$|^\s*(_\s*){3,}$`)
+	tableSepPattern  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	fencePattern     = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)")
+	codeSpanPattern  = regexp.MustCompile("`([^`]+)`")
+	boldPattern      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern    = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*)\*|(^|[^_\w])_([^_\s][^_]*)_`)
+	strikePattern    = regexp.MustCompile(`~~([^~]+)~~`)
+	linkPattern      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	placeholderRegex = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// renderLine 渲染一行完整的内容
+func (m *MarkdownStream) renderLine(line string) string {
+	// 代码块内部
+	if m.inCode {
+		if fence := fencePattern.FindStringSubmatch(line); fence != nil && strings.HasPrefix(strings.TrimSpace(line), m.codeFence) && fence[2] == "" {
+			m.inCode = false
+			return Dim + "└" + Reset + "\n"
+		}
+		return Dim + "│ " + Reset + HighlightCode(line, m.codeLang) + Reset + "\n"
+	}
+
+	// 表格行先缓存，等表格结束后统一计算列宽
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "|") {
+		m.table = append(m.table, trimmed)
+		return ""
+	}
+	out := m.flushTable()
+
+	// 代码块开始
+	if fence := fencePattern.FindStringSubmatch(line); fence != nil {
+		m.inCode = true
+		m.codeFence = fence[1][:3]
+		m.codeLang = strings.ToLower(fence[2])
+		label := m.codeLang
+		if label == "" {
+			label = "code"
+		}
+		return out + Dim + "┌─ " + label + Reset + "\n"
+	}
+
+	return out + m.renderBlock(line) + "\n"
+}
+
+// renderBlock 渲染普通块级元素（标题、列表、引用、分隔线、段落）
+func (m *MarkdownStream) renderBlock(line string) string {
+	if strings.TrimSpace(line) == "" {
+		return ""
+	}
+
+	if rulePattern.MatchString(line) {
+		return Dim + strings.Repeat("─", m.ruleWidth()) + Reset
+	}
+
+	if match := headingPattern.FindStringSubmatch(line); match != nil {
+		text := RenderInline(match[2])
+		switch len(match[1]) {
+		case 1:
+			return Bold + Underline + BrightMagenta + text + Reset
+		case 2:
+			return Bold + BrightCyan + text + Reset
+		case 3:
+			return Bold + BrightBlue + text + Reset
+		default:
+			return Bold + text + Reset
+		}
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(line), ">") {
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), ">"))
+		return m.wrapWithPrefix(Dim+"▌ "+Reset+Italic, "▌ ", RenderInline(text)+Reset)
+	}
+
+	if match := bulletPattern.FindStringSubmatch(line); match != nil {
+		indent := match[1]
+		text := match[3]
+		marker := BrightYellow + "•" + Reset + " "
+		if task := taskPattern.FindStringSubmatch(text); task != nil {
+			if task[1] == " " {
+				marker = "☐ "
+			} else {
+				marker = BrightGreen + "☑" + Reset + " "
+			}
+			text = task[2]
+		}
+		return m.wrapWithPrefix(indent+marker, indent+"  ", RenderInline(text))
+	}
+
+	if match := orderedPattern.FindStringSubmatch(line); match != nil {
+		indent := match[1]
+		marker := BrightYellow + match[2] + Reset + " "
+		return m.wrapWithPrefix(indent+marker, indent+strings.Repeat(" ", len(match[2])+1), RenderInline(match[3]))
+	}
+
+	return m.wrapWithPrefix("", "", RenderInline(line))
+}
+
+// ruleWidth 分隔线宽度
+func (m *MarkdownStream) ruleWidth() int {
+	if m.width > 0 && m.width < 80 {
+		return m.width
+	}
+	return 80
+}
+
+// wrapWithPrefix 按宽度换行，第一行使用prefix，后续行使用continuation缩进
+func (m *MarkdownStream) wrapWithPrefix(prefix, continuation, text string) string {
+	if m.width <= 0 {
+		return prefix + text
+	}
+	available := m.width - VisibleWidth(continuation)
+	if available < 10 {
+		available = 10
+	}
+	lines := WrapANSI(text, available)
+	for i := range lines {
+		if i == 0 {
+			lines[i] = prefix + lines[i]
+		} else {
+			lines[i] = continuation + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flushTable 渲染缓存的表格
+func (m *MarkdownStream) flushTable() string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	rows := m.table
+	m.table = nil
+	return RenderTable(rows) + "\n"
+}
+
+// RenderInline 渲染行内元素（代码、粗体、斜体、删除线、链接）
+func RenderInline(text string) string {
+	// 先把行内代码替换为占位符，避免代码中的 * _ 被当作强调标记
+	var spans []string
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, BrightRed+s[1:len(s)-1]+Reset)
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+
+	text = linkPattern.ReplaceAllString(text, Underline+BrightBlue+"$1"+Reset+Dim+" ($2)"+Reset)
+	text = boldPattern.ReplaceAllStringFunc(text, func(s string) string {
+		return Bold + s[2:len(s)-2] + Reset
+	})
+	text = italicPattern.ReplaceAllStringFunc(text, func(s string) string {
+		match := italicPattern.FindStringSubmatch(s)
+		if match[2] != "" {
+			return match[1] + Italic + match[2] + Reset
+		}
+		return match[3] + Italic + match[4] + Reset
+	})
+	text = strikePattern.ReplaceAllString(text, Strike+"$1"+Reset)
+
+	return placeholderRegex.ReplaceAllStringFunc(text, func(s string) string {
+		idx, err := strconv.Atoi(strings.Trim(s, "\x00"))
+		if err == nil && idx < len(spans) {
+			return spans[idx]
+		}
+		return s
+	})
+}
+
+// RenderTable 渲染Markdown表格，按显示宽度对齐列
+func RenderTable(lines []string) string {
+	var header []string
+	var rows [][]string
+	var aligns []string
+
+	for i, line := range lines {
+		if i == 1 && tableSepPattern.MatchString(line) {
+			for _, cell := range splitTableRow(line) {
+				switch {
+				case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+					aligns = append(aligns, "center")
+				case strings.HasSuffix(cell, ":"):
+					aligns = append(aligns, "right")
+				default:
+					aligns = append(aligns, "left")
+				}
+			}
+			continue
+		}
+		cells := splitTableRow(line)
+		for j := range cells {
+			cells[j] = RenderInline(cells[j])
+		}
+		if i == 0 {
+			header = cells
+		} else {
+			rows = append(rows, cells)
+		}
+	}
+
+	// 计算列宽
+	columns := len(header)
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	widths := make([]int, columns)
+	for _, row := range append([][]string{header}, rows...) {
+		for j, cell := range row {
+			if w := VisibleWidth(cell); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	border := func(left, mid, right string) string {
+		parts := make([]string, columns)
+		for j, w := range widths {
+			parts[j] = strings.Repeat("─", w+2)
+		}
+		return Dim + left + strings.Join(parts, mid) + right + Reset
+	}
+	renderRow := func(row []string, bold bool) string {
+		var b strings.Builder
+		b.WriteString(Dim + "│" + Reset)
+		for j := 0; j < columns; j++ {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			align := "left"
+			if j < len(aligns) {
+				align = aligns[j]
+			}
+			if bold {
+				cell = Bold + cell + Reset
+			}
+			b.WriteString(" " + padCell(cell, widths[j], align) + " " + Dim + "│" + Reset)
+		}
+		return b.String()
+	}
+
+	var out []string
+	out = append(out, border("┌", "┬", "┐"))
+	if header != nil {
+		out = append(out, renderRow(header, true))
+		out = append(out, border("├", "┼", "┤"))
+	}
+	for _, row := range rows {
+		out = append(out, renderRow(row, false))
+	}
+	out = append(out, border("└", "┴", "┘"))
+	return strings.Join(out, "\n")
+}
+
+// splitTableRow 拆分表格行
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	var cells []string
+	var cell strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cell.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteRune(r)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// padCell 按对齐方式填充单元格
+func padCell(cell string, width int, align string) string {
+	gap := width - VisibleWidth(cell)
+	if gap <= 0 {
+		return cell
+	}
+	switch align {
+	case "right":
+		return strings.Repeat(" ", gap) + cell
+	case "center":
+		left := gap / 2
+		return strings.Repeat(" ", left) + cell + strings.Repeat(" ", gap-left)
+	default:
+		return cell + strings.Repeat(" ", gap)
+	}
+}
+
+// StripANSI 移除ANSI转义序列
+func StripANSI(text string) string {
+	var b strings.Builder
+	inEscape := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inEscape {
+			if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+				inEscape = false
+			}
+			continue
+		}
+		if c == '\033' && i+1 < len(text) && text[i+1] == '[' {
+			inEscape = true
+			i++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// VisibleWidth 计算去除ANSI转义序列后的显示宽度
+func VisibleWidth(text string) int {
+	return utils.GetDisplayWidth(StripANSI(text))
+}
+
+// WrapANSI 按显示宽度对包含ANSI转义序列的文本换行
+// 优先在空格处断行，找不到空格时（如中文）按字符断行
+func WrapANSI(text string, width int) []string {
+	if width <= 0 || VisibleWidth(text) <= width {
+		return []string{text}
+	}
+
+	var lines []string
+	var line []rune
+	lineWidth := 0
+	lastSpace := -1 // line 中最后一个空格的位置
+	widthAtSpace := 0
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		// 转义序列不占宽度，整体复制
+		if r == '\033' && i+1 < len(runes) && runes[i+1] == '[' {
+			j := i + 2
+			for j < len(runes) && !((runes[j] >= 'A' && runes[j] <= 'Z') || (runes[j] >= 'a' && runes[j] <= 'z')) {
+				j++
+			}
+			if j < len(runes) {
+				line = append(line, runes[i:j+1]...)
+				i = j
+				continue
+			}
+		}
+
+		w := utils.GetDisplayWidth(string(r))
+		if lineWidth+w > width && lineWidth > 0 {
+			if r == ' ' {
+				lines = append(lines, string(line))
+				line, lineWidth, lastSpace = nil, 0, -1
+				continue
+			}
+			if lastSpace >= 0 {
+				lines = append(lines, string(line[:lastSpace]))
+				line = append([]rune{}, line[lastSpace+1:]...)
+				lineWidth -= widthAtSpace + 1
+			} else {
+				lines = append(lines, string(line))
+				line, lineWidth = nil, 0
+			}
+			lastSpace = -1
+		}
+
+		if r == ' ' {
+			lastSpace = len(line)
+			widthAtSpace = lineWidth
+		}
+		line = append(line, r)
+		lineWidth += w
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
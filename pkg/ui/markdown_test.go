@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+)
+
+// renderChunks 按给定数据块流式渲染并去除ANSI序列
+func renderChunks(width int, chunks ...string) string {
+	m := NewMarkdownStream(width)
+	var out strings.Builder
+	for _, chunk := range chunks {
+		out.WriteString(m.Write(chunk))
+	}
+	out.WriteString(m.Flush())
+	return StripANSI(out.String())
+}
+
+func TestMarkdownStreamIncompleteChunks(t *testing.T) {
+	m := NewMarkdownStream(0)
+	if out := m.Write("# Tit"); out != "" {
+		t.Errorf("incomplete line should be buffered, got %q", out)
+	}
+	out := StripANSI(m.Write("le\nnext **bo"))
+	if out != "Title\n" {
+		t.Errorf("expected heading to be rendered, got %q", out)
+	}
+	out = StripANSI(m.Write("ld**\n"))
+	if out != "next bold\n" {
+		t.Errorf("expected bold split across chunks to be rendered, got %q", out)
+	}
+}
+
+func TestMarkdownInline(t *testing.T) {
+	got := RenderInline("a **b** *c* `d*e*` ~~f~~ [g](http://x)")
+	if !strings.Contains(got, Bold+"b"+Reset) {
+		t.Errorf("bold not rendered: %q", got)
+	}
+	if !strings.Contains(got, Italic+"c"+Reset) {
+		t.Errorf("italic not rendered: %q", got)
+	}
+	if !strings.Contains(StripANSI(got), "d*e*") {
+		t.Errorf("code span content should be kept verbatim: %q", got)
+	}
+	if StripANSI(got) != "a b c d*e* f g (http://x)" {
+		t.Errorf("unexpected plain text: %q", StripANSI(got))
+	}
+}
+
+func TestMarkdownTableAlignment(t *testing.T) {
+	out := renderChunks(0, "| 名称 | n |\n|:--|--:|\n| go | 1", "0 |\n| 中文 | 2 |\n", "after\n")
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("expected 6 table lines and 1 paragraph, got %d: %q", len(lines), out)
+	}
+	width := VisibleWidth(lines[0])
+	for _, line := range lines[:6] {
+		if VisibleWidth(line) != width {
+			t.Errorf("table line %q has width %d, want %d", line, VisibleWidth(line), width)
+		}
+	}
+	if !strings.Contains(lines[3], "│ go   │ 10 │") {
+		t.Errorf("unexpected row rendering: %q", lines[3])
+	}
+	if lines[6] != "after" {
+		t.Errorf("paragraph after table lost: %q", lines[6])
+	}
+}
+
+func TestMarkdownCodeBlock(t *testing.T) {
+	out := renderChunks(0, "```go\nfunc main() { // **x**\n```\n")
+	if !strings.Contains(out, "┌─ go") || !strings.Contains(out, "│ func main() { // **x**") || !strings.Contains(out, "└") {
+		t.Errorf("unexpected code block rendering: %q", out)
+	}
+}
+
+func TestWrapANSI(t *testing.T) {
+	lines := WrapANSI(Bold+"hello"+Reset+" world foo", 11)
+	if len(lines) != 2 || StripANSI(lines[0]) != "hello world" || lines[1] != "foo" {
+		t.Errorf("unexpected wrap: %q", lines)
+	}
+	lines = WrapANSI("中文中文中文", 5)
+	for _, line := range lines {
+		if VisibleWidth(line) > 5 {
+			t.Errorf("line %q exceeds width", line)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ui
+
+import (
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrQuietZone 二维码四周的空白边距（模块数）
+const qrQuietZone = 2
+
+// RenderQRCode 将文本编码为二维码，用半高方块字符渲染（每个字符表示上下两个模块），行以\r\n结尾
+// 浅色模块用前景色绘制，颜色被去掉（NO_COLOR）时在深色背景的终端中仍然可以扫描
+func RenderQRCode(text string) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	size := code.Size + qrQuietZone*2
+	light := func(x, y int) bool {
+		x, y = x-qrQuietZone, y-qrQuietZone
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return true
+		}
+		return !code.Black(x, y)
+	}
+
+	var builder strings.Builder
+	for y := 0; y < size; y += 2 {
+		builder.WriteString(BrightWhite + BgBlack)
+		for x := 0; x < size; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				builder.WriteString("█")
+			case top:
+				builder.WriteString("▀")
+			case bottom:
+				builder.WriteString("▄")
+			default:
+				builder.WriteString(" ")
+			}
+		}
+		builder.WriteString(Reset + "\r\n")
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ColorDepth 终端支持的颜色深度
+type ColorDepth int
+
+const (
+	ColorNone ColorDepth = iota // 不输出颜色（dumb终端或设置了NO_COLOR）
+	Color16                     // 基本16色
+	Color256                    // 256色
+	ColorTrue                   // 24位真彩色
+)
+
+// sgrPattern 匹配设置颜色和样式的SGR转义序列（不包括光标控制序列）
+var sgrPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// Terminal 会话终端状态，由pty-req、window-change和env请求更新
+type Terminal struct {
+	mutex  sync.RWMutex
+	term   string
+	width  int
+	height int
+	env    map[string]string
+}
+
+// NewTerminal 创建终端状态
+func NewTerminal() *Terminal {
+	return &Terminal{env: make(map[string]string)}
+}
+
+// SetTerm 设置终端类型（TERM）
+func (t *Terminal) SetTerm(term string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.term = term
+}
+
+// Term 获取终端类型，优先使用pty-req中的值，其次是env请求中的TERM
+func (t *Terminal) Term() string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.term != "" {
+		return t.term
+	}
+	return t.env["TERM"]
+}
+
+// SetSize 设置终端尺寸（列数和行数）
+func (t *Terminal) SetSize(width, height int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.width = width
+	t.height = height
+}
+
+// Size 获取终端尺寸，未知时返回0
+func (t *Terminal) Size() (width, height int) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.width, t.height
+}
+
+// Width 获取终端列数，未知时返回0
+func (t *Terminal) Width() int {
+	width, _ := t.Size()
+	return width
+}
+
+// SetEnv 记录客户端通过env请求传递的环境变量
+func (t *Terminal) SetEnv(name, value string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.env[name] = value
+}
+
+// Env 获取客户端传递的环境变量
+func (t *Terminal) Env(name string) (string, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	value, ok := t.env[name]
+	return value, ok
+}
+
+// WrapWidth 计算换行宽度：取配置宽度和终端宽度中较小的非零值
+func (t *Terminal) WrapWidth(configured int) int {
+	width := t.Width()
+	if configured > 0 && (width <= 0 || configured < width) {
+		return configured
+	}
+	return width
+}
+
+// ColorDepth 根据TERM、COLORTERM和NO_COLOR推断终端颜色深度
+func (t *Terminal) ColorDepth() ColorDepth {
+	if _, ok := t.Env("NO_COLOR"); ok {
+		return ColorNone
+	}
+	term := strings.ToLower(t.Term())
+	if term == "dumb" {
+		return ColorNone
+	}
+	colorTerm, _ := t.Env("COLORTERM")
+	colorTerm = strings.ToLower(colorTerm)
+	if colorTerm == "truecolor" || colorTerm == "24bit" || strings.Contains(term, "direct") {
+		return ColorTrue
+	}
+	if strings.Contains(term, "256color") {
+		return Color256
+	}
+	return Color16
+}
+
+// AdaptColors 按颜色深度调整输出，不支持颜色时去除SGR序列
+func (t *Terminal) AdaptColors(text string) string {
+	if t.ColorDepth() == ColorNone {
+		return sgrPattern.ReplaceAllString(text, "")
+	}
+	return text
+}
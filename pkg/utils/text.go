@@ -2,6 +2,7 @@ package utils
 
 import (
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -41,19 +42,66 @@ func WrapText(text string, width int) string {
 	return strings.Join(result, "\n")
 }
 
-// GetDisplayWidth 计算文本显示宽度（中文字符占2个宽度）
+// GetDisplayWidth 计算文本显示宽度（东亚宽字符占2个宽度，组合字符不占宽度）
 func GetDisplayWidth(text string) int {
 	width := 0
 	for _, r := range text {
-		if utf8.RuneLen(r) > 1 {
-			width += 2 // 中文字符占2个宽度
-		} else {
-			width += 1 // 英文字符占1个宽度
-		}
+		width += RuneWidth(r)
 	}
 	return width
 }
 
+// wideRanges 东亚宽字符（Wide/Fullwidth）和常见emoji的码点范围
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC},
+	{0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+	{0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+	{0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF},
+	{0xA960, 0xA97F}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19},
+	{0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x1F004, 0x1F004},
+	{0x1F0CF, 0x1F0CF}, {0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F251},
+	{0x1F300, 0x1F64F}, {0x1F680, 0x1F6FF}, {0x1F7E0, 0x1F7EB}, {0x1F90C, 0x1F9FF},
+	{0x1FA70, 0x1FAFF}, {0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// RuneWidth 计算单个字符的显示宽度：组合字符和零宽字符为0，东亚宽字符和emoji为2，其余为1
+func RuneWidth(r rune) int {
+	if r < 0x7F {
+		if r < 0x20 {
+			return 0
+		}
+		return 1
+	}
+	if r == 0x200B || r == 0x200C || r == 0x200D || r == 0x2060 || (r >= 0xFE00 && r <= 0xFE0F) ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) {
+		return 0
+	}
+	if r < 0x1100 {
+		return 1
+	}
+
+	// 二分查找宽字符范围
+	lo, hi := 0, len(wideRanges)-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		switch {
+		case r < wideRanges[mid][0]:
+			hi = mid - 1
+		case r > wideRanges[mid][1]:
+			lo = mid + 1
+		default:
+			return 2
+		}
+	}
+	return 1
+}
+
 // FindBreakPosition 寻找合适的断行位置
 func FindBreakPosition(text string, maxWidth int) int {
 	if len(text) == 0 {
@@ -68,12 +116,7 @@ func FindBreakPosition(text string, maxWidth int) int {
 	currentBytePos := 0
 
 	for _, r := range text {
-		runeWidth := 1
-		if utf8.RuneLen(r) > 1 {
-			runeWidth = 2
-		}
-
-		currentWidth += runeWidth
+		currentWidth += RuneWidth(r)
 
 		// 检查是否是断行字符
 		for _, bc := range breakChars {
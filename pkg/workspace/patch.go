@@ -0,0 +1,200 @@
+package workspace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader unified diff 修改块的头部，如 @@ -10,6 +10,8 @@
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunk 补丁中的一个修改块
+type hunk struct {
+	oldStart int      // 原文件中的起始行号（从1开始），0表示未知（只有 @@ 时）
+	old      []string // 上下文和删除的行
+	new      []string // 上下文和增加的行
+	added    int      // 增加的行数
+	removed  int      // 删除的行数
+
+	counted bool // 头部是否声明了行数
+	oldLeft int  // 头部声明的原文件行数中还未读到的行数
+	newLeft int  // 头部声明的新文件行数中还未读到的行数
+}
+
+// complete 修改块是否已经读完头部声明的所有行，没有行号的修改块无法判断，总是返回false
+func (h *hunk) complete() bool {
+	return h.counted && h.oldLeft <= 0 && h.newLeft <= 0
+}
+
+// hunkCount 解析修改块头部的行数，省略时为1
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// parsePatch 解析一个文件的 unified diff，忽略 ---、+++ 等文件头，包含多个文件的补丁返回错误
+// 模型生成的补丁经常省略行号（只有 @@）或丢失空白上下文行的前导空格，这两种情况都可以接受
+// 文件头只出现在第一个修改块之前，或上一个修改块已经读完头部声明的行数时，
+// 否则 "--- x"、"+++ y" 是删除的 "-- x" 和增加的 "++ y"
+func parsePatch(patch string) ([]hunk, error) {
+	var hunks []hunk
+	var current *hunk
+	headers := 0
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			hunks = append(hunks, hunk{})
+			current = &hunks[len(hunks)-1]
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				current.oldStart, _ = strconv.Atoi(m[1])
+				current.counted = true
+				current.oldLeft, current.newLeft = hunkCount(m[2]), hunkCount(m[4])
+			}
+		case strings.HasPrefix(line, "---") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++") &&
+			(current == nil || current.complete()):
+			// 文件头，只能修改一个文件
+			headers++
+			if headers > 1 || current != nil {
+				return nil, fmt.Errorf("补丁第 %d 行: 补丁只能修改一个文件", i+1)
+			}
+		case current == nil:
+			// 第一个修改块之前的内容（diff、+++ 等）
+		case strings.HasPrefix(line, "+"):
+			current.new = append(current.new, line[1:])
+			current.added++
+			current.newLeft--
+		case strings.HasPrefix(line, "-"):
+			current.old = append(current.old, line[1:])
+			current.removed++
+			current.oldLeft--
+		case strings.HasPrefix(line, " "):
+			current.old = append(current.old, line[1:])
+			current.new = append(current.new, line[1:])
+			current.oldLeft--
+			current.newLeft--
+		case strings.HasPrefix(line, `\`):
+			// \ No newline at end of file
+		case line == "":
+			// 补丁末尾的空行不是上下文
+			if i < len(lines)-1 {
+				current.old = append(current.old, "")
+				current.new = append(current.new, "")
+				current.oldLeft--
+				current.newLeft--
+			}
+		default:
+			return nil, fmt.Errorf("补丁第 %d 行格式无效: %s", i+1, line)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("补丁中没有修改块（需要 unified diff 格式，以 @@ 开始）")
+	}
+	return hunks, nil
+}
+
+// applyPatch 将补丁应用到内容上，返回新内容和增加、删除的行数
+// 每个修改块在上一个修改块之后查找匹配的位置，优先选择最接近头部行号的位置
+func applyPatch(content, patch string) (string, int, int, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	added, removed := 0, 0
+	cursor, offset := 0, 0
+	for n, h := range hunks {
+		expected := cursor
+		if h.oldStart > 0 {
+			expected = h.oldStart - 1 + offset
+			if len(h.old) == 0 {
+				// 只增加行的修改块，-N,0 表示在第N行之后插入
+				expected = h.oldStart + offset
+			}
+		} else if len(h.old) == 0 {
+			expected = len(lines)
+		}
+		position := findHunk(lines, h.old, cursor, expected)
+		if position < 0 {
+			return "", 0, 0, fmt.Errorf("第 %d 个修改块与文件内容不匹配", n+1)
+		}
+
+		updated := make([]string, 0, len(lines)-len(h.old)+len(h.new))
+		updated = append(updated, lines[:position]...)
+		updated = append(updated, h.new...)
+		updated = append(updated, lines[position+len(h.old):]...)
+		lines = updated
+
+		cursor = position + len(h.new)
+		if h.oldStart > 0 {
+			offset = position - (h.oldStart - 1)
+			if len(h.old) == 0 {
+				offset = position - h.oldStart
+			}
+		}
+		added += h.added
+		removed += h.removed
+	}
+
+	result := strings.Join(lines, "\n")
+	if len(lines) > 0 && trailingNewline {
+		result += "\n"
+	}
+	return result, added, removed, nil
+}
+
+// findHunk 在 from 之后查找与 old 匹配的位置，返回最接近 expected 的位置，找不到时返回-1
+// 先精确匹配，再忽略行尾空白匹配
+func findHunk(lines, old []string, from, expected int) int {
+	if expected < from {
+		expected = from
+	}
+	if expected > len(lines) {
+		expected = len(lines)
+	}
+	if len(old) == 0 {
+		return expected
+	}
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	} {
+		best := -1
+		for i := from; i+len(old) <= len(lines); i++ {
+			if matchAt(lines, old, i, equal) && (best < 0 || distance(i, expected) < distance(best, expected)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func matchAt(lines, old []string, position int, equal func(a, b string) bool) bool {
+	for j, line := range old {
+		if !equal(lines[position+j], line) {
+			return false
+		}
+	}
+	return true
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
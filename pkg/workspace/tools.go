@@ -0,0 +1,202 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sshai/pkg/ai"
+)
+
+// ServerName 工作区工具所属的服务器名称，角色和路由规则的 mcp_servers 中使用该名称允许工作区工具
+const ServerName = "workspace"
+
+// tool 工作区的文件工具
+type tool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	call        func(arguments map[string]interface{}) (string, error)
+}
+
+func (t *tool) Name() string                       { return t.name }
+func (t *tool) Description() string                { return t.description }
+func (t *tool) Parameters() map[string]interface{} { return t.parameters }
+func (t *tool) ServerName() string                 { return ServerName }
+func (t *tool) Enabled() bool                      { return Enabled() }
+
+func (t *tool) Call(ctx context.Context, arguments map[string]interface{}) (string, error) {
+	return t.call(arguments)
+}
+
+// Tools 工作区的文件工具：列出、读取、写入、应用补丁和搜索
+func (w *Workspace) Tools() []ai.NativeTool {
+	return []ai.NativeTool{
+		&tool{
+			name:        "workspace_list",
+			description: "列出会话工作区中的文件（工作区是当前会话专用的临时目录，会话结束时删除）",
+			parameters: schema(map[string]interface{}{
+				"path": property("工作区内的目录，默认为根目录"),
+			}),
+			call: func(arguments map[string]interface{}) (string, error) {
+				entries, err := w.List(stringArg(arguments, "path"))
+				if err != nil {
+					return "", err
+				}
+				return formatEntries(w, entries), nil
+			},
+		},
+		&tool{
+			name:        "workspace_read",
+			description: "读取会话工作区中的文件，可以指定行范围",
+			parameters: schema(map[string]interface{}{
+				"path":       property("文件路径（相对工作区）"),
+				"start_line": map[string]interface{}{"type": "integer", "description": "起始行号（从1开始，可选）"},
+				"end_line":   map[string]interface{}{"type": "integer", "description": "结束行号（包含，可选）"},
+			}, "path"),
+			call: func(arguments map[string]interface{}) (string, error) {
+				content, err := w.Read(stringArg(arguments, "path"))
+				if err != nil {
+					return "", err
+				}
+				return selectLines(string(content), intArg(arguments, "start_line"), intArg(arguments, "end_line")), nil
+			},
+		},
+		&tool{
+			name:        "workspace_write",
+			description: "在会话工作区中创建或覆盖文件（自动创建目录），append 为 true 时追加到文件末尾",
+			parameters: schema(map[string]interface{}{
+				"path":    property("文件路径（相对工作区）"),
+				"content": property("文件内容"),
+				"append":  map[string]interface{}{"type": "boolean", "description": "是否追加（默认覆盖）"},
+			}, "path", "content"),
+			call: func(arguments map[string]interface{}) (string, error) {
+				appendMode, _ := arguments["append"].(bool)
+				size, err := w.Write(stringArg(arguments, "path"), []byte(stringArg(arguments, "content")), appendMode)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("已写入 %s（%d 字节）", stringArg(arguments, "path"), size), nil
+			},
+		},
+		&tool{
+			name:        "workspace_patch",
+			description: "对会话工作区中的文件应用 unified diff 格式的补丁（@@ 修改块，行首为空格、- 或 +），文件不存在时创建",
+			parameters: schema(map[string]interface{}{
+				"path":  property("文件路径（相对工作区）"),
+				"patch": property("unified diff 补丁"),
+			}, "path", "patch"),
+			call: func(arguments map[string]interface{}) (string, error) {
+				added, removed, err := w.Patch(stringArg(arguments, "path"), stringArg(arguments, "patch"))
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("已修改 %s：增加 %d 行，删除 %d 行", stringArg(arguments, "path"), added, removed), nil
+			},
+		},
+		&tool{
+			name:        "workspace_grep",
+			description: "在会话工作区的文件中搜索匹配正则表达式（RE2语法）的行",
+			parameters: schema(map[string]interface{}{
+				"pattern": property("正则表达式"),
+				"path":    property("搜索的目录或文件，默认为整个工作区"),
+			}, "pattern"),
+			call: func(arguments map[string]interface{}) (string, error) {
+				matches, truncated, err := w.Grep(stringArg(arguments, "pattern"), stringArg(arguments, "path"))
+				if err != nil {
+					return "", err
+				}
+				if len(matches) == 0 {
+					return "没有匹配的行", nil
+				}
+				var b strings.Builder
+				for _, match := range matches {
+					fmt.Fprintf(&b, "%s:%d: %s\n", match.Path, match.Line, match.Text)
+				}
+				if truncated {
+					fmt.Fprintf(&b, "...（只显示前 %d 条）\n", maxGrepMatches)
+				}
+				return strings.TrimSuffix(b.String(), "\n"), nil
+			},
+		},
+	}
+}
+
+// formatEntries 文件列表和用量说明
+func formatEntries(w *Workspace, entries []Entry) string {
+	var b strings.Builder
+	if len(entries) == 0 {
+		b.WriteString("（空）\n")
+	}
+	for _, entry := range entries {
+		if entry.IsDir {
+			fmt.Fprintf(&b, "%s/\n", entry.Path)
+		} else {
+			fmt.Fprintf(&b, "%s  %s\n", entry.Path, FormatSize(entry.Size))
+		}
+	}
+	files, total := w.Usage()
+	maxBytes, _, maxFiles := limits()
+	fmt.Fprintf(&b, "共 %d/%d 个文件和目录，%s/%s", files, maxFiles, FormatSize(total), FormatSize(maxBytes))
+	return b.String()
+}
+
+// FormatSize 格式化文件大小
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// selectLines 选取行范围，start和end为0表示不限制
+func selectLines(content string, start, end int) string {
+	if start <= 0 && end <= 0 {
+		return content
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return ""
+	}
+	return strings.Join(lines[start-1:end], "")
+}
+
+func schema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	result := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		result["required"] = required
+	}
+	return result
+}
+
+func property(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func stringArg(arguments map[string]interface{}, name string) string {
+	if value, ok := arguments[name].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func intArg(arguments map[string]interface{}, name string) int {
+	switch value := arguments[name].(type) {
+	case float64:
+		return int(value)
+	case string:
+		var n int
+		fmt.Sscanf(value, "%d", &n)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,416 @@
+// Package workspace 会话工作区：每个会话一个临时目录，模型通过文件工具在其中读写文件，会话结束时删除
+// 所有路径都限制在工作区目录内（禁止绝对路径、.. 和符号链接），并限制文件大小、总大小和文件数
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"sshai/pkg/config"
+)
+
+const (
+	defaultMaxBytes    = 10 << 20
+	defaultMaxFileSize = 1 << 20
+	defaultMaxFiles    = 200
+	maxListEntries     = 500
+	maxGrepMatches     = 100
+)
+
+// Entry 工作区中的文件或目录
+type Entry struct {
+	Path  string // 相对工作区的路径，使用 / 分隔
+	Size  int64
+	IsDir bool
+}
+
+// Workspace 会话工作区，目录在第一次使用时创建
+type Workspace struct {
+	mutex  sync.Mutex
+	name   string
+	root   string
+	closed bool
+}
+
+// New 创建会话工作区，name 用于目录名前缀（如会话ID）
+func New(name string) *Workspace {
+	return &Workspace{name: name}
+}
+
+// Enabled 是否启用了会话工作区
+func Enabled() bool {
+	return config.Get().Workspace.Enabled
+}
+
+// limits 获取大小限制：总大小、单个文件大小、文件数
+func limits() (int64, int64, int) {
+	cfg := config.Get().Workspace
+	maxBytes, maxFileSize, maxFiles := cfg.MaxBytes, cfg.MaxFileSize, cfg.MaxFiles
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFiles
+	}
+	return maxBytes, maxFileSize, maxFiles
+}
+
+// ensureRoot 获取工作区目录，不存在时创建（调用方持有锁）
+func (w *Workspace) ensureRoot() (string, error) {
+	if w.closed {
+		return "", fmt.Errorf("工作区已关闭")
+	}
+	if w.root != "" {
+		return w.root, nil
+	}
+	parent := config.Get().Workspace.Dir
+	if parent == "" {
+		parent = os.TempDir()
+	} else if err := os.MkdirAll(parent, 0700); err != nil {
+		return "", fmt.Errorf("创建工作区失败: %v", err)
+	}
+	root, err := os.MkdirTemp(parent, "sshai-ws-"+w.name+"-")
+	if err != nil {
+		return "", fmt.Errorf("创建工作区失败: %v", err)
+	}
+	// 使用解析符号链接后的路径（如 macOS 的 /var -> /private/var），便于检查路径是否在工作区内
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	w.root = root
+	return root, nil
+}
+
+// Root 工作区目录，尚未创建时返回空
+func (w *Workspace) Root() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.root
+}
+
+// Close 删除工作区目录，之后不能再使用
+func (w *Workspace) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+	if w.root == "" {
+		return nil
+	}
+	root := w.root
+	w.root = ""
+	return os.RemoveAll(root)
+}
+
+// resolve 将相对路径转换为工作区内的绝对路径，拒绝绝对路径、跳出工作区的路径和符号链接
+func (w *Workspace) resolve(name string) (string, string, error) {
+	root, err := w.ensureRoot()
+	if err != nil {
+		return "", "", err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || name == "/" {
+		return root, ".", nil
+	}
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || filepath.VolumeName(name) != "" {
+		return "", "", fmt.Errorf("只能使用工作区内的相对路径: %s", name)
+	}
+	rel := filepath.Clean(name)
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("路径超出了工作区: %s", name)
+	}
+
+	// 路径中的任何部分都不能是符号链接
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", "", fmt.Errorf("不允许访问符号链接: %s", name)
+		}
+	}
+	return filepath.Join(root, rel), filepath.ToSlash(rel), nil
+}
+
+// usage 统计工作区的文件数（包括目录，都计入 max_files）和总大小（调用方持有锁）
+func (w *Workspace) usage() (int, int64) {
+	files, total := 0, int64(0)
+	if w.root == "" {
+		return 0, 0
+	}
+	filepath.WalkDir(w.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == w.root {
+			return nil
+		}
+		files++
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return files, total
+}
+
+// Usage 工作区的文件数（包括目录）和总大小
+func (w *Workspace) Usage() (int, int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.usage()
+}
+
+// List 列出目录下的所有文件和子目录（递归）
+func (w *Workspace) List(dir string) ([]Entry, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	path, _, err := w.resolve(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("目录不存在: %s", dir)
+	}
+	if !info.IsDir() {
+		return []Entry{{Path: w.relative(path), Size: info.Size()}}, nil
+	}
+
+	var entries []Entry
+	err = filepath.WalkDir(path, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil || current == path {
+			return nil
+		}
+		if len(entries) >= maxListEntries {
+			return filepath.SkipAll
+		}
+		item := Entry{Path: w.relative(current), IsDir: entry.IsDir()}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			item.Size = info.Size()
+		}
+		entries = append(entries, item)
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, err
+}
+
+// relative 工作区内的绝对路径转换为相对路径
+func (w *Workspace) relative(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Read 读取文件内容
+func (w *Workspace) Read(name string) ([]byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	path, _, err := w.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("文件不存在: %s", name)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s 是目录", name)
+	}
+	return os.ReadFile(path)
+}
+
+// Write 写入文件（appendMode为true时追加），自动创建上级目录，超过大小或文件数限制时返回错误
+func (w *Workspace) Write(name string, content []byte, appendMode bool) (int64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.write(name, content, appendMode)
+}
+
+// write 写入文件（调用方持有锁）
+func (w *Workspace) write(name string, content []byte, appendMode bool) (int64, error) {
+	path, rel, err := w.resolve(name)
+	if err != nil {
+		return 0, err
+	}
+	if rel == "." {
+		return 0, fmt.Errorf("需要指定文件名")
+	}
+
+	var oldSize int64
+	created := 0 // 新建的文件和上级目录数
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return 0, fmt.Errorf("%s 是目录", name)
+		}
+		oldSize = info.Size()
+	} else {
+		created = 1 + w.missingDirs(path)
+	}
+	newSize := int64(len(content))
+	if appendMode {
+		newSize += oldSize
+	}
+	if err := w.checkQuota(newSize-oldSize, newSize, created); err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return 0, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		return 0, err
+	}
+	return newSize, nil
+}
+
+// missingDirs 写入 path 需要新建的上级目录数（调用方持有锁）
+func (w *Workspace) missingDirs(path string) int {
+	count := 0
+	for dir := filepath.Dir(path); len(dir) > len(w.root); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+// checkQuota 检查写入后是否超过限制，created 为新建的文件和目录数（调用方持有锁）
+func (w *Workspace) checkQuota(growth, fileSize int64, created int) error {
+	maxBytes, maxFileSize, maxFiles := limits()
+	if fileSize > maxFileSize {
+		return fmt.Errorf("文件大小 %d 字节超过了限制 %d 字节", fileSize, maxFileSize)
+	}
+	files, total := w.usage()
+	if created > 0 && files+created > maxFiles {
+		return fmt.Errorf("工作区文件和目录数将超过限制 %d（已有 %d 个）", maxFiles, files)
+	}
+	if total+growth > maxBytes {
+		return fmt.Errorf("工作区总大小将超过限制 %d 字节（已使用 %d 字节）", maxBytes, total)
+	}
+	return nil
+}
+
+// Patch 对文件应用 unified diff 格式的补丁，文件不存在时按空文件处理（可用于创建文件）
+// 读取和写入之间持有锁，避免同时进行的写入被覆盖；返回增加和删除的行数
+func (w *Workspace) Patch(name, patch string) (int, int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	path, _, err := w.resolve(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	original, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+
+	result, added, removed, err := applyPatch(string(original), patch)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := w.write(name, []byte(result), false); err != nil {
+		return 0, 0, err
+	}
+	return added, removed, nil
+}
+
+// Remove 删除文件或目录
+func (w *Workspace) Remove(name string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	path, rel, err := w.resolve(name)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return fmt.Errorf("不能删除工作区根目录")
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return fmt.Errorf("文件不存在: %s", name)
+	}
+	return os.RemoveAll(path)
+}
+
+// Match grep 的匹配结果
+type Match struct {
+	Path string
+	Line int
+	Text string
+}
+
+// Grep 在目录（或文件）中搜索匹配正则表达式的行，跳过二进制文件，最多返回100条
+func (w *Workspace) Grep(pattern, dir string) ([]Match, bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, false, fmt.Errorf("正则表达式无效: %v", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	path, _, err := w.resolve(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, false, fmt.Errorf("路径不存在: %s", dir)
+	}
+
+	var matches []Match
+	truncated := false
+	err = filepath.WalkDir(path, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(current)
+		if err != nil || !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+			return nil
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+		for line := 1; scanner.Scan(); line++ {
+			if !re.MatchString(scanner.Text()) {
+				continue
+			}
+			if len(matches) >= maxGrepMatches {
+				truncated = true
+				return filepath.SkipAll
+			}
+			matches = append(matches, Match{Path: w.relative(current), Line: line, Text: scanner.Text()})
+		}
+		return nil
+	})
+	return matches, truncated, err
+}
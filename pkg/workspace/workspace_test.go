@@ -0,0 +1,181 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sshai/pkg/config"
+)
+
+// setup 在临时目录中启用工作区
+func setup(t *testing.T) *Workspace {
+	cfg := config.Get()
+	saved := cfg.Workspace
+	t.Cleanup(func() { cfg.Workspace = saved })
+	cfg.Workspace.Enabled = true
+	cfg.Workspace.Dir = t.TempDir()
+	cfg.Workspace.MaxBytes = 100
+	cfg.Workspace.MaxFileSize = 60
+	cfg.Workspace.MaxFiles = 3
+
+	ws := New("1")
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func TestPathConfinement(t *testing.T) {
+	ws := setup(t)
+	if _, err := ws.Write("docs/a.txt", []byte("hello"), false); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ws.Read("./docs/../docs/a.txt"); err != nil || string(content) != "hello" {
+		t.Errorf("unexpected content: %q %v", content, err)
+	}
+
+	for _, name := range []string{"/etc/passwd", "../outside.txt", "docs/../../outside.txt", "..", `\etc\passwd`} {
+		if _, err := ws.Write(name, []byte("x"), false); err == nil {
+			t.Errorf("%s should be rejected", name)
+		}
+		if _, err := ws.Read(name); err == nil {
+			t.Errorf("%s should not be readable", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(ws.Root()), "outside.txt")); err == nil {
+		t.Error("file written outside the workspace")
+	}
+
+	// 工作区中出现的符号链接不能被跟随
+	secret := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(secret, []byte("secret"), 0600)
+	os.Symlink(secret, filepath.Join(ws.Root(), "link"))
+	os.Symlink(filepath.Dir(secret), filepath.Join(ws.Root(), "dir"))
+	for _, name := range []string{"link", "dir/secret"} {
+		if _, err := ws.Read(name); err == nil {
+			t.Errorf("%s should not follow the symlink", name)
+		}
+	}
+	if _, err := ws.Write("dir/new", []byte("x"), false); err == nil {
+		t.Error("writing through a symlinked directory should fail")
+	}
+}
+
+func TestQuota(t *testing.T) {
+	ws := setup(t)
+	if _, err := ws.Write("big", []byte(strings.Repeat("x", 61)), false); err == nil {
+		t.Error("file larger than max_file_size should be rejected")
+	}
+	if _, err := ws.Write("a", []byte(strings.Repeat("x", 50)), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Write("b", []byte(strings.Repeat("x", 50)), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Write("c", []byte("x"), false); err == nil {
+		t.Error("total size over max_bytes should be rejected")
+	}
+	// 覆盖已有文件只计算增加的大小
+	if _, err := ws.Write("a", []byte(strings.Repeat("y", 40)), false); err != nil {
+		t.Errorf("overwriting with smaller content should succeed: %v", err)
+	}
+	if _, err := ws.Write("a", []byte(strings.Repeat("y", 20)), true); err == nil {
+		t.Error("appending over max_file_size should be rejected")
+	}
+	ws.Write("c", []byte("x"), false)
+	if _, err := ws.Write("d", []byte("x"), false); err == nil {
+		t.Error("file count over max_files should be rejected")
+	}
+
+	// 目录也计入 max_files，不能通过嵌套目录绕过限制
+	ws = setup(t)
+	if _, err := ws.Write("a/b/c/d.txt", []byte("x"), false); err == nil {
+		t.Error("new directories should count toward max_files")
+	}
+	if _, err := ws.Write("a/b.txt", []byte("x"), false); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ws.Usage(); files != 2 {
+		t.Errorf("usage should count the directory and the file, got %d", files)
+	}
+	if _, err := ws.Write("a/c/d.txt", []byte("x"), false); err == nil {
+		t.Error("file and directory count over max_files should be rejected")
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	original := "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"
+	patch := `--- a/main.go
++++ b/main.go
+@@ -3,3 +3,4 @@
+ func main() {
+-	println("hi")
++	println("hello")
++	println("world")
+ }
+`
+	result, added, removed, err := applyPatch(original, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package main\n\nfunc main() {\n\tprintln(\"hello\")\n\tprintln(\"world\")\n}\n"
+	if result != want || added != 2 || removed != 1 {
+		t.Errorf("unexpected result (+%d -%d):\n%s", added, removed, result)
+	}
+
+	// 没有行号的修改块按内容定位
+	if result, _, _, err := applyPatch(original, "@@\n-package main\n+package app\n"); err != nil || !strings.HasPrefix(result, "package app\n") {
+		t.Errorf("bare hunk should apply: %q %v", result, err)
+	}
+	// 创建新文件
+	if result, _, _, err := applyPatch("", "@@ -0,0 +1,2 @@\n+a\n+b\n"); err != nil || result != "a\nb\n" {
+		t.Errorf("new file: %q %v", result, err)
+	}
+	if _, _, _, err := applyPatch(original, "@@ -1 +1 @@\n-missing line\n+x\n"); err == nil {
+		t.Error("mismatched hunk should fail")
+	}
+	if _, _, _, err := applyPatch(original, "not a patch"); err == nil {
+		t.Error("patch without hunks should fail")
+	}
+
+	// 包含多个文件的补丁
+	for _, multi := range []string{
+		"--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package main\n+package app\n--- a/other.go\n+++ b/other.go\n@@ -1 +1 @@\n-a\n+b\n",
+		"--- a/main.go\n+++ b/main.go\n--- a/other.go\n+++ b/other.go\n@@ -1 +1 @@\n-package main\n+package app\n",
+	} {
+		if _, _, _, err := applyPatch(original, multi); err == nil || !strings.Contains(err.Error(), "一个文件") {
+			t.Errorf("multi-file patch should be rejected: %v", err)
+		}
+	}
+
+	// 修改块中的 "--- x"、"+++ y" 是删除的 "-- x" 和增加的 "++ y"，不是文件头
+	sql := "SELECT 1;\n-- old comment\nSELECT 2;\n"
+	result, added, removed, err = applyPatch(sql, "--- a/q.sql\n+++ b/q.sql\n@@ -1,3 +1,3 @@\n SELECT 1;\n--- old comment\n+++ new comment\n SELECT 2;\n")
+	if err != nil || result != "SELECT 1;\n++ new comment\nSELECT 2;\n" || added != 1 || removed != 1 {
+		t.Errorf("removed and added lines looking like file headers: %q (+%d -%d) %v", result, added, removed, err)
+	}
+}
+
+func TestGrepListAndClose(t *testing.T) {
+	ws := setup(t)
+	ws.Write("src/a.go", []byte("func A() {}\n// TODO: fix\n"), false)
+	ws.Write("b.txt", []byte("todo later\n"), false)
+
+	matches, _, err := ws.Grep(`(?i)todo`, "")
+	if err != nil || len(matches) != 2 || matches[0].Path != "b.txt" || matches[1].Line != 2 {
+		t.Errorf("unexpected matches: %+v %v", matches, err)
+	}
+	entries, err := ws.List("")
+	if err != nil || len(entries) != 3 || entries[1].Path != "src" || !entries[1].IsDir {
+		t.Errorf("unexpected entries: %+v %v", entries, err)
+	}
+
+	root := ws.Root()
+	ws.Close()
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Error("workspace should be removed when closed")
+	}
+	if _, err := ws.Write("x", []byte("x"), false); err == nil {
+		t.Error("closed workspace should not be usable")
+	}
+}